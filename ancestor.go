@@ -0,0 +1,51 @@
+package astquery
+
+import "go/ast"
+
+// AncestorFilter matches nodes that match Node and have an ancestor matching Ancestor,
+// such as selector expressions in exported functions:
+//
+//	astquery.AncestorFilter{
+//		Node:     astquery.FilterFunc(func(node ast.Node) bool { _, ok := node.(*ast.SelectorExpr); return ok }),
+//		Ancestor: astquery.MustCompileSelector("FuncDecl.exported"),
+//	}
+//
+// The ancestors are those of the node in the tree passed to Find, and the ancestor is
+// itself filtered with its own ancestors. Captures of Node and Ancestor are passed
+// along, as CaptureFilter describes.
+type AncestorFilter struct {
+	// Node is the filter nodes must match. If nil, any node matches.
+	Node Filter
+
+	// Ancestor is the filter one of the node's ancestors must match.
+	Ancestor Filter
+}
+
+// WithinAncestor returns a filter matching the nodes with an ancestor matching ancestor.
+func WithinAncestor(ancestor Filter) AncestorFilter {
+	return AncestorFilter{Ancestor: ancestor}
+}
+
+func (f AncestorFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f AncestorFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	return f.FilterCaptures(node, ancestors, make(map[string]ast.Node))
+}
+
+func (f AncestorFilter) FilterCaptures(node ast.Node, ancestors []ast.Node, captures map[string]ast.Node) bool {
+	inner := make(map[string]ast.Node)
+	if f.Node != nil && !FilterCaptures(f.Node, node, ancestors, inner) {
+		return false
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if FilterCaptures(f.Ancestor, ancestors[i], ancestors[:i], inner) {
+			for name, captured := range inner {
+				captures[name] = captured
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+func TestAncestorFilter(t *testing.T) {
+	file := parseTestFile(t, querySrc)
+	isSelector := FilterFunc(func(node ast.Node) bool {
+		_, isSel := node.(*ast.SelectorExpr)
+		return isSel
+	})
+	testcases := []struct {
+		name   string
+		filter Filter
+		exp    []string
+	}{
+		{"exported func", AncestorFilter{Node: isSelector, Ancestor: MustCompileSelector("FuncDecl.exported")}, []string{"log.Fatal", "log.Fatal"}},
+		{"method", AncestorFilter{Node: isSelector, Ancestor: MethodFilter{ReceiverType: "Server"}}, []string{"log.Fatal"}},
+		{"if", AncestorFilter{Node: isSelector, Ancestor: MustCompileQuery("//FuncDecl/BlockStmt/IfStmt")}, []string{"log.Fatal"}},
+		{"any node", WithinAncestor(MustCompileQuery(`//ReturnStmt`)), []string{"nil"}},
+	}
+	for _, test := range testcases {
+		var got []string
+		for _, node := range Find([]ast.Node{file}, test.filter) {
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.name, test.exp, got)
+		}
+	}
+
+	captured := FindMatches([]ast.Node{file}, AncestorFilter{
+		Node:     MustCompilePattern(`log.Println($msg)`),
+		Ancestor: Capture("func", FilterFunc(func(node ast.Node) bool { _, ok := node.(*ast.FuncDecl); return ok })),
+	})
+	if got, exp := patternMatches(t, captured), []string{`log.Println("loading")`, `func=func load() error { log.Println("loading") return nil }`, `msg="loading"`}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected captures %v, but got %v", exp, got)
+	}
+}
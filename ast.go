@@ -5,12 +5,21 @@ import (
 	"go/ast"
 	"reflect"
 	"regexp"
+	"sort"
 )
 
 type Filter interface {
 	Filter(node ast.Node) bool
 }
 
+// PathFilter is a Filter that also considers where a node sits in the AST. Find calls
+// FilterPath instead of Filter for filters that implement it, passing the node's
+// ancestors (outermost first, starting at the root passed to Find).
+type PathFilter interface {
+	Filter
+	FilterPath(node ast.Node, ancestors []ast.Node) bool
+}
+
 // SetFilter matches nodes whose names are in the specified set of names.
 type SetFilter struct {
 	// Names is a set of names that match the filter
@@ -55,13 +64,27 @@ func (s RegexpFilter) Filter(node ast.Node) bool {
 
 // MethodFilter matches method declaration nodes that have the specified receiver type.
 type MethodFilter struct {
-	// ReceiverType is the name of the receiver's type (without the '*' if a pointer).
+	// ReceiverType is the name of the receiver's type (without the '*' if a pointer, or
+	// the type parameters if generic).
 	ReceiverType string
 
 	// ExportedOnly is if the filter should select only exported methods.
 	ExportedOnly bool
+
+	// ReceiverKind selects methods by whether their receiver is a pointer. The zero value
+	// selects methods with either kind of receiver.
+	ReceiverKind ReceiverKind
 }
 
+// ReceiverKind is the kind of a method's receiver.
+type ReceiverKind int
+
+const (
+	AnyReceiver     ReceiverKind = iota // pointer or value receiver
+	PointerReceiver                     // receiver of type *T
+	ValueReceiver                       // receiver of type T
+)
+
 func (f MethodFilter) Filter(node ast.Node) bool {
 	switch node := node.(type) {
 	case *ast.FuncDecl:
@@ -76,6 +99,10 @@ func (f MethodFilter) Filter(node ast.Node) bool {
 		if f.ExportedOnly && !node.Name.IsExported() {
 			return false // not exported
 		}
+		_, isPointer := recv.List[0].Type.(*ast.StarExpr)
+		if (f.ReceiverKind == PointerReceiver && !isPointer) || (f.ReceiverKind == ValueReceiver && isPointer) {
+			return false // receiver kind doesn't match
+		}
 		return true
 	default:
 		return false
@@ -89,7 +116,9 @@ func (f FilterFunc) Filter(node ast.Node) bool { return f(node) }
 
 // Find recursively searches the AST nodes passed as the first argument and returns all
 // AST nodes that match the filter. It does not descend into matching nodes for additional
-// matching nodes.
+// matching nodes. Comment groups of a file that are not attached to any node are searched
+// after the rest of the file. Subtrees that can't contain matches, as the filter tells
+// through KindFilter, are skipped.
 func Find(nodes []ast.Node, filter Filter) []ast.Node {
 	var found []ast.Node
 	for _, node := range nodes {
@@ -98,18 +127,134 @@ func Find(nodes []ast.Node, filter Filter) []ast.Node {
 	return found
 }
 
+// FindFiles is like Find for a list of files.
+func FindFiles(files []*ast.File, filter Filter) []ast.Node {
+	var found []ast.Node
+	for _, file := range files {
+		found = append(found, find(file, filter)...)
+	}
+	return found
+}
+
+// FindPackage is like Find for the files of pkg, which are searched in the order of their
+// names rather than in the random order of the map holding them.
+func FindPackage(pkg *ast.Package, filter Filter) []ast.Node {
+	names := make([]string, 0, len(pkg.Files))
+	for name := range pkg.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make([]*ast.File, len(names))
+	for i, name := range names {
+		files[i] = pkg.Files[name]
+	}
+	return FindFiles(files, filter)
+}
+
 func find(node ast.Node, filter Filter) []ast.Node {
 	var found []ast.Node
-	ast.Walk(visitFunc(func(node ast.Node) bool {
-		if filter.Filter(node) {
+	var ancestors []ast.Node
+	seenComments := make(map[*ast.CommentGroup]bool)
+	prune := planSearch(filter)
+
+	// skipped are the nodes that matched or were pruned, whose descendants, free-floating
+	// comments included, are not searched. Their ranges are disjoint.
+	var skipped []ast.Node
+	skip := func(node ast.Node) {
+		skipped = append(skipped, node)
+		// The doc and line comments of a node are outside its range.
+		for _, name := range []string{"Doc", "Comment"} {
+			value, _ := getStructField(node, name)
+			if group, _ := value.(*ast.CommentGroup); group != nil {
+				seenComments[group] = true
+			}
+		}
+	}
+	isSkipped := func(sorted []ast.Node, group *ast.CommentGroup) bool {
+		i := sort.Search(len(sorted), func(i int) bool { return sorted[i].End() >= group.End() })
+		return i < len(sorted) && sorted[i].Pos() <= group.Pos()
+	}
+
+	var visit visitFunc
+	visit = func(node ast.Node) bool {
+		if node == nil {
+			// ast.Walk doesn't visit free-floating comments, such as those in function
+			// bodies, so visit them once the rest of the file is done, with the ancestors
+			// enclosing them.
+			if file, isFile := ancestors[len(ancestors)-1].(*ast.File); isFile {
+				outer := ancestors
+				sorted := append([]ast.Node(nil), skipped...)
+				sort.Slice(sorted, func(i, j int) bool { return sorted[i].Pos() < sorted[j].Pos() })
+				for _, group := range file.Comments {
+					if !seenComments[group] && !isSkipped(sorted, group) {
+						ancestors = enclosingNodes(outer, file, group)
+						ast.Walk(visit, group)
+					}
+				}
+				ancestors = outer
+			}
+			ancestors = ancestors[:len(ancestors)-1]
+			return false
+		}
+		if group, isGroup := node.(*ast.CommentGroup); isGroup {
+			seenComments[group] = true
+		}
+		if filterNode(filter, node, ancestors) {
 			found = append(found, node)
+			skip(node)
+			return false
+		}
+		if prune != nil && prune(node, ancestors) {
+			skip(node)
 			return false
 		}
+		ancestors = append(ancestors, node)
 		return true
-	}), node)
+	}
+	ast.Walk(visit, node)
 	return found
 }
 
+// enclosingNodes returns the ancestors of a free-floating comment group in file: the
+// given ancestors, ending with file, followed by the innermost nodes of file whose source
+// ranges contain the group.
+func enclosingNodes(ancestors []ast.Node, file *ast.File, group *ast.CommentGroup) []ast.Node {
+	enclosing := append([]ast.Node(nil), ancestors...)
+	for node := ast.Node(file); node != nil; {
+		var next ast.Node
+		ast.Inspect(node, func(child ast.Node) bool {
+			if child == node {
+				return true
+			}
+			if child != nil && next == nil && child.Pos() <= group.Pos() && group.End() <= child.End() {
+				next = child
+			}
+			return false
+		})
+		if next != nil {
+			enclosing = append(enclosing, next)
+		}
+		node = next
+	}
+	return enclosing
+}
+
+// filterNode applies filter to node, passing along the ancestors if filter is a PathFilter.
+func filterNode(filter Filter, node ast.Node, ancestors []ast.Node) bool {
+	if pf, ok := filter.(PathFilter); ok {
+		return pf.FilterPath(node, ancestors)
+	}
+	return filter.Filter(node)
+}
+
+// parent returns the innermost of the given ancestors, or nil if there are none.
+func parent(ancestors []ast.Node) ast.Node {
+	if len(ancestors) == 0 {
+		return nil
+	}
+	return ancestors[len(ancestors)-1]
+}
+
 // visitFunc is a wrapper for traversing nodes in the AST
 type visitFunc func(node ast.Node) (descend bool)
 
@@ -136,12 +281,26 @@ func GetName(n ast.Node) (name string, exists bool) {
 	}
 
 	nodeName, isIdent := ident_.(*ast.Ident)
-	if !isIdent {
+	if !isIdent || nodeName == nil {
 		return "", false
 	}
 	return nodeName.Name, true
 }
 
+// ReceiverName gets the name of a method declaration's receiver variable. It returns false
+// if node is not a method or if the receiver is unnamed or blank.
+func ReceiverName(node ast.Node) (name string, exists bool) {
+	decl, isDecl := node.(*ast.FuncDecl)
+	if !isDecl || decl.Recv == nil || len(decl.Recv.List) != 1 {
+		return "", false
+	}
+	names := decl.Recv.List[0].Names
+	if len(names) != 1 || names[0].Name == "_" {
+		return "", false
+	}
+	return names[0].Name, true
+}
+
 // getStructField returns the value of v's field with the given name
 // if it exists. v must be a struct or a pointer to a struct.
 func getStructField(v interface{}, field string) (fieldVal interface{}, exists bool) {
@@ -164,6 +323,10 @@ func typeName(typeExpr ast.Expr) (string, error) {
 	switch typeExpr := typeExpr.(type) {
 	case *ast.StarExpr:
 		return typeName(typeExpr.X)
+	case *ast.IndexExpr:
+		return typeName(typeExpr.X) // generic type with one type parameter
+	case *ast.IndexListExpr:
+		return typeName(typeExpr.X) // generic type with several type parameters
 	case *ast.Ident:
 		return typeExpr.Name, nil
 	default:
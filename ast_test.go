@@ -1,12 +1,14 @@
 package astquery
 
 import (
+	"bytes"
 	"go/ast"
-	"go/build"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -111,6 +113,95 @@ func TestNestedFilters(t *testing.T) {
 	}
 }
 
+func TestFindPackage(t *testing.T) {
+	servicePkg := getTestPkg(t)
+
+	// The files are searched in the order of their names, service1.go before service2.go.
+	found := FindPackage(servicePkg, FilterFunc(func(node ast.Node) bool {
+		spec, isType := node.(*ast.TypeSpec)
+		return isType && strings.HasPrefix(spec.Name.Name, "Service")
+	}))
+	checkNodesExpected(t, []nodeInfo{
+		{Name: "ServiceOne", Type: reflect.TypeOf((*ast.TypeSpec)(nil))},
+		{Name: "ServiceTwo", Type: reflect.TypeOf((*ast.TypeSpec)(nil))},
+	}, found)
+
+	files := []*ast.File{parseTestFile(t, "package p\n\nfunc A() {}\n"), parseTestFile(t, "package p\n\nfunc B() {}\n")}
+	found = FindFiles(files, FilterFunc(func(node ast.Node) bool {
+		_, isFunc := node.(*ast.FuncDecl)
+		return isFunc
+	}))
+	if got := funcNames(found); !reflect.DeepEqual(got, []string{"A", "B"}) {
+		t.Errorf("expected funcs [A B], but got %v", got)
+	}
+}
+
+func TestMethodFilterReceiverKind(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+type Counter struct{ n int }
+
+func (c *Counter) Inc()      { c.n++ }
+func (c Counter) Value() int { return c.n }
+func (Counter) String() string { return "" }
+`)
+
+	testcases := []struct {
+		kind     ReceiverKind
+		expNames []string
+		expRecvs []string
+	}{
+		{AnyReceiver, []string{"Inc", "Value", "String"}, []string{"c", "c", ""}},
+		{PointerReceiver, []string{"Inc"}, []string{"c"}},
+		{ValueReceiver, []string{"Value", "String"}, []string{"c", ""}},
+	}
+	for _, test := range testcases {
+		methods := Find([]ast.Node{file}, MethodFilter{ReceiverType: "Counter", ReceiverKind: test.kind})
+		var names, recvs []string
+		for _, method := range methods {
+			name, _ := GetName(method)
+			recv, _ := ReceiverName(method)
+			names, recvs = append(names, name), append(recvs, recv)
+		}
+		if !reflect.DeepEqual(names, test.expNames) || !reflect.DeepEqual(recvs, test.expRecvs) {
+			t.Errorf("receiver kind %d: expected methods %v with receivers %v, but got %v with %v", test.kind, test.expNames, test.expRecvs, names, recvs)
+		}
+	}
+}
+
+func TestMethodFilterGenericReceiver(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+type Service[T any] struct{}
+
+func (s *Service[T]) Get() T { var zero T; return zero }
+func (s Service[T]) Len() int { return 0 }
+
+type Pair[K comparable, V any] struct{}
+
+func (p *Pair[K, V]) Key() K { var zero K; return zero }
+`)
+
+	testcases := []struct {
+		filter   MethodFilter
+		expNames []string
+	}{
+		{MethodFilter{ReceiverType: "Service"}, []string{"Get", "Len"}},
+		{MethodFilter{ReceiverType: "Service", ReceiverKind: PointerReceiver}, []string{"Get"}},
+		{MethodFilter{ReceiverType: "Pair"}, []string{"Key"}},
+	}
+	for _, test := range testcases {
+		var names []string
+		for _, method := range Find([]ast.Node{file}, test.filter) {
+			name, _ := GetName(method)
+			names = append(names, name)
+		}
+		if !reflect.DeepEqual(names, test.expNames) {
+			t.Errorf("%+v: expected methods %v, but got %v", test.filter, test.expNames, names)
+		}
+	}
+}
+
 //
 // Helpers
 //
@@ -139,18 +230,34 @@ func checkNodesExpected(t *testing.T, exp []nodeInfo, actual []ast.Node) {
 	}
 }
 
-func getTestPkg(t *testing.T) *ast.Package {
-	pkg, err := build.Import("github.com/beyang/go-astquery/testpkg", "", build.FindOnly)
+func parseTestFile(t *testing.T, src string) *ast.File {
+	file, err := parser.ParseFile(token.NewFileSet(), "test.go", src, parser.ParseComments)
 	if err != nil {
 		t.Fatal(err)
 	}
-	pkgs, err := parser.ParseDir(token.NewFileSet(), pkg.Dir, nil, parser.AllErrors)
+	return file
+}
+
+// nodeSource formats node as Go source on a single line.
+func nodeSource(t *testing.T, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), node); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func getTestPkg(t *testing.T) *ast.Package {
+	pkgs, err := Load(&LoadOptions{Tags: []string{"testdata"}}, "./testpkg")
 	if err != nil {
 		t.Fatal(err)
 	}
-	servicePkg, in := pkgs["service"]
-	if !in {
-		t.Fatal("service package not found")
+	if len(pkgs) != 1 || pkgs[0].Name != "service" {
+		t.Fatalf("expected the service package, but got %v", pkgs)
+	}
+	servicePkg := &ast.Package{Name: pkgs[0].Name, Files: make(map[string]*ast.File)}
+	for _, file := range pkgs[0].Files {
+		servicePkg.Files[pkgs[0].Fset.Position(file.Package).Filename] = file
 	}
 	return servicePkg
 }
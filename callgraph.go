@@ -0,0 +1,201 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// CallGraph is a graph of the static calls between the function and method declarations
+// of a set of packages. Calls made inside function literals belong to the enclosing
+// declaration. Calls through interfaces or function values, and calls to functions
+// declared outside the packages, are not part of the graph.
+type CallGraph struct {
+	// Funcs are the declarations in the graph, in the order of their packages and then of
+	// their positions.
+	Funcs []*ast.FuncDecl
+
+	pkgs    map[*ast.FuncDecl]*TypedPackage
+	index   map[*ast.FuncDecl]int
+	decls   map[string]*ast.FuncDecl     // by package path and objectKey
+	byName  map[funcName][]*ast.FuncDecl // for calls that could not be type-checked
+	callees map[*ast.FuncDecl][]*ast.FuncDecl
+	callers map[*ast.FuncDecl][]CallSite
+}
+
+// funcName identifies the function or methods with a name in a package.
+type funcName struct {
+	path   string
+	name   string
+	method bool
+}
+
+// NewCallGraph builds the call graph of the function declarations in pkgs. Calls are
+// resolved through type information. Calls whose callee could not be type-checked are
+// resolved by name instead: to the function with that name in the same (or the selected)
+// package, or to every method with that name in the calling package.
+func NewCallGraph(pkgs ...*TypedPackage) *CallGraph {
+	g := &CallGraph{
+		pkgs:    make(map[*ast.FuncDecl]*TypedPackage),
+		index:   make(map[*ast.FuncDecl]int),
+		decls:   make(map[string]*ast.FuncDecl),
+		byName:  make(map[funcName][]*ast.FuncDecl),
+		callees: make(map[*ast.FuncDecl][]*ast.FuncDecl),
+		callers: make(map[*ast.FuncDecl][]CallSite),
+	}
+	for _, p := range pkgs {
+		for _, file := range p.Files {
+			for _, decl := range file.Decls {
+				funcDecl, isFunc := decl.(*ast.FuncDecl)
+				if !isFunc {
+					continue
+				}
+				g.index[funcDecl] = len(g.Funcs)
+				g.Funcs = append(g.Funcs, funcDecl)
+				g.pkgs[funcDecl] = p
+				if obj := p.Info.Defs[funcDecl.Name]; obj != nil {
+					if key, ok := objectKey(obj); ok {
+						g.decls[p.Pkg.Path()+"."+key] = funcDecl
+					}
+				}
+				name := funcName{p.Pkg.Path(), funcDecl.Name.Name, funcDecl.Recv != nil}
+				g.byName[name] = append(g.byName[name], funcDecl)
+			}
+		}
+	}
+	for _, p := range pkgs {
+		for _, file := range p.Files {
+			for _, decl := range file.Decls {
+				caller, _ := decl.(*ast.FuncDecl)
+				seen := make(map[*ast.FuncDecl]bool)
+				ast.Inspect(decl, func(node ast.Node) bool {
+					call, isCall := node.(*ast.CallExpr)
+					if !isCall {
+						return true
+					}
+					for _, callee := range g.resolve(p, call) {
+						g.callers[callee] = append(g.callers[callee], CallSite{Call: call, Caller: caller, Pkg: p})
+						if caller != nil && !seen[callee] {
+							seen[callee] = true
+							g.callees[caller] = append(g.callees[caller], callee)
+						}
+					}
+					return true
+				})
+				if caller != nil {
+					g.sort(g.callees[caller])
+				}
+			}
+		}
+	}
+	return g
+}
+
+// CallSite is a call to a declaration in a call graph.
+type CallSite struct {
+	// Call is the call expression.
+	Call *ast.CallExpr
+
+	// Caller is the declaration containing the call, or nil if the call is part of a
+	// package-level variable's initializer.
+	Caller *ast.FuncDecl
+
+	// Pkg is the package containing the call.
+	Pkg *TypedPackage
+}
+
+// Position returns the position of the call.
+func (c CallSite) Position() token.Position {
+	return c.Pkg.Fset.Position(c.Call.Pos())
+}
+
+// resolve returns the declarations in the graph that call, made in package p, may call.
+func (g *CallGraph) resolve(p *TypedPackage, call *ast.CallExpr) []*ast.FuncDecl {
+	ident, sel := calleeIdent(call)
+	if ident == nil {
+		return nil
+	}
+	if obj := p.Info.Uses[ident]; obj != nil {
+		fn, isFunc := obj.(*types.Func)
+		if !isFunc || fn.Pkg() == nil {
+			return nil // function value, builtin, conversion, etc.
+		}
+		key, ok := objectKey(originOf(fn))
+		if decl := g.decls[fn.Pkg().Path()+"."+key]; ok && decl != nil {
+			return []*ast.FuncDecl{decl}
+		}
+		return nil
+	}
+	if sel == nil {
+		return g.byName[funcName{p.Pkg.Path(), ident.Name, false}]
+	}
+	if x, isIdent := sel.X.(*ast.Ident); isIdent {
+		if pkgName, isPkg := p.Info.Uses[x].(*types.PkgName); isPkg {
+			return g.byName[funcName{pkgName.Imported().Path(), ident.Name, false}]
+		}
+	}
+	return g.byName[funcName{p.Pkg.Path(), ident.Name, true}]
+}
+
+// sort sorts decls into the order of g.Funcs.
+func (g *CallGraph) sort(decls []*ast.FuncDecl) {
+	sort.Slice(decls, func(i, j int) bool { return g.index[decls[i]] < g.index[decls[j]] })
+}
+
+// Package returns the package declaring decl, or nil if decl is not in the graph.
+func (g *CallGraph) Package(decl *ast.FuncDecl) *TypedPackage {
+	return g.pkgs[decl]
+}
+
+// Find returns the declarations in the graph that match filter. The filter is given the
+// declaration's file as its only ancestor; typed filters can be applied with Bind.
+func (g *CallGraph) Find(filter Filter) []*ast.FuncDecl {
+	var found []*ast.FuncDecl
+	for _, decl := range g.Funcs {
+		p := g.pkgs[decl]
+		file := p.Files[0]
+		for _, f := range p.Files {
+			if f.Pos() <= decl.Pos() && decl.End() <= f.End() {
+				file = f
+				break
+			}
+		}
+		if filterNode(filter, decl, []ast.Node{file}) {
+			found = append(found, decl)
+		}
+	}
+	return found
+}
+
+// Callees returns the declarations called directly by decl, in the order of g.Funcs.
+func (g *CallGraph) Callees(decl *ast.FuncDecl) []*ast.FuncDecl {
+	return g.callees[decl]
+}
+
+// Callers returns the calls to decl, in the order of their packages and then of their
+// positions. Like the rest of the graph, they are resolved through type information where
+// it is available and by name otherwise.
+func (g *CallGraph) Callers(decl *ast.FuncDecl) []CallSite {
+	return g.callers[decl]
+}
+
+// Reachable returns the declarations that match filter and every declaration reachable
+// from them through calls, in the order of g.Funcs.
+func (g *CallGraph) Reachable(filter Filter) []*ast.FuncDecl {
+	reached := make(map[*ast.FuncDecl]bool)
+	queue := g.Find(filter)
+	var found []*ast.FuncDecl
+	for len(queue) > 0 {
+		decl := queue[0]
+		queue = queue[1:]
+		if reached[decl] {
+			continue
+		}
+		reached[decl] = true
+		found = append(found, decl)
+		queue = append(queue, g.callees[decl]...)
+	}
+	g.sort(found)
+	return found
+}
@@ -0,0 +1,190 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const callGraphLibSrc = `package lib
+
+func Open() *Conn { return dial() }
+
+func dial() *Conn { return &Conn{} }
+
+type Conn struct{}
+
+func (c *Conn) Close() { c.flush() }
+
+func (c *Conn) flush() {}
+
+func Unused() {}
+`
+
+const callGraphMainSrc = `package main
+
+import "lib"
+
+func main() {
+	handleIndex()
+}
+
+func handleIndex() {
+	c := lib.Open()
+	defer c.Close()
+	go func() { logf("index") }()
+}
+
+func handleHealth() {
+	logf("ok")
+	broken.Close()
+}
+
+func logf(format string, args ...interface{}) {}
+`
+
+func TestCallGraph(t *testing.T) {
+	fset := token.NewFileSet()
+	libFile, err := parser.ParseFile(fset, "lib.go", callGraphLibSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib, err := NewTypedPackage("lib", fset, []*ast.File{libFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainFile, err := parser.ParseFile(fset, "main.go", callGraphMainSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, _ := NewTypedPackage("main", fset, []*ast.File{mainFile}, &types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) { return lib.Pkg, nil }),
+	})
+	graph := NewCallGraph(lib, main)
+
+	testcases := []struct {
+		filter Filter
+		exp    []string
+	}{
+		{
+			filter: SetFilter{Names: []string{"main"}, Type: reflect.TypeOf((*ast.FuncDecl)(nil))},
+			exp:    []string{"Open", "dial", "Close", "flush", "main", "handleIndex", "logf"},
+		},
+		{
+			// broken has no type, so broken.Close is resolved by name to Close methods in main,
+			// of which there are none.
+			filter: SetFilter{Names: []string{"handleHealth"}, Type: reflect.TypeOf((*ast.FuncDecl)(nil))},
+			exp:    []string{"handleHealth", "logf"},
+		},
+		{
+			filter: RegexpFilter{Pattern: regexp.MustCompile(`^(Close|Unused)$`), Type: reflect.TypeOf((*ast.FuncDecl)(nil))},
+			exp:    []string{"Close", "flush", "Unused"},
+		},
+	}
+	for _, test := range testcases {
+		got := funcDeclNames(graph.Reachable(test.filter))
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected reachable funcs %v, but got %v", test.filter, test.exp, got)
+		}
+	}
+
+	handleIndex := graph.Find(SetFilter{Names: []string{"handleIndex"}, Type: reflect.TypeOf((*ast.FuncDecl)(nil))})
+	if len(handleIndex) != 1 {
+		t.Fatalf("expected to find handleIndex, but got %v", handleIndex)
+	}
+	if got, exp := funcDeclNames(graph.Callees(handleIndex[0])), []string{"Open", "Close", "logf"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected callees of handleIndex %v, but got %v", exp, got)
+	}
+	if graph.Package(handleIndex[0]) != main {
+		t.Errorf("expected handleIndex to be in package main")
+	}
+}
+
+func TestCallGraphUntyped(t *testing.T) {
+	// w is undefined, so w.Stop is resolved by name to the Stop methods of p.
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", `package p
+
+func run() { start(); w.Stop() }
+
+func start() {}
+
+type worker struct{}
+
+func (worker) Stop() {}
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _ := NewTypedPackage("p", fset, []*ast.File{file}, &types.Config{})
+	graph := NewCallGraph(pkg)
+	run := graph.Find(SetFilter{Names: []string{"run"}, Type: reflect.TypeOf((*ast.FuncDecl)(nil))})
+	if got, exp := funcDeclNames(graph.Callees(run[0])), []string{"start", "Stop"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected callees of run %v, but got %v", exp, got)
+	}
+}
+
+func funcDeclNames(decls []*ast.FuncDecl) []string {
+	var names []string
+	for _, decl := range decls {
+		names = append(names, decl.Name.Name)
+	}
+	return names
+}
+
+func TestCallers(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", `package p
+
+var ready = check()
+
+func check() bool { return true }
+
+func run() {
+	if check() {
+		w.Stop()
+	}
+	go func() { check() }()
+}
+
+type worker struct{}
+
+func (worker) Stop() {}
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _ := NewTypedPackage("p", fset, []*ast.File{file}, &types.Config{})
+	graph := NewCallGraph(pkg)
+
+	testcases := []struct {
+		name string
+		exp  []string
+	}{
+		{name: "check", exp: []string{"3: <nil>", "8: run", "11: run"}},
+		{name: "Stop", exp: []string{"9: run"}}, // w is undefined, so resolved by name
+		{name: "run", exp: nil},
+	}
+	for _, test := range testcases {
+		decls := graph.Find(SetFilter{Names: []string{test.name}, Type: reflect.TypeOf((*ast.FuncDecl)(nil))})
+		if len(decls) != 1 {
+			t.Fatalf("expected to find %s, but got %v", test.name, decls)
+		}
+		var got []string
+		for _, site := range graph.Callers(decls[0]) {
+			caller := "<nil>"
+			if site.Caller != nil {
+				caller = site.Caller.Name.Name
+			}
+			got = append(got, fmt.Sprintf("%d: %s", site.Position().Line, caller))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected callers %v, but got %v", test.name, test.exp, got)
+		}
+	}
+}
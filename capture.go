@@ -0,0 +1,131 @@
+package astquery
+
+import "go/ast"
+
+// CaptureFilter is a Filter that can record nodes under names as it matches them, such
+// as the filters Capture returns. Filters that wrap or combine other filters can pass the
+// captures of the filters they apply along by calling FilterCaptures.
+type CaptureFilter interface {
+	Filter
+
+	// FilterCaptures is like FilterPath, and adds the nodes captured by a match to
+	// captures. It must not add captures if node doesn't match.
+	FilterCaptures(node ast.Node, ancestors []ast.Node, captures map[string]ast.Node) bool
+}
+
+// FilterCaptures applies filter to node, with the given ancestors, and adds the nodes
+// captured by a match to captures: those of a CaptureFilter, and those bound to the
+// metavariables or captures of a Pattern or TreeSitterQuery.
+func FilterCaptures(filter Filter, node ast.Node, ancestors []ast.Node, captures map[string]ast.Node) bool {
+	switch filter := filter.(type) {
+	case CaptureFilter:
+		return filter.FilterCaptures(node, ancestors, captures)
+	case nodeMatcher:
+		if bindings, ok := filter.Match(node); ok {
+			for name, bound := range bindings {
+				captures[name] = bound
+			}
+			return true
+		}
+	}
+	return filterNode(filter, node, ancestors)
+}
+
+// nodeMatcher is implemented by the filters that bind nodes when they match one.
+type nodeMatcher interface {
+	Match(node ast.Node) (bindings map[string]ast.Node, ok bool)
+}
+
+// Capture returns a filter matching the nodes that filter matches, which captures each
+// match under name, along with the nodes captured by filter. Captures can be nested in
+// other filters, which pass them along as CaptureFilter describes:
+//
+//	astquery.Capture("call", astquery.CaptureFunc(func(node ast.Node, captures map[string]ast.Node) bool {
+//		call, isCall := node.(*ast.CallExpr)
+//		return isCall && len(call.Args) > 0 && astquery.FilterCaptures(arg, call.Args[0], nil, captures)
+//	}))
+//
+// FindMatches and Package.Find report the captures of the matches.
+func Capture(name string, filter Filter) CaptureFilter {
+	return captureFilter{name: name, filter: filter}
+}
+
+type captureFilter struct {
+	name   string
+	filter Filter
+}
+
+func (f captureFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f captureFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	return filterNode(f.filter, node, ancestors)
+}
+
+func (f captureFilter) FilterCaptures(node ast.Node, ancestors []ast.Node, captures map[string]ast.Node) bool {
+	inner := make(map[string]ast.Node)
+	if !FilterCaptures(f.filter, node, ancestors, inner) {
+		return false
+	}
+	for name, captured := range inner {
+		captures[name] = captured
+	}
+	captures[f.name] = node
+	return true
+}
+
+// Find is FindMatches for the capture, so that Package.Find reports its captures.
+func (f captureFilter) Find(nodes []ast.Node) []PatternMatch {
+	return FindMatches(nodes, f)
+}
+
+// CaptureFunc is like FilterFunc for a function that can capture nodes, by adding them to
+// captures or by applying other filters to the node's descendants with FilterCaptures.
+// Its captures are dropped if it doesn't match.
+type CaptureFunc func(node ast.Node, captures map[string]ast.Node) bool
+
+func (f CaptureFunc) Filter(node ast.Node) bool {
+	return f(node, make(map[string]ast.Node))
+}
+
+func (f CaptureFunc) FilterCaptures(node ast.Node, ancestors []ast.Node, captures map[string]ast.Node) bool {
+	inner := make(map[string]ast.Node)
+	if !f(node, inner) {
+		return false
+	}
+	for name, captured := range inner {
+		captures[name] = captured
+	}
+	return true
+}
+
+// FindMatches searches nodes like Find, returning each match along with the nodes
+// captured by filter when it matched, as FilterCaptures adds them.
+func FindMatches(nodes []ast.Node, filter Filter) []PatternMatch {
+	f := &matchRecorder{filter: filter, captures: make(map[ast.Node]map[string]ast.Node)}
+	var matches []PatternMatch
+	for _, node := range Find(nodes, f) {
+		matches = append(matches, PatternMatch{Node: node, Bindings: f.captures[node]})
+	}
+	return matches
+}
+
+// matchRecorder is a filter recording the captures of the nodes matching another filter.
+type matchRecorder struct {
+	filter   Filter
+	captures map[ast.Node]map[string]ast.Node
+}
+
+func (f *matchRecorder) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f *matchRecorder) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	captures := make(map[string]ast.Node)
+	if !FilterCaptures(f.filter, node, ancestors, captures) {
+		return false
+	}
+	f.captures[node] = captures
+	return true
+}
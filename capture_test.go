@@ -0,0 +1,71 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestFindMatches(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+func f() {
+	log.Print("starting")
+	log.Print(x)
+	fmt.Println("done", x)
+}
+`)
+	str := Capture("msg", FilterFunc(func(node ast.Node) bool {
+		lit, isLit := node.(*ast.BasicLit)
+		return isLit && lit.Kind == token.STRING
+	}))
+	callWithMsg := CaptureFunc(func(node ast.Node, captures map[string]ast.Node) bool {
+		call, isCall := node.(*ast.CallExpr)
+		if !isCall || len(call.Args) == 0 {
+			return false
+		}
+		captures["fun"] = call.Fun
+		return FilterCaptures(str, call.Args[0], nil, captures)
+	})
+	testcases := []struct {
+		name   string
+		filter Filter
+		exp    []string
+	}{
+		{"nested", Capture("call", callWithMsg), []string{
+			`log.Print("starting")`, `call=log.Print("starting")`, "fun=log.Print", `msg="starting"`,
+			`fmt.Println("done", x)`, `call=fmt.Println("done", x)`, "fun=fmt.Println", `msg="done"`,
+		}},
+		{"pattern", Capture("call", MustCompilePattern(`log.Print($x)`)), []string{
+			`log.Print("starting")`, `call=log.Print("starting")`, `x="starting"`,
+			"log.Print(x)", "call=log.Print(x)", "x=x",
+		}},
+		{"no captures", FilterFunc(func(node ast.Node) bool {
+			ident, isIdent := node.(*ast.Ident)
+			return isIdent && ident.Name == "x"
+		}), []string{"x", "x"}},
+	}
+	for _, test := range testcases {
+		if got := patternMatches(t, FindMatches([]ast.Node{file}, test.filter)); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.name, test.exp, got)
+		}
+	}
+}
+
+func TestPackageFindCapture(t *testing.T) {
+	pkg, err := ParseSource("p.go", []byte(`package p
+
+func f() { g(1) }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := pkg.Find(Capture("lit", FilterFunc(func(node ast.Node) bool {
+		_, isLit := node.(*ast.BasicLit)
+		return isLit
+	})))
+	if len(matches) != 1 || matches[0].Bindings["lit"] != matches[0].Node {
+		t.Errorf("expected the literal to be captured, but got %v", matches)
+	}
+}
@@ -0,0 +1,181 @@
+package astquery
+
+import (
+	"go/ast"
+	"regexp"
+	"strings"
+)
+
+// CommentFilter matches comment groups (*ast.CommentGroup) by their text. Files must be
+// parsed with the parser.ParseComments mode for comments to be present in the AST.
+type CommentFilter struct {
+	// Pattern is a regular expression matching the text of the comment group, with
+	// comment markers and directives removed as by (*ast.CommentGroup).Text.
+	Pattern *regexp.Regexp
+}
+
+func (f CommentFilter) Filter(node ast.Node) bool {
+	group, isGroup := node.(*ast.CommentGroup)
+	return isGroup && f.Pattern.MatchString(group.Text())
+}
+
+// DocFilter matches declarations whose doc comment matches a regular expression: function
+// declarations, general declarations (import, const, type and var), the specs within
+// them, and fields. Files must be parsed with the parser.ParseComments mode.
+type DocFilter struct {
+	// Pattern is a regular expression matching the text of the doc comment, as returned
+	// by (*ast.CommentGroup).Text.
+	Pattern *regexp.Regexp
+}
+
+func (f DocFilter) Filter(node ast.Node) bool {
+	doc := docComment(node)
+	return doc != nil && f.Pattern.MatchString(doc.Text())
+}
+
+// DeprecatedDeclFilter matches exported declarations whose doc comment contains a
+// paragraph starting with "Deprecated:", following the Go convention for deprecation
+// notices. It matches the node the doc comment is attached to, as described for
+// DocFilter. Files must be parsed with the parser.ParseComments mode.
+type DeprecatedDeclFilter struct{}
+
+func (f DeprecatedDeclFilter) Filter(node ast.Node) bool {
+	doc := docComment(node)
+	return doc != nil && isExportedDecl(node) && isDeprecated(doc)
+}
+
+// isDeprecated reports whether a doc comment has a deprecation paragraph.
+func isDeprecated(doc *ast.CommentGroup) bool {
+	for _, paragraph := range strings.Split(doc.Text(), "\n\n") {
+		if strings.HasPrefix(paragraph, "Deprecated: ") {
+			return true
+		}
+	}
+	return false
+}
+
+// isExportedDecl reports whether a declaration, spec or field declares an exported name.
+func isExportedDecl(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		return node.Name.IsExported()
+	case *ast.GenDecl:
+		for _, spec := range node.Specs {
+			if isExportedDecl(spec) {
+				return true
+			}
+		}
+	case *ast.TypeSpec:
+		return node.Name.IsExported()
+	case *ast.ValueSpec:
+		return anyExported(node.Names)
+	case *ast.Field:
+		return anyExported(node.Names)
+	}
+	return false
+}
+
+// anyExported reports whether any of the identifiers is exported.
+func anyExported(names []*ast.Ident) bool {
+	for _, name := range names {
+		if name.IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+// DirectiveFilter matches directive comments (*ast.Comment) such as "//go:generate",
+// "//go:embed", "//go:noinline" and "//nolint". See ParseDirective for the comments
+// recognized as directives.
+type DirectiveFilter struct {
+	// Names is a set of directive names to match (e.g., "go:generate" or "nolint"). If
+	// empty, any directive matches.
+	Names []string
+}
+
+func (f DirectiveFilter) Filter(node ast.Node) bool {
+	comment, isComment := node.(*ast.Comment)
+	if !isComment {
+		return false
+	}
+	name, _, isDirective := ParseDirective(comment)
+	if !isDirective {
+		return false
+	}
+	if len(f.Names) == 0 {
+		return true
+	}
+	for _, n := range f.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDirective splits a directive comment into the directive's name and arguments.
+// Directives are line comments without a space after the "//" whose first word has the
+// form "namespace:name" (e.g., "//go:generate stringer -type=Kind", whose name is
+// "go:generate"), as well as "//line", "//export", "//extern" and "//nolint". The linters
+// listed by "//nolint:errcheck,unused" are returned as its arguments.
+func ParseDirective(comment *ast.Comment) (name, args string, isDirective bool) {
+	text := comment.Text
+	if !strings.HasPrefix(text, "//") {
+		return "", "", false
+	}
+	text = text[2:]
+	name, args = text, ""
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		name, args = text[:i], strings.TrimSpace(text[i+1:])
+	}
+	switch {
+	case name == "nolint":
+		return name, args, true
+	case strings.HasPrefix(name, "nolint:"):
+		return "nolint", name[len("nolint:"):], true
+	case name == "line" || name == "export" || name == "extern":
+		return name, args, true
+	case isNamespacedDirective(name):
+		return name, args, true
+	default:
+		return "", "", false
+	}
+}
+
+// isNamespacedDirective reports whether name has the form "namespace:name", where both
+// parts start with a lowercase letter or digit, as go/ast requires of directives.
+func isNamespacedDirective(name string) bool {
+	colon := strings.Index(name, ":")
+	if colon <= 0 || colon+1 >= len(name) {
+		return false
+	}
+	isLowerOrDigit := func(c byte) bool { return 'a' <= c && c <= 'z' || '0' <= c && c <= '9' }
+	for i := 0; i < colon; i++ {
+		if !isLowerOrDigit(name[i]) {
+			return false
+		}
+	}
+	return isLowerOrDigit(name[colon+1])
+}
+
+// docComment returns the doc comment of a declaration, spec or field, or nil if it has
+// none.
+func docComment(node ast.Node) *ast.CommentGroup {
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		return node.Doc
+	case *ast.GenDecl:
+		return node.Doc
+	case *ast.TypeSpec:
+		return node.Doc
+	case *ast.ValueSpec:
+		return node.Doc
+	case *ast.ImportSpec:
+		return node.Doc
+	case *ast.Field:
+		return node.Doc
+	default:
+		return nil
+	}
+}
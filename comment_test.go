@@ -0,0 +1,212 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const commentTestSrc = `// Package p does things.
+package p
+
+// Client talks to the server.
+//
+// Deprecated: Use NewClient instead.
+type Client struct {
+	// TODO: make configurable
+	Addr string
+}
+
+// Dial connects to addr.
+func Dial(addr string) *Client {
+	// FIXME: validate addr
+	return &Client{Addr: addr} // TODO(someone): pool clients
+}
+
+const (
+	// Deprecated: Use DefaultPort.
+	Port = 80
+
+	// DefaultPort is the default port.
+	DefaultPort = 8080
+)
+`
+
+func TestCommentFilter(t *testing.T) {
+	file := parseTestFile(t, commentTestSrc)
+
+	comments := Find([]ast.Node{file}, CommentFilter{Pattern: regexp.MustCompile(`^(TODO|FIXME)\b`)})
+	var texts []string
+	for _, comment := range comments {
+		texts = append(texts, strings.TrimSpace(comment.(*ast.CommentGroup).Text()))
+	}
+	exp := []string{"TODO: make configurable", "FIXME: validate addr", "TODO(someone): pool clients"}
+	if !reflect.DeepEqual(texts, exp) {
+		t.Errorf("expected comments %v, but got %v", exp, texts)
+	}
+}
+
+func TestDocFilter(t *testing.T) {
+	file := parseTestFile(t, commentTestSrc)
+
+	decls := Find([]ast.Node{file}, DocFilter{Pattern: regexp.MustCompile(`(?m)^Deprecated:`)})
+	var names []string
+	for _, decl := range decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			names = append(names, decl.Specs[0].(*ast.TypeSpec).Name.Name)
+		case *ast.ValueSpec:
+			names = append(names, decl.Names[0].Name)
+		}
+	}
+	if exp := []string{"Client", "Port"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected deprecated declarations %v, but got %v", exp, names)
+	}
+}
+
+func TestDeprecatedDeclFilter(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+// Client talks to the server.
+//
+// Deprecated: Use NewClient instead.
+type Client struct {
+	// Timeout is ignored.
+	//
+	// Deprecated: Set a deadline on the context.
+	Timeout int
+
+	// Deprecated: unexported fields aren't part of the API.
+	retries int
+}
+
+// Dial connects to addr. Deprecated: not a paragraph of its own.
+func Dial(addr string) {}
+
+// Deprecated: Use dialContext.
+func dial() {}
+
+const (
+	// Deprecated: Use DefaultPort.
+	Port = 80
+
+	// DefaultPort is the default port.
+	DefaultPort = 8080
+)
+
+// OldName is an alias.
+//
+// Deprecated: Use NewName.
+var OldName, oldName = NewName, newName
+`)
+
+	var names []string
+	for _, decl := range Find([]ast.Node{file}, DeprecatedDeclFilter{}) {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			switch spec := decl.Specs[0].(type) {
+			case *ast.TypeSpec:
+				names = append(names, spec.Name.Name)
+			case *ast.ValueSpec:
+				names = append(names, spec.Names[0].Name)
+			}
+		case *ast.ValueSpec:
+			names = append(names, decl.Names[0].Name)
+		}
+	}
+	if exp := []string{"Client", "Port", "OldName"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected deprecated declarations %v, but got %v", exp, names)
+	}
+
+	// Fields are found when searching within a matched declaration.
+	client := Find([]ast.Node{file}, DeprecatedDeclFilter{})[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+	fields := Find([]ast.Node{client.Type}, DeprecatedDeclFilter{})
+	if names := fieldNames(fields); !reflect.DeepEqual(names, []string{"Timeout"}) {
+		t.Errorf("expected deprecated fields [Timeout], but got %v", names)
+	}
+}
+
+func TestDirectiveFilter(t *testing.T) {
+	file := parseTestFile(t, `//go:build linux
+
+package p
+
+//go:generate stringer -type=Kind
+type Kind int
+
+//go:embed static/*
+var static embed.FS
+
+//go:noinline
+func hot() {
+	// not a directive
+	// go:generate with a space is not a directive either
+	_ = os.Remove("x") //nolint:errcheck,gosec
+	_ = os.Remove("y") //nolint
+}
+`)
+
+	testcases := []struct {
+		filter DirectiveFilter
+		exp    []string
+	}{
+		{DirectiveFilter{}, []string{"go:generate stringer -type=Kind", "go:embed static/*", "go:noinline", "go:build linux", "nolint errcheck,gosec", "nolint"}},
+		{DirectiveFilter{Names: []string{"nolint"}}, []string{"nolint errcheck,gosec", "nolint"}},
+		{DirectiveFilter{Names: []string{"go:generate", "go:build"}}, []string{"go:generate stringer -type=Kind", "go:build linux"}},
+	}
+	for _, test := range testcases {
+		var directives []string
+		for _, comment := range Find([]ast.Node{file}, test.filter) {
+			name, args, _ := ParseDirective(comment.(*ast.Comment))
+			directives = append(directives, strings.TrimSpace(name+" "+args))
+		}
+		if !reflect.DeepEqual(directives, test.exp) {
+			t.Errorf("%+v: expected directives %v, but got %v", test.filter, test.exp, directives)
+		}
+	}
+}
+
+func TestFindComments(t *testing.T) {
+	file := parseTestFile(t, commentTestSrc)
+	describe := func(nodes []ast.Node) []string {
+		var descs []string
+		for _, node := range nodes {
+			switch node := node.(type) {
+			case *ast.FuncDecl:
+				descs = append(descs, "func "+node.Name.Name)
+			case *ast.CommentGroup:
+				descs = append(descs, strings.SplitN(node.Text(), "\n", 2)[0])
+			}
+		}
+		return descs
+	}
+	testcases := []struct {
+		filter Filter
+		exp    []string
+	}{
+		{FilterFunc(func(node ast.Node) bool {
+			switch node.(type) {
+			case *ast.FuncDecl, *ast.CommentGroup:
+				return true
+			}
+			return false
+		}), []string{
+			"Package p does things.",
+			"Client talks to the server.",
+			"TODO: make configurable",
+			"func Dial",
+			"Deprecated: Use DefaultPort.",
+			"DefaultPort is the default port.",
+		}},
+		{MustCompileQuery(`//FuncDecl//CommentGroup`), []string{"Dial connects to addr.", "FIXME: validate addr", "TODO(someone): pool clients"}},
+		{MustCompileQuery(`//BlockStmt/CommentGroup`), []string{"FIXME: validate addr", "TODO(someone): pool clients"}},
+		{MustCompileQuery(`/File/CommentGroup`), []string{"Package p does things."}},
+	}
+	for _, test := range testcases {
+		if got := describe(Find([]ast.Node{file}, test.filter)); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%v: expected %q, but got %q", test.filter, test.exp, got)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// Language is a language in which queries can be written.
+type Language int
+
+const (
+	QueryLanguage      Language = iota // the XPath-like language of Query
+	SelectorLanguage                   // CSS-style selectors, as CompileSelector compiles
+	PatternLanguage                    // structural patterns, as CompilePattern compiles
+	TreeSitterLanguage                 // tree-sitter queries, as CompileTreeSitter compiles
+	SQLLanguage                        // SQL-like queries, as CompileSQL compiles
+)
+
+var languageNames = []string{"query", "selector", "pattern", "tree-sitter query", "select"}
+
+func (l Language) String() string {
+	if l < 0 || int(l) >= len(languageNames) {
+		return fmt.Sprintf("Language(%d)", int(l))
+	}
+	return languageNames[l]
+}
+
+// MarshalText returns the name of the language, as String does.
+func (l Language) MarshalText() ([]byte, error) {
+	if l < 0 || int(l) >= len(languageNames) {
+		return nil, fmt.Errorf("unknown query language %v", l)
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText parses the name of a language.
+func (l *Language) UnmarshalText(text []byte) error {
+	for i, name := range languageNames {
+		if string(text) == name {
+			*l = Language(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown query language %q", text)
+}
+
+// QueryError is an error compiling a query, in any language.
+type QueryError struct {
+	Language Language
+	Query    string
+
+	// Offset is the byte offset in Query where the error was found, and Line and Column
+	// (in bytes) are its 1-based position.
+	Offset, Line, Column int
+
+	// Semantic is if the query is well-formed, but refers to an unknown node kind,
+	// attribute, field or column, or holds an invalid regular expression.
+	Semantic bool
+
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s %q: offset %d: %s", e.Language, e.Query, e.Offset, e.Msg)
+}
+
+// syntaxError and semanticError return errors at an offset of a query being compiled,
+// whose language and source are filled in by queryError.
+func syntaxError(offset int, format string, args ...interface{}) *QueryError {
+	return &QueryError{Offset: offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+func semanticError(offset int, format string, args ...interface{}) *QueryError {
+	return &QueryError{Offset: offset, Semantic: true, Msg: fmt.Sprintf(format, args...)}
+}
+
+// queryError returns err, an error compiling the query src, as a *QueryError.
+func queryError(lang Language, src string, err error) *QueryError {
+	qerr, isQueryErr := err.(*QueryError)
+	if !isQueryErr {
+		qerr = &QueryError{Msg: err.Error()}
+	}
+	qerr.Language, qerr.Query = lang, src
+	before := src[:min(max(qerr.Offset, 0), len(src))]
+	qerr.Line = strings.Count(before, "\n") + 1
+	qerr.Column = len(before) - strings.LastIndex(before, "\n")
+	return qerr
+}
+
+// CompiledQuery is a query compiled ahead of time from any language. Errors in the query
+// are reported when it is compiled, and matching can't fail. A CompiledQuery is a
+// PathFilter.
+type CompiledQuery struct {
+	Language Language
+
+	src    string
+	filter Filter
+}
+
+// Compile compiles a query in the given language. Errors are reported as a *QueryError.
+func Compile(lang Language, src string) (*CompiledQuery, error) {
+	var filter Filter
+	var err error
+	switch lang {
+	case QueryLanguage:
+		filter, err = CompileQuery(src)
+	case SelectorLanguage:
+		filter, err = CompileSelector(src)
+	case PatternLanguage:
+		filter, err = CompilePattern(src)
+	case TreeSitterLanguage:
+		filter, err = CompileTreeSitter(src)
+	case SQLLanguage:
+		filter, err = CompileSQL(src)
+	default:
+		return nil, fmt.Errorf("unknown query language %v", lang)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledQuery{Language: lang, src: src, filter: filter}, nil
+}
+
+// MustCompile is like Compile but panics if the query cannot be compiled.
+func MustCompile(lang Language, src string) *CompiledQuery {
+	q, err := Compile(lang, src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the source of the query.
+func (q *CompiledQuery) String() string { return q.src }
+
+// Bind returns the query with its placeholders replaced by args, in order, without
+// compiling it again. Only queries and selectors, and SQL-like queries, have
+// placeholders.
+func (q *CompiledQuery) Bind(args ...string) (*CompiledQuery, error) {
+	bound := *q
+	var err error
+	switch filter := q.filter.(type) {
+	case *Query:
+		bound.filter, err = filter.Bind(args...)
+	case *SQLQuery:
+		bound.filter, err = filter.Bind(args...)
+	default:
+		if len(args) > 0 {
+			err = fmt.Errorf("%s %q: expected 0 arguments, but got %d", q.Language, q.src, len(args))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bound, nil
+}
+
+func (q *CompiledQuery) Filter(node ast.Node) bool {
+	return q.filter.Filter(node)
+}
+
+func (q *CompiledQuery) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	return filterNode(q.filter, node, ancestors)
+}
+
+func (q *CompiledQuery) FilterCaptures(node ast.Node, ancestors []ast.Node, captures map[string]ast.Node) bool {
+	return FilterCaptures(q.filter, node, ancestors, captures)
+}
+
+// Find searches nodes like Find, returning the matches with the nodes bound to the
+// query's metavariables or captures, for the languages that have them.
+func (q *CompiledQuery) Find(nodes []ast.Node) []PatternMatch {
+	if finder, hasBindings := q.filter.(bindingFinder); hasBindings {
+		return finder.Find(nodes)
+	}
+	var matches []PatternMatch
+	for _, node := range Find(nodes, q.filter) {
+		matches = append(matches, PatternMatch{Node: node})
+	}
+	return matches
+}
@@ -0,0 +1,103 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+func f(x int) {
+	g(x)
+}
+
+func g(y int) {}
+`)
+	testcases := []struct {
+		lang  Language
+		query string
+		exp   []string
+	}{
+		{QueryLanguage, `//FuncDecl[@name="g"]/Ident`, []string{"g"}},
+		{SelectorLanguage, `CallExpr > Ident`, []string{"g", "x"}},
+		{PatternLanguage, `g($x)`, []string{"g(x)", "x=x"}},
+		{TreeSitterLanguage, `(call_expression function: (identifier) @fn)`, []string{"g(x)", "fn=g"}},
+		{SQLLanguage, `SELECT name FROM FuncDecl WHERE name = 'f'`, []string{"func f(x int) { g(x) }"}},
+	}
+	for _, test := range testcases {
+		q, err := Compile(test.lang, test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		if q.String() != test.query {
+			t.Errorf("%s: expected String to return the query, but got %q", test.query, q.String())
+		}
+		if got := patternMatches(t, q.Find([]ast.Node{file})); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s %s: expected %v, but got %v", test.lang, test.query, test.exp, got)
+		}
+	}
+}
+
+func TestCompiledQueryBind(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+func f() { g() }
+
+func g() {}
+`)
+	q := MustCompile(SelectorLanguage, `FuncDecl[name=?]`)
+	for _, name := range []string{"f", "g"} {
+		bound, err := q.Bind(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := patternMatches(t, bound.Find([]ast.Node{file})); len(got) != 1 || !strings.HasPrefix(got[0], "func "+name) {
+			t.Errorf("%s: expected the declaration of %s, but got %v", q, name, got)
+		}
+	}
+	if _, err := MustCompile(PatternLanguage, `g()`).Bind("x"); err == nil || !strings.Contains(err.Error(), "expected 0 arguments, but got 1") {
+		t.Errorf("expected an error binding a pattern, but got %v", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	testcases := []struct {
+		lang         Language
+		query        string
+		line, column int
+		semantic     bool
+		err          string
+	}{
+		{QueryLanguage, `//FuncDecl[@name=`, 1, 18, false, `query "//FuncDecl[@name=": offset 17: expected a quoted string`},
+		{QueryLanguage, `//Func`, 1, 3, true, `offset 2: unknown node kind "Func"`},
+		{QueryLanguage, `//Ident[@name=~"("]`, 1, 16, true, "offset 15: error parsing regexp"},
+		{SelectorLanguage, `FuncDecl[size=1]`, 1, 10, true, `unknown attribute "size"`},
+		{PatternLanguage, "f(\n$)", 2, 1, false, `pattern "f(\n$)": offset 3: expected a metavariable name after '$'`},
+		{PatternLanguage, "if $x {", 1, 8, false, "offset 7: expected '}', found 'EOF'"},
+		{TreeSitterLanguage, "(call_expression\n  name: (identifier))", 2, 3, true, `unknown field "name" of call_expression`},
+		{TreeSitterLanguage, `((identifier) @x (#match? @x "["))`, 1, 30, true, "error parsing regexp"},
+		{SQLLanguage, `SELECT size FROM FuncDecl`, 1, 8, true, `select "SELECT size FROM FuncDecl": offset 7: unknown column "size"`},
+		{SQLLanguage, `SELECT name FROM FuncDecl LIMIT`, 1, 32, false, "offset 31: expected a number"},
+	}
+	for _, test := range testcases {
+		_, err := Compile(test.lang, test.query)
+		qerr, ok := err.(*QueryError)
+		if !ok {
+			t.Errorf("%s: expected a *QueryError, but got %v", test.query, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.query, test.err, err)
+		}
+		if qerr.Language != test.lang || qerr.Query != test.query {
+			t.Errorf("%s: expected the error to be in %s %q, but got %s %q", test.query, test.lang, test.query, qerr.Language, qerr.Query)
+		}
+		if qerr.Line != test.line || qerr.Column != test.column || qerr.Semantic != test.semantic {
+			t.Errorf("%s: expected line %d, column %d, semantic %v, but got %d, %d, %v", test.query, test.line, test.column, test.semantic, qerr.Line, qerr.Column, qerr.Semantic)
+		}
+	}
+}
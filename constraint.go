@@ -0,0 +1,89 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"path/filepath"
+	"strings"
+)
+
+// Constraint returns the build constraint of the file containing node, combining its
+// //go:build (or // +build) lines with the constraints implied by a _GOOS or _GOARCH
+// suffix of its name, as in "linux && amd64". It returns the empty string if the file
+// has no constraints or node is not in p.
+func (p *Package) Constraint(node ast.Node) string {
+	for _, file := range p.Files {
+		if file.Pos() <= node.Pos() && node.End() <= file.End() {
+			if expr := fileConstraint(file, p.Fset.Position(file.Pos()).Filename); expr != nil {
+				return expr.String()
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// fileConstraint returns the build constraint of a file, or nil if it has none.
+func fileConstraint(file *ast.File, filename string) constraint.Expr {
+	var expr constraint.Expr
+	and := func(x constraint.Expr) {
+		if expr == nil {
+			expr = x
+		} else {
+			expr = &constraint.AndExpr{X: expr, Y: x}
+		}
+	}
+
+	// A //go:build line takes precedence over // +build lines.
+	var goBuild constraint.Expr
+	var plusBuild []constraint.Expr
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if constraint.IsGoBuild(c.Text) && goBuild == nil {
+				goBuild, _ = constraint.Parse(c.Text)
+			} else if constraint.IsPlusBuild(c.Text) {
+				if x, err := constraint.Parse(c.Text); err == nil {
+					plusBuild = append(plusBuild, x)
+				}
+			}
+		}
+	}
+	if goBuild != nil {
+		and(goBuild)
+	} else {
+		for _, x := range plusBuild {
+			and(x)
+		}
+	}
+
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(filename), ".go"), "_test")
+	parts := strings.Split(name, "_")
+	if n := len(parts); n >= 3 && knownOS[parts[n-2]] && knownArch[parts[n-1]] {
+		and(&constraint.TagExpr{Tag: parts[n-2]})
+		and(&constraint.TagExpr{Tag: parts[n-1]})
+	} else if n >= 2 && (knownOS[parts[n-1]] || knownArch[parts[n-1]]) {
+		and(&constraint.TagExpr{Tag: parts[n-1]})
+	}
+	return expr
+}
+
+// knownOS and knownArch are the values of GOOS and GOARCH that file name suffixes can
+// refer to.
+var (
+	knownOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+		"hurd": true, "illumos": true, "ios": true, "js": true, "linux": true, "nacl": true,
+		"netbsd": true, "openbsd": true, "plan9": true, "solaris": true, "wasip1": true,
+		"windows": true, "zos": true,
+	}
+	knownArch = map[string]bool{
+		"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true,
+		"arm64be": true, "loong64": true, "mips": true, "mipsle": true, "mips64": true,
+		"mips64le": true, "mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true,
+		"ppc64le": true, "riscv": true, "riscv64": true, "s390": true, "s390x": true,
+		"sparc": true, "sparc64": true, "wasm": true,
+	}
+)
@@ -0,0 +1,90 @@
+package astquery
+
+import (
+	"go/ast"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+var constraintTestFS = fstest.MapFS{
+	"go.mod":               {Data: []byte("module example.com/m\n")},
+	"open.go":              {Data: []byte("package m\n\nfunc open() {}\n")},
+	"open_linux.go":        {Data: []byte("package m\n\nfunc openLinux() {}\n")},
+	"open_windows.go":      {Data: []byte("package m\n\nfunc openWindows() {}\n")},
+	"open_darwin_arm64.go": {Data: []byte("package m\n\nfunc openAppleSilicon() {}\n")},
+	"debug.go":             {Data: []byte("//go:build debug && !race\n\npackage m\n\nfunc debug() {}\n")},
+	"legacy_unix.go":       {Data: []byte("// +build linux darwin\n\npackage m\n\nfunc legacy() {}\n")},
+	"fast_amd64.go":        {Data: []byte("//go:build go1.21\n\npackage m\n\nfunc fast() {}\n")},
+}
+
+// constraintFuncs returns the functions found in the workspace of pkgs with their
+// constraints.
+func constraintFuncs(pkgs []*Package) []string {
+	ws := &Workspace{Packages: pkgs}
+	var funcs []string
+	for _, m := range ws.Find(FilterFunc(func(node ast.Node) bool {
+		_, isFunc := node.(*ast.FuncDecl)
+		return isFunc
+	})) {
+		funcs = append(funcs, m.Node.(*ast.FuncDecl).Name.Name+": "+m.Constraint)
+	}
+	sort.Strings(funcs)
+	return funcs
+}
+
+func TestConstraint(t *testing.T) {
+	pkgs, err := LoadFS(constraintTestFS, &LoadOptions{AllFiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"debug: debug && !race",
+		"fast: go1.21 && amd64",
+		"legacy: linux || darwin",
+		"open: ",
+		"openAppleSilicon: darwin && arm64",
+		"openLinux: linux",
+		"openWindows: windows",
+	}
+	if got := constraintFuncs(pkgs); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected functions %v, but got %v", exp, got)
+	}
+}
+
+func TestLoadBuildConfiguration(t *testing.T) {
+	testcases := []struct {
+		opts LoadOptions
+		exp  []string
+	}{
+		{LoadOptions{GOOS: "windows", GOARCH: "amd64"}, []string{"fast: go1.21 && amd64", "open: ", "openWindows: windows"}},
+		{LoadOptions{GOOS: "darwin", GOARCH: "arm64", Tags: []string{"debug"}}, []string{"debug: debug && !race", "legacy: linux || darwin", "open: ", "openAppleSilicon: darwin && arm64"}},
+	}
+	for _, test := range testcases {
+		pkgs, err := LoadFS(constraintTestFS, &test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := constraintFuncs(pkgs); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("LoadFS %+v: expected functions %v, but got %v", test.opts, test.exp, got)
+		}
+
+		dir := t.TempDir()
+		files := make(map[string]string)
+		for name, file := range constraintTestFS {
+			files[name] = string(file.Data)
+		}
+		writeTestFiles(t, dir, files)
+		test.opts.Dir = dir
+		test.opts.Env = append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod")
+		pkgs, err = Load(&test.opts, ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := constraintFuncs(pkgs); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("Load %+v: expected functions %v, but got %v", test.opts, test.exp, got)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package astquery
+
+import "go/ast"
+
+// CountFilter matches nodes that match Node and have a number of descendants matching
+// Descendants between Min and Max, such as functions with more than 5 return statements:
+//
+//	astquery.CountFilter{
+//		Node:        astquery.MustCompileSelector("FuncDecl"),
+//		Descendants: astquery.MustCompileSelector("ReturnStmt"),
+//		Min:         6,
+//		Max:         -1,
+//	}
+//
+// All the matching descendants are counted, including those nested in others, and they
+// are filtered with their ancestors in the tree passed to Find.
+type CountFilter struct {
+	// Node is the filter nodes must match. If nil, any node matches.
+	Node Filter
+
+	// Descendants is the filter of the descendants that are counted.
+	Descendants Filter
+
+	// Min and Max bound the number of matching descendants. If Max is negative, there is
+	// no upper bound.
+	Min, Max int
+}
+
+// AtLeast returns a filter matching the nodes with at least n descendants matching
+// filter.
+func AtLeast(n int, filter Filter) CountFilter {
+	return CountFilter{Descendants: filter, Min: n, Max: -1}
+}
+
+// Exactly returns a filter matching the nodes with exactly n descendants matching filter.
+func Exactly(n int, filter Filter) CountFilter {
+	return CountFilter{Descendants: filter, Min: n, Max: n}
+}
+
+func (f CountFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f CountFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	if f.Node != nil && !filterNode(f.Node, node, ancestors) {
+		return false
+	}
+	limit := f.Max + 1 // counting past Max is enough to tell the node doesn't match
+	if f.Max < 0 {
+		limit = f.Min
+	}
+	n := 0
+	if limit > 0 {
+		walkDescendants(node, ancestors, false, func(desc ast.Node, descAncestors []ast.Node) bool {
+			if filterNode(f.Descendants, desc, descAncestors) {
+				n++
+			}
+			return n < limit
+		})
+	}
+	return n >= f.Min && (f.Max < 0 || n <= f.Max)
+}
+
+// walkDescendants calls visit for each descendant of node, or only for its children,
+// in depth-first order, until visit returns false. Visit is passed the ancestors of the
+// descendant: those of node, followed by node and the nodes in between. It must not
+// retain them.
+func walkDescendants(node ast.Node, ancestors []ast.Node, childrenOnly bool, visit func(desc ast.Node, descAncestors []ast.Node) bool) {
+	stack := ancestors[:len(ancestors):len(ancestors)]
+	stopped := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch {
+		case stopped:
+			return false
+		case n == nil:
+			stack = stack[:len(stack)-1]
+			return false
+		case n != node:
+			if stopped = !visit(n, stack); stopped || childrenOnly {
+				return false
+			}
+		}
+		stack = append(stack, n)
+		return true
+	})
+}
@@ -0,0 +1,101 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+const countSrc = `package p
+
+type Public struct {
+	Name string
+	addr string
+}
+
+type private struct {
+	name string
+	addr struct{ host string }
+}
+
+func check(x int) error {
+	if x < 0 {
+		return errNegative
+	}
+	if x > 10 {
+		return errLarge
+	}
+	return nil
+}
+
+func get() int { return 1 }
+`
+
+func TestCountFilter(t *testing.T) {
+	file := parseTestFile(t, countSrc)
+	funcDecl := MustCompileSelector("FuncDecl")
+	returnStmt := MustCompileSelector("ReturnStmt")
+	exportedField := MustCompileSelector("Field.exported")
+	testcases := []struct {
+		name   string
+		filter Filter
+		exp    []string
+	}{
+		{"more than 2 returns", CountFilter{Node: funcDecl, Descendants: returnStmt, Min: 3, Max: -1}, []string{"check"}},
+		{"at most 1 return", CountFilter{Node: funcDecl, Descendants: returnStmt, Max: 1}, []string{"get"}},
+		{"no exported fields", CountFilter{Node: MustCompileSelector("TypeSpec"), Descendants: exportedField}, []string{"private"}},
+		{"at least", withNode(AtLeast(2, MustCompileSelector("IfStmt")), funcDecl), []string{"check"}},
+		{"exactly", withNode(Exactly(1, returnStmt), funcDecl), []string{"get"}},
+	}
+	for _, test := range testcases {
+		var got []string
+		for _, node := range Find([]ast.Node{file}, test.filter) {
+			switch node := node.(type) {
+			case *ast.Field:
+				got = append(got, node.Names[0].Name)
+			default:
+				name, _ := GetName(node)
+				got = append(got, name)
+			}
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.name, test.exp, got)
+		}
+	}
+}
+
+// withNode sets the node filter of a CountFilter.
+func withNode(f CountFilter, node Filter) CountFilter {
+	f.Node = node
+	return f
+}
+
+func TestQueryCount(t *testing.T) {
+	file := parseTestFile(t, countSrc)
+	testcases := []struct {
+		query string
+		exp   []string
+	}{
+		{`//FuncDecl[count(descendant::ReturnStmt) > 2]/Ident`, []string{"check"}},
+		{`//FuncDecl[count(descendant::ReturnStmt) <= 1]/Ident`, []string{"get"}},
+		{`//TypeSpec[count(descendant::Field[@exported='true']) = 0]/Ident`, []string{"private"}},
+		{`//StructType[count(descendant::Field) >= 2]`, []string{"struct { Name string addr string }", "struct { name string addr struct{ host string } }"}},
+		{`//TypeSpec[count(descendant::Field) != 2]/Ident`, []string{"private"}},
+		{`//IfStmt[count(following-sibling::*) = 1 and count(preceding-sibling::IfStmt) < 1]`, nil},
+		{`//TypeSpec[count(descendant::Field[@name=?]) = 1]/Ident`, nil},
+	}
+	for _, test := range testcases {
+		q, err := CompileQuery(test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, node := range Find([]ast.Node{file}, q) {
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.query, test.exp, got)
+		}
+	}
+}
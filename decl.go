@@ -0,0 +1,404 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ConstDeclFilter matches constant specs (*ast.ValueSpec) in const declarations. Specs
+// with several names match if any of the names does.
+type ConstDeclFilter struct {
+	// Pattern, if non-nil, is a regular expression matching the constant's name.
+	Pattern *regexp.Regexp
+
+	// UsesIota is if the filter should select only constants whose value refers to iota,
+	// including values implicitly repeated from an earlier spec in the same group.
+	UsesIota bool
+
+	// Type, if non-empty, is the declared type of the constant as written in the source
+	// (e.g., "time.Duration").
+	Type string
+}
+
+// Filter reports whether node is a matching value spec. Without ancestors, the spec is
+// assumed to belong to a const declaration and implicit values cannot be resolved.
+func (f ConstDeclFilter) Filter(node ast.Node) bool {
+	return f.filterSpec(node, nil)
+}
+
+func (f ConstDeclFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	decl, isDecl := parent(ancestors).(*ast.GenDecl)
+	if !isDecl || decl.Tok != token.CONST {
+		return false
+	}
+	return f.filterSpec(node, decl)
+}
+
+func (f ConstDeclFilter) filterSpec(node ast.Node, decl *ast.GenDecl) bool {
+	spec, isSpec := node.(*ast.ValueSpec)
+	if !isSpec {
+		return false
+	}
+	if f.Pattern != nil && !anyNameMatches(spec.Names, f.Pattern) {
+		return false
+	}
+	typ, values := constSpecValues(spec, decl)
+	if f.Type != "" && (typ == nil || types.ExprString(typ) != f.Type) {
+		return false
+	}
+	if f.UsesIota && !refersToIota(values) {
+		return false
+	}
+	return true
+}
+
+// VarDeclFilter matches variable declarations, both var specs (*ast.ValueSpec) and short
+// variable declarations (*ast.AssignStmt using :=). A declaration matches if any one of the
+// variables it declares satisfies all the criteria.
+type VarDeclFilter struct {
+	// Pattern, if non-nil, is a regular expression matching the variable's name.
+	Pattern *regexp.Regexp
+
+	// Type, if non-empty, is the type of the variable as written in the source (e.g.,
+	// "sync.Mutex" or "*bytes.Buffer"). When no type is declared, it is inferred from
+	// composite literal, address-of composite literal, new(T) and make(T, ...)
+	// initializers.
+	Type string
+}
+
+// Filter reports whether node is a matching declaration. Without ancestors, value specs
+// are assumed to belong to a var declaration.
+func (f VarDeclFilter) Filter(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.ValueSpec:
+		for i, name := range node.Names {
+			typ := node.Type
+			if typ == nil && len(node.Values) == len(node.Names) {
+				typ = inferredType(node.Values[i])
+			}
+			if f.matchVar(name, typ) {
+				return true
+			}
+		}
+	case *ast.AssignStmt:
+		if node.Tok != token.DEFINE {
+			return false
+		}
+		for i, lhs := range node.Lhs {
+			name, isIdent := lhs.(*ast.Ident)
+			if !isIdent {
+				continue
+			}
+			var typ ast.Expr
+			if len(node.Rhs) == len(node.Lhs) {
+				typ = inferredType(node.Rhs[i])
+			}
+			if f.matchVar(name, typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f VarDeclFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	if _, isSpec := node.(*ast.ValueSpec); isSpec {
+		decl, isDecl := parent(ancestors).(*ast.GenDecl)
+		if !isDecl || decl.Tok != token.VAR {
+			return false
+		}
+	}
+	return f.Filter(node)
+}
+
+func (f VarDeclFilter) matchVar(name *ast.Ident, typ ast.Expr) bool {
+	if f.Pattern != nil && !f.Pattern.MatchString(name.Name) {
+		return false
+	}
+	if f.Type != "" && (typ == nil || types.ExprString(typ) != f.Type) {
+		return false
+	}
+	return true
+}
+
+// EntryPointFilter matches the function declarations (*ast.FuncDecl) the Go runtime calls
+// implicitly: package initializers, func init(), and the program entry point, func main()
+// in package main. Methods and functions with parameters or results never match.
+type EntryPointFilter struct {
+	// Funcs is the set of entry points to match. The zero value matches both.
+	Funcs EntryPoint
+}
+
+// EntryPoint is a set of implicitly called functions.
+type EntryPoint int
+
+const (
+	InitFuncs EntryPoint = 1 << iota // func init()
+	MainFunc                         // func main() in package main
+)
+
+func (f EntryPointFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+// FilterPath reports whether node is a matching entry point. The package of a main function
+// is determined from the *ast.File among ancestors, so main functions only match if it is
+// present.
+func (f EntryPointFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	decl, isFunc := node.(*ast.FuncDecl)
+	if !isFunc || decl.Recv != nil || decl.Type.TypeParams != nil {
+		return false
+	}
+	if len(fieldTypes(decl.Type.Params)) != 0 || len(fieldTypes(decl.Type.Results)) != 0 {
+		return false
+	}
+	var entryPoint EntryPoint
+	switch decl.Name.Name {
+	case "init":
+		entryPoint = InitFuncs
+	case "main":
+		if len(ancestors) == 0 {
+			return false
+		}
+		file, isFile := ancestors[0].(*ast.File)
+		if !isFile || file.Name.Name != "main" {
+			return false
+		}
+		entryPoint = MainFunc
+	default:
+		return false
+	}
+	return f.Funcs == 0 || f.Funcs&entryPoint != 0
+}
+
+// TestFunctionFilter matches the function declarations (*ast.FuncDecl) run by go test,
+// following its naming and signature rules: TestXxx(*testing.T), BenchmarkXxx(*testing.B),
+// FuzzXxx(*testing.F) and ExampleXxx(), where Xxx does not start with a lowercase letter.
+// The testing package must be imported under its own name.
+type TestFunctionFilter struct {
+	// Kinds is the set of test functions to match. The zero value matches all of them.
+	Kinds TestKind
+}
+
+// TestKind is a set of kinds of test functions.
+type TestKind int
+
+const (
+	TestFuncs      TestKind = 1 << iota // func TestXxx(t *testing.T)
+	BenchmarkFuncs                      // func BenchmarkXxx(b *testing.B)
+	FuzzFuncs                           // func FuzzXxx(f *testing.F)
+	ExampleFuncs                        // func ExampleXxx()
+)
+
+// testFuncRules are the name prefix and parameter types of each kind of test function.
+var testFuncRules = []struct {
+	kind   TestKind
+	prefix string
+	params []string
+}{
+	{TestFuncs, "Test", []string{"*testing.T"}},
+	{BenchmarkFuncs, "Benchmark", []string{"*testing.B"}},
+	{FuzzFuncs, "Fuzz", []string{"*testing.F"}},
+	{ExampleFuncs, "Example", []string{}},
+}
+
+func (f TestFunctionFilter) Filter(node ast.Node) bool {
+	decl, isFunc := node.(*ast.FuncDecl)
+	if !isFunc || decl.Recv != nil || decl.Type.TypeParams != nil || len(fieldTypes(decl.Type.Results)) != 0 {
+		return false
+	}
+	for _, rule := range testFuncRules {
+		if f.Kinds != 0 && f.Kinds&rule.kind == 0 {
+			continue
+		}
+		if isTestName(decl.Name.Name, rule.prefix) && typesMatch(rule.params, fieldTypes(decl.Type.Params)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTestName reports whether name is prefix followed by nothing or by a string that does
+// not start with a lowercase letter, as go test requires.
+func isTestName(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
+
+// inferredType returns the type expression of a value that spells out its type
+// syntactically: T{...}, &T{...}, new(T) and make(T, ...). It returns nil for any other
+// expression.
+func inferredType(value ast.Expr) ast.Expr {
+	switch value := value.(type) {
+	case *ast.CompositeLit:
+		return value.Type
+	case *ast.UnaryExpr:
+		if lit, isLit := value.X.(*ast.CompositeLit); isLit && value.Op == token.AND && lit.Type != nil {
+			return &ast.StarExpr{X: lit.Type}
+		}
+	case *ast.CallExpr:
+		fn, isIdent := value.Fun.(*ast.Ident)
+		if !isIdent || len(value.Args) == 0 {
+			break
+		}
+		switch {
+		case fn.Name == "new" && len(value.Args) == 1:
+			return &ast.StarExpr{X: value.Args[0]}
+		case fn.Name == "make":
+			return value.Args[0]
+		}
+	}
+	return nil
+}
+
+// declaredType returns the type of the variable with the given name, used at pos, as
+// declared in the innermost of the ancestors' scopes that declares it: a function's
+// parameters, a block's var and := statements before pos, or a file's package-level vars.
+// It returns nil if the variable is not found or its type cannot be inferred
+// syntactically (see inferredType).
+func declaredType(name string, pos token.Pos, ancestors []ast.Node) ast.Expr {
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		var typ ast.Expr
+		found := false
+		switch node := ancestors[i].(type) {
+		case *ast.BlockStmt:
+			for _, stmt := range node.List {
+				if stmt.Pos() >= pos {
+					break // declared later, if at all, so not in scope at pos
+				}
+				switch stmt := stmt.(type) {
+				case *ast.DeclStmt:
+					typ, found = specsType(name, stmt.Decl)
+				case *ast.AssignStmt:
+					typ, found = assignType(name, stmt)
+				}
+				if found {
+					break
+				}
+			}
+		case *ast.FuncDecl:
+			typ, found = paramsType(name, node.Recv, node.Type.Params, node.Type.Results)
+		case *ast.FuncLit:
+			typ, found = paramsType(name, node.Type.Params, node.Type.Results)
+		case *ast.File:
+			for _, decl := range node.Decls {
+				if typ, found = specsType(name, decl); found {
+					break
+				}
+			}
+		}
+		if found {
+			return typ
+		}
+	}
+	return nil
+}
+
+// specsType looks up the type of the variable with the given name in a var declaration.
+func specsType(name string, decl ast.Decl) (ast.Expr, bool) {
+	gen, isGen := decl.(*ast.GenDecl)
+	if !isGen || gen.Tok != token.VAR {
+		return nil, false
+	}
+	for _, spec := range gen.Specs {
+		spec := spec.(*ast.ValueSpec)
+		for i, ident := range spec.Names {
+			if ident.Name != name {
+				continue
+			}
+			if spec.Type == nil && len(spec.Values) == len(spec.Names) {
+				return inferredType(spec.Values[i]), true
+			}
+			return spec.Type, true
+		}
+	}
+	return nil, false
+}
+
+// assignType looks up the type of the variable with the given name in a short variable
+// declaration.
+func assignType(name string, stmt *ast.AssignStmt) (ast.Expr, bool) {
+	if stmt.Tok != token.DEFINE {
+		return nil, false
+	}
+	for i, lhs := range stmt.Lhs {
+		if ident, isIdent := lhs.(*ast.Ident); isIdent && ident.Name == name {
+			if len(stmt.Rhs) == len(stmt.Lhs) {
+				return inferredType(stmt.Rhs[i]), true
+			}
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// paramsType looks up the type of the parameter with the given name in the field lists.
+func paramsType(name string, lists ...*ast.FieldList) (ast.Expr, bool) {
+	for _, list := range lists {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, ident := range field.Names {
+				if ident.Name == name {
+					return field.Type, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// constSpecValues returns the type and values of a constant spec. If the spec omits them,
+// they are taken from the closest preceding spec in decl that has values.
+func constSpecValues(spec *ast.ValueSpec, decl *ast.GenDecl) (ast.Expr, []ast.Expr) {
+	if len(spec.Values) > 0 || decl == nil {
+		return spec.Type, spec.Values
+	}
+	var typ ast.Expr
+	var values []ast.Expr
+	for _, s := range decl.Specs {
+		if s == spec {
+			break
+		}
+		if vs := s.(*ast.ValueSpec); len(vs.Values) > 0 {
+			typ, values = vs.Type, vs.Values
+		}
+	}
+	return typ, values
+}
+
+// refersToIota reports whether any of the expressions mentions iota.
+func refersToIota(exprs []ast.Expr) bool {
+	found := false
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(node ast.Node) bool {
+			if ident, isIdent := node.(*ast.Ident); isIdent && ident.Name == "iota" {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// anyNameMatches reports whether any of the identifiers' names matches pattern.
+func anyNameMatches(names []*ast.Ident, pattern *regexp.Regexp) bool {
+	for _, name := range names {
+		if pattern.MatchString(name.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const declTestSrc = `package p
+
+import "time"
+
+type Color int
+
+const (
+	Red Color = iota
+	Green
+	Blue
+)
+
+const (
+	DefaultTimeout time.Duration = 30 * time.Second
+	maxRetries                   = 3
+)
+
+var notAConst = 1
+
+var (
+	mu    sync.Mutex
+	buf   = &bytes.Buffer{}
+	count int
+)
+
+func run() {
+	lock := sync.Mutex{}
+	out := new(bytes.Buffer)
+	n, err := 0, error(nil)
+	n = 1
+	seen := make(map[string]bool, 8)
+	jobs := make(chan int)
+}
+`
+
+func TestConstDeclFilter(t *testing.T) {
+	file := parseTestFile(t, declTestSrc)
+
+	testcases := []struct {
+		filter ConstDeclFilter
+		exp    []string
+	}{
+		{ConstDeclFilter{}, []string{"Red", "Green", "Blue", "DefaultTimeout", "maxRetries"}},
+		{ConstDeclFilter{UsesIota: true}, []string{"Red", "Green", "Blue"}},
+		{ConstDeclFilter{Type: "Color"}, []string{"Red", "Green", "Blue"}},
+		{ConstDeclFilter{Type: "time.Duration"}, []string{"DefaultTimeout"}},
+		{ConstDeclFilter{Pattern: regexp.MustCompile(`^[a-z]`)}, []string{"maxRetries"}},
+	}
+	for _, test := range testcases {
+		specs := Find([]ast.Node{file}, test.filter)
+		if names := specNames(specs); !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v: expected specs %v, but got %v", test.filter, test.exp, names)
+		}
+	}
+}
+
+func TestVarDeclFilter(t *testing.T) {
+	file := parseTestFile(t, declTestSrc)
+
+	testcases := []struct {
+		filter VarDeclFilter
+		exp    []string
+	}{
+		{VarDeclFilter{}, []string{"notAConst", "mu", "buf", "count", "lock", "out", "n", "seen", "jobs"}},
+		{VarDeclFilter{Type: "sync.Mutex"}, []string{"mu", "lock"}},
+		{VarDeclFilter{Type: "*bytes.Buffer"}, []string{"buf", "out"}},
+		{VarDeclFilter{Type: "map[string]bool"}, []string{"seen"}},
+		{VarDeclFilter{Type: "chan int"}, []string{"jobs"}},
+		{VarDeclFilter{Pattern: regexp.MustCompile(`^err$`)}, []string{"n"}},
+	}
+	for _, test := range testcases {
+		decls := Find([]ast.Node{file}, test.filter)
+		if names := declNames(decls); !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v: expected declarations %v, but got %v", test.filter, test.exp, names)
+		}
+	}
+}
+
+func TestEntryPointFilter(t *testing.T) {
+	mainFile := parseTestFile(t, `package main
+
+func init() {}
+func init() {}
+
+func main() {}
+
+type app struct{}
+
+func (a *app) init() {}
+`)
+	libFile := parseTestFile(t, `package lib
+
+func init() {}
+
+func main() {}
+
+func initialize() {}
+`)
+
+	testcases := []struct {
+		filter EntryPointFilter
+		file   *ast.File
+		exp    []string
+	}{
+		{EntryPointFilter{}, mainFile, []string{"init", "init", "main"}},
+		{EntryPointFilter{Funcs: InitFuncs}, mainFile, []string{"init", "init"}},
+		{EntryPointFilter{Funcs: MainFunc}, mainFile, []string{"main"}},
+		{EntryPointFilter{}, libFile, []string{"init"}},
+		{EntryPointFilter{Funcs: MainFunc}, libFile, nil},
+	}
+	for _, test := range testcases {
+		funcs := Find([]ast.Node{test.file}, test.filter)
+		if names := funcNames(funcs); !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v in package %s: expected functions %v, but got %v", test.filter, test.file.Name.Name, test.exp, names)
+		}
+	}
+}
+
+func TestTestFunctionFilter(t *testing.T) {
+	file := parseTestFile(t, `package p_test
+
+func TestParse(t *testing.T) {}
+func Test(t *testing.T)      {}
+func Testify(t *testing.T)   {}
+func TestHelper(s string)    {}
+func TestMain(m *testing.M)  {}
+
+func BenchmarkParse(b *testing.B) {}
+func FuzzParse(f *testing.F)      {}
+
+func Example()             {}
+func ExampleParse_second() {}
+func Example_suffix()      {}
+func Exampleparse()        {}
+func ExampleBad() int      { return 0 }
+`)
+
+	testcases := []struct {
+		filter TestFunctionFilter
+		exp    []string
+	}{
+		{TestFunctionFilter{}, []string{"TestParse", "Test", "BenchmarkParse", "FuzzParse", "Example", "ExampleParse_second", "Example_suffix"}},
+		{TestFunctionFilter{Kinds: TestFuncs}, []string{"TestParse", "Test"}},
+		{TestFunctionFilter{Kinds: BenchmarkFuncs | FuzzFuncs}, []string{"BenchmarkParse", "FuzzParse"}},
+		{TestFunctionFilter{Kinds: ExampleFuncs}, []string{"Example", "ExampleParse_second", "Example_suffix"}},
+	}
+	for _, test := range testcases {
+		funcs := Find([]ast.Node{file}, test.filter)
+		if names := funcNames(funcs); !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v: expected functions %v, but got %v", test.filter, test.exp, names)
+		}
+	}
+}
+
+// declNames returns the first name declared by each value spec or short variable
+// declaration node.
+func declNames(nodes []ast.Node) []string {
+	var names []string
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case *ast.ValueSpec:
+			names = append(names, node.Names[0].Name)
+		case *ast.AssignStmt:
+			names = append(names, node.Lhs[0].(*ast.Ident).Name)
+		}
+	}
+	return names
+}
+
+// specNames returns the first name of each value spec node.
+func specNames(nodes []ast.Node) []string {
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.(*ast.ValueSpec).Names[0].Name)
+	}
+	return names
+}
@@ -0,0 +1,219 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// RuleFunc is a group of rules written in Go, in the style of go-ruleguard, so that rules
+// live in plain Go code and are checked by the compiler:
+//
+//	func wrapErrors(m *astquery.Matcher) {
+//		m.Match(`errors.Wrap($err, $msg)`).
+//			Where(m.Var("msg").TextMatches(`^"`)).
+//			Report(`use fmt.Errorf to wrap $err`).
+//			Suggest(`fmt.Errorf($msg + ": %w", $err)`)
+//	}
+//
+// The rules are compiled by Rules and checked like those of a rule file.
+type RuleFunc func(m *Matcher)
+
+// Rules compiles the rules of rule functions. The ID of each rule is the name of the
+// function that defined it.
+func Rules(funcs ...RuleFunc) ([]*Rule, error) {
+	var rules []*Rule
+	for _, f := range funcs {
+		m := &Matcher{group: ruleFuncName(f)}
+		f(m)
+		for _, b := range m.builders {
+			if m.err == nil && b.rules != nil && b.rules[0].Message == "" {
+				m.errorf("Match(%s): expected a Report", b.patterns)
+			}
+			rules = append(rules, b.rules...)
+		}
+		if m.err != nil {
+			return nil, m.err
+		}
+	}
+	return rules, nil
+}
+
+// MustRules is like Rules but panics if the rules cannot be compiled.
+func MustRules(funcs ...RuleFunc) []*Rule {
+	rules, err := Rules(funcs...)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// ruleFuncName returns the name of a rule function, without its package path.
+func ruleFuncName(f RuleFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// Matcher defines the rules of a RuleFunc.
+type Matcher struct {
+	group    string
+	builders []*RuleBuilder
+
+	// err is the first error in the rules.
+	err error
+}
+
+func (m *Matcher) errorf(format string, args ...interface{}) {
+	if m.err == nil {
+		m.err = fmt.Errorf("rule %q: %s", m.group, fmt.Sprintf(format, args...))
+	}
+}
+
+// Match starts a rule matching any of the patterns, as written for CompilePattern.
+func (m *Matcher) Match(patterns ...string) *RuleBuilder {
+	b := &RuleBuilder{m: m, patterns: patterns}
+	m.builders = append(m.builders, b)
+	if len(patterns) == 0 {
+		m.errorf("Match: expected a pattern")
+	}
+	for _, src := range patterns {
+		pattern, err := CompilePattern(src)
+		if err != nil {
+			m.errorf("%v", err)
+			continue
+		}
+		b.rules = append(b.rules, &Rule{ID: m.group, Pattern: pattern})
+	}
+	return b
+}
+
+// Var refers to the node bound to a metavariable of the rule's patterns, for conditions.
+func (m *Matcher) Var(name string) Var {
+	return Var{m: m, name: name}
+}
+
+// RuleBuilder completes a rule started by Matcher.Match.
+type RuleBuilder struct {
+	m        *Matcher
+	patterns []string
+	rules    []*Rule
+}
+
+// Where adds a condition that matches must meet. Conditions of several calls must all be
+// met.
+func (b *RuleBuilder) Where(cond Cond) *RuleBuilder {
+	for _, rule := range b.rules {
+		if rule.Where != nil {
+			rule.Where = rule.Where.And(cond)
+		} else {
+			rule.Where = cond
+		}
+	}
+	return b
+}
+
+// Report sets the message reported for each match, which can refer to metavariables.
+func (b *RuleBuilder) Report(msg string) *RuleBuilder {
+	for _, rule := range b.rules {
+		rule.Message = msg
+	}
+	return b
+}
+
+// Suggest sets the replacement for matched nodes, which can refer to metavariables.
+func (b *RuleBuilder) Suggest(fix string) *RuleBuilder {
+	for _, rule := range b.rules {
+		rule.Fix = fix
+	}
+	return b
+}
+
+// Severity sets the severity of the rule's findings.
+func (b *RuleBuilder) Severity(severity string) *RuleBuilder {
+	for _, rule := range b.rules {
+		rule.Severity = severity
+	}
+	return b
+}
+
+// Cond is a condition on the matches of a rule.
+type Cond func(match Match) bool
+
+// And returns a condition met when both c and other are.
+func (c Cond) And(other Cond) Cond {
+	return func(match Match) bool { return c(match) && other(match) }
+}
+
+// Or returns a condition met when either c or other is.
+func (c Cond) Or(other Cond) Cond {
+	return func(match Match) bool { return c(match) || other(match) }
+}
+
+// Not returns a condition met when c is not.
+func Not(c Cond) Cond {
+	return func(match Match) bool { return !c(match) }
+}
+
+// Var is a metavariable of a rule, as returned by Matcher.Var. Conditions on a
+// metavariable that is not bound are not met.
+type Var struct {
+	m    *Matcher
+	name string
+}
+
+// node returns the node bound to the metavariable in match, or nil.
+func (v Var) node(match Match) ast.Node {
+	return match.Bindings[v.name]
+}
+
+// TextMatches returns a condition met when the source of the node matches the regular
+// expression re.
+func (v Var) TextMatches(re string) Cond {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		v.m.errorf("%s: %v", v.name, err)
+		return func(Match) bool { return false }
+	}
+	return func(match Match) bool {
+		node := v.node(match)
+		return node != nil && r.MatchString(bindingSource(node, match))
+	}
+}
+
+// Matches returns a condition met when the node matches filter.
+func (v Var) Matches(filter Filter) Cond {
+	return func(match Match) bool {
+		node := v.node(match)
+		return node != nil && filter.Filter(node)
+	}
+}
+
+// TypeIs returns a condition met when the node is an expression of the given type,
+// written with full package paths as for ExprTypeFilter. It is never met in packages
+// loaded without type information.
+func (v Var) TypeIs(typ string) Cond {
+	return func(match Match) bool {
+		expr, isExpr := v.node(match).(ast.Expr)
+		if !isExpr || match.Pkg.Typed == nil {
+			return false
+		}
+		tv, isTyped := match.Pkg.Typed.Info.Types[expr]
+		return isTyped && tv.Type != nil && typeIs(match.Pkg.Typed, tv.Type, typ)
+	}
+}
+
+// Const returns a condition met when the node is a constant expression. It is never met
+// in packages loaded without type information.
+func (v Var) Const() Cond {
+	return func(match Match) bool {
+		expr, isExpr := v.node(match).(ast.Expr)
+		if !isExpr || match.Pkg.Typed == nil {
+			return false
+		}
+		tv := match.Pkg.Typed.Info.Types[expr]
+		return tv.Value != nil
+	}
+}
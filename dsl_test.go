@@ -0,0 +1,81 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const dslSrc = `package p
+
+type ID string
+
+func use(s string, id ID, n int) {}
+
+func f(id ID, n int) {
+	use("a", id, 1)
+	use(string(id), id, len("ab"))
+	use(string(id), "b", n)
+}
+`
+
+func convertedIDs(m *Matcher) {
+	m.Match(`use($s, $id, $_)`).
+		Where(m.Var("s").TextMatches(`^string\(`).And(Not(m.Var("id").Const()))).
+		Report(`$s converts $id back`).
+		Suggest(`use(string($id), $id, 0)`).
+		Severity("warning")
+}
+
+func variableCounts(m *Matcher) {
+	m.Match(`use($_, $_, $n)`, `len($n)`).
+		Where(Not(m.Var("n").Const()).And(m.Var("n").TypeIs("int"))).
+		Where(m.Var("n").Matches(FilterFunc(func(node ast.Node) bool { _, isIdent := node.(*ast.Ident); return isIdent }))).
+		Report(`$n is not constant`)
+}
+
+func TestRules(t *testing.T) {
+	rules, err := Rules(convertedIDs, variableCounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := ParseSource("p.go", []byte(dslSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Typed, err = NewTypedPackage("p", pkg.Fset, pkg.Files, &types.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, finding := range (&Workspace{Packages: []*Package{pkg}}).Check(rules...) {
+		got = append(got, fmt.Sprintf("%s: %s %s: %q %q", finding.Match.Position(), finding.Rule.ID, finding.Rule.Severity, finding.Message, finding.Fix))
+	}
+	exp := []string{
+		`p.go:9:2: convertedIDs warning: "string(id) converts id back" "use(string(id), id, 0)"`,
+		`p.go:10:2: variableCounts : "n is not constant" ""`,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %q, but got %q", exp, got)
+	}
+}
+
+func TestRulesErrors(t *testing.T) {
+	testcases := []struct {
+		f   RuleFunc
+		err string
+	}{
+		{func(m *Matcher) { m.Match(`f($)`).Report("r") }, `pattern "f($)": offset 2`},
+		{func(m *Matcher) { m.Match().Report("r") }, "Match: expected a pattern"},
+		{func(m *Matcher) { m.Match(`f($x)`).Where(m.Var("x").TextMatches("(")).Report("r") }, "x: error parsing regexp"},
+		{func(m *Matcher) { m.Match(`f($x)`, `g($x)`) }, "Match([f($x) g($x)]): expected a Report"},
+	}
+	for _, test := range testcases {
+		_, err := Rules(test.f)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.err, test.err, err)
+		}
+	}
+}
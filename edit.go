@@ -0,0 +1,476 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+)
+
+// Replace replaces the nodes matching filter in the trees of nodes, in place, with the
+// nodes that replace returns for them, and returns the roots, with those that matched
+// replaced. As with Find, the descendants of a matched node are not searched, so
+// replace is given whole subtrees to rewrite. If replace returns its argument, the node
+// is left as is; if it returns nil, the node is deleted from the list it is an element
+// of, such as the statements of a block, or else the field holding it is cleared: to
+// delete a call statement, the ExprStmt rather than the CallExpr must be replaced.
+//
+// Like astutil.Apply, Replace panics if a replacement is not of a type the field holding
+// the node can hold, such as a statement in place of an expression.
+func Replace(nodes []ast.Node, filter Filter, replace func(node ast.Node) ast.Node) []ast.Node {
+	roots := make([]ast.Node, 0, len(nodes))
+	for _, root := range nodes {
+		f := &parentRecorder{filter: filter, parents: make(map[ast.Node]ast.Node)}
+		for _, node := range find(root, f) {
+			replacement := replace(node)
+			if replacement == node {
+				continue
+			}
+			if node == root {
+				root = replacement
+				continue
+			}
+			replaceChild(f.parents[node], node, replacement)
+		}
+		if root != nil {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// parentRecorder is a filter recording the parents of the nodes matching another filter.
+type parentRecorder struct {
+	filter  Filter
+	parents map[ast.Node]ast.Node
+}
+
+func (f *parentRecorder) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f *parentRecorder) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	if !filterNode(f.filter, node, ancestors) {
+		return false
+	}
+	f.parents[node] = parent(ancestors)
+	return true
+}
+
+// replaceChild replaces node with replacement in the fields of parent, deleting it from
+// the list it is an element of if replacement is nil. It panics if replacement can't be
+// assigned to a field holding node.
+func replaceChild(parent, node, replacement ast.Node) {
+	set := func(v reflect.Value) {
+		if replacement == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		r := reflect.ValueOf(replacement)
+		if !r.Type().AssignableTo(v.Type()) {
+			panic(fmt.Sprintf("astquery: cannot use %T in place of %T in %T", replacement, node, parent))
+		}
+		v.Set(r)
+	}
+	v := reflect.ValueOf(parent).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if !field.IsNil() && field.Interface() == node {
+				set(field)
+			}
+		case reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				elem := field.Index(j)
+				if elem.Kind() != reflect.Interface && elem.Kind() != reflect.Ptr || elem.IsNil() || elem.Interface() != node {
+					continue
+				}
+				if replacement == nil {
+					field.Set(reflect.AppendSlice(field.Slice(0, j), field.Slice(j+1, field.Len())))
+					j--
+				} else {
+					set(elem)
+				}
+			}
+		}
+	}
+}
+
+// Delete deletes a matched node from its package's AST, in place. The node can be a
+// declaration, a spec of one, a name of a value spec, a field of a struct or a method of
+// an interface, or a statement in a list of statements or in an optional part of an
+// if, for or switch statement, such as the init statement of an if. The AST is repaired
+// around it: a declaration or DeclStmt left without specs is deleted too, as is a value
+// spec left without names, the value of a deleted name is deleted along with it, and
+// deleted imports are removed from the file's imports. The comments of the deleted nodes
+// are removed from the file. Deleting a constant whose expression the next one repeats
+// implicitly moves the expression to the next one.
+//
+// Delete returns an error, leaving the AST as it was, for other nodes and where the
+// deletion would leave invalid syntax, such as the body of an if, the statement of a
+// labeled statement, a receiver or a name whose value is one of several results of a
+// call, and where it would change the value of other constants, through iota.
+func Delete(match Match) error {
+	file, ancestors := match.Pkg.nodePath(match.Node)
+	if file == nil {
+		return fmt.Errorf("%T not found in package %s", match.Node, match.Pkg.Name)
+	}
+	deleted, err := deleteNode(file, ancestors, match.Node)
+	if err != nil {
+		return fmt.Errorf("%s: %v", match.Position(), err)
+	}
+	deleteComments(file, deleted)
+	return nil
+}
+
+// nodePath returns the file of p containing node, along with the ancestors of node in it,
+// or nil if node isn't in p.
+func (p *Package) nodePath(node ast.Node) (*ast.File, []ast.Node) {
+	for _, file := range p.Files {
+		var path, ancestors []ast.Node
+		found := false
+		ast.Inspect(file, func(n ast.Node) bool {
+			if found || n == nil {
+				if n == nil && !found {
+					ancestors = ancestors[:len(ancestors)-1]
+				}
+				return false
+			}
+			if n == node {
+				path, found = append([]ast.Node(nil), ancestors...), true
+				return false
+			}
+			if n.Pos() > node.Pos() || n.End() < node.End() {
+				return false
+			}
+			ancestors = append(ancestors, n)
+			return true
+		})
+		if found {
+			return file, path
+		}
+	}
+	return nil, nil
+}
+
+// deleteNode deletes node, with the given ancestors, from file, returning the node that
+// was removed from its parent, which is an ancestor of node if the parent can't be left
+// without it.
+func deleteNode(file *ast.File, ancestors []ast.Node, node ast.Node) (ast.Node, error) {
+	p := parent(ancestors)
+	if p == nil {
+		return nil, fmt.Errorf("cannot delete a %T without a parent", node)
+	}
+	outer := ancestors[:len(ancestors)-1]
+	switch node := node.(type) {
+	case *ast.Ident:
+		spec, isSpec := p.(*ast.ValueSpec)
+		if !isSpec {
+			break
+		}
+		i := identIndex(spec.Names, node)
+		if i < 0 {
+			break
+		}
+		if len(spec.Names) == 1 {
+			return deleteNode(file, outer, spec)
+		}
+		if len(spec.Values) > 0 && len(spec.Values) != len(spec.Names) {
+			return nil, fmt.Errorf("cannot delete %s: its value is one of several results", node.Name)
+		}
+		if decl, isDecl := parent(outer).(*ast.GenDecl); isDecl && repeatsValues(decl, spec) {
+			return nil, fmt.Errorf("cannot delete %s: the constants after it repeat its values", node.Name)
+		}
+		spec.Names = append(spec.Names[:i], spec.Names[i+1:]...)
+		if len(spec.Values) > 0 {
+			spec.Values = append(spec.Values[:i], spec.Values[i+1:]...)
+		}
+		return node, nil
+	case ast.Spec:
+		decl := p.(*ast.GenDecl)
+		if len(decl.Specs) == 1 {
+			return deleteNode(file, outer, decl)
+		}
+		if decl.Tok == token.CONST {
+			if err := deleteConst(decl, node.(*ast.ValueSpec)); err != nil {
+				return nil, err
+			}
+		}
+		replaceChild(decl, node, nil)
+		replaceChild(file, node, nil)
+		return node, nil
+	case ast.Decl:
+		if stmt, isStmt := p.(*ast.DeclStmt); isStmt {
+			return deleteNode(file, outer, stmt)
+		}
+		if decl, isGen := node.(*ast.GenDecl); isGen {
+			for _, spec := range decl.Specs {
+				replaceChild(file, spec, nil)
+			}
+		}
+		replaceChild(p, node, nil)
+		return node, nil
+	case *ast.Field:
+		switch parent(outer).(type) {
+		case *ast.StructType, *ast.InterfaceType:
+			replaceChild(p, node, nil)
+			return node, nil
+		}
+	case ast.Stmt:
+		if !isOptionalStmt(p, node) {
+			break
+		}
+		replaceChild(p, node, nil)
+		return node, nil
+	}
+	return nil, fmt.Errorf("cannot delete a %T from a %T", node, p)
+}
+
+// deleteConst prepares the deletion of spec from a const declaration: the constants after
+// it mustn't depend on iota, which the deletion would decrement, and if the spec after it
+// repeats its values implicitly, they're moved there.
+func deleteConst(decl *ast.GenDecl, spec *ast.ValueSpec) error {
+	i := specIndex(decl, spec)
+	var values []ast.Expr // the values of the spec, written or repeated
+	for j, s := range decl.Specs {
+		s := s.(*ast.ValueSpec)
+		if len(s.Values) > 0 {
+			values = s.Values
+		}
+		if j > i && usesIota(values) {
+			return fmt.Errorf("cannot delete %s: the value of %s depends on its position", spec.Names[0].Name, s.Names[0].Name)
+		}
+	}
+	if repeatsValues(decl, spec) {
+		next := decl.Specs[i+1].(*ast.ValueSpec)
+		next.Type, next.Values = spec.Type, spec.Values
+	}
+	return nil
+}
+
+// repeatsValues reports whether the spec after spec in a const declaration repeats its
+// values implicitly.
+func repeatsValues(decl *ast.GenDecl, spec *ast.ValueSpec) bool {
+	i := specIndex(decl, spec)
+	if decl.Tok != token.CONST || len(spec.Values) == 0 || i+1 >= len(decl.Specs) {
+		return false
+	}
+	return len(decl.Specs[i+1].(*ast.ValueSpec).Values) == 0
+}
+
+func specIndex(decl *ast.GenDecl, spec ast.Spec) int {
+	for i, s := range decl.Specs {
+		if s == spec {
+			return i
+		}
+	}
+	return -1
+}
+
+// usesIota reports whether iota appears in exprs.
+func usesIota(exprs []ast.Expr) bool {
+	found := false
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(node ast.Node) bool {
+			if ident, isIdent := node.(*ast.Ident); isIdent && ident.Name == "iota" {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// isOptionalStmt reports whether stmt, a child of parent, is an element of a list of
+// statements or an optional part of parent.
+func isOptionalStmt(parent ast.Node, stmt ast.Stmt) bool {
+	switch parent := parent.(type) {
+	case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+		return true
+	case *ast.IfStmt:
+		return stmt == parent.Init || stmt == parent.Else
+	case *ast.ForStmt:
+		return stmt == parent.Init || stmt == parent.Post
+	case *ast.SwitchStmt:
+		return stmt == parent.Init
+	case *ast.TypeSwitchStmt:
+		return stmt == parent.Init
+	}
+	return false
+}
+
+func identIndex(idents []*ast.Ident, ident *ast.Ident) int {
+	for i, id := range idents {
+		if id == ident {
+			return i
+		}
+	}
+	return -1
+}
+
+// deleteComments removes the comments of a deleted node from file: those in its source
+// range, including its doc comment and line comment.
+func deleteComments(file *ast.File, node ast.Node) {
+	start, end := node.Pos(), node.End()
+	if doc, hasDoc := getStructField(node, "Doc"); hasDoc {
+		if doc, _ := doc.(*ast.CommentGroup); doc != nil {
+			start = doc.Pos()
+		}
+	}
+	if comment, hasComment := getStructField(node, "Comment"); hasComment {
+		if comment, _ := comment.(*ast.CommentGroup); comment != nil {
+			end = comment.End()
+		}
+	}
+	comments := file.Comments[:0]
+	for _, group := range file.Comments {
+		if group.Pos() < start || group.End() > end {
+			comments = append(comments, group)
+		}
+	}
+	file.Comments = comments
+}
+
+// InsertBefore inserts nodes immediately before a matched node, in place. The nodes are
+// inserted before the statement or declaration enclosing the matched node in a list of
+// them, so that a statement can be inserted before every matched call, for example:
+// before its statement in a block, or before its declaration in a file.
+//
+// In a block, the nodes must be statements or declarations other than imports and
+// functions, which are inserted as DeclStmts; in the body of a switch or select
+// statement, they must be case or comm clauses. Among a file's declarations, they must be
+// declarations, with imports before the others. InsertBefore returns an error, leaving
+// the AST as it was, if a node can't be inserted where the match is.
+func InsertBefore(match Match, nodes ...ast.Node) error {
+	return insert(match, 0, nodes)
+}
+
+// InsertAfter is like InsertBefore, inserting the nodes immediately after the statement
+// or declaration enclosing the matched node.
+func InsertAfter(match Match, nodes ...ast.Node) error {
+	return insert(match, 1, nodes)
+}
+
+// insert inserts nodes at offset from the statement or declaration enclosing a match.
+func insert(match Match, offset int, nodes []ast.Node) error {
+	file, ancestors := match.Pkg.nodePath(match.Node)
+	if file == nil {
+		return fmt.Errorf("%T not found in package %s", match.Node, match.Pkg.Name)
+	}
+	err := fmt.Errorf("cannot insert next to a %T", match.Node)
+	for node := match.Node; len(ancestors) > 0; node, ancestors = parent(ancestors), ancestors[:len(ancestors)-1] {
+		if list := stmtList(parent(ancestors)); list != nil {
+			if i := stmtIndex(*list, node); i >= 0 {
+				err = insertStmts(list, i+offset, ancestors, nodes)
+				break
+			}
+		}
+		if _, isFile := parent(ancestors).(*ast.File); isFile {
+			if decl, isDecl := node.(ast.Decl); isDecl {
+				err = insertDecls(file, decl, offset, nodes)
+			}
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", match.Position(), err)
+	}
+	return nil
+}
+
+// stmtList returns the list of statements of node, or nil if it has none.
+func stmtList(node ast.Node) *[]ast.Stmt {
+	switch node := node.(type) {
+	case *ast.BlockStmt:
+		return &node.List
+	case *ast.CaseClause:
+		return &node.Body
+	case *ast.CommClause:
+		return &node.Body
+	}
+	return nil
+}
+
+func stmtIndex(list []ast.Stmt, node ast.Node) int {
+	for i, stmt := range list {
+		if stmt == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertStmts inserts nodes at index i of a list of statements, whose ancestors are the
+// ancestors of the statements.
+func insertStmts(list *[]ast.Stmt, i int, ancestors []ast.Node, nodes []ast.Node) error {
+	var clauses reflect.Type
+	if len(ancestors) > 1 {
+		switch ancestors[len(ancestors)-2].(type) {
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			clauses = reflect.TypeOf(&ast.CaseClause{})
+		case *ast.SelectStmt:
+			clauses = reflect.TypeOf(&ast.CommClause{})
+		}
+	}
+	stmts := make([]ast.Stmt, len(nodes))
+	for j, node := range nodes {
+		switch node := node.(type) {
+		case *ast.CaseClause, *ast.CommClause:
+			if reflect.TypeOf(node) == clauses {
+				stmts[j] = node.(ast.Stmt)
+			}
+		case ast.Stmt:
+			if clauses == nil {
+				stmts[j] = node
+			}
+		case *ast.GenDecl:
+			if clauses == nil && node.Tok != token.IMPORT {
+				stmts[j] = &ast.DeclStmt{Decl: node}
+			}
+		}
+		if stmts[j] == nil {
+			return fmt.Errorf("cannot insert a %T into a %T", node, parent(ancestors))
+		}
+	}
+	*list = append((*list)[:i], append(stmts, (*list)[i:]...)...)
+	return nil
+}
+
+// insertDecls inserts nodes at offset from decl among the declarations of file.
+func insertDecls(file *ast.File, decl ast.Decl, offset int, nodes []ast.Node) error {
+	i := offset
+	for j, d := range file.Decls {
+		if d == decl {
+			i += j
+		}
+	}
+	decls := make([]ast.Decl, len(nodes))
+	var imports []*ast.ImportSpec
+	for j, node := range nodes {
+		d, isDecl := node.(ast.Decl)
+		if !isDecl {
+			return fmt.Errorf("cannot insert a %T among declarations", node)
+		}
+		// Imports must precede the other declarations.
+		if isImportDecl(d) {
+			if i > 0 && !isImportDecl(file.Decls[i-1]) || j > 0 && !isImportDecl(decls[j-1]) {
+				return fmt.Errorf("cannot insert imports after other declarations")
+			}
+			for _, spec := range d.(*ast.GenDecl).Specs {
+				imports = append(imports, spec.(*ast.ImportSpec))
+			}
+		} else if i < len(file.Decls) && isImportDecl(file.Decls[i]) {
+			return fmt.Errorf("cannot insert a %T before imports", node)
+		}
+		decls[j] = d
+	}
+	file.Decls = append(file.Decls[:i], append(decls, file.Decls[i:]...)...)
+	file.Imports = append(file.Imports, imports...)
+	return nil
+}
+
+func isImportDecl(decl ast.Decl) bool {
+	gen, isGen := decl.(*ast.GenDecl)
+	return isGen && gen.Tok == token.IMPORT
+}
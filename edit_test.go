@@ -0,0 +1,366 @@
+package astquery
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const editSrc = `package p
+
+func f(x int) int {
+	log.Println("f", x)
+	y := x + 1
+	log.Println("y", y)
+	return y * 2
+}
+`
+
+// fileSource formats a file parsed by parseTestFile.
+func fileSource(t *testing.T, file ast.Node) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), file); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// pkgSource formats the file of a package parsed by ParseSource.
+func pkgSource(t *testing.T, pkg *Package) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, pkg.Fset, pkg.Files[0]); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestReplace(t *testing.T) {
+	testcases := []struct {
+		name    string
+		filter  Filter
+		replace func(node ast.Node) ast.Node
+		exp     string
+	}{
+		{
+			"expressions",
+			MustCompileQuery(`//BinaryExpr`),
+			func(node ast.Node) ast.Node {
+				expr := node.(*ast.BinaryExpr)
+				return &ast.CallExpr{Fun: ast.NewIdent("add"), Args: []ast.Expr{expr.X, expr.Y}}
+			},
+			"y := add(x, 1)\n\tlog.Println(\"y\", y)\n\treturn add(y, 2)",
+		},
+		{
+			"deleted statements",
+			MustCompileQuery(`//ExprStmt`),
+			func(node ast.Node) ast.Node { return nil },
+			"{\n\ty := x + 1\n\treturn y * 2\n}",
+		},
+		{
+			"unchanged nodes",
+			MustCompileQuery(`//Ident`),
+			func(node ast.Node) ast.Node { return node },
+			editSrc,
+		},
+		{
+			"renamed identifiers",
+			MustCompileQuery(`//Ident[@name='y']`),
+			func(node ast.Node) ast.Node { return ast.NewIdent("sum") },
+			"sum := x + 1\n\tlog.Println(\"y\", sum)\n\treturn sum * 2",
+		},
+	}
+	for _, test := range testcases {
+		file := parseTestFile(t, editSrc)
+		roots := Replace([]ast.Node{file}, test.filter, test.replace)
+		if len(roots) != 1 || roots[0] != file {
+			t.Errorf("%s: expected the file as the root, but got %v", test.name, roots)
+			continue
+		}
+		if got := fileSource(t, file); !strings.Contains(got, test.exp) {
+			t.Errorf("%s: expected source containing %q, but got %q", test.name, test.exp, got)
+		}
+	}
+}
+
+func TestReplaceRoots(t *testing.T) {
+	file := parseTestFile(t, editSrc)
+	body := file.Decls[0].(*ast.FuncDecl).Body
+	ret := body.List[3]
+	roots := Replace([]ast.Node{body.List[0], ret}, MustCompileQuery(`/ReturnStmt`), func(node ast.Node) ast.Node { return nil })
+	if len(roots) != 1 || roots[0] != body.List[0] {
+		t.Errorf("expected the matching root to be deleted, but got %v", roots)
+	}
+	if body.List[3] != ret {
+		t.Error("expected the statements to be left as they were")
+	}
+}
+
+func TestReplacePanics(t *testing.T) {
+	defer func() {
+		exp := "astquery: cannot use *ast.ReturnStmt in place of *ast.BinaryExpr in *ast.AssignStmt"
+		if r := recover(); r != exp {
+			t.Errorf("expected panic %q, but got %v", exp, r)
+		}
+	}()
+	file := parseTestFile(t, editSrc)
+	Replace([]ast.Node{file}, MustCompileQuery(`//AssignStmt/BinaryExpr`), func(node ast.Node) ast.Node { return &ast.ReturnStmt{} })
+}
+
+const deleteSrc = `package p
+
+import (
+	"fmt"
+	"os"
+)
+
+// Limit is the limit.
+const Limit = 10
+
+var a, b, c = 1, 2, 3
+
+var x, y = pair()
+
+type T struct {
+	A int // the A
+	B string
+}
+
+func pair() (int, int) { return 1, 2 }
+
+func (t T) Run(n int) {
+	var unused = 1
+	if err := check(); err != nil {
+		fmt.Println(err)
+	}
+loop:
+	for i := 0; i < n; i++ {
+		continue loop
+	}
+}
+
+const (
+	X = 1
+	Y
+)
+
+const (
+	A = iota
+	B
+	C
+)
+
+const (
+	K, L = 1, 2
+	M, N
+)
+`
+
+// named returns a filter matching the nodes of the same type as kind named name, or
+// whose first name is name.
+func named(kind ast.Node, name string) Filter {
+	return FilterFunc(func(node ast.Node) bool {
+		if reflect.TypeOf(node) != reflect.TypeOf(kind) {
+			return false
+		}
+		if names, hasNames := getStructField(node, "Names"); hasNames {
+			idents := names.([]*ast.Ident)
+			return len(idents) > 0 && idents[0].Name == name
+		}
+		if ident, isIdent := node.(*ast.Ident); isIdent {
+			return ident.Name == name
+		}
+		got, _ := GetName(node)
+		return got == name
+	})
+}
+
+func TestDelete(t *testing.T) {
+	testcases := []struct {
+		name    string
+		filter  Filter
+		exp     []string
+		deleted []string
+	}{
+		{"import", FilterFunc(func(node ast.Node) bool {
+			spec, isImport := node.(*ast.ImportSpec)
+			return isImport && spec.Path.Value == `"os"`
+		}), []string{`"fmt"`}, []string{`"os"`}},
+		{"const", named(&ast.ValueSpec{}, "Limit"), nil, []string{"Limit", "10"}},
+		{"name", named(&ast.Ident{}, "b"), []string{"var a, c = 1, 3"}, nil},
+		{"func", named(&ast.FuncDecl{}, "pair"), []string{"var x, y = pair()"}, []string{"func pair"}},
+		{"field", named(&ast.Field{}, "A"), []string{"type T struct {\n\tB string\n}"}, []string{"A int", "the A"}},
+		{"decl stmt", named(&ast.ValueSpec{}, "unused"), []string{"\tif err := check(); err != nil {"}, []string{"unused"}},
+		{"if init", MustCompilePattern(`$x := check()`), []string{"\tif err != nil {"}, []string{"check"}},
+		{"for post", FilterFunc(func(node ast.Node) bool { _, isIncDec := node.(*ast.IncDecStmt); return isIncDec }), []string{"for i := 0; i < n; {"}, nil},
+		{"repeated const", named(&ast.ValueSpec{}, "X"), []string{"const (\n\tY = 1\n)"}, []string{"X"}},
+		{"last iota const", named(&ast.ValueSpec{}, "C"), []string{"A = iota\n\tB\n)"}, []string{"C"}},
+		{"branch", FilterFunc(func(node ast.Node) bool { _, isBranch := node.(*ast.BranchStmt); return isBranch }), []string{"for i := 0; i < n; i++ {"}, []string{"continue"}},
+	}
+	for _, test := range testcases {
+		pkg, err := ParseSource("p.go", []byte(deleteSrc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches := pkg.Find(test.filter)
+		if len(matches) == 0 {
+			t.Errorf("%s: no match", test.name)
+			continue
+		}
+		if err := Delete(matches[0]); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got := pkgSource(t, pkg)
+		for _, exp := range test.exp {
+			if !strings.Contains(got, exp) {
+				t.Errorf("%s: expected source containing %q, but got %q", test.name, exp, got)
+			}
+		}
+		for _, deleted := range test.deleted {
+			if strings.Contains(got, deleted) {
+				t.Errorf("%s: expected %q to be deleted, but got %q", test.name, deleted, got)
+			}
+		}
+	}
+}
+
+func TestDeleteErrors(t *testing.T) {
+	testcases := []struct {
+		filter Filter
+		err    string
+	}{
+		{named(&ast.Ident{}, "x"), "p.go:13:5: cannot delete x: its value is one of several results"},
+		{named(&ast.ValueSpec{}, "B"), "cannot delete B: the value of C depends on its position"},
+		{named(&ast.ValueSpec{}, "A"), "cannot delete A: the value of B depends on its position"},
+		{named(&ast.Ident{}, "K"), "cannot delete K: the constants after it repeat its values"},
+		{named(&ast.Field{}, "t"), "cannot delete a *ast.Field from a *ast.FieldList"},
+		{FilterFunc(func(node ast.Node) bool { _, isFor := node.(*ast.ForStmt); return isFor }), "cannot delete a *ast.ForStmt from a *ast.LabeledStmt"},
+		{FilterFunc(func(node ast.Node) bool { _, isLit := node.(*ast.BasicLit); return isLit }), "p.go:4:2: cannot delete a *ast.BasicLit from a *ast.ImportSpec"},
+		{FilterFunc(func(node ast.Node) bool { _, isFile := node.(*ast.File); return isFile }), "cannot delete a *ast.File without a parent"},
+	}
+	for _, test := range testcases {
+		pkg, err := ParseSource("p.go", []byte(deleteSrc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := pkgSource(t, pkg)
+		err = Delete(pkg.Find(test.filter)[0])
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.err, test.err, err)
+		}
+		if after := pkgSource(t, pkg); after != before {
+			t.Errorf("%s: expected the source to be left as it was, but got %q", test.err, after)
+		}
+	}
+}
+
+const insertSrc = `package p
+
+import "fmt"
+
+func run(items []string) {
+	for _, item := range items {
+		process(item)
+	}
+	switch len(items) {
+	case 0:
+		fmt.Println("none")
+	}
+}
+
+func process(item string) {}
+`
+
+func TestInsert(t *testing.T) {
+	stmt := func(src string) ast.Node {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &ast.ExprStmt{X: expr}
+	}
+	decl := func(src string) ast.Node {
+		file, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return file.Decls[0]
+	}
+	clause := FilterFunc(func(node ast.Node) bool { _, isClause := node.(*ast.CaseClause); return isClause })
+	testcases := []struct {
+		name   string
+		insert func(match Match, nodes ...ast.Node) error
+		filter Filter
+		nodes  []ast.Node
+		exp    string
+	}{
+		{"call site", InsertBefore, MustCompilePattern(`process($x)`), []ast.Node{stmt(`fmt.Println("processing", item)`)},
+			"\t\tfmt.Println(\"processing\", item)\n\t\tprocess(item)\n"},
+		{"after call site", InsertAfter, MustCompilePattern(`process($x)`), []ast.Node{stmt(`a()`), stmt(`b()`)},
+			"\t\tprocess(item)\n\t\ta()\n\t\tb()\n"},
+		{"clause body", InsertBefore, MustCompilePattern(`fmt.Println("none")`), []ast.Node{stmt(`a()`)},
+			"\tcase 0:\n\t\ta()\n\t\tfmt.Println(\"none\")\n"},
+		{"clause", InsertAfter, clause, []ast.Node{&ast.CaseClause{Body: []ast.Stmt{stmt(`a()`).(ast.Stmt)}}},
+			"\t\tfmt.Println(\"none\")\n\tdefault:\n\t\ta()\n\t}\n"},
+		{"decl stmt", InsertBefore, MustCompilePattern(`process($x)`), []ast.Node{decl(`var n int`)},
+			"\t\tvar n int\n\t\tprocess(item)\n"},
+		{"decl", InsertAfter, named(&ast.FuncDecl{}, "process"), []ast.Node{decl(`func extra() {}`)},
+			"func process(item string) {\n}\nfunc extra() {\n}\n"},
+		{"decl before", InsertBefore, named(&ast.FuncDecl{}, "run"), []ast.Node{decl(`const max = 1`)},
+			"const max = 1\n\nfunc run("},
+		{"import", InsertAfter, MustCompileQuery(`/File/GenDecl`), []ast.Node{decl(`import "os"`)},
+			"import \"fmt\"\nimport \"os\"\n"},
+	}
+	for _, test := range testcases {
+		pkg, err := ParseSource("p.go", []byte(insertSrc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := test.insert(pkg.Find(test.filter)[0], test.nodes...); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := fileSource(t, pkg.Files[0]); !strings.Contains(got, test.exp) {
+			t.Errorf("%s: expected source containing %q, but got %q", test.name, test.exp, got)
+		}
+	}
+}
+
+func TestInsertErrors(t *testing.T) {
+	fn := &ast.FuncDecl{Name: ast.NewIdent("f"), Type: &ast.FuncType{Params: &ast.FieldList{}}}
+	imp := &ast.GenDecl{Tok: token.IMPORT, Specs: []ast.Spec{&ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: `"os"`}}}}
+	call := &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("f")}}
+	testcases := []struct {
+		insert func(match Match, nodes ...ast.Node) error
+		filter Filter
+		node   ast.Node
+		err    string
+	}{
+		{InsertBefore, MustCompilePattern(`process($x)`), fn, "p.go:7:3: cannot insert a *ast.FuncDecl into a *ast.BlockStmt"},
+		{InsertBefore, FilterFunc(func(node ast.Node) bool { _, isClause := node.(*ast.CaseClause); return isClause }), call, "cannot insert a *ast.ExprStmt into a *ast.BlockStmt"},
+		{InsertBefore, MustCompilePattern(`process($x)`), &ast.CaseClause{}, "cannot insert a *ast.CaseClause into a *ast.BlockStmt"},
+		{InsertAfter, named(&ast.FuncDecl{}, "process"), call, "cannot insert a *ast.ExprStmt among declarations"},
+		{InsertAfter, named(&ast.FuncDecl{}, "run"), imp, "cannot insert imports after other declarations"},
+		{InsertBefore, MustCompileQuery(`/File/GenDecl`), fn, "cannot insert a *ast.FuncDecl before imports"},
+		{InsertBefore, FilterFunc(func(node ast.Node) bool { _, isFile := node.(*ast.File); return isFile }), call, "cannot insert next to a *ast.File"},
+	}
+	for _, test := range testcases {
+		pkg, err := ParseSource("p.go", []byte(insertSrc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := fileSource(t, pkg.Files[0])
+		err = test.insert(pkg.Find(test.filter)[0], test.node)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.err, test.err, err)
+		}
+		if after := fileSource(t, pkg.Files[0]); after != before {
+			t.Errorf("%s: expected the source to be left as it was, but got %q", test.err, after)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strconv"
+)
+
+// LiteralFilter matches basic literals (*ast.BasicLit) by kind and value.
+type LiteralFilter struct {
+	// Kind is the kind of literal to filter for (token.INT, token.FLOAT, token.IMAG,
+	// token.CHAR or token.STRING). The zero value, token.ILLEGAL, matches any kind.
+	Kind token.Token
+
+	// Pattern, if non-nil, is a regular expression the literal's value must match. String
+	// and character literals are unquoted before matching.
+	Pattern *regexp.Regexp
+
+	// Min and Max, if non-nil, are inclusive bounds on the numeric value of the
+	// literal. Only integer and floating-point literals match when either is set.
+	Min, Max *float64
+}
+
+func (f LiteralFilter) Filter(node ast.Node) bool {
+	lit, isLit := node.(*ast.BasicLit)
+	if !isLit {
+		return false
+	}
+	if f.Kind != token.ILLEGAL && lit.Kind != f.Kind {
+		return false
+	}
+	if f.Pattern != nil && !f.Pattern.MatchString(literalValue(lit)) {
+		return false
+	}
+	if f.Min != nil || f.Max != nil {
+		val, isNum := numericValue(lit)
+		if !isNum {
+			return false
+		}
+		if f.Min != nil && val < *f.Min {
+			return false
+		}
+		if f.Max != nil && val > *f.Max {
+			return false
+		}
+	}
+	return true
+}
+
+// ChannelOperationFilter matches channel operations: sends (*ast.SendStmt), receives
+// (*ast.UnaryExpr), and calls to close and make(chan ...) (*ast.CallExpr).
+type ChannelOperationFilter struct {
+	// Ops is the set of operations to match. The zero value matches all of them.
+	Ops ChanOp
+
+	// ElemType, if non-empty, is the element type of the channel as written in the source
+	// (e.g., "*Job"). The type of a channel operand is not known from the syntax alone, so
+	// only make(chan ...) sites match when it is set.
+	ElemType string
+}
+
+// ChanOp is a set of channel operations.
+type ChanOp int
+
+const (
+	ChanSend    ChanOp = 1 << iota // ch <- v
+	ChanReceive                    // <-ch
+	ChanClose                      // close(ch)
+	ChanMake                       // make(chan T)
+)
+
+func (f ChannelOperationFilter) Filter(node ast.Node) bool {
+	op, chanType := channelOp(node)
+	if op == 0 {
+		return false
+	}
+	if f.Ops != 0 && f.Ops&op == 0 {
+		return false
+	}
+	if f.ElemType != "" && (chanType == nil || types.ExprString(chanType.Value) != f.ElemType) {
+		return false
+	}
+	return true
+}
+
+// channelOp returns the channel operation node performs, or 0 if it is not one. For
+// make(chan ...) calls, it also returns the channel type.
+func channelOp(node ast.Node) (ChanOp, *ast.ChanType) {
+	switch node := node.(type) {
+	case *ast.SendStmt:
+		return ChanSend, nil
+	case *ast.UnaryExpr:
+		if node.Op == token.ARROW {
+			return ChanReceive, nil
+		}
+	case *ast.CallExpr:
+		fn, isIdent := node.Fun.(*ast.Ident)
+		if !isIdent || len(node.Args) == 0 {
+			break
+		}
+		switch fn.Name {
+		case "close":
+			return ChanClose, nil
+		case "make":
+			if chanType, isChan := node.Args[0].(*ast.ChanType); isChan {
+				return ChanMake, chanType
+			}
+		}
+	}
+	return 0, nil
+}
+
+// TypeAssertionFilter matches type assertions (*ast.TypeAssertExpr). The x.(type) guards
+// of type switches are not type assertions and never match.
+type TypeAssertionFilter struct {
+	// Types is a set of asserted types to match, written as they appear in the source
+	// (e.g., "*os.PathError"). If empty, any asserted type matches.
+	Types []string
+
+	// Form selects assertions by whether they use the comma-ok form. It requires
+	// ancestors, so Filter never matches when it is set.
+	Form AssertionForm
+}
+
+// AssertionForm is the form in which a type assertion is used.
+type AssertionForm int
+
+const (
+	AnyAssertion       AssertionForm = iota // either form
+	CheckedAssertion                        // v, ok := x.(T)
+	UncheckedAssertion                      // v := x.(T), which panics if the assertion fails
+)
+
+func (f TypeAssertionFilter) Filter(node ast.Node) bool {
+	return f.Form == AnyAssertion && f.matchesType(node)
+}
+
+// matchesType reports whether node is a type assertion to one of f.Types.
+func (f TypeAssertionFilter) matchesType(node ast.Node) bool {
+	assert, isAssert := node.(*ast.TypeAssertExpr)
+	if !isAssert || assert.Type == nil {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	typ := types.ExprString(assert.Type)
+	for _, t := range f.Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func (f TypeAssertionFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	if !f.matchesType(node) {
+		return false
+	}
+	switch f.Form {
+	case CheckedAssertion:
+		return isCommaOk(node, parent(ancestors))
+	case UncheckedAssertion:
+		return !isCommaOk(node, parent(ancestors))
+	default:
+		return true
+	}
+}
+
+// PanicFilter matches calls to the builtins panic and recover (*ast.CallExpr).
+type PanicFilter struct {
+	// Calls is the set of builtins to match. The zero value matches both.
+	Calls PanicCall
+
+	// OutsideDefer is if the filter should select only calls to recover that are not made
+	// directly by a deferred function literal, and so cannot stop a panic. Calls made
+	// directly by a function declaration are assumed to be deferred by name elsewhere. It
+	// requires ancestors, so Filter never matches when it is set.
+	OutsideDefer bool
+}
+
+// PanicCall is a set of the panic and recover builtins.
+type PanicCall int
+
+const (
+	PanicCalls   PanicCall = 1 << iota // panic(v)
+	RecoverCalls                       // recover()
+)
+
+func (f PanicFilter) Filter(node ast.Node) bool {
+	return !f.OutsideDefer && f.FilterPath(node, nil)
+}
+
+func (f PanicFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	call, isCall := node.(*ast.CallExpr)
+	if !isCall {
+		return false
+	}
+	fn, isIdent := call.Fun.(*ast.Ident)
+	if !isIdent {
+		return false
+	}
+	var builtin PanicCall
+	switch fn.Name {
+	case "panic":
+		builtin = PanicCalls
+	case "recover":
+		builtin = RecoverCalls
+	default:
+		return false
+	}
+	if f.Calls != 0 && f.Calls&builtin == 0 {
+		return false
+	}
+	if f.OutsideDefer {
+		return builtin == RecoverCalls && !calledByDeferredFunc(ancestors)
+	}
+	return true
+}
+
+// calledByDeferredFunc reports whether the innermost function among ancestors is a
+// function declaration or a function literal deferred by a defer statement.
+func calledByDeferredFunc(ancestors []ast.Node) bool {
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		switch node := ancestors[i].(type) {
+		case *ast.FuncDecl:
+			return true
+		case *ast.FuncLit:
+			if i < 2 {
+				return false
+			}
+			call, isCall := ancestors[i-1].(*ast.CallExpr)
+			_, isDefer := ancestors[i-2].(*ast.DeferStmt)
+			return isCall && isDefer && call.Fun == node
+		}
+	}
+	return false
+}
+
+// isCommaOk reports whether expr is the single value assigned to two variables by its
+// parent, as in the comma-ok forms of type assertions, map indexing and channel receives.
+func isCommaOk(expr ast.Node, parent ast.Node) bool {
+	switch parent := parent.(type) {
+	case *ast.AssignStmt:
+		return len(parent.Lhs) == 2 && len(parent.Rhs) == 1 && parent.Rhs[0] == expr
+	case *ast.ValueSpec:
+		return len(parent.Names) == 2 && len(parent.Values) == 1 && parent.Values[0] == expr
+	default:
+		return false
+	}
+}
+
+// BinaryExprFilter matches binary expressions (*ast.BinaryExpr).
+type BinaryExprFilter struct {
+	// Op is the operator to filter for (e.g., token.EQL or token.ADD). The zero value,
+	// token.ILLEGAL, matches any operator.
+	Op token.Token
+
+	// Operand selects expressions by the shape of their operands; one of them must have
+	// the shape. For example, NilShape with token.EQL or token.NEQ finds comparisons
+	// against nil, and LiteralShape with token.ADD finds string concatenation involving a
+	// string literal.
+	Operand ExprShape
+
+	// InLoop is if the filter should select only expressions inside the body of a for or
+	// range statement in the same function. It requires ancestors, so Filter never matches
+	// when it is set.
+	InLoop bool
+}
+
+func (f BinaryExprFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f BinaryExprFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	expr, isBinary := node.(*ast.BinaryExpr)
+	if !isBinary {
+		return false
+	}
+	if f.Op != token.ILLEGAL && expr.Op != f.Op {
+		return false
+	}
+	if f.Operand != AnyShape && !f.Operand.matches(expr.X) && !f.Operand.matches(expr.Y) {
+		return false
+	}
+	if f.InLoop && !inLoopBody(ancestors) {
+		return false
+	}
+	return true
+}
+
+// inLoopBody reports whether the node whose ancestors are given is inside the body of a for
+// or range statement, without a function boundary in between.
+func inLoopBody(ancestors []ast.Node) bool {
+	for i := len(ancestors) - 1; i > 0; i-- {
+		switch node := ancestors[i].(type) {
+		case *ast.FuncLit, *ast.FuncDecl:
+			return false
+		case *ast.BlockStmt:
+			switch loop := ancestors[i-1].(type) {
+			case *ast.ForStmt:
+				if loop.Body == node {
+					return true
+				}
+			case *ast.RangeStmt:
+				if loop.Body == node {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// CompositeLitFilter matches composite literals (*ast.CompositeLit).
+type CompositeLitFilter struct {
+	// Types is a set of literal types to match, written as they appear in the source
+	// (e.g., "http.Server" or "[]string"). If empty, any type matches, including the types
+	// elided from nested literals.
+	Types []string
+
+	// Elements selects literals by whether their elements are keyed.
+	Elements ElementForm
+}
+
+// ElementForm is the form of the elements of a composite literal.
+type ElementForm int
+
+const (
+	AnyElements     ElementForm = iota // keyed or positional elements
+	KeyedElements                      // T{A: a, B: b}, or no elements at all
+	UnkeyedElements                    // T{a, b}
+)
+
+func (f CompositeLitFilter) Filter(node ast.Node) bool {
+	lit, isLit := node.(*ast.CompositeLit)
+	if !isLit {
+		return false
+	}
+	if len(f.Types) > 0 {
+		if lit.Type == nil {
+			return false
+		}
+		typ := types.ExprString(lit.Type)
+		matched := false
+		for _, t := range f.Types {
+			if t == typ {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	unkeyed := false
+	for _, elt := range lit.Elts {
+		if _, isKeyed := elt.(*ast.KeyValueExpr); !isKeyed {
+			unkeyed = true
+		}
+	}
+	switch f.Elements {
+	case KeyedElements:
+		return !unkeyed
+	case UnkeyedElements:
+		return unkeyed
+	default:
+		return true
+	}
+}
+
+// ExprShape is the syntactic form of an expression.
+type ExprShape int
+
+const (
+	AnyShape       ExprShape = iota // any expression
+	CallShape                       // function call or conversion, f(x)
+	LiteralShape                    // basic literal, such as 1 or "s"
+	CompositeShape                  // composite literal, T{...}, or its address, &T{...}
+	IdentShape                      // identifier other than nil
+	NilShape                        // the identifier nil
+	FuncLitShape                    // function literal
+)
+
+// matches reports whether expr has the shape s.
+func (s ExprShape) matches(expr ast.Expr) bool {
+	expr = ast.Unparen(expr)
+	switch s {
+	case CallShape:
+		_, isCall := expr.(*ast.CallExpr)
+		return isCall
+	case LiteralShape:
+		_, isLit := expr.(*ast.BasicLit)
+		return isLit
+	case CompositeShape:
+		if unary, isUnary := expr.(*ast.UnaryExpr); isUnary && unary.Op == token.AND {
+			expr = unary.X
+		}
+		_, isComposite := expr.(*ast.CompositeLit)
+		return isComposite
+	case IdentShape:
+		ident, isIdent := expr.(*ast.Ident)
+		return isIdent && ident.Name != "nil"
+	case NilShape:
+		ident, isIdent := expr.(*ast.Ident)
+		return isIdent && ident.Name == "nil"
+	case FuncLitShape:
+		_, isLit := expr.(*ast.FuncLit)
+		return isLit
+	default:
+		return true
+	}
+}
+
+// literalValue returns the value of lit as written, unquoting string and character
+// literals.
+func literalValue(lit *ast.BasicLit) string {
+	switch lit.Kind {
+	case token.STRING, token.CHAR:
+		if s, err := strconv.Unquote(lit.Value); err == nil {
+			return s
+		}
+	}
+	return lit.Value
+}
+
+// numericValue returns the value of an integer or floating-point literal.
+func numericValue(lit *ast.BasicLit) (float64, bool) {
+	if lit.Kind != token.INT && lit.Kind != token.FLOAT {
+		return 0, false
+	}
+	val := constant.MakeFromLiteral(lit.Value, lit.Kind, 0)
+	if val.Kind() == constant.Unknown {
+		return 0, false
+	}
+	f, _ := constant.Float64Val(constant.ToFloat(val))
+	return f, true
+}
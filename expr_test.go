@@ -0,0 +1,265 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const exprTestSrc = `package p
+
+const (
+	endpoint = "https://api.example.com/v1"
+	name     = "server"
+	port     = 8080
+	timeout  = 2.5
+	maxConns = 1_000
+	sep      = ':'
+)
+
+func pipeline(in <-chan *Job) {
+	out := make(chan *Job, 10)
+	done := make(chan struct{})
+	buf := make([]byte, 0)
+	for job := range in {
+		out <- job
+	}
+	<-done
+	close(out)
+}
+
+func classify(err error, v interface{}) {
+	pathErr, ok := err.(*os.PathError)
+	s := v.(fmt.Stringer)
+	var n, isInt = v.(int)
+	use(v.(fmt.Stringer).String())
+	switch v.(type) {
+	case int:
+	}
+}
+`
+
+func TestLiteralFilter(t *testing.T) {
+	file := parseTestFile(t, exprTestSrc)
+
+	lo, hi := 1024.0, 65535.0
+	testcases := []struct {
+		filter LiteralFilter
+		exp    []string
+	}{
+		{LiteralFilter{Kind: token.STRING}, []string{`"https://api.example.com/v1"`, `"server"`}},
+		{LiteralFilter{Kind: token.STRING, Pattern: regexp.MustCompile(`^https?://`)}, []string{`"https://api.example.com/v1"`}},
+		{LiteralFilter{Min: &lo, Max: &hi}, []string{"8080"}},
+		{LiteralFilter{Max: &lo}, []string{"2.5", "1_000", "10", "0"}},
+		{LiteralFilter{Pattern: regexp.MustCompile(`^:$`)}, []string{"':'"}},
+	}
+	for _, test := range testcases {
+		lits := Find([]ast.Node{file}, test.filter)
+		if values := literalValues(lits); !reflect.DeepEqual(values, test.exp) {
+			t.Errorf("%+v: expected literals %v, but got %v", test.filter, test.exp, values)
+		}
+	}
+}
+
+func TestChannelOperationFilter(t *testing.T) {
+	file := parseTestFile(t, exprTestSrc)
+
+	testcases := []struct {
+		filter ChannelOperationFilter
+		exp    []string
+	}{
+		{ChannelOperationFilter{}, []string{"make(chan *Job, 10)", "make(chan struct{})", "out <- job", "<-done", "close(out)"}},
+		{ChannelOperationFilter{Ops: ChanSend | ChanReceive}, []string{"out <- job", "<-done"}},
+		{ChannelOperationFilter{Ops: ChanClose}, []string{"close(out)"}},
+		{ChannelOperationFilter{ElemType: "*Job"}, []string{"make(chan *Job, 10)"}},
+		{ChannelOperationFilter{Ops: ChanSend, ElemType: "*Job"}, nil},
+	}
+	for _, test := range testcases {
+		var ops []string
+		for _, op := range Find([]ast.Node{file}, test.filter) {
+			ops = append(ops, nodeSource(t, op))
+		}
+		if !reflect.DeepEqual(ops, test.exp) {
+			t.Errorf("%+v: expected channel operations %v, but got %v", test.filter, test.exp, ops)
+		}
+	}
+}
+
+func TestTypeAssertionFilter(t *testing.T) {
+	file := parseTestFile(t, exprTestSrc)
+
+	testcases := []struct {
+		filter TypeAssertionFilter
+		exp    []string
+	}{
+		{TypeAssertionFilter{}, []string{"err.(*os.PathError)", "v.(fmt.Stringer)", "v.(int)", "v.(fmt.Stringer)"}},
+		{TypeAssertionFilter{Types: []string{"fmt.Stringer"}}, []string{"v.(fmt.Stringer)", "v.(fmt.Stringer)"}},
+		{TypeAssertionFilter{Form: CheckedAssertion}, []string{"err.(*os.PathError)", "v.(int)"}},
+		{TypeAssertionFilter{Form: UncheckedAssertion}, []string{"v.(fmt.Stringer)", "v.(fmt.Stringer)"}},
+		{TypeAssertionFilter{Types: []string{"int"}, Form: UncheckedAssertion}, nil},
+	}
+	for _, test := range testcases {
+		var asserts []string
+		for _, assert := range Find([]ast.Node{file}, test.filter) {
+			asserts = append(asserts, nodeSource(t, assert))
+		}
+		if !reflect.DeepEqual(asserts, test.exp) {
+			t.Errorf("%+v: expected type assertions %v, but got %v", test.filter, test.exp, asserts)
+		}
+
+		// Without ancestors, the form of an assertion is unknown.
+		matched := len(Find([]ast.Node{file}, FilterFunc(test.filter.Filter))) > 0
+		if exp := test.filter.Form == AnyAssertion && test.exp != nil; matched != exp {
+			t.Errorf("%+v: expected Filter to match %v, but got %v", test.filter, exp, matched)
+		}
+	}
+}
+
+func TestPanicFilter(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+func mustParse(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func safely(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Print(r)
+		}
+	}()
+	defer func() {
+		func() { recover() }()
+	}()
+	fn()
+}
+
+func handlePanic() {
+	recover()
+}
+
+func broken() {
+	cleanup := func() { recover() }
+	defer cleanup()
+}
+`)
+
+	testcases := []struct {
+		filter PanicFilter
+		exp    []string
+	}{
+		{PanicFilter{}, []string{"panic(err)", "recover()", "recover()", "recover()", "recover()"}},
+		{PanicFilter{Calls: PanicCalls}, []string{"panic(err)"}},
+		{PanicFilter{Calls: RecoverCalls}, []string{"recover()", "recover()", "recover()", "recover()"}},
+		{PanicFilter{OutsideDefer: true}, []string{"recover()", "recover()"}},
+	}
+	for _, test := range testcases {
+		var calls []string
+		for _, call := range Find([]ast.Node{file}, test.filter) {
+			calls = append(calls, nodeSource(t, call))
+		}
+		if !reflect.DeepEqual(calls, test.exp) {
+			t.Errorf("%+v: expected calls %v, but got %v", test.filter, test.exp, calls)
+		}
+
+		// Without ancestors, whether a call is deferred is unknown.
+		matched := len(Find([]ast.Node{file}, FilterFunc(test.filter.Filter))) > 0
+		if exp := !test.filter.OutsideDefer; matched != exp {
+			t.Errorf("%+v: expected Filter to match %v, but got %v", test.filter, exp, matched)
+		}
+	}
+
+	// Only the recovers nested in another literal and in a literal deferred by name are
+	// outside a deferred function.
+	safely := file.Decls[1]
+	if n := len(Find([]ast.Node{safely}, PanicFilter{OutsideDefer: true})); n != 1 {
+		t.Errorf("expected 1 ineffective recover in safely, but got %d", n)
+	}
+}
+
+func TestBinaryExprFilter(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+func join(parts []string, conn *Conn) string {
+	if conn == nil || len(parts) == 0 {
+		return ""
+	}
+	s := "parts: "
+	for i, p := range parts {
+		s += p
+		s = s + "," + p
+		if i > 0 && p != "" {
+			go func() { log.Print("part " + p) }()
+		}
+	}
+	return s + "."
+}
+`)
+
+	testcases := []struct {
+		filter BinaryExprFilter
+		exp    []string
+	}{
+		{BinaryExprFilter{Op: token.EQL, Operand: NilShape}, []string{"conn == nil"}},
+		{BinaryExprFilter{Op: token.LOR}, []string{"conn == nil || len(parts) == 0"}},
+		{BinaryExprFilter{Op: token.ADD, InLoop: true}, []string{"s + \",\" + p"}},
+		{BinaryExprFilter{Op: token.ADD, Operand: LiteralShape}, []string{"s + \",\"", "\"part \" + p", "s + \".\""}},
+		{BinaryExprFilter{Operand: CallShape}, []string{"len(parts) == 0"}},
+	}
+	for _, test := range testcases {
+		var exprs []string
+		for _, expr := range Find([]ast.Node{file}, test.filter) {
+			exprs = append(exprs, nodeSource(t, expr))
+		}
+		if !reflect.DeepEqual(exprs, test.exp) {
+			t.Errorf("%+v: expected expressions %v, but got %v", test.filter, test.exp, exprs)
+		}
+	}
+}
+
+func TestCompositeLitFilter(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+var (
+	a = Point{1, 2}
+	b = Point{X: 1, Y: 2}
+	c = &Point{}
+	d = []Point{{3, 4}, {X: 5}}
+	e = http.Server{":80", nil}
+	f = map[string]int{"a": 1}
+)
+`)
+
+	testcases := []struct {
+		filter CompositeLitFilter
+		exp    []string
+	}{
+		{CompositeLitFilter{Types: []string{"Point"}}, []string{"Point{1, 2}", "Point{X: 1, Y: 2}", "Point{}"}},
+		{CompositeLitFilter{Types: []string{"Point", "http.Server"}, Elements: UnkeyedElements}, []string{"Point{1, 2}", "http.Server{\":80\", nil}"}},
+		{CompositeLitFilter{Elements: KeyedElements}, []string{"Point{X: 1, Y: 2}", "Point{}", "{X: 5}", "map[string]int{\"a\": 1}"}},
+		{CompositeLitFilter{Elements: UnkeyedElements}, []string{"Point{1, 2}", "[]Point{{3, 4}, {X: 5}}", "http.Server{\":80\", nil}"}},
+	}
+	for _, test := range testcases {
+		var lits []string
+		for _, lit := range Find([]ast.Node{file}, test.filter) {
+			lits = append(lits, nodeSource(t, lit))
+		}
+		if !reflect.DeepEqual(lits, test.exp) {
+			t.Errorf("%+v: expected composite literals %v, but got %v", test.filter, test.exp, lits)
+		}
+	}
+}
+
+func literalValues(nodes []ast.Node) []string {
+	var values []string
+	for _, node := range nodes {
+		values = append(values, node.(*ast.BasicLit).Value)
+	}
+	return values
+}
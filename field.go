@@ -0,0 +1,232 @@
+package astquery
+
+import (
+	"bytes"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+// StructTagFilter matches struct fields by the contents of their tags. Tags are parsed
+// using the reflect.StructTag conventions, so keys and values are compared rather than the
+// raw tag text.
+type StructTagFilter struct {
+	// Key is the tag key to look up (e.g., "json").
+	Key string
+
+	// Value, if non-nil, is a regular expression the value for Key must match.
+	Value *regexp.Regexp
+
+	// Missing is if the filter should select fields whose tag does not contain Key instead.
+	Missing bool
+}
+
+// Filter reports whether node is a field with a matching tag. Without ancestors, every
+// *ast.Field is assumed to belong to a struct.
+func (f StructTagFilter) Filter(node ast.Node) bool {
+	field, isField := node.(*ast.Field)
+	if !isField {
+		return false
+	}
+	value, exists := fieldTag(field).Lookup(f.Key)
+	if f.Missing {
+		return !exists
+	}
+	return exists && (f.Value == nil || f.Value.MatchString(value))
+}
+
+func (f StructTagFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	return isStructField(ancestors) && f.Filter(node)
+}
+
+// InterfaceMethodFilter matches the method entries (*ast.Field) of interface types.
+// Embedded interfaces and type set terms are not methods and never match.
+type InterfaceMethodFilter struct {
+	// Pattern, if non-nil, is a regular expression matching the method's name.
+	Pattern *regexp.Regexp
+
+	// Signature, if non-empty, is the method's signature without parameter names, in the
+	// form "func(context.Context, string) (int, error)".
+	Signature string
+
+	// Interface, if non-empty, is the name of the interface type declaring the method.
+	// It requires ancestors, so Filter never matches when it is set.
+	Interface string
+}
+
+func (f InterfaceMethodFilter) Filter(node ast.Node) bool {
+	return f.Interface == "" && f.matchesMethod(node)
+}
+
+// matchesMethod reports whether node is a method with f.Pattern's name and f.Signature.
+func (f InterfaceMethodFilter) matchesMethod(node ast.Node) bool {
+	field, isField := node.(*ast.Field)
+	if !isField || len(field.Names) == 0 {
+		return false
+	}
+	funcType, isFunc := field.Type.(*ast.FuncType)
+	if !isFunc {
+		return false
+	}
+	if f.Pattern != nil && !f.Pattern.MatchString(field.Names[0].Name) {
+		return false
+	}
+	if f.Signature != "" && signatureString(funcType) != f.Signature {
+		return false
+	}
+	return true
+}
+
+func (f InterfaceMethodFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	if len(ancestors) < 2 {
+		return false
+	}
+	if _, isInterface := ancestors[len(ancestors)-2].(*ast.InterfaceType); !isInterface {
+		return false
+	}
+	if f.Interface != "" {
+		if len(ancestors) < 3 {
+			return false
+		}
+		spec, isSpec := ancestors[len(ancestors)-3].(*ast.TypeSpec)
+		if !isSpec || spec.Name.Name != f.Interface {
+			return false
+		}
+	}
+	return f.matchesMethod(node)
+}
+
+// EmbeddedFieldFilter matches embedded fields (*ast.Field) of struct types and embedded
+// interfaces of interface types.
+type EmbeddedFieldFilter struct {
+	// Names is a set of embedded type names to match, written as they appear in the source
+	// without any '*' or type arguments (e.g., "sync.Mutex" or "BaseService"). If empty,
+	// any embedded field matches.
+	Names []string
+}
+
+func (f EmbeddedFieldFilter) Filter(node ast.Node) bool {
+	field, isField := node.(*ast.Field)
+	if !isField || len(field.Names) != 0 {
+		return false
+	}
+	name, isNamed := embeddedTypeName(field.Type)
+	if !isNamed {
+		return false
+	}
+	if len(f.Names) == 0 {
+		return true
+	}
+	for _, n := range f.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f EmbeddedFieldFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	if len(ancestors) < 2 {
+		return false
+	}
+	switch ancestors[len(ancestors)-2].(type) {
+	case *ast.StructType, *ast.InterfaceType:
+		return f.Filter(node)
+	default:
+		return false
+	}
+}
+
+// embeddedTypeName returns the name of an embedded type, qualified by its package name if
+// it is imported. It reports false for type set terms and other unnamed types.
+func embeddedTypeName(typ ast.Expr) (string, bool) {
+	switch typ := typ.(type) {
+	case *ast.StarExpr:
+		return embeddedTypeName(typ.X)
+	case *ast.IndexExpr:
+		return embeddedTypeName(typ.X)
+	case *ast.IndexListExpr:
+		return embeddedTypeName(typ.X)
+	case *ast.Ident:
+		return typ.Name, true
+	case *ast.SelectorExpr:
+		if pkg, isIdent := typ.X.(*ast.Ident); isIdent {
+			return pkg.Name + "." + typ.Sel.Name, true
+		}
+	}
+	return "", false
+}
+
+// signatureString formats a function type without parameter names, e.g.
+// "func(int, ...string) (bool, error)".
+func signatureString(funcType *ast.FuncType) string {
+	var buf bytes.Buffer
+	buf.WriteString("func")
+	writeFieldTypes(&buf, funcType.Params, true)
+	if results := funcType.Results; results != nil && len(results.List) > 0 {
+		buf.WriteByte(' ')
+		parens := len(results.List) > 1 || len(results.List[0].Names) > 1
+		writeFieldTypes(&buf, results, parens)
+	}
+	return buf.String()
+}
+
+// writeFieldTypes writes the types of the fields, repeating the type once per name.
+func writeFieldTypes(buf *bytes.Buffer, fields *ast.FieldList, parens bool) {
+	if parens {
+		buf.WriteByte('(')
+	}
+	for i, typ := range fieldTypes(fields) {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(types.ExprString(typ))
+	}
+	if parens {
+		buf.WriteByte(')')
+	}
+}
+
+// fieldTypes returns the type of each entry in fields, repeating the type of a field once
+// per name it declares.
+func fieldTypes(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	var typs []ast.Expr
+	for _, field := range fields.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			typs = append(typs, field.Type)
+		}
+	}
+	return typs
+}
+
+// fieldTag returns the parsed tag of a struct field, or the empty tag if it has none or
+// the tag literal is malformed.
+func fieldTag(field *ast.Field) reflect.StructTag {
+	if field.Tag == nil {
+		return ""
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return ""
+	}
+	return reflect.StructTag(tag)
+}
+
+// isStructField reports whether the node whose ancestors are given is a field of a struct
+// type.
+func isStructField(ancestors []ast.Node) bool {
+	if len(ancestors) < 2 {
+		return false
+	}
+	_, isStruct := ancestors[len(ancestors)-2].(*ast.StructType)
+	return isStruct
+}
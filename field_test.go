@@ -0,0 +1,129 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const fieldTestSrc = `package p
+
+type User struct {
+	ID       int    ` + "`json:\"id\" db:\"id\"`" + `
+	Name     string ` + "`json:\"name\"`" + `
+	Password string ` + "`json:\"-\" db:\"password\"`" + `
+	cache    map[string]string
+}
+
+func lookup(id int) string { return "" }
+
+type Store interface {
+	io.Closer
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key, value string) error
+	Len() int
+}
+
+type Sizer interface {
+	Len() int
+}
+
+type Cache struct {
+	sync.Mutex
+	*BaseService
+	List[string]
+	items map[string]string
+}
+
+type Number interface {
+	~int | ~float64
+}
+`
+
+func TestStructTagFilter(t *testing.T) {
+	file := parseTestFile(t, fieldTestSrc)
+
+	testcases := []struct {
+		filter StructTagFilter
+		exp    []string
+	}{
+		{StructTagFilter{Key: "json"}, []string{"ID", "Name", "Password"}},
+		{StructTagFilter{Key: "json", Value: regexp.MustCompile(`^-$`)}, []string{"Password"}},
+		{StructTagFilter{Key: "db", Missing: true}, []string{"Name", "cache", "", "", "", "items"}},
+	}
+	for _, test := range testcases {
+		fields := Find([]ast.Node{file}, test.filter)
+		if names := fieldNames(fields); !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v: expected fields %v, but got %v", test.filter, test.exp, names)
+		}
+	}
+}
+
+func TestInterfaceMethodFilter(t *testing.T) {
+	file := parseTestFile(t, fieldTestSrc)
+
+	testcases := []struct {
+		filter InterfaceMethodFilter
+		exp    []string
+	}{
+		{InterfaceMethodFilter{}, []string{"Get", "Put", "Len", "Len"}},
+		{InterfaceMethodFilter{Interface: "Store"}, []string{"Get", "Put", "Len"}},
+		{InterfaceMethodFilter{Pattern: regexp.MustCompile(`^P`)}, []string{"Put"}},
+		{InterfaceMethodFilter{Signature: "func(context.Context, string, string) error"}, []string{"Put"}},
+		{InterfaceMethodFilter{Signature: "func(context.Context, string) ([]byte, error)"}, []string{"Get"}},
+		{InterfaceMethodFilter{Interface: "Sizer", Signature: "func() int"}, []string{"Len"}},
+	}
+	for _, test := range testcases {
+		methods := Find([]ast.Node{file}, test.filter)
+		if names := fieldNames(methods); !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v: expected methods %v, but got %v", test.filter, test.exp, names)
+		}
+
+		// Without ancestors, the interface declaring a method is unknown.
+		matched := len(Find([]ast.Node{file}, FilterFunc(test.filter.Filter))) > 0
+		if exp := test.filter.Interface == ""; matched != exp {
+			t.Errorf("%+v: expected Filter to match %v, but got %v", test.filter, exp, matched)
+		}
+	}
+}
+
+func TestEmbeddedFieldFilter(t *testing.T) {
+	file := parseTestFile(t, fieldTestSrc)
+
+	testcases := []struct {
+		filter EmbeddedFieldFilter
+		exp    []string
+	}{
+		{EmbeddedFieldFilter{}, []string{"io.Closer", "sync.Mutex", "*BaseService", "List[string]"}},
+		{EmbeddedFieldFilter{Names: []string{"sync.Mutex", "BaseService"}}, []string{"sync.Mutex", "*BaseService"}},
+		{EmbeddedFieldFilter{Names: []string{"List"}}, []string{"List[string]"}},
+		{EmbeddedFieldFilter{Names: []string{"Mutex"}}, nil},
+	}
+	for _, test := range testcases {
+		fields := Find([]ast.Node{file}, test.filter)
+		var typs []string
+		for _, field := range fields {
+			typs = append(typs, types.ExprString(field.(*ast.Field).Type))
+		}
+		if !reflect.DeepEqual(typs, test.exp) {
+			t.Errorf("%+v: expected embedded fields %v, but got %v", test.filter, test.exp, typs)
+		}
+	}
+}
+
+// fieldNames returns the first name of each field node, or the empty string for
+// embedded fields.
+func fieldNames(nodes []ast.Node) []string {
+	var names []string
+	for _, node := range nodes {
+		field := node.(*ast.Field)
+		if len(field.Names) == 0 {
+			names = append(names, "")
+		} else {
+			names = append(names, field.Names[0].Name)
+		}
+	}
+	return names
+}
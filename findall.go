@@ -0,0 +1,76 @@
+package astquery
+
+import (
+	"go/ast"
+	"sort"
+)
+
+// FindAll is like Find for several filters, by name, but walks the AST once, evaluating
+// all the filters at each node. It returns the nodes matching each filter by the
+// filter's name, with the filters that match no nodes left out. As with Find, the
+// descendants of a node matching a filter are not searched for more matches of that
+// filter, but are for those of the others.
+func FindAll(nodes []ast.Node, filters map[string]Filter) map[string][]ast.Node {
+	f := newMultiFilter(filters)
+	for _, node := range nodes {
+		find(node, f)
+	}
+	return f.found
+}
+
+// FindAll is like Find for several filters, walking the package's files once. See
+// FindAll.
+func (p *Package) FindAll(filters map[string]Filter) map[string][]Match {
+	files := make([]ast.Node, len(p.Files))
+	for i, file := range p.Files {
+		files[i] = file
+	}
+	matches := make(map[string][]Match)
+	for name, nodes := range FindAll(files, filters) {
+		matches[name] = p.matches(nodes)
+	}
+	return matches
+}
+
+// multiFilter is a PathFilter that records the matches of several filters and matches
+// no nodes itself, so that find walks the whole AST.
+type multiFilter struct {
+	names   []string
+	filters []Filter
+	found   map[string][]ast.Node
+
+	// matchDepth is, for each filter, the number of ancestors of the node it last
+	// matched while the walk is below that node, or -1.
+	matchDepth []int
+}
+
+func newMultiFilter(filters map[string]Filter) *multiFilter {
+	f := &multiFilter{found: make(map[string][]ast.Node)}
+	for name := range filters {
+		f.names = append(f.names, name)
+	}
+	sort.Strings(f.names)
+	for _, name := range f.names {
+		f.filters = append(f.filters, filters[name])
+		f.matchDepth = append(f.matchDepth, -1)
+	}
+	return f
+}
+
+func (f *multiFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f *multiFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	depth := len(ancestors)
+	for i, filter := range f.filters {
+		if f.matchDepth[i] >= depth {
+			f.matchDepth[i] = -1 // the walk has left the last match
+		}
+		if f.matchDepth[i] < 0 && filterNode(filter, node, ancestors) {
+			f.found[f.names[i]] = append(f.found[f.names[i]], node)
+			f.matchDepth[i] = depth
+		}
+	}
+	return false
+}
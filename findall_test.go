@@ -0,0 +1,42 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+func TestFindAll(t *testing.T) {
+	file := parseTestFile(t, querySrc)
+	filters := map[string]Filter{
+		"fatal":   MustCompileQuery(`//CallExpr[@callee='log.Fatal']`),
+		"calls":   MustCompileSelector("CallExpr"),
+		"funcs":   MustCompileSelector("FuncDecl.exported"),
+		"idents":  MustCompileQuery(`//Ident[@name='log']`),
+		"pattern": MustCompilePattern("log.$f($x)"),
+		"none":    MustCompileSelector("GoStmt"),
+		"comments": FilterFunc(func(node ast.Node) bool {
+			_, isGroup := node.(*ast.CommentGroup)
+			return isGroup
+		}),
+	}
+	got := FindAll([]ast.Node{file, file}, filters)
+	for name, filter := range filters {
+		exp := Find([]ast.Node{file, file}, filter)
+		if !reflect.DeepEqual(got[name], exp) {
+			t.Errorf("%s: expected %d matches %v, but got %d %v", name, len(exp), exp, len(got[name]), got[name])
+		}
+	}
+	if _, hasNone := got["none"]; hasNone {
+		t.Errorf("expected no entry for a filter without matches")
+	}
+
+	pkg, err := ParseSource("p.go", []byte(querySrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := pkg.FindAll(map[string]Filter{"funcs": filters["funcs"]})
+	if len(matches["funcs"]) != 2 || matches["funcs"][1].Position().Line != 22 {
+		t.Errorf("expected 2 exported funcs, the second on line 22, but got %v", matches["funcs"])
+	}
+}
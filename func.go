@@ -0,0 +1,164 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// FuncSignatureFilter matches function declarations (*ast.FuncDecl) and function literals
+// (*ast.FuncLit) by the shape of their signature.
+//
+// Types are written as they appear in the source (e.g., "context.Context" or "[]byte").
+// In Params and Results, the entry "_" matches any single type and a final entry "..."
+// matches any number of remaining entries.
+type FuncSignatureFilter struct {
+	// Params, if non-nil, are the parameter types. An empty, non-nil slice matches
+	// functions without parameters.
+	Params []string
+
+	// Results, if non-nil, are the result types. An empty, non-nil slice matches
+	// functions without results.
+	Results []string
+
+	// ReturnsError is if the filter should select only functions whose last result is of
+	// type error.
+	ReturnsError bool
+
+	// Variadic is if the filter should select only functions whose final parameter is
+	// variadic.
+	Variadic bool
+
+	// VariadicElem, if non-empty, is the element type of the variadic parameter (e.g.,
+	// "interface{}" for "...interface{}"). It implies Variadic.
+	VariadicElem string
+}
+
+func (f FuncSignatureFilter) Filter(node ast.Node) bool {
+	funcType := funcTypeOf(node)
+	if funcType == nil {
+		return false
+	}
+	if f.Params != nil && !typesMatch(f.Params, fieldTypes(funcType.Params)) {
+		return false
+	}
+	if f.Variadic || f.VariadicElem != "" {
+		elem, isVariadic := variadicElem(funcType)
+		if !isVariadic {
+			return false
+		}
+		if f.VariadicElem != "" && types.ExprString(elem) != f.VariadicElem {
+			return false
+		}
+	}
+	results := fieldTypes(funcType.Results)
+	if f.Results != nil && !typesMatch(f.Results, results) {
+		return false
+	}
+	if f.ReturnsError {
+		if len(results) == 0 || types.ExprString(results[len(results)-1]) != "error" {
+			return false
+		}
+	}
+	return true
+}
+
+// FuncLitFilter matches function literals (*ast.FuncLit), optionally by signature and by
+// the context they appear in.
+type FuncLitFilter struct {
+	// Signature, if non-nil, is a filter the literal's signature must match.
+	Signature *FuncSignatureFilter
+
+	// Context selects literals by how they are used. The zero value selects literals in
+	// any context. It requires ancestors, so Filter never matches when it is set.
+	Context FuncLitContext
+}
+
+// FuncLitContext is the context in which a function literal is used.
+type FuncLitContext int
+
+const (
+	AnyContext      FuncLitContext = iota // any use
+	ArgumentContext                       // passed as an argument to a call
+	GoContext                             // called by, or passed as an argument in, a go statement
+	DeferContext                          // called by, or passed as an argument in, a defer statement
+)
+
+func (f FuncLitFilter) Filter(node ast.Node) bool {
+	return f.Context == AnyContext && f.matchesLit(node)
+}
+
+// matchesLit reports whether node is a function literal matching f.Signature.
+func (f FuncLitFilter) matchesLit(node ast.Node) bool {
+	if _, isLit := node.(*ast.FuncLit); !isLit {
+		return false
+	}
+	return f.Signature == nil || f.Signature.Filter(node)
+}
+
+func (f FuncLitFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	if !f.matchesLit(node) {
+		return false
+	}
+	if f.Context == AnyContext {
+		return true
+	}
+	call, isCall := parent(ancestors).(*ast.CallExpr)
+	if !isCall {
+		return false
+	}
+	switch f.Context {
+	case ArgumentContext:
+		return call.Fun != node
+	case GoContext:
+		_, isGo := parent(ancestors[:len(ancestors)-1]).(*ast.GoStmt)
+		return isGo
+	case DeferContext:
+		_, isDefer := parent(ancestors[:len(ancestors)-1]).(*ast.DeferStmt)
+		return isDefer
+	}
+	return false
+}
+
+// funcTypeOf returns the type of a function declaration or literal, or nil if node is
+// neither.
+func funcTypeOf(node ast.Node) *ast.FuncType {
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		return node.Type
+	case *ast.FuncLit:
+		return node.Type
+	default:
+		return nil
+	}
+}
+
+// variadicElem returns the element type of the final parameter of funcType if it is
+// variadic.
+func variadicElem(funcType *ast.FuncType) (ast.Expr, bool) {
+	params := fieldTypes(funcType.Params)
+	if len(params) == 0 {
+		return nil, false
+	}
+	ellipsis, isVariadic := params[len(params)-1].(*ast.Ellipsis)
+	if !isVariadic {
+		return nil, false
+	}
+	return ellipsis.Elt, true
+}
+
+// typesMatch reports whether typs match the patterns, as described for
+// FuncSignatureFilter.
+func typesMatch(patterns []string, typs []ast.Expr) bool {
+	for i, pattern := range patterns {
+		if pattern == "..." && i == len(patterns)-1 {
+			return true
+		}
+		if i >= len(typs) {
+			return false
+		}
+		if pattern != "_" && pattern != types.ExprString(typs[i]) {
+			return false
+		}
+	}
+	return len(patterns) == len(typs)
+}
@@ -0,0 +1,121 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+const funcTestSrc = `package p
+
+func Handle(ctx context.Context, req *Request) error { return nil }
+
+func HandleBatch(ctx context.Context, reqs []*Request, opts ...Option) (int, error) {
+	return 0, nil
+}
+
+func Version() string { return "" }
+
+func Reset() {}
+
+func Logf(format string, args ...interface{}) {}
+
+func (s *Server) Serve(ctx context.Context) error {
+	return run(func(ctx context.Context) error { return nil })
+}
+`
+
+func TestFuncSignatureFilter(t *testing.T) {
+	file := parseTestFile(t, funcTestSrc)
+
+	testcases := []struct {
+		filter FuncSignatureFilter
+		exp    []string
+	}{
+		{FuncSignatureFilter{Params: []string{"context.Context", "..."}, ReturnsError: true}, []string{"Handle", "HandleBatch", "Serve"}},
+		{FuncSignatureFilter{Params: []string{"context.Context", "..."}, Results: []string{"error"}}, []string{"Handle", "Serve"}},
+		{FuncSignatureFilter{Params: []string{"_", "_", "_"}}, []string{"HandleBatch"}},
+		{FuncSignatureFilter{Params: []string{"_", "[]*Request", "...Option"}}, []string{"HandleBatch"}},
+		{FuncSignatureFilter{Params: []string{}}, []string{"Version", "Reset"}},
+		{FuncSignatureFilter{Variadic: true}, []string{"HandleBatch", "Logf"}},
+		{FuncSignatureFilter{VariadicElem: "interface{}"}, []string{"Logf"}},
+		{FuncSignatureFilter{VariadicElem: "Option", ReturnsError: true}, []string{"HandleBatch"}},
+		{FuncSignatureFilter{Params: []string{}, Results: []string{}}, []string{"Reset"}},
+		{FuncSignatureFilter{Results: []string{"int", "error"}}, []string{"HandleBatch"}},
+	}
+	for _, test := range testcases {
+		funcs := Find([]ast.Node{file}, test.filter)
+		if names := funcNames(funcs); !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v: expected functions %v, but got %v", test.filter, test.exp, names)
+		}
+	}
+
+	// Function literals are matched when no enclosing declaration is.
+	lits := Find([]ast.Node{file}, FuncSignatureFilter{Params: []string{"context.Context"}, Results: []string{"error"}})
+	if names := funcNames(lits); !reflect.DeepEqual(names, []string{"Serve"}) {
+		t.Errorf("expected declaration Serve to be matched, but got %v", names)
+	}
+	serve := lits[0].(*ast.FuncDecl)
+	lits = Find([]ast.Node{serve.Body}, FuncSignatureFilter{Params: []string{"context.Context"}, Results: []string{"error"}})
+	if names := funcNames(lits); !reflect.DeepEqual(names, []string{"func literal"}) {
+		t.Errorf("expected a function literal to be matched, but got %v", names)
+	}
+}
+
+func TestFuncLitFilter(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+func worker(jobs []Job) {
+	defer func() { recover() }()
+	for _, job := range jobs {
+		go func(j Job) { j.Run() }(job)
+	}
+	go run(func() error { return nil })
+	sort.Slice(jobs, func(i, j int) bool { return false })
+	done := func() {}
+	done()
+}
+`)
+
+	testcases := []struct {
+		filter FuncLitFilter
+		exp    []string
+	}{
+		{FuncLitFilter{}, []string{"func()", "func(Job)", "func() error", "func(int, int) bool", "func()"}},
+		{FuncLitFilter{Context: GoContext}, []string{"func(Job)", "func() error"}},
+		{FuncLitFilter{Context: DeferContext}, []string{"func()"}},
+		{FuncLitFilter{Context: ArgumentContext}, []string{"func() error", "func(int, int) bool"}},
+		{FuncLitFilter{Signature: &FuncSignatureFilter{ReturnsError: true}}, []string{"func() error"}},
+		{FuncLitFilter{Signature: &FuncSignatureFilter{Params: []string{}}, Context: GoContext}, []string{"func() error"}},
+	}
+	for _, test := range testcases {
+		var sigs []string
+		for _, lit := range Find([]ast.Node{file}, test.filter) {
+			sigs = append(sigs, signatureString(lit.(*ast.FuncLit).Type))
+		}
+		if !reflect.DeepEqual(sigs, test.exp) {
+			t.Errorf("%+v: expected function literals %v, but got %v", test.filter, test.exp, sigs)
+		}
+
+		// Without ancestors, the context of a literal is unknown.
+		matched := len(Find([]ast.Node{file}, FilterFunc(test.filter.Filter))) > 0
+		if exp := test.filter.Context == AnyContext; matched != exp {
+			t.Errorf("%+v: expected Filter to match %v, but got %v", test.filter, exp, matched)
+		}
+	}
+}
+
+// funcNames returns the names of function declaration nodes, using "func literal" for
+// function literals.
+func funcNames(nodes []ast.Node) []string {
+	var names []string
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			names = append(names, node.Name.Name)
+		case *ast.FuncLit:
+			names = append(names, "func literal")
+		}
+	}
+	return names
+}
@@ -0,0 +1,95 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// GenericDeclFilter matches generic declarations: type specs (*ast.TypeSpec) and function
+// declarations (*ast.FuncDecl) with type parameters. Methods of generic types have no type
+// parameters of their own and never match.
+type GenericDeclFilter struct {
+	// NumTypeParams, if positive, is the number of type parameters the declaration must
+	// have.
+	NumTypeParams int
+
+	// Constraint, if non-empty, is a constraint that one of the type parameters must have,
+	// as written in the source (e.g., "comparable" or "constraints.Ordered").
+	Constraint string
+}
+
+func (f GenericDeclFilter) Filter(node ast.Node) bool {
+	typeParams := typeParamsOf(node)
+	if typeParams == nil || len(typeParams.List) == 0 {
+		return false
+	}
+	if f.NumTypeParams > 0 && len(fieldTypes(typeParams)) != f.NumTypeParams {
+		return false
+	}
+	if f.Constraint != "" {
+		for _, constraint := range fieldTypes(typeParams) {
+			if types.ExprString(constraint) == f.Constraint {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// TypeParamFilter matches the type parameter entries (*ast.Field) of generic types and
+// functions by their constraint. An entry declaring several type parameters, as in
+// [K, V any], is a single node. It requires ancestors to tell type parameters from other
+// fields, so Filter never matches.
+type TypeParamFilter struct {
+	// Constraints is a set of constraints to match, written as they appear in the source
+	// (e.g., "comparable", "any" or "Number"). If empty, any constraint matches.
+	Constraints []string
+}
+
+func (f TypeParamFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f TypeParamFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	field, isField := node.(*ast.Field)
+	if !isField || len(ancestors) < 2 {
+		return false
+	}
+	list := ancestors[len(ancestors)-1]
+	switch owner := ancestors[len(ancestors)-2].(type) {
+	case *ast.TypeSpec:
+		if owner.TypeParams != list {
+			return false
+		}
+	case *ast.FuncType:
+		if owner.TypeParams != list {
+			return false
+		}
+	default:
+		return false
+	}
+	if len(f.Constraints) == 0 {
+		return true
+	}
+	constraint := types.ExprString(field.Type)
+	for _, c := range f.Constraints {
+		if c == constraint {
+			return true
+		}
+	}
+	return false
+}
+
+// typeParamsOf returns the type parameters of a type spec or function declaration, or nil
+// if node is neither or is not generic.
+func typeParamsOf(node ast.Node) *ast.FieldList {
+	switch node := node.(type) {
+	case *ast.TypeSpec:
+		return node.TypeParams
+	case *ast.FuncDecl:
+		return node.Type.TypeParams
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const genericsTestSrc = `package p
+
+type Set[T comparable] map[T]struct{}
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+type Plain struct{}
+
+func Map[T, U any](s []T, fn func(T) U) []U { return nil }
+
+func Max[T constraints.Ordered](a, b T) T { return a }
+
+func (s Set[T]) Has(v T) bool { return false }
+
+func Sum[N interface{ ~int | ~float64 }](ns []N) N { return 0 }
+`
+
+func TestGenericDeclFilter(t *testing.T) {
+	file := parseTestFile(t, genericsTestSrc)
+
+	testcases := []struct {
+		filter GenericDeclFilter
+		exp    []string
+	}{
+		{GenericDeclFilter{}, []string{"Set", "Pair", "Map", "Max", "Sum"}},
+		{GenericDeclFilter{NumTypeParams: 2}, []string{"Pair", "Map"}},
+		{GenericDeclFilter{Constraint: "comparable"}, []string{"Set", "Pair"}},
+		{GenericDeclFilter{Constraint: "constraints.Ordered"}, []string{"Max"}},
+		{GenericDeclFilter{NumTypeParams: 1, Constraint: "any"}, nil},
+	}
+	for _, test := range testcases {
+		var names []string
+		for _, decl := range Find([]ast.Node{file}, test.filter) {
+			name, _ := GetName(decl)
+			names = append(names, name)
+		}
+		if !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v: expected declarations %v, but got %v", test.filter, test.exp, names)
+		}
+	}
+}
+
+func TestTypeParamFilter(t *testing.T) {
+	file := parseTestFile(t, genericsTestSrc)
+
+	testcases := []struct {
+		filter TypeParamFilter
+		exp    []string
+	}{
+		{TypeParamFilter{}, []string{"T comparable", "K comparable", "V any", "T, U any", "T constraints.Ordered", "N interface{~int | ~float64}"}},
+		{TypeParamFilter{Constraints: []string{"comparable"}}, []string{"T comparable", "K comparable"}},
+		{TypeParamFilter{Constraints: []string{"any", "constraints.Ordered"}}, []string{"V any", "T, U any", "T constraints.Ordered"}},
+	}
+	for _, test := range testcases {
+		var params []string
+		for _, param := range Find([]ast.Node{file}, test.filter) {
+			field := param.(*ast.Field)
+			var names []string
+			for _, name := range field.Names {
+				names = append(names, name.Name)
+			}
+			params = append(params, strings.Join(names, ", ")+" "+types.ExprString(field.Type))
+		}
+		if !reflect.DeepEqual(params, test.exp) {
+			t.Errorf("%+v: expected type parameters %v, but got %v", test.filter, test.exp, params)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package astquery
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+// GitFS returns the tree of a revision of the Git repository containing dir as a file
+// system, without checking it out. rev is any revision the git command accepts, such as
+// "HEAD~1", a branch name or a commit hash. Paths in the file system are relative to the
+// root of the repository.
+func GitFS(dir, rev string) (fs.FS, error) {
+	root, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	// Resolve rev first, so that a rev starting with '-' can't be read as an option.
+	tree, err := git(dir, "rev-parse", "--verify", "--end-of-options", rev+"^{tree}")
+	if err != nil {
+		return nil, err
+	}
+	archive, err := git(strings.TrimSpace(string(root)), "archive", "--format=zip", "-0", strings.TrimSpace(string(tree)))
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+}
+
+// LoadGit loads the packages in a revision of the Git repository containing dir, as
+// LoadFS loads them from the file system returned by GitFS. opts.Dir, if set, is the
+// directory to load relative to the root of the repository. Running the same query on the
+// packages of two revisions shows how its matches changed between them.
+func LoadGit(dir, rev string, opts *LoadOptions) ([]*Package, error) {
+	fsys, err := GitFS(dir, rev)
+	if err != nil {
+		return nil, err
+	}
+	return LoadFS(fsys, opts)
+}
+
+// git runs the git command in dir and returns its output.
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,80 @@
+package astquery
+
+import (
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadGit(t *testing.T) {
+	dir := t.TempDir()
+	commit := func(files map[string]string) {
+		writeTestFiles(t, dir, files)
+		for _, args := range [][]string{
+			{"add", "-A"},
+			{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "commit"},
+		} {
+			if _, err := git(dir, args...); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := git(dir, "init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+	commit(map[string]string{
+		"go.mod":       "module example.com/m\n",
+		"util/util.go": "package util\n\nfunc Old() {}\n",
+	})
+	commit(map[string]string{
+		"util/util.go": "package util\n\nfunc New() {}\n",
+	})
+	// Uncommitted changes are not loaded.
+	writeTestFiles(t, dir, map[string]string{"util/util.go": "package util\n\nfunc Edited() {}\n"})
+
+	funcs := func(pkgs []*Package) []string {
+		var names []string
+		for _, pkg := range pkgs {
+			for _, m := range pkg.Find(FilterFunc(func(node ast.Node) bool {
+				_, isFunc := node.(*ast.FuncDecl)
+				return isFunc
+			})) {
+				names = append(names, pkg.ImportPath+"."+m.Node.(*ast.FuncDecl).Name.Name)
+			}
+		}
+		return names
+	}
+	testcases := []struct {
+		rev string
+		exp []string
+	}{
+		{"HEAD~1", []string{"example.com/m/util.Old"}},
+		{"HEAD", []string{"example.com/m/util.New"}},
+	}
+	for _, test := range testcases {
+		// Load from a subdirectory: the whole repository is still loaded.
+		pkgs, err := LoadGit(filepath.Join(dir, "util"), test.rev, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := funcs(pkgs); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected funcs %v, but got %v", test.rev, test.exp, got)
+		}
+	}
+
+	if _, err := LoadGit(dir, "no-such-rev", nil); err == nil {
+		t.Errorf("expected an error for an unknown revision")
+	}
+	output := filepath.Join(t.TempDir(), "x.zip")
+	if _, err := GitFS(dir, "--output="+output); err == nil {
+		t.Errorf("expected an error for a revision starting with '-'")
+	}
+	if _, err := os.Stat(output); err == nil {
+		t.Errorf("expected the revision not to be read as an option")
+	}
+	if _, err := GitFS(t.TempDir(), "HEAD"); err == nil {
+		t.Errorf("expected an error outside a repository")
+	}
+}
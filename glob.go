@@ -0,0 +1,97 @@
+package astquery
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchGlob reports whether the slash-separated path name matches pattern. A "**" element
+// of the pattern matches any number of path elements, including none; the other elements
+// match one path element each, as in path.Match.
+func matchGlob(pattern, name string) bool {
+	return matchGlobElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchGlobElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], elems[0]); !matched {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// validateGlob reports whether pattern is a valid glob for matchGlob.
+func validateGlob(pattern string) error {
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// excludesDir reports whether the directory dir, a slash-separated relative path, is
+// excluded by opts.Exclude, along with everything in it.
+func (opts *LoadOptions) excludesDir(dir string) bool {
+	for _, pattern := range opts.Exclude {
+		if matchGlob(pattern, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// includesFile reports whether the file filename, a slash-separated relative path, is to be
+// loaded according to opts.Include and opts.Exclude.
+func (opts *LoadOptions) includesFile(filename string) bool {
+	for _, pattern := range opts.Exclude {
+		if matchGlob(pattern, filename) {
+			return false
+		}
+	}
+	if len(opts.Include) == 0 {
+		return true
+	}
+	for _, pattern := range opts.Include {
+		if matchGlob(pattern, filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// scope returns the names of the files in the directory dir to load according to
+// opts.Include and opts.Exclude, which are relative to the directory base. Directories
+// outside base are not scoped.
+func (opts *LoadOptions) scope(base, dir string, names []string) []string {
+	rel, err := filepath.Rel(base, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return names
+	}
+	rel = filepath.ToSlash(rel)
+	if rel != "." && opts.excludesDir(rel) {
+		return nil
+	}
+	var scoped []string
+	for _, name := range names {
+		if opts.includesFile(path.Join(rel, name)) {
+			scoped = append(scoped, name)
+		}
+	}
+	return scoped
+}
@@ -0,0 +1,31 @@
+package astquery
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	testcases := []struct {
+		pattern string
+		name    string
+		exp     bool
+	}{
+		{"**/testdata/**", "testdata", true},
+		{"**/testdata/**", "a/b/testdata", true},
+		{"**/testdata/**", "a/testdata/x/y.go", true},
+		{"**/testdata/**", "a/testdata.go", false},
+		{"**/mocks/**", "internal/mocks/store.go", true},
+		{"cmd/**", "cmd", true},
+		{"cmd/**", "cmd/tool/main.go", true},
+		{"cmd/**", "pkg/cmd/main.go", false},
+		{"**/*_mock.go", "a/b/store_mock.go", true},
+		{"**/*_mock.go", "store_mock.go", true},
+		{"*.go", "a/b.go", false},
+		{"a/*/c.go", "a/b/c.go", true},
+		{"a/*/c.go", "a/b/x/c.go", false},
+		{"a/**/c.go", "a/b/x/c.go", true},
+	}
+	for _, test := range testcases {
+		if got := matchGlob(test.pattern, test.name); got != test.exp {
+			t.Errorf("%+v: expected %v, but got %v", test, test.exp, got)
+		}
+	}
+}
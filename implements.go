@@ -0,0 +1,139 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// TypeDecl is a type declaration in a typed package.
+type TypeDecl struct {
+	Spec *ast.TypeSpec
+	Pkg  *TypedPackage
+}
+
+// Position returns the position of the declared type's name.
+func (d TypeDecl) Position() token.Position {
+	return d.Pkg.Fset.Position(d.Spec.Pos())
+}
+
+// Satisfaction records that a concrete type satisfies an interface.
+type Satisfaction struct {
+	Interface TypeDecl
+	Concrete  TypeDecl
+
+	// PointerOnly is if only a pointer to the concrete type, not the type itself,
+	// satisfies the interface.
+	PointerOnly bool
+}
+
+// Position returns the position of the concrete type's declaration.
+func (s Satisfaction) Position() token.Position {
+	return s.Concrete.Position()
+}
+
+// Implementations reports, for each interface type declared in pkgs whose spec matches
+// filter, the concrete types declared in pkgs that satisfy it. Satisfactions are grouped
+// by interface and ordered by package and position. Generic types and interfaces that are
+// only usable as constraints are ignored.
+//
+// Types are compared by identity, so packages that refer to each other should be
+// type-checked with an importer that returns the other TypedPackages' Pkg.
+func Implementations(filter Filter, pkgs ...*TypedPackage) []Satisfaction {
+	ifaces, concretes := satisfactionDecls(pkgs)
+	var sats []Satisfaction
+	for _, iface := range ifaces {
+		if !filterTypeDecl(filter, iface) {
+			continue
+		}
+		for _, concrete := range concretes {
+			if sat, ok := satisfies(concrete, iface); ok {
+				sats = append(sats, sat)
+			}
+		}
+	}
+	return sats
+}
+
+// Interfaces is the reverse of Implementations: it reports, for each concrete type
+// declared in pkgs whose spec matches filter, the interfaces declared in pkgs that it
+// satisfies. Empty interfaces, which every type satisfies, are left out.
+func Interfaces(filter Filter, pkgs ...*TypedPackage) []Satisfaction {
+	ifaces, concretes := satisfactionDecls(pkgs)
+	var sats []Satisfaction
+	for _, concrete := range concretes {
+		if !filterTypeDecl(filter, concrete) {
+			continue
+		}
+		for _, iface := range ifaces {
+			if iface.Pkg.Info.Defs[iface.Spec.Name].Type().Underlying().(*types.Interface).Empty() {
+				continue
+			}
+			if sat, ok := satisfies(concrete, iface); ok {
+				sats = append(sats, sat)
+			}
+		}
+	}
+	return sats
+}
+
+// satisfactionDecls returns the non-generic interface and concrete type declarations of
+// pkgs. Interfaces that are only usable as constraints are left out.
+func satisfactionDecls(pkgs []*TypedPackage) (ifaces, concretes []TypeDecl) {
+	for _, p := range pkgs {
+		for _, file := range p.Files {
+			for _, decl := range file.Decls {
+				genDecl, isGen := decl.(*ast.GenDecl)
+				if !isGen {
+					continue
+				}
+				for _, spec := range genDecl.Specs {
+					spec, isType := spec.(*ast.TypeSpec)
+					if !isType || spec.TypeParams != nil {
+						continue
+					}
+					obj := p.Info.Defs[spec.Name]
+					if obj == nil {
+						continue
+					}
+					if iface, isInterface := obj.Type().Underlying().(*types.Interface); isInterface {
+						if iface.IsMethodSet() {
+							ifaces = append(ifaces, TypeDecl{spec, p})
+						}
+					} else {
+						concretes = append(concretes, TypeDecl{spec, p})
+					}
+				}
+			}
+		}
+	}
+	return ifaces, concretes
+}
+
+// filterTypeDecl applies filter to a type spec, with its file and declaration as
+// ancestors.
+func filterTypeDecl(filter Filter, decl TypeDecl) bool {
+	for _, file := range decl.Pkg.Files {
+		if file.Pos() > decl.Spec.Pos() || decl.Spec.End() > file.End() {
+			continue
+		}
+		for _, d := range file.Decls {
+			if d.Pos() <= decl.Spec.Pos() && decl.Spec.End() <= d.End() {
+				return filterNode(filter, decl.Spec, []ast.Node{file, d})
+			}
+		}
+	}
+	return filterNode(filter, decl.Spec, nil)
+}
+
+// satisfies reports how concrete satisfies iface, if it does.
+func satisfies(concrete, iface TypeDecl) (Satisfaction, bool) {
+	typ := concrete.Pkg.Info.Defs[concrete.Spec.Name].Type()
+	ifaceType := iface.Pkg.Info.Defs[iface.Spec.Name].Type().Underlying().(*types.Interface)
+	sat := Satisfaction{Interface: iface, Concrete: concrete}
+	if types.Implements(typ, ifaceType) {
+		return sat, true
+	}
+	sat.PointerOnly = true
+	return sat, types.Implements(types.NewPointer(typ), ifaceType)
+}
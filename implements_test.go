@@ -0,0 +1,122 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const implementsLibSrc = `package lib
+
+type Store interface {
+	Get(key string) ([]byte, error)
+}
+
+type Closer interface{ Close() error }
+
+type Any interface{}
+
+type Number interface{ ~int | ~float64 }
+
+type memStore map[string][]byte
+
+func (s memStore) Get(key string) ([]byte, error) { return s[key], nil }
+`
+
+const implementsAppSrc = `package app
+
+import "lib"
+
+type diskStore struct{}
+
+func (s *diskStore) Get(key string) ([]byte, error) { return nil, nil }
+
+func (s *diskStore) Close() error { return nil }
+
+type cache struct{ lib.Store }
+
+type List[T any] []T
+
+func (l List[T]) Get(key string) ([]byte, error) { return nil, nil }
+
+type config struct{}
+`
+
+func TestImplementations(t *testing.T) {
+	fset := token.NewFileSet()
+	libFile, err := parser.ParseFile(fset, "lib.go", implementsLibSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib, err := NewTypedPackage("lib", fset, []*ast.File{libFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appFile, err := parser.ParseFile(fset, "app.go", implementsAppSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := NewTypedPackage("app", fset, []*ast.File{appFile}, &types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) { return lib.Pkg, nil }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specFilter := func(pattern string) Filter {
+		return RegexpFilter{Pattern: regexp.MustCompile(pattern), Type: reflect.TypeOf((*ast.TypeSpec)(nil))}
+	}
+	testcases := []struct {
+		filter  Filter
+		reverse bool
+		exp     []string
+	}{
+		{
+			filter: specFilter(`^Store$`),
+			exp:    []string{"Store: lib.memStore", "Store: app.*diskStore", "Store: app.cache"},
+		},
+		{
+			filter: specFilter(`^(Closer|Any|Number)$`),
+			exp:    []string{"Closer: app.*diskStore", "Any: lib.memStore", "Any: app.diskStore", "Any: app.cache", "Any: app.config"},
+		},
+		{
+			filter:  specFilter(`^diskStore$`),
+			reverse: true,
+			exp:     []string{"Store: app.*diskStore", "Closer: app.*diskStore"},
+		},
+		{
+			filter:  specFilter(`^config$`),
+			reverse: true,
+			exp:     nil,
+		},
+	}
+	for _, test := range testcases {
+		var sats []Satisfaction
+		if test.reverse {
+			sats = Interfaces(test.filter, lib, app)
+		} else {
+			sats = Implementations(test.filter, lib, app)
+		}
+		var got []string
+		for _, sat := range sats {
+			ptr := ""
+			if sat.PointerOnly {
+				ptr = "*"
+			}
+			got = append(got, fmt.Sprintf("%s: %s.%s%s", sat.Interface.Spec.Name.Name, sat.Concrete.Pkg.Pkg.Name(), ptr, sat.Concrete.Spec.Name.Name))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected satisfactions %v, but got %v", test.filter, test.exp, got)
+		}
+	}
+
+	sats := Implementations(specFilter(`^Store$`), lib, app)
+	if len(sats) == 0 || sats[0].Interface.Position().Filename != "lib.go" || sats[len(sats)-1].Position().Filename != "app.go" {
+		t.Errorf("expected positions in lib.go and app.go, but got %+v", sats)
+	}
+}
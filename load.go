@@ -0,0 +1,666 @@
+package astquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"go/version"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Package is a package loaded by Load, ready to be queried.
+type Package struct {
+	// ImportPath is the package's import path.
+	ImportPath string
+
+	// Name is the package's name.
+	Name string
+
+	// Dir is the directory containing the package's files.
+	Dir string
+
+	// Standard is if the package is part of the standard library.
+	Standard bool
+
+	// Fset is the file set the package's files were parsed with. It is shared by all the
+	// packages of a Load.
+	Fset *token.FileSet
+
+	// Files are the package's parsed Go files, with comments, including those using cgo.
+	Files []*ast.File
+
+	// Typed is the package's type information, or nil if it was not requested.
+	Typed *TypedPackage
+
+	// Errors are the errors reported for the package by the go command and the parser.
+	// Type errors are recorded in Typed instead.
+	Errors []error
+}
+
+// NewPackage returns a package of files parsed with fset, so that they can be queried with
+// the package's Find and the matches' positions reported. The package is named after the
+// first file's package clause; its other fields are left empty.
+func NewPackage(fset *token.FileSet, files ...*ast.File) *Package {
+	pkg := &Package{Fset: fset, Files: files}
+	if len(files) > 0 {
+		pkg.Name = files[0].Name.Name
+	}
+	return pkg
+}
+
+// Find returns the nodes of the package's files that match filter.
+func (p *Package) Find(filter Filter) []Match {
+	if finder, hasBindings := filter.(bindingFinder); hasBindings {
+		files := make([]ast.Node, len(p.Files))
+		for i, file := range p.Files {
+			files[i] = file
+		}
+		var matches []Match
+		for _, pm := range finder.Find(files) {
+			match := p.match(pm.Node)
+			match.Bindings = pm.Bindings
+			matches = append(matches, match)
+		}
+		return matches
+	}
+	return p.matches(FindFiles(p.Files, filter))
+}
+
+// FindTyped is like Find for a typed filter. It returns nil if the package was loaded
+// without type information.
+func (p *Package) FindTyped(filter TypedFilter) []Match {
+	if p.Typed == nil {
+		return nil
+	}
+	return p.matches(p.Typed.FindTyped(filter))
+}
+
+func (p *Package) matches(nodes []ast.Node) []Match {
+	var matches []Match
+	for _, node := range nodes {
+		matches = append(matches, p.match(node))
+	}
+	return matches
+}
+
+func (p *Package) match(node ast.Node) Match {
+	return Match{Node: node, PkgPath: p.ImportPath, Pkg: p, Constraint: p.Constraint(node)}
+}
+
+// Position returns the position of the start of node, which must be part of one of the
+// package's files.
+func (p *Package) Position(node ast.Node) token.Position {
+	return p.Fset.Position(node.Pos())
+}
+
+// LoadOptions configures Load.
+type LoadOptions struct {
+	// Dir is the directory the patterns are interpreted in. If empty, the current
+	// directory is used.
+	Dir string
+
+	// Env is the environment of the go command, e.g. to set GOFLAGS. If nil, the current
+	// process's environment is used.
+	Env []string
+
+	// Overlay maps file paths to contents that replace, or add to, the files on disk, such
+	// as an editor's unsaved buffers. Relative paths are relative to Dir.
+	Overlay map[string][]byte
+
+	// GOOS and GOARCH, if non-empty, are the target operating system and architecture
+	// whose files are loaded, instead of those of the go command's environment.
+	GOOS, GOARCH string
+
+	// Tags are additional build tags to satisfy when selecting files (e.g., "integration").
+	Tags []string
+
+	// AllFiles is if every Go file should be loaded regardless of build constraints,
+	// covering all build configurations at once. The constraints of the file containing a
+	// node are reported by Package.Constraint. Type information for such packages is
+	// unreliable, since files for different configurations may conflict.
+	AllFiles bool
+
+	// Tests is if test files should be loaded. The _test.go files of a package's own
+	// tests are added to the package, and those of its external tests (package p_test)
+	// are loaded as a separate package whose import path has a "_test" suffix.
+	Tests bool
+
+	// Vendor is if packages in vendor directories should be loaded when they match a
+	// pattern with a "..." wildcard or a meta-pattern such as "all". Packages named
+	// explicitly are always loaded.
+	Vendor bool
+
+	// ModuleCache is like Vendor for the packages of dependency modules, which are
+	// stored in the module cache.
+	ModuleCache bool
+
+	// DepDepth is how many levels of the imports of the matching packages are loaded as
+	// well: 1 loads their direct imports, and a negative value loads all their transitive
+	// imports, including the standard library packages they depend on.
+	DepDepth int
+
+	// SkipGenerated is if files with a "// Code generated ... DO NOT EDIT." comment
+	// should be left out, so that only hand-written code is queried.
+	SkipGenerated bool
+
+	// Include and Exclude are glob patterns scoping the directories and files to load,
+	// such as "cmd/**" or "**/testdata/**". A "**" element matches any number of path
+	// elements, including none, and other elements are matched as by path.Match. Paths
+	// are slash-separated and relative to Dir, or for LoadFS, to the root of the file
+	// system. Directories matching an Exclude pattern are not walked, so "..." patterns
+	// don't match the packages in them, and files are only loaded if they match no
+	// Exclude pattern and, if any are given, an Include pattern. Packages left without
+	// files are not loaded. Packages outside Dir are unaffected.
+	Include []string
+	Exclude []string
+
+	// BestEffort is if files with syntax errors should be parsed as far as the parser can
+	// recover them, rather than up to the first few errors, and each syntax error recorded
+	// separately in the package's Errors, as a scanner.Error with its position. Otherwise,
+	// a file's syntax errors are recorded together. Either way, files with syntax errors
+	// are kept with what could be parsed of them, so that queries still run over their
+	// intact declarations.
+	BestEffort bool
+
+	// DeclsOnly is if function and method bodies should be skipped, for queries that
+	// only look at declarations: the bodies are left empty, without their statements or
+	// comments, which makes parsing and type-checking large packages much faster.
+	// Identifiers are not resolved to objects in this mode.
+	DeclsOnly bool
+
+	// GoVersion, if non-empty, is the version of the Go language the packages are written
+	// in (e.g., "go1.17"). Syntax introduced by later versions is reported in a package's
+	// Errors, and other language features introduced by later versions are reported as
+	// type errors. The files are still loaded.
+	GoVersion string
+
+	// Parallelism is the maximum number of files parsed concurrently. If zero, GOMAXPROCS
+	// is used.
+	Parallelism int
+
+	// Types is if the packages should be type-checked. Dependencies are imported from
+	// compiled export data, which the go command builds as needed; loaded packages that
+	// import each other share their type information.
+	Types bool
+}
+
+// listedPackage is the subset of the output of go list -json that Load uses.
+type listedPackage struct {
+	ImportPath     string
+	Name           string
+	Dir            string
+	Standard       bool
+	GoFiles        []string
+	CgoFiles       []string
+	IgnoredGoFiles []string
+	TestGoFiles    []string
+	XTestGoFiles   []string
+	ForTest        string
+	Imports        []string
+	Match          []string
+	Module         *struct {
+		Main    bool
+		Replace *struct{ Dir string }
+	}
+	Export    string
+	ImportMap map[string]string
+	DepOnly   bool
+	Error     *struct{ Err string }
+}
+
+// Load loads the packages matching the patterns, which have the form accepted by go list
+// (e.g., "./..." or "net/http"), in module or GOPATH mode alike. If opts is nil, the
+// packages are loaded from the current directory without type information. Load only
+// fails if the go command cannot be run; problems with individual packages are recorded
+// in their Errors.
+func Load(opts *LoadOptions, patterns ...string) ([]*Package, error) {
+	return NewStore(opts).Load(patterns...)
+}
+
+// parseJob is a file to parse for a package.
+type parseJob struct {
+	pkg      *Package
+	filename string
+	src      interface{} // as accepted by parser.ParseFile; if nil, the file is read from disk
+
+	file *ast.File
+	err  error
+}
+
+// parseMode returns the parser mode for loading files with opts.
+func (opts *LoadOptions) parseMode() parser.Mode {
+	mode := parser.ParseComments
+	if opts.BestEffort {
+		mode |= parser.AllErrors
+	}
+	if opts.DeclsOnly {
+		mode |= parser.SkipObjectResolution
+	}
+	return mode
+}
+
+// parseFile parses a file for loading with opts. src is as accepted by parser.ParseFile.
+func (opts *LoadOptions) parseFile(fset *token.FileSet, filename string, src interface{}) (*ast.File, error) {
+	if opts.DeclsOnly {
+		if src == nil {
+			contents, err := os.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			src = contents
+		}
+		contents, isBytes := src.([]byte)
+		if !isBytes {
+			return nil, fmt.Errorf("%s: unsupported source type %T", filename, src)
+		}
+		src = stripFuncBodies(contents)
+	}
+	return parser.ParseFile(fset, filename, src, opts.parseMode())
+}
+
+// keep reports whether the file parsed by job should be part of its package, and returns
+// the errors to record for it.
+func (opts *LoadOptions) keep(job *parseJob) (bool, []error) {
+	var errs []error
+	if list, isList := job.err.(scanner.ErrorList); isList && opts.BestEffort {
+		for _, err := range list {
+			errs = append(errs, err)
+		}
+	} else if job.err != nil {
+		errs = append(errs, job.err)
+	}
+	if job.file == nil || (opts.SkipGenerated && ast.IsGenerated(job.file)) {
+		return false, errs
+	}
+	return true, errs
+}
+
+// parseFiles parses the files of jobs for loading with opts, using up to opts.Parallelism
+// goroutines. If cache is non-nil, files whose contents haven't changed since they were
+// cached are not parsed again.
+func parseFiles(fset *token.FileSet, jobs []*parseJob, opts *LoadOptions, cache *fileCache) {
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	queue := make(chan *parseJob)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if cache != nil {
+					cache.parse(fset, job, opts)
+					continue
+				}
+				job.file, job.err = opts.parseFile(fset, job.filename, job.src)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// LoadStd loads packages of the standard library of the active go toolchain, given by
+// import path or by patterns such as "net/..." or "std". The packages are resolved from
+// GOROOT, regardless of the module opts.Dir (or the current directory) is in, whose
+// setting is ignored. If opts is nil, the packages are loaded without type information.
+func LoadStd(opts *LoadOptions, paths ...string) ([]*Package, error) {
+	stdOpts := LoadOptions{}
+	if opts != nil {
+		stdOpts = *opts
+	}
+	goroot, err := goEnv(&stdOpts, "GOROOT")
+	if err != nil {
+		return nil, err
+	}
+	stdOpts.Dir = filepath.Join(goroot, "src")
+	pkgs, err := Load(&stdOpts, paths...)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		if !pkg.Standard {
+			return nil, fmt.Errorf("%s is not a standard library package", pkg.ImportPath)
+		}
+	}
+	return pkgs, nil
+}
+
+// validate reports whether the options are valid.
+func (opts *LoadOptions) validate() error {
+	if opts.GoVersion != "" && !version.IsValid(opts.GoVersion) {
+		return fmt.Errorf("invalid Go version %q", opts.GoVersion)
+	}
+	for _, pattern := range append(opts.Include[:len(opts.Include):len(opts.Include)], opts.Exclude...) {
+		if err := validateGlob(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// goEnv returns the value of a go environment variable.
+func goEnv(opts *LoadOptions, name string) (string, error) {
+	cmd := exec.Command("go", "env", name)
+	cmd.Dir = opts.Dir
+	cmd.Env = opts.Env
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go env %s: %v", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// absOverlay returns opts.Overlay with its paths made absolute.
+func absOverlay(opts *LoadOptions) (map[string][]byte, error) {
+	if len(opts.Overlay) == 0 {
+		return nil, nil
+	}
+	overlay := make(map[string][]byte)
+	for name, contents := range opts.Overlay {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(opts.Dir, name)
+		}
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return nil, err
+		}
+		overlay[abs] = contents
+	}
+	return overlay, nil
+}
+
+// goList runs go list for the patterns and decodes its output.
+func goList(opts *LoadOptions, overlay map[string][]byte, patterns []string) ([]listedPackage, error) {
+	if len(patterns) > 0 {
+		expanded, err := expandPatterns(opts, patterns)
+		if err != nil {
+			return nil, err
+		}
+		if len(expanded) == 0 {
+			return nil, nil // every directory matched is excluded
+		}
+		patterns = expanded
+	}
+	args := []string{"list", "-e", "-json"}
+	if len(opts.Tags) > 0 {
+		args = append(args, "-tags="+strings.Join(opts.Tags, ","))
+	}
+	if opts.Types || opts.DepDepth != 0 {
+		args = append(args, "-deps")
+	}
+	if opts.Types {
+		args = append(args, "-export")
+		if opts.Tests {
+			args = append(args, "-test") // for the export data of the tests' dependencies
+		}
+	}
+	if len(overlay) > 0 {
+		// The go command reads overlaid files from disk, so write them out.
+		dir, err := os.MkdirTemp("", "astquery-overlay")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		overlayFile, err := writeOverlay(dir, overlay)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-overlay="+overlayFile)
+	}
+	cmd := exec.Command("go", append(args, patterns...)...)
+	cmd.Dir = opts.Dir
+	cmd.Env = opts.Env
+	if opts.GOOS != "" || opts.GOARCH != "" {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		if opts.GOOS != "" {
+			cmd.Env = append(cmd.Env, "GOOS="+opts.GOOS)
+		}
+		if opts.GOARCH != "" {
+			cmd.Env = append(cmd.Env, "GOARCH="+opts.GOARCH)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go list: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var listed []listedPackage
+	dec := json.NewDecoder(&stdout)
+	for dec.More() {
+		var lp listedPackage
+		if err := dec.Decode(&lp); err != nil {
+			return nil, fmt.Errorf("go list: %v", err)
+		}
+		listed = append(listed, lp)
+	}
+	return listed, nil
+}
+
+// expandPatterns returns the patterns with those of the form "dir/..." for directories in
+// opts.Dir expanded so that the go command doesn't walk the directories excluded by
+// opts.Exclude, as LoadFS doesn't: the subtrees with no excluded directory are kept as
+// "dir/..." patterns, and the other directories holding Go files are named explicitly.
+// The directories the go command skips when matching "..." are skipped too, as are vendor
+// directories unless opts.Vendor is set.
+func expandPatterns(opts *LoadOptions, patterns []string) ([]string, error) {
+	if len(opts.Exclude) == 0 {
+		return patterns, nil
+	}
+	base, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	ctxt := build.Default
+	if opts.GOOS != "" {
+		ctxt.GOOS = opts.GOOS
+	}
+	if opts.GOARCH != "" {
+		ctxt.GOARCH = opts.GOARCH
+	}
+	ctxt.BuildTags = opts.Tags
+
+	var expanded []string
+	for _, pattern := range patterns {
+		root, isTree := strings.CutSuffix(pattern, "/...")
+		if !isTree || !(build.IsLocalImport(root) || filepath.IsAbs(root)) || strings.Contains(root, "...") {
+			expanded = append(expanded, pattern)
+			continue
+		}
+		rootDir := root
+		if !filepath.IsAbs(rootDir) {
+			rootDir = filepath.Join(base, root)
+		}
+		if rel, err := filepath.Rel(base, rootDir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			expanded = append(expanded, pattern) // outside Dir, so not scoped
+			continue
+		}
+
+		// Find the excluded directories first, to tell the subtrees without any.
+		var excluded []string
+		walkErr := walkPatternDirs(opts, base, rootDir, func(dir string, isExcluded bool) error {
+			if isExcluded {
+				excluded = append(excluded, dir)
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if walkErr != nil {
+			return nil, walkErr
+		}
+		if len(excluded) == 0 {
+			expanded = append(expanded, pattern)
+			continue
+		}
+		walkErr = walkPatternDirs(opts, base, rootDir, func(dir string, isExcluded bool) error {
+			if isExcluded {
+				return filepath.SkipDir
+			}
+			name := "."
+			if rel, _ := filepath.Rel(base, dir); rel != "." {
+				name = "./" + filepath.ToSlash(rel)
+			}
+			hasExcluded := false
+			for _, ex := range excluded {
+				if strings.HasPrefix(ex, dir+string(filepath.Separator)) {
+					hasExcluded = true
+					break
+				}
+			}
+			if !hasExcluded {
+				expanded = append(expanded, name+"/...")
+				return filepath.SkipDir
+			}
+			if hasPackage(&ctxt, opts, dir) {
+				expanded = append(expanded, name)
+			}
+			return nil
+		})
+		if walkErr != nil {
+			return nil, walkErr
+		}
+	}
+	return expanded, nil
+}
+
+// walkPatternDirs calls fn with each directory that a "..." pattern for root matches,
+// reporting whether opts.Exclude excludes it, in lexical order. fn may return
+// filepath.SkipDir to skip a directory's subdirectories.
+func walkPatternDirs(opts *LoadOptions, base, root string, fn func(dir string, isExcluded bool) error) error {
+	return filepath.WalkDir(root, func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if dir != root {
+			name := entry.Name()
+			if name == "testdata" || (name == "vendor" && !opts.Vendor) || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				return filepath.SkipDir // another module
+			}
+		}
+		rel, err := filepath.Rel(base, dir)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		return fn(dir, rel != "." && opts.excludesDir(rel))
+	})
+}
+
+// hasPackage reports whether dir holds Go files to load with opts, so that naming it
+// explicitly doesn't yield an error where a "..." pattern would match nothing.
+func hasPackage(ctxt *build.Context, opts *LoadOptions, dir string) bool {
+	if opts.AllFiles {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		return len(matches) > 0
+	}
+	_, err := ctxt.ImportDir(dir, 0)
+	_, noGo := err.(*build.NoGoError)
+	return !noGo
+}
+
+// writeOverlay writes the overlaid files and an overlay file describing them, in the form
+// of the go command's -overlay flag, to dir. It returns the overlay file's path.
+func writeOverlay(dir string, overlay map[string][]byte) (string, error) {
+	replace := make(map[string]string)
+	i := 0
+	for name, contents := range overlay {
+		replacement := filepath.Join(dir, fmt.Sprintf("%d-%s", i, filepath.Base(name)))
+		if err := os.WriteFile(replacement, contents, 0644); err != nil {
+			return "", err
+		}
+		replace[name] = replacement
+		i++
+	}
+	data, err := json.Marshal(struct{ Replace map[string]string }{replace})
+	if err != nil {
+		return "", err
+	}
+	overlayFile := filepath.Join(dir, "overlay.json")
+	return overlayFile, os.WriteFile(overlayFile, data, 0644)
+}
+
+// excluded reports whether lp was only matched by wildcard patterns and is vendored or
+// in the module cache, when opts exclude such packages.
+func (lp *listedPackage) excluded(opts *LoadOptions) bool {
+	if len(lp.Match) == 0 {
+		return false // loaded as a dependency
+	}
+	for _, pattern := range lp.Match {
+		if !strings.Contains(pattern, "...") && pattern != "all" {
+			return false // named explicitly
+		}
+	}
+	vendored := strings.Contains(filepath.ToSlash(lp.Dir)+"/", "/vendor/")
+	if vendored {
+		return !opts.Vendor
+	}
+	cached := lp.Module != nil && !lp.Module.Main && lp.Module.Replace == nil
+	return cached && !opts.ModuleCache
+}
+
+// loadsDepth reports whether dependencies at the given depth in the import graph are
+// loaded with opts.
+func (opts *LoadOptions) loadsDepth(depth int) bool {
+	return opts.DepDepth < 0 || depth <= opts.DepDepth
+}
+
+// importDepths returns the depth of each package in listed in the import graph of the
+// packages matching the patterns, which have depth 0.
+func importDepths(listed []listedPackage) map[string]int {
+	byPath := make(map[string]*listedPackage)
+	depths := make(map[string]int)
+	var queue []string
+	for i, lp := range listed {
+		if lp.ForTest != "" || strings.HasSuffix(lp.ImportPath, ".test") {
+			continue
+		}
+		byPath[lp.ImportPath] = &listed[i]
+		if !lp.DepOnly {
+			depths[lp.ImportPath] = 0
+			queue = append(queue, lp.ImportPath)
+		}
+	}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		if lp := byPath[path]; lp != nil {
+			for _, imp := range lp.Imports {
+				if _, seen := depths[imp]; !seen {
+					depths[imp] = depths[path] + 1
+					queue = append(queue, imp)
+				}
+			}
+		}
+	}
+	return depths
+}
+
+// importerFunc implements types.Importer with a function.
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
@@ -0,0 +1,420 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	pkgs, err := Load(nil, "github.com/beyang/go-astquery/testpkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("expected 1 package, but got %d", len(pkgs))
+	}
+	pkg := pkgs[0]
+	if pkg.Name != "service" || pkg.Typed != nil || len(pkg.Errors) != 0 {
+		t.Errorf("expected untyped package service without errors, but got %+v", pkg)
+	}
+	// Files excluded by build constraints are not loaded.
+	var files []string
+	for _, file := range pkg.Files {
+		files = append(files, filepath.Base(pkg.Fset.Position(file.Pos()).Filename))
+	}
+	if exp := []string{"check.go", "uncheckedservice.go"}; !reflect.DeepEqual(files, exp) {
+		t.Errorf("expected files %v, but got %v", exp, files)
+	}
+}
+
+func TestNewPackage(t *testing.T) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range []string{"a.go", "b.go"} {
+		file, err := parser.ParseFile(fset, name, "package p\n\nvar x = 1\n", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	pkg := NewPackage(fset, files...)
+	if pkg.Name != "p" {
+		t.Errorf("expected package p, but got %q", pkg.Name)
+	}
+	var positions []string
+	for _, m := range pkg.Find(FilterFunc(func(node ast.Node) bool {
+		_, isValue := node.(*ast.ValueSpec)
+		return isValue
+	})) {
+		positions = append(positions, m.Position().String())
+	}
+	if exp := []string{"a.go:3:5", "b.go:3:5"}; !reflect.DeepEqual(positions, exp) {
+		t.Errorf("expected matches at %v, but got %v", exp, positions)
+	}
+}
+
+func TestLoadModule(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":      "module example.com/m\n\ngo 1.21\n",
+		"store/db.go": "package store\n\ntype DB struct{}\n\nfunc Open() *DB { return &DB{} }\n",
+		"cmd/main.go": "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/m/store\"\n)\n\nfunc main() { fmt.Println(store.Open()) }\n",
+		"broken/b.go": "package broken\n\nfunc f() { undefined() }\n",
+	})
+	pkgs, err := Load(&LoadOptions{
+		Dir:   dir,
+		Env:   append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod"),
+		Types: true,
+	}, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	byPath := make(map[string]*Package)
+	for _, pkg := range pkgs {
+		paths = append(paths, pkg.ImportPath)
+		byPath[pkg.ImportPath] = pkg
+	}
+	if exp := []string{"example.com/m/broken", "example.com/m/store", "example.com/m/cmd"}; !reflect.DeepEqual(paths, exp) {
+		t.Fatalf("expected packages %v, but got %v", exp, paths)
+	}
+	if errs := byPath["example.com/m/broken"].Typed.Errors; len(errs) != 1 {
+		t.Errorf("expected 1 type error in broken, but got %v", errs)
+	}
+
+	// The main package sees the loaded store package rather than its export data.
+	mainPkg, storePkg := byPath["example.com/m/cmd"].Typed, byPath["example.com/m/store"].Typed
+	if len(mainPkg.Errors) != 0 {
+		t.Fatalf("expected no type errors in main, but got %v", mainPkg.Errors)
+	}
+	calls := mainPkg.FindTyped(CallFilter{PkgPath: "example.com/m/store", Name: "Open"})
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call to store.Open, but got %d", len(calls))
+	}
+	if fn := calleeFunc(calls[0].(*ast.CallExpr), mainPkg.Info); fn != storePkg.Pkg.Scope().Lookup("Open") {
+		t.Errorf("expected call to resolve to the loaded store.Open, but got %v", fn)
+	}
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadOverlay(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":    "module example.com/m\n\ngo 1.21\n",
+		"server.go": "package m\n\nfunc Serve() {}\n",
+	})
+	pkgs, err := Load(&LoadOptions{
+		Dir: dir,
+		Env: append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod"),
+		Overlay: map[string][]byte{
+			"server.go":                       []byte("package m\n\nfunc Serve() { shutdown() }\n"),
+			filepath.Join(dir, "shutdown.go"): []byte("package m\n\nfunc shutdown() {}\n"),
+		},
+		Types: true,
+	}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || len(pkgs[0].Errors) != 0 || len(pkgs[0].Typed.Errors) != 0 {
+		t.Fatalf("expected 1 package without errors, but got %+v", pkgs)
+	}
+	calls := pkgs[0].Typed.FindTyped(CallFilter{PkgPath: "example.com/m", Name: "shutdown"})
+	if len(calls) != 1 {
+		t.Errorf("expected the overlaid call to shutdown, but got %v", calls)
+	}
+}
+
+func TestLoadSyntaxErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":    "module example.com/m\n\ngo 1.21\n",
+		"ok.go":     "package m\n\nfunc OK() {}\n",
+		"broken.go": "package m\n\nfunc Start() {}\n\nfunc Run() {\n\ty := ;\n}\n",
+	})
+	pkgs, err := Load(&LoadOptions{Dir: dir, Env: append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod")}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || len(pkgs[0].Files) != 2 || len(pkgs[0].Errors) != 1 {
+		t.Fatalf("expected 1 package with both files and 1 error, but got %+v", pkgs)
+	}
+	funcs := pkgs[0].Find(FilterFunc(func(node ast.Node) bool {
+		decl, isFunc := node.(*ast.FuncDecl)
+		return isFunc && decl.Name.Name == "Start"
+	}))
+	if len(funcs) != 1 {
+		t.Errorf("expected Start in the file with a syntax error, but got %v", funcs)
+	}
+}
+
+func TestLoadTests(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":          "module example.com/m\n\ngo 1.21\n",
+		"sum.go":          "package m\n\nfunc Sum(xs ...int) int { return 0 }\n",
+		"sum_test.go":     "package m\n\nimport \"testing\"\n\nfunc TestSum(t *testing.T) { _ = Sum() }\n",
+		"example_test.go": "package m_test\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/m\"\n)\n\nfunc ExampleSum() { fmt.Println(m.Sum(1, 2)) }\n",
+	})
+	env := append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod")
+
+	testcases := []struct {
+		opts LoadOptions
+		exp  []string
+	}{
+		{LoadOptions{Dir: dir, Env: env}, []string{"example.com/m [sum.go]"}},
+		{LoadOptions{Dir: dir, Env: env, Tests: true}, []string{"example.com/m [sum.go sum_test.go]", "example.com/m_test [example_test.go]"}},
+		{LoadOptions{Dir: dir, Env: env, Tests: true, Types: true}, []string{"example.com/m [sum.go sum_test.go]", "example.com/m_test [example_test.go]"}},
+	}
+	for _, test := range testcases {
+		pkgs, err := Load(&test.opts, ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pkg := range pkgs {
+			var files []string
+			for _, file := range pkg.Files {
+				files = append(files, filepath.Base(pkg.Fset.Position(file.Pos()).Filename))
+			}
+			got = append(got, fmt.Sprint(pkg.ImportPath, " ", files))
+			if len(pkg.Errors) != 0 || (test.opts.Types && len(pkg.Typed.Errors) != 0) {
+				t.Errorf("%s: expected no errors, but got %v and %v", pkg.ImportPath, pkg.Errors, pkg.Typed)
+			}
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected packages %v, but got %v", test.opts, test.exp, got)
+		}
+	}
+}
+
+func TestLoadVendor(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":                      "module example.com/m\n\ngo 1.21\n\nrequire example.com/dep v1.0.0\n",
+		"main.go":                     "package main\n\nimport \"example.com/dep\"\n\nfunc main() { dep.Run() }\n",
+		"vendor/modules.txt":          "# example.com/dep v1.0.0\n## explicit\nexample.com/dep\n",
+		"vendor/example.com/dep/d.go": "package dep\n\nfunc Run() {}\n",
+	})
+	env := append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=vendor")
+
+	testcases := []struct {
+		opts     LoadOptions
+		patterns []string
+		exp      []string
+	}{
+		{LoadOptions{}, []string{"all"}, []string{"example.com/m"}},
+		{LoadOptions{Vendor: true}, []string{"all"}, []string{"example.com/dep", "example.com/m"}},
+		{LoadOptions{}, []string{"./...", "example.com/dep"}, []string{"example.com/dep", "example.com/m"}},
+	}
+	for _, test := range testcases {
+		test.opts.Dir, test.opts.Env = dir, env
+		pkgs, err := Load(&test.opts, test.patterns...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pkg := range pkgs {
+			got = append(got, pkg.ImportPath)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v %v: expected packages %v, but got %v", test.opts, test.patterns, test.exp, got)
+		}
+	}
+}
+
+func TestLoadIncludeExclude(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":              "module example.com/m\n\ngo 1.21\n",
+		"app/app.go":          "package app\n\nimport _ \"example.com/m/store\"\n",
+		"store/store.go":      "package store\n",
+		"store/store_mock.go": "package store\n",
+		"store/mocks/mock.go": "package mocks\n",
+	})
+	pkgs, err := Load(&LoadOptions{
+		Dir:     filepath.Join(dir, "app"),
+		Env:     append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod"),
+		Exclude: []string{"**/*_mock.go"},
+		Types:   true,
+	}, "example.com/m/...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			rel, _ := filepath.Rel(dir, pkg.Position(file).Filename)
+			files = append(files, filepath.ToSlash(rel))
+		}
+	}
+	// Packages outside Dir are not scoped.
+	if exp := []string{"store/store.go", "store/store_mock.go", "app/app.go", "store/mocks/mock.go"}; !reflect.DeepEqual(files, exp) {
+		t.Errorf("expected files %v, but got %v", exp, files)
+	}
+
+	pkgs, err = Load(&LoadOptions{
+		Dir:     dir,
+		Env:     append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod"),
+		Exclude: []string{"**/mocks/**", "**/*_mock.go"},
+	}, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = nil
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			rel, _ := filepath.Rel(dir, pkg.Position(file).Filename)
+			files = append(files, filepath.ToSlash(rel))
+		}
+	}
+	if exp := []string{"app/app.go", "store/store.go"}; !reflect.DeepEqual(files, exp) {
+		t.Errorf("expected files %v, but got %v", exp, files)
+	}
+}
+
+func TestLoadExcludeWalk(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":                 "module example.com/m\n\ngo 1.21\n",
+		"app/app.go":             "package app\n\nimport _ \"example.com/m/store\"\n",
+		"app/cmd/main.go":        "package main\n",
+		"store/store.go":         "package store\n",
+		"store/ignored/x.go":     "//go:build ignore\n\npackage ignored\n",
+		"store/ignored/gen/y.go": "package gen\n\nimport _ \"nonexistent/dep\"\n",
+		"gen/gen.go":             "package gen\n\nimport _ \"nonexistent/dep\"\n",
+		"docs/README":            "docs\n",
+	})
+	opts := &LoadOptions{
+		Dir:      dir,
+		Env:      append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod"),
+		Exclude:  []string{"gen/**", "**/gen/**"},
+		DepDepth: 1,
+	}
+
+	expanded, err := expandPatterns(opts, []string{"./...", "./app/...", "example.com/m/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"./app/...", "./docs/...", "./store", "./app/...", "example.com/m/..."}
+	if !reflect.DeepEqual(expanded, exp) {
+		t.Errorf("expected patterns %v, but got %v", exp, expanded)
+	}
+
+	// The dependencies of the packages in excluded directories are not loaded either.
+	pkgs, err := Load(opts, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, pkg := range pkgs {
+		paths = append(paths, pkg.ImportPath)
+	}
+	sort.Strings(paths)
+	if exp := []string{"example.com/m/app", "example.com/m/app/cmd", "example.com/m/store"}; !reflect.DeepEqual(paths, exp) {
+		t.Errorf("expected packages %v, but got %v", exp, paths)
+	}
+}
+
+func TestLoadDeps(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":       "module example.com/m\n\ngo 1.21\n",
+		"cmd/main.go":  "package main\n\nimport \"example.com/m/lib\"\n\nfunc main() { lib.Run() }\n",
+		"lib/lib.go":   "package lib\n\nimport \"example.com/m/util\"\n\nfunc Run() { util.Log() }\n",
+		"util/util.go": "package util\n\nimport \"unsafe\"\n\nfunc Log() { _ = unsafe.Sizeof(0) }\n",
+	})
+	env := append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod")
+
+	testcases := []struct {
+		depth int
+		exp   []string
+	}{
+		{0, []string{"example.com/m/cmd"}},
+		{1, []string{"example.com/m/lib", "example.com/m/cmd"}},
+		{-1, []string{"unsafe", "example.com/m/util", "example.com/m/lib", "example.com/m/cmd"}},
+	}
+	for _, test := range testcases {
+		pkgs, err := Load(&LoadOptions{Dir: dir, Env: env, DepDepth: test.depth, Types: true}, "./cmd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pkg := range pkgs {
+			got = append(got, pkg.ImportPath)
+			if len(pkg.Typed.Errors) != 0 {
+				t.Errorf("%s: expected no type errors, but got %v", pkg.ImportPath, pkg.Typed.Errors)
+			}
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("DepDepth %d: expected packages %v, but got %v", test.depth, test.exp, got)
+		}
+	}
+
+	// Standard library dependencies are loaded from source too.
+	pkgs, err := Load(&LoadOptions{DepDepth: 1, Types: true}, "errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		if len(pkg.Files) == 0 && pkg.ImportPath != "unsafe" {
+			t.Errorf("%s: expected files to be loaded", pkg.ImportPath)
+		}
+	}
+	if len(pkgs) < 2 || pkgs[len(pkgs)-1].ImportPath != "errors" {
+		t.Errorf("expected errors and its imports, but got %d packages", len(pkgs))
+	}
+}
+
+func TestLoadStd(t *testing.T) {
+	// The standard library is found from anywhere, even inside another module.
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"go.mod": "module example.com/m\n\ngo 1.21\n"})
+	pkgs, err := LoadStd(&LoadOptions{Dir: dir, Types: true}, "net/http", "container/...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	var http *Package
+	for _, pkg := range pkgs {
+		paths = append(paths, pkg.ImportPath)
+		if pkg.ImportPath == "net/http" {
+			http = pkg
+		}
+		if !pkg.Standard || len(pkg.Errors) != 0 || len(pkg.Typed.Errors) != 0 {
+			t.Errorf("%s: expected a standard package without errors, but got %v and %v", pkg.ImportPath, pkg.Errors, pkg.Typed.Errors)
+		}
+	}
+	sort.Strings(paths)
+	if exp := []string{"container/heap", "container/list", "container/ring", "net/http"}; !reflect.DeepEqual(paths, exp) {
+		t.Errorf("expected packages %v, but got %v", exp, paths)
+	}
+
+	clients := http.Find(SetFilter{Names: []string{"Client"}, Type: reflect.TypeOf((*ast.TypeSpec)(nil))})
+	if len(clients) != 1 {
+		t.Errorf("expected to find http.Client, but got %v", clients)
+	}
+
+	if _, err := LoadStd(nil, "example.com/m"); err == nil {
+		t.Errorf("expected an error for a non-standard package")
+	}
+}
@@ -0,0 +1,257 @@
+package astquery
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// LoadFS loads the packages in the directory tree of fsys rooted at opts.Dir (or the root
+// of fsys if opts is nil or Dir is empty), such as an embed.FS or an fstest.MapFS, without
+// running the go command. As with the go command, directories named testdata, or
+// beginning with '.' or '_', are skipped, as are files excluded by build constraints for
+// the target platform and tags. Vendor directories are skipped unless opts.Vendor is set,
+// and test files unless opts.Tests is set.
+//
+// Import paths are formed from the module path declared by a go.mod file at the root of
+// fsys, if there is one, and the directories' paths within fsys. Vendored packages have
+// the import path they are vendored under. If opts.Types is set, the
+// packages are type-checked; imports of packages outside fsys are resolved from compiled
+// export data. Overlay paths are paths within fsys, and overlaid files can only be added
+// to directories that exist in fsys. opts.Env is ignored.
+func LoadFS(fsys fs.FS, opts *LoadOptions) ([]*Package, error) {
+	return loadFS(fsys, opts, fsModulePath(fsys))
+}
+
+// loadFS is LoadFS with the module path given by the caller.
+func loadFS(fsys fs.FS, opts *LoadOptions, modPath string) ([]*Package, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	root := opts.Dir
+	if root == "" {
+		root = "."
+	}
+
+	overlay := make(map[string][]byte)
+	for name, contents := range opts.Overlay {
+		overlay[path.Clean(name)] = contents
+	}
+
+	ctxt := build.Default
+	if opts.GOOS != "" {
+		ctxt.GOOS = opts.GOOS
+	}
+	if opts.GOARCH != "" {
+		ctxt.GOARCH = opts.GOARCH
+	}
+	ctxt.BuildTags = opts.Tags
+	ctxt.JoinPath = path.Join
+	ctxt.OpenFile = func(name string) (io.ReadCloser, error) {
+		if contents, exists := overlay[name]; exists {
+			return io.NopCloser(bytes.NewReader(contents)), nil
+		}
+		return fsys.Open(name)
+	}
+
+	fset := token.NewFileSet()
+	var pkgs []*Package
+	var jobs []*parseJob
+	err := fs.WalkDir(fsys, root, func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		base := path.Base(dir)
+		if dir != root && (base == "testdata" || (base == "vendor" && !opts.Vendor) || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+			return fs.SkipDir
+		}
+		if dir != "." && opts.excludesDir(dir) {
+			return fs.SkipDir
+		}
+		pkg, pkgJobs, err := listFSDir(fsys, overlay, &ctxt, opts, dir)
+		if err != nil {
+			return err
+		}
+		if pkg != nil {
+			pkg.ImportPath = path.Join(modPath, dir)
+			if i := strings.LastIndex("/"+dir, "/vendor/"); i >= 0 {
+				pkg.ImportPath = dir[i+len("vendor/"):] // imported without the vendor prefix
+			}
+			pkg.Fset = fset
+			pkgs = append(pkgs, pkg)
+			jobs = append(jobs, pkgJobs...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	parseFiles(fset, jobs, opts, nil)
+	xtests := make(map[*Package]*Package)
+	for _, job := range jobs {
+		pkg := job.pkg
+		if job.file != nil && strings.HasSuffix(job.filename, "_test.go") && strings.HasSuffix(job.file.Name.Name, "_test") {
+			if xtests[pkg] == nil {
+				xtests[pkg] = &Package{ImportPath: pkg.ImportPath + "_test", Dir: pkg.Dir, Fset: fset}
+			}
+			pkg = xtests[pkg]
+		}
+		keep, errs := opts.keep(job)
+		pkg.Errors = append(pkg.Errors, errs...)
+		if !keep {
+			continue
+		}
+		if pkg.Name == "" {
+			pkg.Name = job.file.Name.Name
+		} else if job.file.Name.Name != pkg.Name {
+			pkg.Errors = append(pkg.Errors, fmt.Errorf("%s: found packages %s and %s in %s", job.filename, pkg.Name, job.file.Name.Name, pkg.Dir))
+			continue
+		}
+		pkg.Files = append(pkg.Files, job.file)
+		if opts.GoVersion != "" {
+			pkg.Errors = append(pkg.Errors, checkSyntaxVersion(fset, job.file, opts.GoVersion)...)
+		}
+	}
+	if len(xtests) > 0 {
+		var withXTests []*Package
+		for _, pkg := range pkgs {
+			if len(pkg.Files) > 0 || len(pkg.Errors) > 0 {
+				withXTests = append(withXTests, pkg)
+			}
+			if xtest := xtests[pkg]; xtest != nil {
+				withXTests = append(withXTests, xtest)
+			}
+		}
+		pkgs = withXTests
+	}
+	if opts.Types {
+		typeCheckFS(pkgs, opts)
+	}
+	return pkgs, nil
+}
+
+// listFSDir returns the package in dir and the jobs to parse its Go files, or nil if
+// there are none.
+func listFSDir(fsys fs.FS, overlay map[string][]byte, ctxt *build.Context, opts *LoadOptions, dir string) (*Package, []*parseJob, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if _, overlaid := overlay[path.Join(dir, entry.Name())]; !entry.IsDir() && !overlaid {
+			names = append(names, entry.Name())
+		}
+	}
+	for name := range overlay {
+		if path.Dir(name) == dir {
+			names = append(names, path.Base(name))
+		}
+	}
+	sort.Strings(names)
+
+	pkg := &Package{Dir: dir}
+	var jobs []*parseJob
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".go") || (strings.HasSuffix(name, "_test.go") && !opts.Tests) {
+			continue
+		}
+		if !opts.AllFiles {
+			match, err := ctxt.MatchFile(dir, name)
+			if err != nil {
+				pkg.Errors = append(pkg.Errors, err)
+				continue
+			}
+			if !match {
+				continue
+			}
+		}
+		filename := path.Join(dir, name)
+		if !opts.includesFile(filename) {
+			continue
+		}
+		src, overlaid := overlay[filename]
+		if !overlaid {
+			if src, err = fs.ReadFile(fsys, filename); err != nil {
+				return nil, nil, err
+			}
+		}
+		jobs = append(jobs, &parseJob{pkg: pkg, filename: filename, src: src})
+	}
+	if len(jobs) == 0 && len(pkg.Errors) == 0 {
+		return nil, nil, nil
+	}
+	return pkg, jobs, nil
+}
+
+// fsModulePath returns the module path declared by the go.mod file at the root of fsys, or
+// the empty string if there is none.
+func fsModulePath(fsys fs.FS) string {
+	data, err := fs.ReadFile(fsys, "go.mod")
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// typeCheckFS type-checks pkgs as configured by opts, checking each package before the
+// packages that import it.
+// Other imports are resolved from compiled export data.
+func typeCheckFS(pkgs []*Package, opts *LoadOptions) {
+	byPath := make(map[string]*Package)
+	for _, pkg := range pkgs {
+		byPath[pkg.ImportPath] = pkg
+	}
+	exportImporter := importer.Default()
+	checking := make(map[*Package]bool)
+	var check func(pkg *Package)
+	imp := importerFunc(func(path string) (*types.Package, error) {
+		pkg, exists := byPath[path]
+		if !exists {
+			return exportImporter.Import(path)
+		}
+		if checking[pkg] {
+			return nil, fmt.Errorf("import cycle through %s", path)
+		}
+		check(pkg)
+		return pkg.Typed.Pkg, nil
+	})
+	check = func(pkg *Package) {
+		if pkg.Typed != nil {
+			return
+		}
+		checking[pkg] = true
+		pkg.Typed, _ = NewTypedPackage(pkg.ImportPath, pkg.Fset, pkg.Files, &types.Config{
+			Importer:         imp,
+			GoVersion:        opts.GoVersion,
+			IgnoreFuncBodies: opts.DeclsOnly,
+		})
+		checking[pkg] = false
+	}
+	for _, pkg := range pkgs {
+		check(pkg)
+	}
+}
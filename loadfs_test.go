@@ -0,0 +1,375 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":                 {Data: []byte("module example.com/m\n\ngo 1.21\n")},
+		"main.go":                {Data: []byte("package main\n\nimport \"example.com/m/util\"\n\nfunc main() { util.Greet(\"world\") }\n")},
+		"util/greet.go":          {Data: []byte("package util\n\nimport \"fmt\"\n\nfunc Greet(name string) { fmt.Println(\"hello\", name) }\n")},
+		"util/greet_test.go":     {Data: []byte("package util\n\nfunc TestGreet() {}\n")},
+		"util/ignored.go":        {Data: []byte("//go:build ignore\n\npackage util\n\nfunc Ignored() {}\n")},
+		"util/testdata/x.go":     {Data: []byte("package x\n")},
+		"mixed/a.go":             {Data: []byte("package a\n")},
+		"mixed/b.go":             {Data: []byte("package b\n")},
+		"docs/README.md":         {Data: []byte("# docs\n")},
+		"_examples/example.go":   {Data: []byte("package examples\n")},
+		"internal/.hidden/h.go":  {Data: []byte("package hidden\n")},
+		"internal/plat/plat.go":  {Data: []byte("package plat\n")},
+		"internal/plat/x_zos.go": {Data: []byte("package plat\n\nfunc onlyOnZOS() {}\n")},
+	}
+	pkgs, err := LoadFS(fsys, &LoadOptions{Types: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, pkg := range pkgs {
+		var files []string
+		for _, file := range pkg.Files {
+			files = append(files, pkg.Fset.Position(file.Pos()).Filename)
+		}
+		got = append(got, pkg.ImportPath+" "+pkg.Name+" "+fmt.Sprint(files)+" "+fmt.Sprint(len(pkg.Errors)))
+	}
+	exp := []string{
+		"example.com/m main [main.go] 0",
+		"example.com/m/internal/plat plat [internal/plat/plat.go] 0",
+		"example.com/m/mixed a [mixed/a.go] 1",
+		"example.com/m/util util [util/greet.go] 0",
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected packages %v, but got %v", exp, got)
+	}
+
+	// main was type-checked against the util package loaded from fsys.
+	main := pkgs[0].Typed
+	if main == nil || len(main.Errors) != 0 {
+		t.Fatalf("expected main to type-check, but got %+v", main)
+	}
+	calls := main.FindTyped(CallFilter{PkgPath: "example.com/m/util", Name: "Greet"})
+	if len(calls) != 1 {
+		t.Errorf("expected 1 call to util.Greet, but got %d", len(calls))
+	}
+	if util := pkgs[3].Typed; util == nil || len(util.Errors) != 0 {
+		t.Errorf("expected util to type-check, but got %+v", util)
+	}
+
+	// Loading can be restricted to a subtree.
+	pkgs, err = LoadFS(fsys, &LoadOptions{Dir: "util"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].ImportPath != "example.com/m/util" || pkgs[0].Typed != nil {
+		t.Errorf("expected the untyped util package, but got %v", pkgs)
+	}
+}
+
+func TestLoadFSOverlay(t *testing.T) {
+	fsys := fstest.MapFS{
+		"server.go": {Data: []byte("package m\n\nfunc Serve() {}\n")},
+	}
+	pkgs, err := LoadFS(fsys, &LoadOptions{
+		Overlay: map[string][]byte{
+			"server.go":   []byte("package m\n\nfunc Serve() { shutdown() }\n"),
+			"shutdown.go": []byte("package m\n\nfunc shutdown() {}\n"),
+		},
+		Types: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || len(pkgs[0].Files) != 2 || len(pkgs[0].Typed.Errors) != 0 {
+		t.Fatalf("expected 1 package with 2 files and no errors, but got %+v", pkgs)
+	}
+	calls := pkgs[0].Typed.FindTyped(CallFilter{PkgPath: ".", Name: "shutdown"})
+	if len(calls) != 1 {
+		t.Errorf("expected the overlaid call to shutdown, but got %v", calls)
+	}
+}
+
+func TestLoadFSParallelism(t *testing.T) {
+	fsys := fstest.MapFS{"empty/empty.go": {}}
+	for i := 0; i < 20; i++ {
+		dir := fmt.Sprintf("pkg%02d", i)
+		for j := 0; j < 5; j++ {
+			fsys[fmt.Sprintf("%s/f%d.go", dir, j)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("package %s\n\nfunc F%d() {}\n", dir, j))}
+		}
+	}
+	summary := func(pkgs []*Package) []string {
+		var lines []string
+		for _, pkg := range pkgs {
+			var files []string
+			for _, file := range pkg.Files {
+				files = append(files, pkg.Fset.Position(file.Pos()).Filename)
+			}
+			lines = append(lines, fmt.Sprint(pkg.ImportPath, files, len(pkg.Errors)))
+		}
+		return lines
+	}
+
+	sequential, err := LoadFS(fsys, &LoadOptions{Parallelism: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sequential) != 21 {
+		t.Fatalf("expected 21 packages, but got %d", len(sequential))
+	}
+	if errs := sequential[0].Errors; len(errs) != 1 {
+		t.Errorf("expected a syntax error in the empty file, but got %v", errs)
+	}
+	parallel, err := LoadFS(fsys, &LoadOptions{Parallelism: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, got := summary(sequential), summary(parallel); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected parallel loading to match sequential loading %v, but got %v", exp, got)
+	}
+}
+
+func TestLoadFSTests(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sum.go":          {Data: []byte("package m\n\nfunc Sum(xs ...int) int { return 0 }\n")},
+		"sum_test.go":     {Data: []byte("package m\n\nimport \"testing\"\n\nfunc TestSum(t *testing.T) { _ = Sum() }\n")},
+		"example_test.go": {Data: []byte("package m_test\n\nimport \"m\"\n\nfunc ExampleSum() { _ = m.Sum(1, 2) }\n")},
+		"only/x_test.go":  {Data: []byte("package only_test\n")},
+		"go.mod":          {Data: []byte("module m\n")},
+	}
+	pkgs, err := LoadFS(fsys, &LoadOptions{Tests: true, Types: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, pkg := range pkgs {
+		var files []string
+		for _, file := range pkg.Files {
+			files = append(files, pkg.Fset.Position(file.Pos()).Filename)
+		}
+		got = append(got, fmt.Sprint(pkg.ImportPath, " ", pkg.Name, " ", files, " ", len(pkg.Typed.Errors)))
+	}
+	exp := []string{
+		"m m [sum.go sum_test.go] 0",
+		"m_test m_test [example_test.go] 0",
+		"m/only_test only_test [only/x_test.go] 0",
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected packages %v, but got %v", exp, got)
+	}
+}
+
+func TestLoadFSSkipGenerated(t *testing.T) {
+	fsys := fstest.MapFS{
+		"api.go":         {Data: []byte("package api\n\nfunc Handle() {}\n")},
+		"api.pb.go":      {Data: []byte("// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage api\n\ntype Request struct{}\n")},
+		"stringer.go":    {Data: []byte("// Package api.\n//\n// Code generated by stringer; DO NOT EDIT.\npackage api\n")},
+		"not_really.go":  {Data: []byte("package api\n\n// Code generated by hand. DO NOT EDIT.\nvar x int\n")},
+		"mentions_it.go": {Data: []byte("// This file is not Code generated ... DO NOT EDIT.\npackage api\n")},
+	}
+	testcases := []struct {
+		skip bool
+		exp  []string
+	}{
+		{false, []string{"api.go", "api.pb.go", "mentions_it.go", "not_really.go", "stringer.go"}},
+		{true, []string{"api.go", "mentions_it.go", "not_really.go"}},
+	}
+	for _, test := range testcases {
+		pkgs, err := LoadFS(fsys, &LoadOptions{SkipGenerated: test.skip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var files []string
+		for _, file := range pkgs[0].Files {
+			files = append(files, pkgs[0].Fset.Position(file.Pos()).Filename)
+		}
+		if !reflect.DeepEqual(files, test.exp) {
+			t.Errorf("SkipGenerated %v: expected files %v, but got %v", test.skip, test.exp, files)
+		}
+	}
+}
+
+func TestLoadFSVendor(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":                      {Data: []byte("module example.com/m\n")},
+		"main.go":                     {Data: []byte("package main\n")},
+		"vendor/example.com/dep/d.go": {Data: []byte("package dep\n")},
+	}
+	for _, vendor := range []bool{false, true} {
+		pkgs, err := LoadFS(fsys, &LoadOptions{Vendor: vendor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pkg := range pkgs {
+			got = append(got, pkg.ImportPath)
+		}
+		exp := []string{"example.com/m"}
+		if vendor {
+			exp = append(exp, "example.com/dep")
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("Vendor %v: expected packages %v, but got %v", vendor, exp, got)
+		}
+	}
+}
+
+func TestLoadFSGoVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":  {Data: []byte("module example.com/m\n")},
+		"m.go":    {Data: []byte("package m\n\nfunc Map[T any](s []T) {}\n\nconst mask = 0b1010\n")},
+		"loop.go": {Data: []byte("package m\n\nfunc loop() {\n\tfor i := range 10 {\n\t\t_ = i\n\t}\n}\n")},
+	}
+	testcases := []struct {
+		version string
+		types   bool
+		exp     []string
+	}{
+		{"", true, nil},
+		{"go1.23", true, nil},
+		{"go1.21", false, nil},
+		{"go1.21", true, []string{"loop.go:4:"}},
+		{"go1.17", false, []string{"m.go:3:9: type parameters requires go1.18 or later (version set to go1.17)"}},
+		{"go1.12", false, []string{"m.go:3:9: type parameters requires go1.18 or later", "m.go:5:14: binary literals requires go1.13 or later"}},
+	}
+	for _, test := range testcases {
+		pkgs, err := LoadFS(fsys, &LoadOptions{GoVersion: test.version, Types: test.types})
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := pkgs[0].Errors
+		if pkgs[0].Typed != nil {
+			errs = append(errs, pkgs[0].Typed.Errors...)
+		}
+		if len(errs) != len(test.exp) {
+			t.Errorf("%+v: expected %d errors, but got %v", test, len(test.exp), errs)
+			continue
+		}
+		for i, err := range errs {
+			if !strings.HasPrefix(err.Error(), test.exp[i]) {
+				t.Errorf("%+v: expected error starting with %q, but got %q", test, test.exp[i], err)
+			}
+		}
+	}
+
+	if _, err := LoadFS(fsys, &LoadOptions{GoVersion: "1.17"}); err == nil {
+		t.Errorf("expected an error for an invalid version, but got none")
+	}
+}
+
+func TestLoadFSBestEffort(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ok.go":     {Data: []byte("package p\n\nfunc OK() {}\n")},
+		"broken.go": {Data: []byte("package p\n\nfunc Start() {}\n\nfunc Run() {\n\tif x {\n\t}\n\ty := ;\n\tif {\n\t}\n}\n\nfunc Stop() {}\n")},
+	}
+	testcases := []struct {
+		bestEffort bool
+		exp        []string
+		errs       []string
+	}{
+		{false, []string{"OK", "Run", "Start", "Stop"}, []string{"broken.go:8:7: expected operand, found ';' (and 1 more errors)"}},
+		{true, []string{"OK", "Run", "Start", "Stop"}, []string{
+			"broken.go:8:7: expected operand, found ';'",
+			"broken.go:9:2: expected ';', found 'if'",
+			"broken.go:9:5: missing condition in if statement",
+		}},
+	}
+	for _, test := range testcases {
+		pkgs, err := LoadFS(fsys, &LoadOptions{BestEffort: test.bestEffort})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var funcs, errs []string
+		for _, m := range pkgs[0].Find(FilterFunc(func(node ast.Node) bool {
+			_, isFunc := node.(*ast.FuncDecl)
+			return isFunc
+		})) {
+			funcs = append(funcs, m.Node.(*ast.FuncDecl).Name.Name)
+		}
+		sort.Strings(funcs)
+		for _, err := range pkgs[0].Errors {
+			errs = append(errs, err.Error())
+		}
+		if !reflect.DeepEqual(funcs, test.exp) {
+			t.Errorf("BestEffort %v: expected funcs %v, but got %v", test.bestEffort, test.exp, funcs)
+		}
+		if !reflect.DeepEqual(errs, test.errs) {
+			t.Errorf("BestEffort %v: expected errors %q, but got %q", test.bestEffort, test.errs, errs)
+		}
+	}
+}
+
+func TestLoadFSDeclsOnly(t *testing.T) {
+	fsys := fstest.MapFS{
+		"p.go": {Data: []byte("package p\n\nimport \"fmt\"\n\n// Greet greets.\nfunc Greet(name string) string {\n\treturn fmt.Sprint(\"hello \", name)\n}\n\ntype T struct{}\n\nfunc (T) Run() {\n\tGreet(\"world\")\n}\n")},
+	}
+	pkgs, err := LoadFS(fsys, &LoadOptions{DeclsOnly: true, Types: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) != 0 || len(pkg.Typed.Errors) != 0 {
+		t.Fatalf("expected no errors, but got %v and %v", pkg.Errors, pkg.Typed.Errors)
+	}
+	if calls := pkg.Find(FilterFunc(func(node ast.Node) bool {
+		_, isCall := node.(*ast.CallExpr)
+		return isCall
+	})); len(calls) != 0 {
+		t.Errorf("expected function bodies to be skipped, but found calls %v", calls)
+	}
+	var funcs []string
+	for _, m := range pkg.FindTyped(ObjectFilter{Kind: FuncObject}) {
+		funcs = append(funcs, fmt.Sprintf("%s:%d", m.Node.(*ast.Ident).Name, m.Position().Line))
+	}
+	if exp := []string{"Greet:6", "Run:12"}; !reflect.DeepEqual(funcs, exp) {
+		t.Errorf("expected funcs %v, but got %v", exp, funcs)
+	}
+	if doc := pkg.Files[0].Decls[1].(*ast.FuncDecl).Doc; doc == nil || doc.Text() != "Greet greets.\n" {
+		t.Errorf("expected doc comments to be kept, but got %v", doc)
+	}
+}
+
+func TestLoadFSIncludeExclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":                   {Data: []byte("module example.com/m\n")},
+		"cmd/tool/main.go":         {Data: []byte("package main\n")},
+		"store/store.go":           {Data: []byte("package store\n")},
+		"store/store_mock.go":      {Data: []byte("package store\n")},
+		"store/mocks/mock.go":      {Data: []byte("package mocks\n")},
+		"internal/mocks/x/mock.go": {Data: []byte("package x\n")},
+	}
+	testcases := []struct {
+		include []string
+		exclude []string
+		exp     []string
+	}{
+		{nil, nil, []string{"cmd/tool/main.go", "internal/mocks/x/mock.go", "store/store.go", "store/store_mock.go", "store/mocks/mock.go"}},
+		{nil, []string{"**/mocks/**", "**/*_mock.go"}, []string{"cmd/tool/main.go", "store/store.go"}},
+		{[]string{"store/**"}, []string{"**/mocks/**"}, []string{"store/store.go", "store/store_mock.go"}},
+		{[]string{"cmd/**", "**/mock.go"}, []string{"internal/**"}, []string{"cmd/tool/main.go", "store/mocks/mock.go"}},
+	}
+	for _, test := range testcases {
+		pkgs, err := LoadFS(fsys, &LoadOptions{Include: test.include, Exclude: test.exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var files []string
+		for _, pkg := range pkgs {
+			for _, file := range pkg.Files {
+				files = append(files, pkg.Position(file).Filename)
+			}
+		}
+		if !reflect.DeepEqual(files, test.exp) {
+			t.Errorf("%+v: expected files %v, but got %v", test, test.exp, files)
+		}
+	}
+
+	if _, err := LoadFS(fsys, &LoadOptions{Exclude: []string{"[a-"}}); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,187 @@
+package astquery
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Macros are named query predicates, which queries compiled with Macros.CompileQuery can
+// refer to as "$name", so that a vocabulary of rules can be defined once and shared:
+//
+//	//FuncDecl[$is-http-handler and not($is-test-helper)]
+//
+// A macro is a predicate of Query, as written in brackets, and can refer to other
+// macros, as long as no macro refers to itself.
+type Macros struct {
+	defs  map[string]string
+	preds map[string]queryPred
+
+	// resolving are the macros being compiled, innermost last, to detect cycles.
+	resolving []string
+}
+
+// LoadMacros reads the macros of a macro file. See ParseMacros.
+func LoadMacros(filename string) (*Macros, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ParseMacros(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return m, nil
+}
+
+// ParseMacros parses the macros of a YAML macro file, which maps the name of each macro
+// to its predicate under "macros":
+//
+//	macros:
+//	  is-test-helper: "@name=~'^(assert|check|must)' and descendant::Ident[@name='t']"
+//	  is-exported-helper: "$is-test-helper and @exported='true'"
+//
+// Names are made of letters, digits, '-' and '_'. All the macros are compiled, and cycles
+// among them are reported as errors.
+func ParseMacros(src []byte) (*Macros, error) {
+	docs, err := parseYAML(string(src))
+	if err != nil {
+		return nil, err
+	}
+	defs := make(map[string]string)
+	for _, doc := range docs {
+		m, isMap := doc.(map[string]interface{})
+		if !isMap {
+			return nil, fmt.Errorf("expected a mapping of macros")
+		}
+		macros, isMap := m["macros"].(map[string]interface{})
+		if !isMap {
+			return nil, fmt.Errorf("macros: expected a mapping of macros")
+		}
+		for name, def := range macros {
+			if defs[name], isMap = def.(string); !isMap {
+				return nil, fmt.Errorf("macro %q: expected a string", name)
+			}
+		}
+	}
+	return NewMacros(defs)
+}
+
+// NewMacros compiles macros, given the predicate of each by name.
+func NewMacros(defs map[string]string) (*Macros, error) {
+	m := &Macros{defs: defs, preds: make(map[string]queryPred)}
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		if !isMacroName(name) {
+			return nil, fmt.Errorf("macro %q: invalid name", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := m.pred(name); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Names returns the names of the macros, sorted.
+func (m *Macros) Names() []string {
+	names := make([]string, 0, len(m.defs))
+	for name := range m.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CompileQuery compiles a query, which can refer to the macros.
+func (m *Macros) CompileQuery(src string) (*Query, error) {
+	return compileQuery(src, m)
+}
+
+// MustCompileQuery is like CompileQuery but panics if the query cannot be compiled.
+func (m *Macros) MustCompileQuery(src string) *Query {
+	q, err := m.CompileQuery(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// pred returns the compiled predicate of a macro, compiling it if needed.
+func (m *Macros) pred(name string) (queryPred, error) {
+	if pred, isCompiled := m.preds[name]; isCompiled {
+		return pred, nil
+	}
+	src := m.defs[name]
+	for i, resolving := range m.resolving {
+		if resolving == name {
+			return nil, fmt.Errorf("cycle: %s", strings.Join(append(m.resolving[i:], name), " -> "))
+		}
+	}
+	m.resolving = append(m.resolving, name)
+	defer func() { m.resolving = m.resolving[:len(m.resolving)-1] }()
+
+	p := &queryParser{src: src, macros: m}
+	pred, err := p.pred()
+	if err == nil {
+		if p.skipSpace(); p.pos < len(src) {
+			err = p.errorf("unexpected %q", src[p.pos:])
+		} else if p.params > 0 {
+			err = p.errorf("placeholders are not supported in macros")
+		}
+	}
+	if err != nil {
+		if _, isQueryErr := err.(*QueryError); isQueryErr {
+			err = queryError(QueryLanguage, src, err)
+		}
+		return nil, fmt.Errorf("macro %q: %v", name, err)
+	}
+	m.preds[name] = pred
+	return pred, nil
+}
+
+// macroRef parses a reference to a macro, after its '$'.
+func (p *queryParser) macroRef() (queryPred, error) {
+	start := p.pos
+	for p.pos < len(p.src) && isMacroRune(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+	if name == "" {
+		return nil, p.errorf("expected a macro name")
+	}
+	p.pos = start
+	if p.macros == nil || !p.macros.has(name) {
+		return nil, p.semanticf("unknown macro %q", name)
+	}
+	pred, err := p.macros.pred(name)
+	if err != nil {
+		return nil, p.semanticf("%v", err)
+	}
+	p.pos += len(name)
+	return pred, nil
+}
+
+// has reports whether there is a macro with the given name.
+func (m *Macros) has(name string) bool {
+	_, exists := m.defs[name]
+	return exists
+}
+
+func isMacroName(name string) bool {
+	for _, r := range name {
+		if !isMacroRune(r) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func isMacroRune(r rune) bool {
+	return r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,91 @@
+package astquery
+
+import (
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const macroFile = `# Shared vocabulary.
+macros:
+  is-handler: "count(descendant::Field) = 2 and descendant::SelectorExpr[@name='ResponseWriter']"
+  is-exported-handler: "$is-handler and @exported='true'"
+  is-test-helper: "descendant::Field[@name='t']"
+`
+
+const macroSrc = `package p
+
+func Index(w http.ResponseWriter, r *http.Request) {}
+
+func admin(w http.ResponseWriter, r *http.Request) {}
+
+func checkIndex(t *testing.T) {}
+`
+
+func TestMacros(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "macros.yml")
+	if err := os.WriteFile(filename, []byte(macroFile), 0666); err != nil {
+		t.Fatal(err)
+	}
+	macros, err := LoadMacros(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"is-exported-handler", "is-handler", "is-test-helper"}; !reflect.DeepEqual(macros.Names(), exp) {
+		t.Errorf("expected macros %v, but got %v", exp, macros.Names())
+	}
+	file := parseTestFile(t, macroSrc)
+	testcases := []struct {
+		query string
+		exp   []string
+	}{
+		{`//FuncDecl[$is-handler]/Ident`, []string{"Index", "admin"}},
+		{`//FuncDecl[$is-exported-handler]/Ident`, []string{"Index"}},
+		{`//FuncDecl[not($is-handler or $is-test-helper)]`, nil},
+		{`//FuncDecl[$is-test-helper and @name=?]/Ident`, nil},
+	}
+	for _, test := range testcases {
+		q, err := macros.CompileQuery(test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, node := range Find([]ast.Node{file}, q) {
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.query, test.exp, got)
+		}
+	}
+}
+
+func TestMacrosErrors(t *testing.T) {
+	testcases := []struct {
+		defs map[string]string
+		err  string
+	}{
+		{map[string]string{"a": "$b", "b": "$c and @exported", "c": "@name='x' or $a"}, "cycle: a -> b -> c -> a"},
+		{map[string]string{"self": "not($self)"}, "cycle: self -> self"},
+		{map[string]string{"a": "$missing"}, `macro "a": query "$missing": offset 1: unknown macro "missing"`},
+		{map[string]string{"a": "@name=?"}, "placeholders are not supported in macros"},
+		{map[string]string{"a": "@exported]"}, `macro "a": query "@exported]": offset 9: unexpected "]"`},
+		{map[string]string{"a b": "@exported"}, `macro "a b": invalid name`},
+	}
+	for _, test := range testcases {
+		_, err := NewMacros(test.defs)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: expected error containing %q, but got %v", test.defs, test.err, err)
+		}
+	}
+
+	if _, err := CompileQuery(`//FuncDecl[$is-handler]`); err == nil || !strings.Contains(err.Error(), `offset 12: unknown macro "is-handler"`) {
+		t.Errorf("expected an unknown macro error, but got %v", err)
+	}
+	if _, err := ParseMacros([]byte("macros: [a, b]\n")); err == nil || !strings.Contains(err.Error(), "macros: expected a mapping of macros") {
+		t.Errorf("expected an error parsing a list of macros, but got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+)
+
+// Method is a method in the method set of a type.
+type Method struct {
+	// Func is the method.
+	Func *types.Func
+
+	// Decl is the method's declaration, or nil if it is not declared in the package (for
+	// example, if it is promoted from an embedded type of another package or is a method
+	// of an interface).
+	Decl *ast.FuncDecl
+
+	// Promoted is if the method is promoted from an embedded field.
+	Promoted bool
+
+	// PointerOnly is if the method is only in the method set of a pointer to the type,
+	// because it has a pointer receiver.
+	PointerOnly bool
+}
+
+// MethodSet returns the methods of the type declared by spec, sorted by name. These are
+// the methods of the pointer type *T, including promoted methods; methods requiring a
+// pointer receiver are marked PointerOnly. For interface types, the interface's methods
+// are returned. It returns nil if spec does not belong to p.
+func (p *TypedPackage) MethodSet(spec *ast.TypeSpec) []Method {
+	obj := p.Info.Defs[spec.Name]
+	if obj == nil {
+		return nil
+	}
+	typ := obj.Type()
+	ptrSet := types.NewMethodSet(typ)
+	if !types.IsInterface(typ) {
+		ptrSet = types.NewMethodSet(types.NewPointer(typ))
+	}
+	valueSet := types.NewMethodSet(typ)
+
+	decls := p.funcDecls()
+	methods := make([]Method, ptrSet.Len())
+	for i := 0; i < ptrSet.Len(); i++ {
+		sel := ptrSet.At(i)
+		fn := sel.Obj().(*types.Func)
+		methods[i] = Method{
+			Func:        fn,
+			Decl:        decls[fn.Origin()],
+			Promoted:    len(sel.Index()) > 1,
+			PointerOnly: valueSet.Lookup(fn.Pkg(), fn.Name()) == nil,
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Func.Name() < methods[j].Func.Name() })
+	return methods
+}
+
+// HasMethod reports whether the type declared by spec, or a pointer to it, has a method
+// with the given name, including promoted methods.
+func (p *TypedPackage) HasMethod(spec *ast.TypeSpec, name string) bool {
+	for _, m := range p.MethodSet(spec) {
+		if m.Func.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// funcDecls maps the functions and methods declared in the files of p to their
+// declarations.
+func (p *TypedPackage) funcDecls() map[*types.Func]*ast.FuncDecl {
+	decls := make(map[*types.Func]*ast.FuncDecl)
+	for _, file := range p.Files {
+		for _, decl := range file.Decls {
+			if funcDecl, isFunc := decl.(*ast.FuncDecl); isFunc {
+				if fn, isFunc := p.Info.Defs[funcDecl.Name].(*types.Func); isFunc {
+					decls[fn] = funcDecl
+				}
+			}
+		}
+	}
+	return decls
+}
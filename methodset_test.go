@@ -0,0 +1,76 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+func TestMethodSet(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import "sync"
+
+type Base struct{}
+
+func (b Base) ID() string { return "" }
+func (b *Base) SetID(id string) {}
+
+type File struct {
+	Base
+	sync.Mutex
+}
+
+func (f *File) Close() error { return nil }
+func (f File) Name() string  { return "" }
+
+type Closer interface {
+	Close() error
+}
+`)
+
+	specs := make(map[string]*ast.TypeSpec)
+	for _, node := range pkg.Find(FilterFunc(func(node ast.Node) bool {
+		_, isSpec := node.(*ast.TypeSpec)
+		return isSpec
+	})) {
+		spec := node.(*ast.TypeSpec)
+		specs[spec.Name.Name] = spec
+	}
+
+	type methodInfo struct {
+		Name                           string
+		HasDecl, Promoted, PointerOnly bool
+	}
+	testcases := []struct {
+		typ string
+		exp []methodInfo
+	}{
+		{"File", []methodInfo{
+			{"Close", true, false, true},
+			{"ID", true, true, false},
+			{"Lock", false, true, true},
+			{"Name", true, false, false},
+			{"SetID", true, true, true},
+			{"TryLock", false, true, true},
+			{"Unlock", false, true, true},
+		}},
+		{"Closer", []methodInfo{{"Close", false, false, false}}},
+	}
+	for _, test := range testcases {
+		var methods []methodInfo
+		for _, m := range pkg.MethodSet(specs[test.typ]) {
+			methods = append(methods, methodInfo{m.Func.Name(), m.Decl != nil, m.Promoted, m.PointerOnly})
+		}
+		if !reflect.DeepEqual(methods, test.exp) {
+			t.Errorf("%s: expected methods %+v, but got %+v", test.typ, test.exp, methods)
+		}
+	}
+
+	if !pkg.HasMethod(specs["File"], "Close") || !pkg.HasMethod(specs["File"], "Lock") {
+		t.Error("expected File to have methods Close and Lock")
+	}
+	if pkg.HasMethod(specs["Base"], "Close") {
+		t.Error("expected Base not to have method Close")
+	}
+}
@@ -0,0 +1,96 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+)
+
+// ParseSource parses the Go source file src, with comments, into a package holding just
+// that file, so that it can be queried with the package's Find and the matches' positions
+// reported. name is the file name recorded in the positions; the file is not read.
+// Syntax errors are returned, and recorded in the package's Errors, along with the
+// partially parsed file.
+func ParseSource(name string, src []byte) (*Package, error) {
+	pkg := &Package{Fset: token.NewFileSet()}
+	file, err := parser.ParseFile(pkg.Fset, name, src, parser.ParseComments)
+	if file != nil {
+		pkg.Name = file.Name.Name
+		pkg.Files = []*ast.File{file}
+	}
+	if err != nil {
+		pkg.Errors = append(pkg.Errors, err)
+	}
+	return pkg, err
+}
+
+// ParseReader is like ParseSource, reading the source from r.
+func ParseReader(name string, r io.Reader) (*Package, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSource(name, src)
+}
+
+// stripFuncBodies returns a copy of src with the contents of the bodies of its function
+// and method declarations replaced by spaces. Newlines are kept, so positions in the
+// stripped source are the same as in src.
+func stripFuncBodies(src []byte) []byte {
+	stripped := append([]byte(nil), src...)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, 0)
+
+	prev := token.SEMICOLON
+	depth := 0      // of braces at the top level
+	inSig := false  // in the signature of a function declaration
+	sigDepth := 0   // of parentheses, brackets and type literals' braces in the signature
+	bodyStart := -1 // offset of the body's contents, if in a body
+	bodyDepth := 0  // of braces in the body
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch {
+		case bodyStart >= 0:
+			if tok == token.LBRACE {
+				bodyDepth++
+			} else if tok == token.RBRACE && bodyDepth > 0 {
+				bodyDepth--
+			} else if tok == token.RBRACE {
+				for i := bodyStart; i < file.Offset(pos); i++ {
+					if stripped[i] != '\n' {
+						stripped[i] = ' '
+					}
+				}
+				bodyStart = -1
+			}
+		case inSig:
+			switch {
+			case tok == token.LPAREN || tok == token.LBRACK:
+				sigDepth++
+			case tok == token.LBRACE && (prev == token.STRUCT || prev == token.INTERFACE):
+				sigDepth++
+			case tok == token.RPAREN || tok == token.RBRACK || tok == token.RBRACE:
+				sigDepth--
+			case tok == token.LBRACE && sigDepth == 0:
+				inSig, bodyStart = false, file.Offset(pos)+1
+			case tok == token.SEMICOLON && sigDepth == 0:
+				inSig = false // declared without a body
+			}
+		case tok == token.FUNC && depth == 0 && prev == token.SEMICOLON:
+			inSig, sigDepth = true, 0
+		case tok == token.LBRACE:
+			depth++
+		case tok == token.RBRACE:
+			depth--
+		}
+		prev = tok
+	}
+	return stripped
+}
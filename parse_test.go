@@ -0,0 +1,80 @@
+package astquery
+
+import (
+	"errors"
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseSource(t *testing.T) {
+	pkg, err := ParseSource("buffer.go", []byte("package p\n\n// Run runs.\nfunc Run() {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Name != "p" || len(pkg.Errors) != 0 {
+		t.Errorf("expected package p without errors, but got %q and %v", pkg.Name, pkg.Errors)
+	}
+	found := pkg.Find(SetFilter{Names: []string{"Run"}, Type: reflect.TypeOf((*ast.FuncDecl)(nil))})
+	if len(found) != 1 {
+		t.Fatalf("expected to find Run, but got %v", found)
+	}
+	if pos := found[0].Position(); pos.Filename != "buffer.go" || pos.Line != 4 {
+		t.Errorf("expected Run at buffer.go:4, but got %v", pos)
+	}
+	if doc := found[0].Node.(*ast.FuncDecl).Doc; doc == nil || doc.Text() != "Run runs.\n" {
+		t.Errorf("expected comments to be parsed, but got doc %v", doc)
+	}
+
+	// Syntax errors are returned with the partial file.
+	pkg, err = ParseSource("broken.go", []byte("package p\n\nfunc Run() {\n\tif {\n}\n\nfunc Stop() {}\n"))
+	if err == nil || len(pkg.Files) != 1 || len(pkg.Errors) != 1 {
+		t.Errorf("expected a syntax error and a partial file, but got %v and %v", err, pkg.Files)
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	pkg, err := ParseReader("stdin.go", strings.NewReader("package p\n\nvar x = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.Files) != 1 || pkg.Position(pkg.Files[0]).Filename != "stdin.go" {
+		t.Errorf("expected a file named stdin.go, but got %v", pkg.Files)
+	}
+
+	readErr := errors.New("read failed")
+	if _, err := ParseReader("stdin.go", iotest.ErrReader(readErr)); err != readErr {
+		t.Errorf("expected error %v, but got %v", readErr, err)
+	}
+}
+
+func TestStripFuncBodies(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp string
+	}{
+		{
+			"package p\n\nfunc f() int {\n\tif true { return 1 }\n\treturn 0 // done\n}\n",
+			"package p\n\nfunc f() int {\n" + strings.Repeat(" ", 21) + "\n" + strings.Repeat(" ", 17) + "\n}\n",
+		},
+		{
+			"package p\nfunc (r *T[K]) M(x []int) struct{ y int } { return struct{ y int }{} }\n",
+			"package p\nfunc (r *T[K]) M(x []int) struct{ y int } {" + strings.Repeat(" ", 26) + "}\n",
+		},
+		{
+			"package p\nfunc ext()\nfunc g() func() { return nil }\n",
+			"package p\nfunc ext()\nfunc g() func() {            }\n",
+		},
+		{
+			"package p\nvar f = func() { x() }\ntype S struct{ f func() }\n",
+			"package p\nvar f = func() { x() }\ntype S struct{ f func() }\n",
+		},
+	}
+	for _, test := range testcases {
+		if got := string(stripFuncBodies([]byte(test.src))); got != test.exp {
+			t.Errorf("%q: expected %q, but got %q", test.src, test.exp, got)
+		}
+	}
+}
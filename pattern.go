@@ -0,0 +1,464 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// Pattern is a compiled structural pattern, in the style of gofmt -r. A pattern is a Go
+// expression or statement in which metavariables, written as identifiers prefixed with
+// '$', stand for any subtree:
+//
+//	errors.Wrap($err, $msg)
+//
+// A pattern matches the nodes that have the same structure as the pattern, ignoring
+// positions and comments, where each metavariable is bound to the node at its place. A
+// metavariable that occurs more than once matches only where its nodes are the same, and
+// the metavariable $_ matches anything without being bound. A metavariable written as a
+// statement matches any statement. A Pattern is a Filter.
+//
+// Patterns follow the dialect of gogrep, so that its patterns can be used unchanged. In
+// lists, such as arguments, parameters or statements, a metavariable written as $*name
+// matches any number of consecutive elements, which are bound as a NodeList. As in
+// Semgrep, such a metavariable can also be written as $name..., with no space before the
+// "..." (which otherwise spreads a slice in a call); in a list of statements or
+// arguments, "..." on its own is short for $*_:
+//
+//	$x, $_ := f(); if $x != nil { ... }
+//	log.Printf($format, ...)
+//
+// A pattern of several statements matches a sequence of consecutive statements in a
+// block or case clause. Find reports each sequence as a NodeList; as a Filter, the
+// pattern matches the blocks and clauses that contain such a sequence. Package.Find
+// reports the matches of a Pattern like Find, with their bindings.
+type Pattern struct {
+	src   string
+	node  ast.Node   // of a single expression or statement
+	stmts []ast.Stmt // of several statements
+}
+
+// NodeList is a sequence of nodes, such as the elements bound to a $*name metavariable or
+// the statements matched by a pattern of several statements.
+type NodeList []ast.Node
+
+// Pos returns the position of the first node, or token.NoPos if the list is empty.
+func (l NodeList) Pos() token.Pos {
+	if len(l) == 0 {
+		return token.NoPos
+	}
+	return l[0].Pos()
+}
+
+// End returns the end of the last node, or token.NoPos if the list is empty.
+func (l NodeList) End() token.Pos {
+	if len(l) == 0 {
+		return token.NoPos
+	}
+	return l[len(l)-1].End()
+}
+
+// PatternMatch is a node matched by a pattern, with the nodes bound to the pattern's
+// metavariables, by name without the '$'.
+type PatternMatch struct {
+	Node     ast.Node
+	Bindings map[string]ast.Node
+}
+
+// bindingFinder is implemented by the filters whose matches have bindings, which
+// Package.Find reports.
+type bindingFinder interface {
+	Filter
+	Find(nodes []ast.Node) []PatternMatch
+}
+
+// metavarPrefix and listMetavarPrefix replace the '$' and '$*' of metavariables, so that
+// patterns parse as Go.
+const (
+	metavarPrefix     = "__astquery_"
+	listMetavarPrefix = "__astquerylist_"
+)
+
+// CompilePattern compiles a pattern.
+func CompilePattern(src string) (*Pattern, error) {
+	goSrc, edits, err := replaceMetavars(src)
+	if err != nil {
+		return nil, queryError(PatternLanguage, src, err)
+	}
+	stmts, err := parsePattern(goSrc)
+	if syntaxErr, isSyntax := err.(*scanner.Error); isSyntax {
+		// Report the offset in src, before the metavariables were replaced.
+		offset := syntaxErr.Pos.Offset
+		for _, edit := range edits {
+			if edit.end <= syntaxErr.Pos.Offset {
+				offset -= edit.grown
+			}
+		}
+		return nil, queryError(PatternLanguage, src, syntaxError(offset, "%s", syntaxErr.Msg))
+	} else if err != nil {
+		return nil, queryError(PatternLanguage, src, err)
+	}
+	p := &Pattern{src: src}
+	if len(stmts) == 1 {
+		p.node = stmts[0]
+		if stmt, isExpr := p.node.(*ast.ExprStmt); isExpr {
+			p.node = stmt.X
+		}
+	} else {
+		p.stmts = stmts
+	}
+	return p, nil
+}
+
+// MustCompilePattern is like CompilePattern but panics if the pattern cannot be compiled.
+func MustCompilePattern(src string) *Pattern {
+	p, err := CompilePattern(src)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source of the pattern.
+func (p *Pattern) String() string { return p.src }
+
+func (p *Pattern) Filter(node ast.Node) bool {
+	if p.stmts != nil {
+		return len(p.findStmts(node)) > 0
+	}
+	_, ok := p.Match(node)
+	return ok
+}
+
+// Match reports whether node matches the pattern and, if it does, the nodes bound to the
+// pattern's metavariables. A pattern of several statements matches a NodeList of
+// statements.
+func (p *Pattern) Match(node ast.Node) (bindings map[string]ast.Node, ok bool) {
+	m := &patternMatcher{bindings: make(map[string]ast.Node)}
+	if p.stmts != nil {
+		list, isList := node.(NodeList)
+		if !isList || !m.match(reflect.ValueOf(p.stmts), reflect.ValueOf([]ast.Node(list))) {
+			return nil, false
+		}
+		return m.bindings, true
+	}
+	if !m.match(reflect.ValueOf(p.node), reflect.ValueOf(node)) {
+		return nil, false
+	}
+	return m.bindings, true
+}
+
+// Find searches nodes like Find, returning the matches with their bindings. For a
+// pattern of several statements, it returns the matching sequences of statements, at any
+// depth.
+func (p *Pattern) Find(nodes []ast.Node) []PatternMatch {
+	var matches []PatternMatch
+	if p.stmts != nil {
+		for _, node := range nodes {
+			ast.Inspect(node, func(node ast.Node) bool {
+				if node != nil {
+					matches = append(matches, p.findStmts(node)...)
+				}
+				return true
+			})
+		}
+		return matches
+	}
+	for _, node := range Find(nodes, p) {
+		bindings, _ := p.Match(node)
+		matches = append(matches, PatternMatch{Node: node, Bindings: bindings})
+	}
+	return matches
+}
+
+// findStmts returns the sequences of statements of a block or case clause that match a
+// pattern of several statements. Sequences are not empty and don't overlap, and the
+// longest sequence is taken from each starting statement.
+func (p *Pattern) findStmts(node ast.Node) []PatternMatch {
+	var stmts []ast.Stmt
+	switch node := node.(type) {
+	case *ast.BlockStmt:
+		stmts = node.List
+	case *ast.CaseClause:
+		stmts = node.Body
+	case *ast.CommClause:
+		stmts = node.Body
+	default:
+		return nil
+	}
+	var matches []PatternMatch
+	for i := 0; i < len(stmts); i++ {
+		for j := len(stmts); j > i; j-- {
+			list := make(NodeList, j-i)
+			for k, stmt := range stmts[i:j] {
+				list[k] = stmt
+			}
+			if bindings, ok := p.Match(list); ok {
+				matches = append(matches, PatternMatch{Node: list, Bindings: bindings})
+				i = j - 1
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// srcEdit records that replaceMetavars grew the source by grown bytes, up to offset end
+// of the replaced source.
+type srcEdit struct {
+	end, grown int
+}
+
+// replaceMetavars replaces the '$' and '$*' of the metavariables in src with their
+// prefixes, dropping the "..." of $name... metavariables, and each "..." standing for
+// statements, arguments or other elements of a list with a $*_ metavariable.
+func replaceMetavars(src string) (string, []srcEdit, error) {
+	type tokenAt struct {
+		offset int
+		tok    token.Token
+		lit    string
+	}
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	s.Init(file, []byte(src), nil, 0)
+	var toks []tokenAt
+	for {
+		pos, tok, lit := s.Scan()
+		toks = append(toks, tokenAt{file.Offset(pos), tok, lit})
+		if tok == token.EOF {
+			break
+		}
+	}
+	// adjacent reports whether toks[i] is tok, right after toks[i-1].
+	adjacent := func(i int, tok token.Token) bool {
+		return toks[i].tok == tok && toks[i].offset == toks[i-1].offset+len(toks[i-1].lit)
+	}
+
+	var buf strings.Builder
+	var edits []srcEdit
+	last := 0
+	replace := func(start, end int, with string) {
+		buf.WriteString(src[last:start])
+		buf.WriteString(with)
+		last = end
+		edits = append(edits, srcEdit{buf.Len(), len(with) - (end - start)})
+	}
+	prev := token.SEMICOLON
+	for i := 0; toks[i].tok != token.EOF; i++ {
+		t := toks[i]
+		switch {
+		case t.tok == token.ELLIPSIS && (prev == token.SEMICOLON || prev == token.LBRACE || prev == token.COLON):
+			if next := toks[i+1].tok; next == token.SEMICOLON || next == token.RBRACE || next == token.EOF {
+				replace(t.offset, t.offset+len("..."), listMetavarPrefix+"_")
+				t.tok = token.IDENT
+			}
+		case t.tok == token.ELLIPSIS && (prev == token.LPAREN || prev == token.COMMA):
+			if next := toks[i+1].tok; next == token.RPAREN || next == token.COMMA {
+				replace(t.offset, t.offset+len("..."), listMetavarPrefix+"_")
+				t.tok = token.IDENT
+			}
+		case t.tok == token.ILLEGAL && t.lit == "$":
+			prefix := metavarPrefix
+			if i++; adjacent(i, token.MUL) {
+				prefix = listMetavarPrefix
+				toks[i].lit = "*"
+				i++
+			}
+			if !adjacent(i, token.IDENT) {
+				return "", nil, syntaxError(t.offset, "expected a metavariable name after '$'")
+			}
+			if prefix == metavarPrefix && adjacent(i+1, token.ELLIPSIS) {
+				replace(t.offset, toks[i].offset, listMetavarPrefix)
+				i++
+				replace(toks[i].offset, toks[i].offset+len("..."), "")
+			} else {
+				replace(t.offset, toks[i].offset, prefix)
+			}
+			t.tok = token.IDENT
+		}
+		prev = t.tok
+	}
+	buf.WriteString(src[last:])
+	return buf.String(), edits, nil
+}
+
+// parsePattern parses src as an expression, which is returned as an expression
+// statement, or, failing that, as a list of statements. Syntax errors are returned as a
+// *scanner.Error, with the offset in src.
+func parsePattern(src string) ([]ast.Stmt, error) {
+	if expr, err := parser.ParseExpr(src); err == nil {
+		return []ast.Stmt{&ast.ExprStmt{X: expr}}, nil
+	}
+	const header = "package p; func _() {\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "", header+src+"\n}", parser.SkipObjectResolution)
+	if list, isList := err.(scanner.ErrorList); isList && len(list) > 0 {
+		syntaxErr := *list[0]
+		syntaxErr.Pos.Offset = min(max(syntaxErr.Pos.Offset-len(header), 0), len(src))
+		return nil, &syntaxErr
+	} else if err != nil {
+		return nil, err
+	}
+	stmts := file.Decls[0].(*ast.FuncDecl).Body.List
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	return stmts, nil
+}
+
+// patternMatcher matches a pattern against a node, recording the metavariables' bindings.
+// The bindings are replaced rather than modified, so that they can be restored when
+// backtracking.
+type patternMatcher struct {
+	bindings map[string]ast.Node
+}
+
+var (
+	posType          = reflect.TypeOf(token.NoPos)
+	objectType       = reflect.TypeOf((*ast.Object)(nil))
+	scopeType        = reflect.TypeOf((*ast.Scope)(nil))
+	commentGroupType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+// match reports whether the node or field value v matches the pattern value p.
+func (m *patternMatcher) match(p, v reflect.Value) bool {
+	if p.IsValid() && p.CanInterface() {
+		if name, isMetavar := metavar(p.Interface()); isMetavar {
+			return m.bind(name, v)
+		}
+		if stmt, isStmt := p.Interface().(*ast.ExprStmt); isStmt {
+			if name, isMetavar := metavar(stmt.X); isMetavar && v.IsValid() && v.CanInterface() {
+				if _, isExprStmt := v.Interface().(*ast.ExprStmt); !isExprStmt {
+					return m.bind(name, v)
+				}
+			}
+		}
+	}
+	if !p.IsValid() || !v.IsValid() {
+		return p.IsValid() == v.IsValid()
+	}
+	switch p.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if p.IsNil() || v.IsNil() {
+			return p.IsNil() == v.IsNil()
+		}
+		if p.Kind() == reflect.Interface {
+			return m.match(p.Elem(), v.Elem())
+		}
+		return p.Type() == v.Type() && m.match(p.Elem(), v.Elem())
+	case reflect.Struct:
+		if p.Type() != v.Type() {
+			return false
+		}
+		for i := 0; i < p.NumField(); i++ {
+			switch field := p.Type().Field(i); field.Type {
+			case posType:
+				// The position of a call's "..." records whether a slice is spread.
+				if field.Name == "Ellipsis" && p.Field(i).Interface().(token.Pos).IsValid() != v.Field(i).Interface().(token.Pos).IsValid() {
+					return false
+				}
+				continue
+			case objectType, scopeType, commentGroupType:
+				continue
+			}
+			if !m.match(p.Field(i), v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		return m.matchList(p, v, 0, 0)
+	default:
+		return p.Type() == v.Type() && p.Interface() == v.Interface()
+	}
+}
+
+// matchList reports whether the elements of the slice v from j on match the elements of
+// the slice p from i on, trying each number of elements for the list metavariables.
+func (m *patternMatcher) matchList(p, v reflect.Value, i, j int) bool {
+	if i == p.Len() {
+		return j == v.Len()
+	}
+	saved := m.bindings // bind doesn't modify the bindings it replaces
+	if name, isList := listMetavar(p.Index(i)); isList {
+		for k := v.Len(); k >= j; k-- {
+			list := make(NodeList, k-j)
+			for l := range list {
+				list[l] = v.Index(j + l).Interface().(ast.Node)
+			}
+			if m.bind(name, reflect.ValueOf(list)) && m.matchList(p, v, i+1, k) {
+				return true
+			}
+			m.bindings = saved
+		}
+		return false
+	}
+	if j < v.Len() && m.match(p.Index(i), v.Index(j)) && m.matchList(p, v, i+1, j+1) {
+		return true
+	}
+	m.bindings = saved
+	return false
+}
+
+// bind binds the metavariable name to the node v, or reports whether v is the same as the
+// node it is already bound to.
+func (m *patternMatcher) bind(name string, v reflect.Value) bool {
+	for v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return false
+	}
+	node, isNode := v.Interface().(ast.Node)
+	if !isNode {
+		return false
+	}
+	if name == "_" {
+		return true
+	}
+	if bound, isBound := m.bindings[name]; isBound {
+		return (&patternMatcher{}).match(reflect.ValueOf(bound), reflect.ValueOf(node))
+	}
+	bindings := make(map[string]ast.Node, len(m.bindings)+1)
+	for bound, node := range m.bindings {
+		bindings[bound] = node
+	}
+	bindings[name] = node
+	m.bindings = bindings
+	return true
+}
+
+// metavar returns the name of the metavariable x is, if it is one.
+func metavar(x interface{}) (name string, isMetavar bool) {
+	ident, isIdent := x.(*ast.Ident)
+	if !isIdent || ident == nil || !strings.HasPrefix(ident.Name, metavarPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(ident.Name, metavarPrefix), true
+}
+
+// listMetavar returns the name of the list metavariable that the list element v is, if
+// it is one. A list metavariable is an identifier, or a statement or field holding just
+// one.
+func listMetavar(v reflect.Value) (name string, isMetavar bool) {
+	var x ast.Expr
+	switch elem := v.Interface().(type) {
+	case *ast.Ident:
+		x = elem
+	case *ast.ExprStmt:
+		x = elem.X
+	case *ast.Field:
+		if len(elem.Names) == 0 {
+			x = elem.Type
+		}
+	}
+	ident, isIdent := x.(*ast.Ident)
+	if !isIdent || ident == nil || !strings.HasPrefix(ident.Name, listMetavarPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(ident.Name, listMetavarPrefix), true
+}
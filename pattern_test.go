@@ -0,0 +1,209 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const patternSrc = `package p
+
+import "github.com/pkg/errors"
+
+func load(name string) error {
+	if err := open(name); err != nil {
+		return errors.Wrap(err, "opening")
+	}
+	if err := read(name); err != nil {
+		return errors.Wrap(err, name)
+	}
+	x := 1
+	x = x + x
+	x = x + 2
+	return errors.New("done")
+}
+`
+
+func TestPattern(t *testing.T) {
+	file := parseTestFile(t, patternSrc)
+	testcases := []struct {
+		pattern string
+		exp     []string // each match followed by its bindings, sorted by name
+	}{
+		{`errors.Wrap($err, $msg)`, []string{
+			`errors.Wrap(err, "opening")`, `err=err`, `msg="opening"`,
+			`errors.Wrap(err, name)`, `err=err`, `msg=name`,
+		}},
+		{`errors.Wrap($_, $_)`, []string{`errors.Wrap(err, "opening")`, `errors.Wrap(err, name)`}},
+		{`$x + $x`, []string{`x + x`, `x=x`}},
+		{`$x = $y + 2`, []string{`x = x + 2`, `x=x`, `y=x`}},
+		{`if err := $f(name); err != nil { $body }`, []string{
+			`if err := open(name); err != nil { return errors.Wrap(err, "opening") }`, `body=return errors.Wrap(err, "opening")`, `f=open`,
+			`if err := read(name); err != nil { return errors.Wrap(err, name) }`, `body=return errors.Wrap(err, name)`, `f=read`,
+		}},
+		{`$f($a, $b, $c)`, nil},
+		{`errors.New($msg, $extra)`, nil},
+		{`x := 1`, []string{`x := 1`}},
+	}
+	for _, test := range testcases {
+		p, err := CompilePattern(test.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", test.pattern, err)
+			continue
+		}
+		got := patternMatches(t, p.Find([]ast.Node{file}))
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %q, but got %q", test.pattern, test.exp, got)
+		}
+	}
+}
+
+func TestCompilePatternErrors(t *testing.T) {
+	testcases := []struct {
+		pattern string
+		err     string
+	}{
+		{`f($)`, "offset 2: expected a metavariable name after '$'"},
+		{`$ x`, "offset 0: expected a metavariable name after '$'"},
+		{`f($x`, "offset 4: missing ',' before newline in argument list"},
+		{`if $x {`, "offset 7: expected '}', found 'EOF'"},
+		{``, "empty pattern"},
+		{`f($*)`, "offset 2: expected a metavariable name after '$'"},
+		{`if $x { ... `, "offset 12: expected '}', found 'EOF'"},
+	}
+	for _, test := range testcases {
+		_, err := CompilePattern(test.pattern)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.pattern, test.err, err)
+		}
+	}
+}
+
+const gogrepSrc = `package p
+
+func run(args []string) error {
+	f, err := open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, _ := count(f)
+	if n == 0 {
+		log(f, "empty")
+		return nil
+	}
+	switch n {
+	case 1:
+		g, err := open(args[1])
+		if err != nil {
+			log(g)
+			return err
+		}
+	}
+	log()
+	return nil
+}
+`
+
+func TestPatternGogrep(t *testing.T) {
+	file := parseTestFile(t, gogrepSrc)
+	testcases := []struct {
+		pattern string
+		exp     []string
+	}{
+		{`$_, $x := $f($*_); if $x != nil { ... }`, []string{
+			"f, err := open(args[0]); if err != nil { return err }", "f=open", "x=err",
+			"g, err := open(args[1]); if err != nil { log(g) return err }", "f=open", "x=err",
+		}},
+		{`$x, $err := $_; if $err != nil { return $err }`, []string{
+			"f, err := open(args[0]); if err != nil { return err }", "err=err", "x=f",
+		}},
+		{`log($*args)`, []string{
+			`log(f, "empty")`, `args=f; "empty"`,
+			`log(g)`, `args=g`,
+			`log()`, `args=`,
+		}},
+		{`log($x, $*_)`, []string{`log(f, "empty")`, "x=f", `log(g)`, "x=g"}},
+		{`if $c { $*_; return nil }`, []string{"if n == 0 { log(f, \"empty\") return nil }", "c=n == 0"}},
+		{`if $c { ...; return err }`, []string{"if err != nil { return err }", "c=err != nil", "if err != nil { log(g) return err }", "c=err != nil"}},
+		{`defer $x.Close(); ...; return nil`, []string{
+			"defer f.Close(); n, _ := count(f); if n == 0 { log(f, \"empty\") return nil }; switch n { case 1: g, err := open(args[1]) if err != nil { log(g) return err } }; log(); return nil", "x=f",
+		}},
+		{`log($ARGS...)`, []string{`log(f, "empty")`, `ARGS=f; "empty"`, `log(g)`, `ARGS=g`, `log()`, `ARGS=`}},
+		{`$FN($X, $REST...)`, []string{
+			`open(args[0])`, `FN=open`, `REST=`, `X=args[0]`,
+			`count(f)`, `FN=count`, `REST=`, `X=f`,
+			`log(f, "empty")`, `FN=log`, `REST="empty"`, `X=f`,
+			`open(args[1])`, `FN=open`, `REST=`, `X=args[1]`,
+			`log(g)`, `FN=log`, `REST=`, `X=g`,
+		}},
+		{`log(...)`, []string{`log(f, "empty")`, `log(g)`, `log()`}},
+		{`log($x, ...)`, []string{`log(f, "empty")`, "x=f", `log(g)`, "x=g"}},
+		{`log(..., "empty")`, []string{`log(f, "empty")`}},
+		{`log($x ...)`, nil},
+		{`func($*params) error { ... }`, nil},
+		{`$*a, $*a := $_`, nil},
+	}
+	for _, test := range testcases {
+		p, err := CompilePattern(test.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", test.pattern, err)
+			continue
+		}
+		got := patternMatches(t, p.Find([]ast.Node{file}))
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %q, but got %q", test.pattern, test.exp, got)
+		}
+	}
+}
+
+// patternMatches returns the source of each match, unless its node is nil, followed by
+// its bindings sorted by name. Node lists are joined with "; ".
+func patternMatches(t *testing.T, matches []PatternMatch) []string {
+	source := func(node ast.Node) string {
+		list, isList := node.(NodeList)
+		if !isList {
+			return nodeSource(t, node)
+		}
+		elems := make([]string, len(list))
+		for i, elem := range list {
+			elems[i] = nodeSource(t, elem)
+		}
+		return strings.Join(elems, "; ")
+	}
+	var got []string
+	for _, match := range matches {
+		if match.Node != nil {
+			got = append(got, source(match.Node))
+		}
+		var bindings []string
+		for name, node := range match.Bindings {
+			bindings = append(bindings, name+"="+source(node))
+		}
+		sort.Strings(bindings)
+		got = append(got, bindings...)
+	}
+	return got
+}
+
+func TestPackageFindPattern(t *testing.T) {
+	pkg, err := ParseSource("run.go", []byte(gogrepSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, match := range pkg.Find(MustCompilePattern(`if $c { $BODY...; return $x }`)) {
+		got = append(got, fmt.Sprintf("%s: %s", match.Position(), patternMatches(t, []PatternMatch{{match.Node, match.Bindings}})))
+	}
+	exp := []string{
+		`run.go:5:2: [if err != nil { return err } BODY= c=err != nil x=err]`,
+		`run.go:10:2: [if n == 0 { log(f, "empty") return nil } BODY=log(f, "empty") c=n == 0 x=nil]`,
+		`run.go:17:3: [if err != nil { log(g) return err } BODY=log(g) c=err != nil x=err]`,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %q, but got %q", exp, got)
+	}
+}
@@ -0,0 +1,258 @@
+package astquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pipeline is a multi-stage query, held as data so that it can be stored and shared as
+// JSON:
+//
+//	{"stages": [
+//		{"find": "//FuncDecl[@exported]"},
+//		{"filter": "FuncDecl[name^=Handle]", "language": "selector"},
+//		{"transform": "name"},
+//		{"aggregate": "count by name"}
+//	]}
+//
+// Each stage takes the nodes produced by the previous stage, starting with the nodes the
+// pipeline is run on, and does one of:
+//
+//	find       search the nodes for matches of a query, as Find does
+//	filter     keep the nodes that match a query
+//	transform  replace each node with its "parent", its "children", or its "name",
+//	           "type" or "body" field
+//	aggregate  summarize the nodes in a table: "count" counts them, and "count by attr"
+//	           counts them by the value of an attribute of Query; it must be the last stage
+//
+// Queries are in the language of the stage, by default that of Query.
+type Pipeline struct {
+	Stages []Stage `json:"stages"`
+}
+
+// Stage is a stage of a Pipeline. Exactly one of Find, Filter, Transform and Aggregate is
+// set.
+type Stage struct {
+	Find      string   `json:"find,omitempty"`
+	Filter    string   `json:"filter,omitempty"`
+	Language  Language `json:"language,omitempty"` // of Find or Filter
+	Transform string   `json:"transform,omitempty"`
+	Aggregate string   `json:"aggregate,omitempty"`
+}
+
+// ParsePipeline parses a pipeline from JSON and checks that it compiles.
+func ParsePipeline(data []byte) (*Pipeline, error) {
+	var p Pipeline
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if _, err := p.Compile(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CompiledPipeline is a Pipeline whose queries are compiled, ready to be run.
+type CompiledPipeline struct {
+	stages []pipelineStage
+}
+
+// PipelineResult is the result of a pipeline: the nodes produced by its last stage, or
+// the table of its aggregate stage.
+type PipelineResult struct {
+	Nodes []ast.Node
+	Table *Table
+}
+
+// pipelineStage is a compiled stage of a pipeline.
+type pipelineStage struct {
+	find, filter *CompiledQuery
+	transform    func(item pipelineNode) []pipelineNode
+	countBy      string // the attribute an aggregate stage counts by, or "" for all nodes
+	aggregate    bool
+}
+
+// pipelineNode is a node produced by a stage of a pipeline, with its ancestors.
+type pipelineNode struct {
+	node      ast.Node
+	ancestors []ast.Node
+}
+
+// Compile compiles the queries of the pipeline and checks its stages.
+func (p *Pipeline) Compile() (*CompiledPipeline, error) {
+	c := &CompiledPipeline{}
+	for i, stage := range p.Stages {
+		compiled, err := stage.compile()
+		if err == nil && compiled.aggregate && i < len(p.Stages)-1 {
+			err = fmt.Errorf("aggregate must be the last stage")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %v", i+1, err)
+		}
+		c.stages = append(c.stages, compiled)
+	}
+	return c, nil
+}
+
+func (s Stage) compile() (pipelineStage, error) {
+	var stage pipelineStage
+	set := 0
+	for _, value := range []string{s.Find, s.Filter, s.Transform, s.Aggregate} {
+		if value != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return stage, fmt.Errorf("expected one of find, filter, transform and aggregate, but got %d", set)
+	}
+	var err error
+	switch {
+	case s.Find != "":
+		stage.find, err = Compile(s.Language, s.Find)
+	case s.Filter != "":
+		stage.filter, err = Compile(s.Language, s.Filter)
+	case s.Transform != "":
+		if stage.transform = pipelineTransforms[s.Transform]; stage.transform == nil {
+			err = fmt.Errorf("unknown transform %q", s.Transform)
+		}
+	default:
+		stage.aggregate = true
+		if s.Aggregate != "count" {
+			attr := strings.TrimPrefix(s.Aggregate, "count by ")
+			if attr == s.Aggregate {
+				return stage, fmt.Errorf("unknown aggregate %q", s.Aggregate)
+			}
+			if queryAttrs[attr] == nil {
+				return stage, fmt.Errorf("unknown attribute %q", attr)
+			}
+			stage.countBy = attr
+		}
+	}
+	return stage, err
+}
+
+// pipelineTransforms are the transforms of pipeline stages, by name.
+var pipelineTransforms = map[string]func(item pipelineNode) []pipelineNode{
+	"parent": func(item pipelineNode) []pipelineNode {
+		if len(item.ancestors) == 0 {
+			return nil
+		}
+		n := len(item.ancestors) - 1
+		return []pipelineNode{{item.ancestors[n], item.ancestors[:n:n]}}
+	},
+	"children": func(item pipelineNode) []pipelineNode {
+		var children []pipelineNode
+		ancestors := append(item.ancestors[:len(item.ancestors):len(item.ancestors)], item.node)
+		ast.Inspect(item.node, func(node ast.Node) bool {
+			if node == item.node {
+				return true
+			}
+			if node != nil {
+				children = append(children, pipelineNode{node, ancestors})
+			}
+			return false
+		})
+		return children
+	},
+	"name": fieldTransform("Name"),
+	"type": fieldTransform("Type"),
+	"body": fieldTransform("Body"),
+}
+
+// fieldTransform returns a transform replacing nodes with the node in a field.
+func fieldTransform(field string) func(item pipelineNode) []pipelineNode {
+	return func(item pipelineNode) []pipelineNode {
+		value, exists := getStructField(item.node, field)
+		node, isNode := value.(ast.Node)
+		if !exists || !isNode || reflect.ValueOf(node).IsNil() {
+			return nil
+		}
+		return []pipelineNode{{node, append(item.ancestors[:len(item.ancestors):len(item.ancestors)], item.node)}}
+	}
+}
+
+// Run runs the pipeline on nodes.
+func (c *CompiledPipeline) Run(nodes []ast.Node) PipelineResult {
+	items := make([]pipelineNode, len(nodes))
+	for i, node := range nodes {
+		items[i] = pipelineNode{node: node}
+	}
+	for _, stage := range c.stages {
+		if stage.aggregate {
+			return PipelineResult{Table: stage.count(items)}
+		}
+		items = stage.run(items)
+	}
+	var result PipelineResult
+	for _, item := range items {
+		result.Nodes = append(result.Nodes, item.node)
+	}
+	return result
+}
+
+// run runs a stage other than an aggregate stage.
+func (s pipelineStage) run(items []pipelineNode) []pipelineNode {
+	var out []pipelineNode
+	seen := make(map[ast.Node]bool)
+	add := func(item pipelineNode) {
+		if !seen[item.node] {
+			seen[item.node] = true
+			out = append(out, item)
+		}
+	}
+	for _, item := range items {
+		switch {
+		case s.find != nil:
+			find(item.node, pathFilterFunc(func(node ast.Node, ancestors []ast.Node) bool {
+				// The nodes found have the ancestors of the node searched too.
+				ancestors = append(item.ancestors[:len(item.ancestors):len(item.ancestors)], ancestors...)
+				if !s.find.FilterPath(node, ancestors) {
+					return false
+				}
+				add(pipelineNode{node, ancestors})
+				return true
+			}))
+		case s.filter != nil:
+			if s.filter.FilterPath(item.node, item.ancestors) {
+				add(item)
+			}
+		default:
+			for _, transformed := range s.transform(item) {
+				add(transformed)
+			}
+		}
+	}
+	return out
+}
+
+// count returns the table of an aggregate stage.
+func (s pipelineStage) count(items []pipelineNode) *Table {
+	if s.countBy == "" {
+		return &Table{Columns: []string{"count"}, Rows: [][]string{{strconv.Itoa(len(items))}}}
+	}
+	counts := make(map[string]int)
+	for _, item := range items {
+		value, _ := queryAttrs[s.countBy](item.node)
+		counts[value]++
+	}
+	table := &Table{Columns: []string{s.countBy, "count"}}
+	for value, count := range counts {
+		table.Rows = append(table.Rows, []string{value, strconv.Itoa(count)})
+	}
+	sort.Slice(table.Rows, func(i, j int) bool { return table.Rows[i][0] < table.Rows[j][0] })
+	return table
+}
+
+// pathFilterFunc is a PathFilter calling a function.
+type pathFilterFunc func(node ast.Node, ancestors []ast.Node) bool
+
+func (f pathFilterFunc) Filter(node ast.Node) bool { return f(node, nil) }
+
+func (f pathFilterFunc) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	return f(node, ancestors)
+}
@@ -0,0 +1,110 @@
+package astquery
+
+import (
+	"encoding/json"
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	file := parseTestFile(t, querySrc)
+	testcases := []struct {
+		pipeline string
+		exp      []string
+		table    [][]string
+	}{
+		{`{"stages": [{"find": "//FuncDecl[@exported]"}, {"transform": "name"}]}`, []string{"HandleIndex", "HandleAdmin"}, nil},
+		{`{"stages": [
+			{"find": "//CallExpr[@callee='log.Fatal']"},
+			{"transform": "parent"},
+			{"transform": "parent"},
+			{"transform": "parent"},
+			{"filter": "FuncDecl", "language": "selector"}
+		]}`, []string{`func handleAbout() { log.Fatal("about") }`, "func (s *Server) HandleAdmin() { log.Fatal(s) }"}, nil},
+		{`{"stages": [{"find": "//FuncDecl[@name='load']"}, {"transform": "body"}, {"transform": "children"}]}`, []string{`log.Println("loading")`, "return nil"}, nil},
+		{`{"stages": [{"find": "//CallExpr"}, {"aggregate": "count by callee"}]}`, nil, [][]string{
+			{"callee", "count"},
+			{"load", "1"},
+			{"log.Fatal", "3"},
+			{"log.Println", "1"},
+		}},
+		{`{"stages": [{"find": "//FuncDecl"}, {"find": "//CallExpr"}, {"aggregate": "count"}]}`, nil, [][]string{{"count"}, {"5"}}},
+		{`{"stages": [
+			{"find": "//FuncDecl[@name='load']"},
+			{"transform": "body"},
+			{"find": "FuncDecl > BlockStmt CallExpr", "language": "selector"}
+		]}`, []string{`log.Println("loading")`}, nil},
+	}
+	for _, test := range testcases {
+		p, err := ParsePipeline([]byte(test.pipeline))
+		if err != nil {
+			t.Errorf("%s: %v", test.pipeline, err)
+			continue
+		}
+		c, err := p.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := c.Run([]ast.Node{file})
+		var got []string
+		for _, node := range result.Nodes {
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.pipeline, test.exp, got)
+		}
+		var table [][]string
+		if result.Table != nil {
+			table = append([][]string{result.Table.Columns}, result.Table.Rows...)
+		}
+		if !reflect.DeepEqual(table, test.table) {
+			t.Errorf("%s: expected table %q, but got %q", test.pipeline, test.table, table)
+		}
+	}
+}
+
+func TestPipelineJSON(t *testing.T) {
+	p := &Pipeline{Stages: []Stage{
+		{Find: "FuncDecl.exported", Language: SelectorLanguage},
+		{Filter: "//FuncDecl[@receiver]"},
+		{Aggregate: "count"},
+	}}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"stages":[{"find":"FuncDecl.exported","language":"selector"},{"filter":"//FuncDecl[@receiver]"},{"aggregate":"count"}]}`
+	if string(data) != exp {
+		t.Errorf("expected %s, but got %s", exp, data)
+	}
+	parsed, err := ParsePipeline(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, p) {
+		t.Errorf("expected %+v, but got %+v", p, parsed)
+	}
+}
+
+func TestParsePipelineErrors(t *testing.T) {
+	testcases := []struct {
+		pipeline string
+		err      string
+	}{
+		{`{"stages": [{"find": "//Func"}]}`, `stage 1: query "//Func": offset 2: unknown node kind "Func"`},
+		{`{"stages": [{"find": "//FuncDecl", "transform": "name"}]}`, "stage 1: expected one of find, filter, transform and aggregate, but got 2"},
+		{`{"stages": [{"find": "//FuncDecl"}, {"transform": "grandparent"}]}`, `stage 2: unknown transform "grandparent"`},
+		{`{"stages": [{"aggregate": "count"}, {"transform": "name"}]}`, "stage 1: aggregate must be the last stage"},
+		{`{"stages": [{"aggregate": "count by size"}]}`, `stage 1: unknown attribute "size"`},
+		{`{"stages": [{"aggregate": "sum"}]}`, `stage 1: unknown aggregate "sum"`},
+		{`{"stages": [{"filter": "x", "language": "xpath"}]}`, `unknown query language "xpath"`},
+	}
+	for _, test := range testcases {
+		_, err := ParsePipeline([]byte(test.pipeline))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.pipeline, test.err, err)
+		}
+	}
+}
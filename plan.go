@@ -0,0 +1,151 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+)
+
+// KindFilter is implemented by filters that match only nodes of certain kinds. Find uses
+// the kinds to plan its search, skipping the subtrees that can't contain nodes of those
+// kinds: for example, a filter of FuncDecls doesn't look into function bodies.
+type KindFilter interface {
+	Filter
+
+	// Kinds returns the go/ast node types, such as reflect.TypeOf(&ast.FuncDecl{}), of
+	// the nodes the filter can match, or nil if it can match nodes of any kind.
+	Kinds() []reflect.Type
+}
+
+// subtreePruner is implemented by filters that can tell from a node and its ancestors
+// that none of the node's descendants match, beyond what their kinds tell.
+type subtreePruner interface {
+	pruneBelow(node ast.Node, ancestors []ast.Node) bool
+}
+
+// planSearch analyzes filter before a search, returning a function that reports whether
+// the descendants of a node, with the given ancestors, can't match and needn't be
+// searched, or nil if no subtrees can be skipped.
+func planSearch(filter Filter) func(node ast.Node, ancestors []ast.Node) bool {
+	var kinds []reflect.Type
+	if kf, hasKinds := filter.(KindFilter); hasKinds {
+		kinds = kf.Kinds()
+	}
+	for _, kind := range kinds {
+		if kind == reflect.TypeOf(&ast.CommentGroup{}) || kind == reflect.TypeOf(&ast.Comment{}) {
+			// Free-floating comments can be within nodes of any kind.
+			kinds = nil
+			break
+		}
+	}
+	pruner, _ := filter.(subtreePruner)
+	if len(kinds) == 0 && pruner == nil {
+		return nil
+	}
+	return func(node ast.Node, ancestors []ast.Node) bool {
+		if pruner != nil && pruner.pruneBelow(node, ancestors) {
+			return true
+		}
+		if len(kinds) == 0 {
+			return false
+		}
+		below, isKnown := kindDescendants[reflect.TypeOf(node)]
+		if !isKnown {
+			return false
+		}
+		for _, kind := range kinds {
+			if below[kind] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// kindDescendants are, for each kind of node, the kinds of the nodes that can be its
+// descendants.
+var kindDescendants = descendantKinds()
+
+func descendantKinds() map[reflect.Type]map[reflect.Type]bool {
+	// The kinds of the children of each kind, from the types of its fields.
+	children := make(map[reflect.Type][]reflect.Type)
+	for _, kind := range nodeKinds {
+		st := kind.Elem()
+		for i := 0; i < st.NumField(); i++ {
+			typ := st.Field(i).Type
+			if typ.Kind() == reflect.Slice {
+				typ = typ.Elem()
+			}
+			if kind == nodeKinds["DeclStmt"] {
+				typ = nodeKinds["GenDecl"] // the Decl of a DeclStmt is never a FuncDecl
+			}
+			for _, child := range nodeKinds {
+				if typ == child || typ.Kind() == reflect.Interface && child.Implements(typ) {
+					children[kind] = append(children[kind], child)
+				}
+			}
+		}
+	}
+	descendants := make(map[reflect.Type]map[reflect.Type]bool)
+	for _, kind := range nodeKinds {
+		below := make(map[reflect.Type]bool)
+		queue := append([]reflect.Type(nil), children[kind]...)
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			if !below[next] {
+				below[next] = true
+				queue = append(queue, children[next]...)
+			}
+		}
+		descendants[kind] = below
+	}
+	return descendants
+}
+
+func (f SetFilter) Kinds() []reflect.Type { return []reflect.Type{f.Type} }
+
+func (f RegexpFilter) Kinds() []reflect.Type { return []reflect.Type{f.Type} }
+
+func (f MethodFilter) Kinds() []reflect.Type { return []reflect.Type{reflect.TypeOf(&ast.FuncDecl{})} }
+
+func (q *Query) Kinds() []reflect.Type {
+	if kind := q.steps[len(q.steps)-1].kind; kind != nil {
+		return []reflect.Type{kind}
+	}
+	return nil
+}
+
+// pruneBelow skips the subtrees that a query's leading "/" steps rule out: a node at the
+// depth of one of these steps must be of the step's kind to have matching descendants,
+// and if all the steps are "/" steps, there are none below the depth of the last one.
+func (q *Query) pruneBelow(node ast.Node, ancestors []ast.Node) bool {
+	depth := len(ancestors)
+	for i, step := range q.steps {
+		if step.axis != childAxis {
+			return false
+		}
+		if i == depth {
+			return step.kind != nil && reflect.TypeOf(node) != step.kind || i == len(q.steps)-1
+		}
+	}
+	return true
+}
+
+func (q *SQLQuery) Kinds() []reflect.Type {
+	if q.kind != nil {
+		return []reflect.Type{q.kind}
+	}
+	return nil
+}
+
+func (q *CompiledQuery) Kinds() []reflect.Type {
+	if kf, hasKinds := q.filter.(KindFilter); hasKinds {
+		return kf.Kinds()
+	}
+	return nil
+}
+
+func (q *CompiledQuery) pruneBelow(node ast.Node, ancestors []ast.Node) bool {
+	pruner, isPruner := q.filter.(subtreePruner)
+	return isPruner && pruner.pruneBelow(node, ancestors)
+}
@@ -0,0 +1,75 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+// visitCounter counts the nodes its filter is applied to, keeping the filter's plan.
+type visitCounter struct {
+	*Query
+	visited map[string]int
+}
+
+func (f visitCounter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	f.visited[reflect.TypeOf(node).Elem().Name()]++
+	return f.Query.FilterPath(node, ancestors)
+}
+
+func TestPlannedFind(t *testing.T) {
+	file := parseTestFile(t, querySrc+`
+func local() {
+	type T int
+	var x T
+	_ = x
+}
+`)
+	testcases := []struct {
+		query     string
+		unvisited []string // kinds of nodes that the search must skip
+	}{
+		{`//FuncDecl[@receiver]`, []string{"CallExpr", "BlockStmt", "FieldList"}},
+		{`/File/GenDecl/TypeSpec`, []string{"CallExpr", "BlockStmt", "StructType"}},
+		{`/File/*/Ident`, []string{"CallExpr", "ExprStmt", "StructType"}},
+		{`//TypeSpec`, nil},
+		{`//IfStmt//CallExpr`, nil},
+	}
+	for _, test := range testcases {
+		q := MustCompileQuery(test.query)
+		counter := visitCounter{q, make(map[string]int)}
+		got := Find([]ast.Node{file}, counter)
+		// A pathFilterFunc has no plan, so the search visits all nodes.
+		exp := Find([]ast.Node{file}, pathFilterFunc(q.FilterPath))
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s: expected %d matches, but got %d", test.query, len(exp), len(got))
+		}
+		for _, kind := range test.unvisited {
+			if counter.visited[kind] > 0 {
+				t.Errorf("%s: expected no %s nodes to be visited, but %d were", test.query, kind, counter.visited[kind])
+			}
+		}
+	}
+}
+
+func TestKindDescendants(t *testing.T) {
+	kind := func(node ast.Node) reflect.Type { return reflect.TypeOf(node) }
+	testcases := []struct {
+		node, desc ast.Node
+		exp        bool
+	}{
+		{&ast.File{}, &ast.FuncDecl{}, true},
+		{&ast.FuncDecl{}, &ast.FuncDecl{}, false},
+		{&ast.FuncDecl{}, &ast.TypeSpec{}, true},
+		{&ast.BlockStmt{}, &ast.FuncLit{}, true},
+		{&ast.Ident{}, &ast.Ident{}, false},
+		{&ast.StructType{}, &ast.Field{}, true},
+		{&ast.CallExpr{}, &ast.ReturnStmt{}, true},
+		{&ast.BasicLit{}, &ast.CommentGroup{}, false},
+	}
+	for _, test := range testcases {
+		if got := kindDescendants[kind(test.node)][kind(test.desc)]; got != test.exp {
+			t.Errorf("%T below %T: expected %v, but got %v", test.desc, test.node, test.exp, got)
+		}
+	}
+}
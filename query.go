@@ -0,0 +1,828 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a compiled query string. Queries are written in an XPath-like language:
+//
+//	//FuncDecl[@name=~'^Handle']//CallExpr[@callee='log.Fatal']
+//
+// A query is a sequence of steps, each selecting nodes by kind and by predicates. A step
+// is introduced by "//", which selects nodes at any depth below the nodes selected by the
+// previous step, or by "/", which selects their children. A query starting with "/"
+// selects the roots passed to Find with its first step. The kind is the name of a go/ast
+// node type, such as FuncDecl or CallExpr, or "*" for any kind. The predicates, in
+// brackets, compare the attributes of the nodes:
+//
+//	[@attr='value']   the attribute is value
+//	[@attr!='value']  the attribute is not value
+//	[@attr=~'regexp'] the attribute matches the regular expression
+//	[@attr]           the attribute is set, and not 'false'
+//	[axis::Kind[...]] a node on the axis is of the kind, or of any kind for "*", and
+//	                  satisfies the predicates in brackets, such as
+//	                  //SelectorExpr[ancestor::FuncDecl[@exported='true']]
+//
+// Predicates can be combined with "and", "or" and "not(...)", in order of increasing
+// precedence, and grouped in parentheses:
+//
+//	//FuncDecl[not(descendant::DeferStmt) and (@exported='true' or @receiver)]
+//
+// The number of nodes on an axis can be compared with "=", "!=", "<", "<=", ">" or ">=":
+//
+//	//FuncDecl[count(descendant::ReturnStmt) > 5]
+//
+// The axes of predicates are:
+//
+//	ancestor           the ancestors of the node
+//	child              the children of the node
+//	descendant         the descendants of the node
+//	preceding-sibling  the siblings before the node, as Siblings returns them
+//	following-sibling  the siblings after the node
+//	previous-sibling   the sibling immediately before the node
+//	next-sibling       the sibling immediately after the node
+//
+// The attributes are:
+//
+//	name      the name of the node, as GetName returns it, of an identifier, or the
+//	          names of a Field, separated by ", "
+//	exported  'true' or 'false', for nodes with a name
+//	kind      the node's kind, such as 'CallExpr'
+//	callee    the called function of a CallExpr, as written (e.g., 'log.Fatal')
+//	receiver  the receiver type name of a method's FuncDecl, without '*'
+//	tag       the tag of a struct Field, unquoted
+//	lhs       the left-hand side of an AssignStmt, as written (e.g., 'x, err')
+//
+// A node that doesn't have an attribute doesn't satisfy predicates on it. Values are
+// quoted with single or double quotes, or are placeholders, written "?", whose values are
+// given to Bind:
+//
+//	//FuncDecl[@name=?]
+//
+// A Query is a PathFilter: it matches the nodes selected by its last step. Queries can
+// also be written as CSS-style selectors, which CompileSelector compiles.
+type Query struct {
+	src    string
+	steps  []queryStep
+	params int // the number of placeholders
+}
+
+// queryStep is a step of a query.
+type queryStep struct {
+	axis  queryAxis
+	kind  reflect.Type // nil for any kind
+	preds []queryPred
+}
+
+// queryAxis is the relation of the nodes selected by a step to those of the previous step.
+type queryAxis int
+
+const (
+	descendantAxis queryAxis = iota // "//"
+	childAxis                       // "/"
+)
+
+// queryPred is a predicate of a query step.
+type queryPred interface {
+	eval(node ast.Node, ancestors []ast.Node) bool
+}
+
+// paramPred is a predicate that can hold placeholders.
+type paramPred interface {
+	queryPred
+
+	// bind returns the predicate with its placeholders replaced by the arguments.
+	bind(args []string) (queryPred, error)
+}
+
+// attrPred compares an attribute of a node with a value.
+type attrPred struct {
+	attr  string
+	op    string // "=", "!=", "=~", a CSS operator, or "" for the attribute being set
+	value string
+	re    *regexp.Regexp // for "=~"
+
+	// param is the 1-based index of the placeholder whose argument is the value, or 0 if
+	// the value was given in the query. The value of a LIKE pattern is converted to a
+	// regular expression when it is bound.
+	param int
+	like  bool
+}
+
+func (p attrPred) eval(node ast.Node, ancestors []ast.Node) bool {
+	val, exists := queryAttrs[p.attr](node)
+	if !exists {
+		return false
+	}
+	switch p.op {
+	case "=":
+		return val == p.value
+	case "!=":
+		return val != p.value
+	case "=~":
+		return p.re.MatchString(val)
+	case "^=":
+		return strings.HasPrefix(val, p.value)
+	case "$=":
+		return strings.HasSuffix(val, p.value)
+	case "*=":
+		return strings.Contains(val, p.value)
+	case "~=":
+		for _, word := range strings.FieldsFunc(val, func(r rune) bool { return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			if word == p.value {
+				return true
+			}
+		}
+		return false
+	default:
+		return val != "false"
+	}
+}
+
+func (p attrPred) bind(args []string) (queryPred, error) {
+	if p.param == 0 {
+		return p, nil
+	}
+	p.value, p.param = args[p.param-1], 0
+	if p.op == "=~" {
+		expr := p.value
+		if p.like {
+			expr = likeRegexp(p.value)
+		}
+		var err error
+		if p.re, err = regexp.Compile(expr); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// axisPred is satisfied by nodes with a node on an axis, such as an ancestor, of a kind
+// that satisfies predicates.
+type axisPred struct {
+	axis  string
+	kind  reflect.Type // nil for any kind
+	preds []queryPred
+}
+
+// predAxes are the axes of predicates.
+var predAxes = []string{"ancestor", "child", "descendant", "preceding-sibling", "following-sibling", "previous-sibling", "next-sibling"}
+
+func (p axisPred) eval(node ast.Node, ancestors []ast.Node) bool {
+	return p.count(node, ancestors, 1) > 0
+}
+
+// count returns the number of nodes on the axis that are of the kind and satisfy the
+// predicates, counting up to limit, or all of them if limit is negative.
+func (p axisPred) count(node ast.Node, ancestors []ast.Node, limit int) int {
+	n := 0
+	if p.axis == "ancestor" {
+		for i := len(ancestors) - 1; i >= 0 && n != limit; i-- {
+			if matchKindAndPreds(p.kind, p.preds, ancestors[i], ancestors[:i]) {
+				n++
+			}
+		}
+		return n
+	}
+	if p.axis == "child" || p.axis == "descendant" {
+		walkDescendants(node, ancestors, p.axis == "child", func(desc ast.Node, descAncestors []ast.Node) bool {
+			if matchKindAndPreds(p.kind, p.preds, desc, descAncestors) {
+				n++
+			}
+			return n != limit
+		})
+		return n
+	}
+	siblings, i := Siblings(node, ancestors)
+	var axis []ast.Node
+	switch {
+	case siblings == nil:
+	case p.axis == "preceding-sibling":
+		axis = siblings[:i]
+	case p.axis == "following-sibling":
+		axis = siblings[i+1:]
+	case p.axis == "previous-sibling" && i > 0:
+		axis = siblings[i-1 : i]
+	case p.axis == "next-sibling" && i < len(siblings)-1:
+		axis = siblings[i+1 : i+2]
+	}
+	for _, sibling := range axis {
+		if n == limit {
+			break
+		}
+		if sibling != nil && matchKindAndPreds(p.kind, p.preds, sibling, ancestors) {
+			n++
+		}
+	}
+	return n
+}
+
+func (p axisPred) bind(args []string) (queryPred, error) {
+	preds, err := bindPreds(p.preds, args)
+	return axisPred{p.axis, p.kind, preds}, err
+}
+
+// countPred compares the number of nodes on an axis satisfying a predicate with n.
+type countPred struct {
+	axis axisPred
+	op   string // "=", "!=", "<", "<=", ">" or ">="
+	n    int
+}
+
+func (p countPred) eval(node ast.Node, ancestors []ast.Node) bool {
+	// Counting past n is enough for any comparison.
+	count := p.axis.count(node, ancestors, p.n+1)
+	switch p.op {
+	case "=":
+		return count == p.n
+	case "!=":
+		return count != p.n
+	case "<":
+		return count < p.n
+	case "<=":
+		return count <= p.n
+	case ">":
+		return count > p.n
+	default:
+		return count >= p.n
+	}
+}
+
+func (p countPred) bind(args []string) (queryPred, error) {
+	axis, err := p.axis.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	p.axis = axis.(axisPred)
+	return p, nil
+}
+
+// notPred, andPred and orPred combine predicates.
+type notPred struct{ x queryPred }
+
+func (p notPred) eval(node ast.Node, ancestors []ast.Node) bool { return !p.x.eval(node, ancestors) }
+
+func (p notPred) bind(args []string) (queryPred, error) {
+	x, err := bindPred(p.x, args)
+	return notPred{x}, err
+}
+
+type andPred struct{ x, y queryPred }
+
+func (p andPred) eval(node ast.Node, ancestors []ast.Node) bool {
+	return p.x.eval(node, ancestors) && p.y.eval(node, ancestors)
+}
+
+func (p andPred) bind(args []string) (queryPred, error) {
+	preds, err := bindPreds([]queryPred{p.x, p.y}, args)
+	if err != nil {
+		return nil, err
+	}
+	return andPred{preds[0], preds[1]}, nil
+}
+
+type orPred struct{ x, y queryPred }
+
+func (p orPred) eval(node ast.Node, ancestors []ast.Node) bool {
+	return p.x.eval(node, ancestors) || p.y.eval(node, ancestors)
+}
+
+func (p orPred) bind(args []string) (queryPred, error) {
+	preds, err := bindPreds([]queryPred{p.x, p.y}, args)
+	if err != nil {
+		return nil, err
+	}
+	return orPred{preds[0], preds[1]}, nil
+}
+
+// matchKindAndPreds reports whether node, with the given ancestors, is of kind (any kind
+// if nil) and satisfies preds.
+func matchKindAndPreds(kind reflect.Type, preds []queryPred, node ast.Node, ancestors []ast.Node) bool {
+	if kind != nil && reflect.TypeOf(node) != kind {
+		return false
+	}
+	for _, pred := range preds {
+		if !pred.eval(node, ancestors) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryAttrs are the attributes that query predicates can compare, by name.
+var queryAttrs = map[string]func(node ast.Node) (string, bool){
+	"name": nodeName,
+	"exported": func(node ast.Node) (string, bool) {
+		name, exists := nodeName(node)
+		if !exists {
+			return "", false
+		}
+		return fmt.Sprint(ast.IsExported(name)), true
+	},
+	"kind": func(node ast.Node) (string, bool) {
+		return reflect.TypeOf(node).Elem().Name(), true
+	},
+	"callee": func(node ast.Node) (string, bool) {
+		call, isCall := node.(*ast.CallExpr)
+		if !isCall {
+			return "", false
+		}
+		return types.ExprString(call.Fun), true
+	},
+	"tag": func(node ast.Node) (string, bool) {
+		field, isField := node.(*ast.Field)
+		if !isField || field.Tag == nil {
+			return "", false
+		}
+		tag, err := strconv.Unquote(field.Tag.Value)
+		return tag, err == nil
+	},
+	"lhs": func(node ast.Node) (string, bool) {
+		assign, isAssign := node.(*ast.AssignStmt)
+		if !isAssign {
+			return "", false
+		}
+		return exprList(assign.Lhs), true
+	},
+	"receiver": func(node ast.Node) (string, bool) {
+		decl, isDecl := node.(*ast.FuncDecl)
+		if !isDecl || decl.Recv == nil || len(decl.Recv.List) != 1 {
+			return "", false
+		}
+		name, err := typeName(decl.Recv.List[0].Type)
+		return name, err == nil
+	},
+}
+
+// nodeName returns the name of node as GetName does, the name of an identifier, or the
+// names of a field.
+func nodeName(node ast.Node) (string, bool) {
+	switch node := node.(type) {
+	case *ast.Ident:
+		return node.Name, true
+	case *ast.Field:
+		if len(node.Names) == 0 {
+			return "", false
+		}
+		names := make([]ast.Expr, len(node.Names))
+		for i, name := range node.Names {
+			names[i] = name
+		}
+		return exprList(names), true
+	}
+	return GetName(node)
+}
+
+// exprList returns expressions as written, separated by ", ".
+func exprList(exprs []ast.Expr) string {
+	strs := make([]string, len(exprs))
+	for i, expr := range exprs {
+		strs[i] = types.ExprString(expr)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// nodeKinds are the go/ast node types, by name.
+var nodeKinds = func() map[string]reflect.Type {
+	kinds := make(map[string]reflect.Type)
+	for _, node := range []ast.Node{
+		(*ast.ArrayType)(nil), (*ast.AssignStmt)(nil), (*ast.BadDecl)(nil), (*ast.BadExpr)(nil),
+		(*ast.BadStmt)(nil), (*ast.BasicLit)(nil), (*ast.BinaryExpr)(nil), (*ast.BlockStmt)(nil),
+		(*ast.BranchStmt)(nil), (*ast.CallExpr)(nil), (*ast.CaseClause)(nil), (*ast.ChanType)(nil),
+		(*ast.CommClause)(nil), (*ast.Comment)(nil), (*ast.CommentGroup)(nil), (*ast.CompositeLit)(nil),
+		(*ast.DeclStmt)(nil), (*ast.DeferStmt)(nil), (*ast.Ellipsis)(nil), (*ast.EmptyStmt)(nil),
+		(*ast.ExprStmt)(nil), (*ast.Field)(nil), (*ast.FieldList)(nil), (*ast.File)(nil),
+		(*ast.ForStmt)(nil), (*ast.FuncDecl)(nil), (*ast.FuncLit)(nil), (*ast.FuncType)(nil),
+		(*ast.GenDecl)(nil), (*ast.GoStmt)(nil), (*ast.Ident)(nil), (*ast.IfStmt)(nil),
+		(*ast.ImportSpec)(nil), (*ast.IncDecStmt)(nil), (*ast.IndexExpr)(nil), (*ast.IndexListExpr)(nil),
+		(*ast.InterfaceType)(nil), (*ast.KeyValueExpr)(nil), (*ast.LabeledStmt)(nil), (*ast.MapType)(nil),
+		(*ast.ParenExpr)(nil), (*ast.RangeStmt)(nil), (*ast.ReturnStmt)(nil), (*ast.SelectStmt)(nil),
+		(*ast.SelectorExpr)(nil), (*ast.SendStmt)(nil), (*ast.SliceExpr)(nil), (*ast.StarExpr)(nil),
+		(*ast.StructType)(nil), (*ast.SwitchStmt)(nil), (*ast.TypeAssertExpr)(nil), (*ast.TypeSpec)(nil),
+		(*ast.TypeSwitchStmt)(nil), (*ast.UnaryExpr)(nil), (*ast.ValueSpec)(nil),
+	} {
+		typ := reflect.TypeOf(node)
+		kinds[typ.Elem().Name()] = typ
+	}
+	return kinds
+}()
+
+// CompileQuery compiles a query string.
+func CompileQuery(src string) (*Query, error) {
+	return compileQuery(src, nil)
+}
+
+// compileQuery compiles a query string that can refer to macros.
+func compileQuery(src string, macros *Macros) (*Query, error) {
+	p := &queryParser{src: src, macros: macros}
+	q := &Query{src: src}
+	for {
+		p.skipSpace()
+		if p.pos == len(src) {
+			break
+		}
+		step, err := p.step()
+		if err != nil {
+			return nil, queryError(QueryLanguage, src, err)
+		}
+		q.steps = append(q.steps, step)
+	}
+	if len(q.steps) == 0 {
+		return nil, queryError(QueryLanguage, src, p.errorf("empty query"))
+	}
+	q.params = p.params
+	return q, nil
+}
+
+// MustCompileQuery is like CompileQuery but panics if the query cannot be compiled.
+func MustCompileQuery(src string) *Query {
+	q, err := CompileQuery(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the source of the query.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Bind returns the query with its placeholders replaced by args, in order, without
+// compiling it again. A query with placeholders matches no nodes until it is bound.
+func (q *Query) Bind(args ...string) (*Query, error) {
+	if len(args) != q.params {
+		return nil, fmt.Errorf("query %q: expected %d arguments, but got %d", q.src, q.params, len(args))
+	}
+	if q.params == 0 {
+		return q, nil
+	}
+	bound := &Query{src: q.src, steps: make([]queryStep, len(q.steps))}
+	for i, step := range q.steps {
+		bound.steps[i] = step
+		var err error
+		if bound.steps[i].preds, err = bindPreds(step.preds, args); err != nil {
+			return nil, fmt.Errorf("query %q: %v", q.src, err)
+		}
+	}
+	return bound, nil
+}
+
+// bindPreds returns preds with their placeholders replaced by args.
+func bindPreds(preds []queryPred, args []string) ([]queryPred, error) {
+	bound := make([]queryPred, len(preds))
+	for i, pred := range preds {
+		var err error
+		if bound[i], err = bindPred(pred, args); err != nil {
+			return nil, err
+		}
+	}
+	return bound, nil
+}
+
+// bindPred returns pred with its placeholders replaced by args.
+func bindPred(pred queryPred, args []string) (queryPred, error) {
+	if pred, hasParams := pred.(paramPred); hasParams {
+		return pred.bind(args)
+	}
+	return pred, nil
+}
+
+func (q *Query) Filter(node ast.Node) bool {
+	return q.FilterPath(node, nil)
+}
+
+func (q *Query) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	if q.params > 0 {
+		return false
+	}
+	return q.matchStep(len(q.steps)-1, node, ancestors)
+}
+
+// matchStep reports whether node, with the given ancestors, is selected by the query's
+// steps up to and including step i.
+func (q *Query) matchStep(i int, node ast.Node, ancestors []ast.Node) bool {
+	step := q.steps[i]
+	if !matchKindAndPreds(step.kind, step.preds, node, ancestors) {
+		return false
+	}
+	switch {
+	case i == 0 && step.axis == childAxis:
+		return len(ancestors) == 0
+	case i == 0:
+		return true
+	case step.axis == childAxis:
+		return len(ancestors) > 0 && q.matchStep(i-1, ancestors[len(ancestors)-1], ancestors[:len(ancestors)-1])
+	default:
+		for j := len(ancestors) - 1; j >= 0; j-- {
+			if q.matchStep(i-1, ancestors[j], ancestors[:j]) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// queryParser parses a query string.
+type queryParser struct {
+	src    string
+	pos    int
+	params int     // the number of placeholders parsed
+	macros *Macros // the macros that can be referred to, if any
+}
+
+// errorf returns a syntax error at the parser's position, and semanticf a semantic
+// error.
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return syntaxError(p.pos, format, args...)
+}
+
+func (p *queryParser) semanticf(format string, args ...interface{}) error {
+	return semanticError(p.pos, format, args...)
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// consume consumes s, ignoring leading space, and reports whether it was there.
+func (p *queryParser) consume(s string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// ident parses an identifier.
+func (p *queryParser) ident() (string, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos])) || (p.pos > start && unicode.IsDigit(rune(p.src[p.pos])))) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a name")
+	}
+	return p.src[start:p.pos], nil
+}
+
+// str parses a quoted string.
+func (p *queryParser) str() (string, error) {
+	p.skipSpace()
+	if p.pos == len(p.src) || (p.src[p.pos] != '\'' && p.src[p.pos] != '"') {
+		return "", p.errorf("expected a quoted string")
+	}
+	quote := p.src[p.pos]
+	end := strings.IndexByte(p.src[p.pos+1:], quote)
+	if end < 0 {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.src[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return s, nil
+}
+
+// step parses a step.
+func (p *queryParser) step() (queryStep, error) {
+	var step queryStep
+	switch {
+	case p.consume("//"):
+		step.axis = descendantAxis
+	case p.consume("/"):
+		step.axis = childAxis
+	default:
+		return step, p.errorf("expected '/' or '//'")
+	}
+	var err error
+	if step.kind, err = p.kind(); err != nil {
+		return step, err
+	}
+	step.preds, err = p.preds()
+	return step, err
+}
+
+// preds parses the predicates in brackets following a node kind.
+func (p *queryParser) preds() ([]queryPred, error) {
+	var preds []queryPred
+	for p.consume("[") {
+		pred, err := p.pred()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume("]") {
+			return nil, p.errorf("expected ']'")
+		}
+		preds = append(preds, pred)
+	}
+	return preds, nil
+}
+
+// pred parses a predicate, after its opening bracket: predicates combined with "or".
+func (p *queryParser) pred() (queryPred, error) {
+	x, err := p.andPred()
+	for err == nil && p.keyword("or") {
+		var y queryPred
+		y, err = p.andPred()
+		x = orPred{x, y}
+	}
+	return x, err
+}
+
+// andPred parses predicates combined with "and".
+func (p *queryParser) andPred() (queryPred, error) {
+	x, err := p.unaryPred()
+	for err == nil && p.keyword("and") {
+		var y queryPred
+		y, err = p.unaryPred()
+		x = andPred{x, y}
+	}
+	return x, err
+}
+
+// unaryPred parses a negated or parenthesized predicate, or a simple one.
+func (p *queryParser) unaryPred() (queryPred, error) {
+	negate := p.keyword("not")
+	if negate || p.consume("(") {
+		if negate && !p.consume("(") {
+			return nil, p.errorf("expected '('")
+		}
+		x, err := p.pred()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		if negate {
+			return notPred{x}, nil
+		}
+		return x, nil
+	}
+	return p.simplePred()
+}
+
+// keyword consumes the keyword kw, ignoring leading space, and reports whether it was
+// there.
+func (p *queryParser) keyword(kw string) bool {
+	p.skipSpace()
+	end := p.pos + len(kw)
+	if !strings.HasPrefix(p.src[p.pos:], kw) || end < len(p.src) && (p.src[end] == '_' || p.src[end] == '-' || unicode.IsLetter(rune(p.src[end])) || unicode.IsDigit(rune(p.src[end]))) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// simplePred parses a count, macro, axis or attribute predicate.
+func (p *queryParser) simplePred() (queryPred, error) {
+	if p.keyword("count") {
+		return p.countPred()
+	}
+	if p.consume("$") {
+		return p.macroRef()
+	}
+	if pred, isAxis, err := p.axisPred(); isAxis {
+		return pred, err
+	}
+	return p.attrPred()
+}
+
+// axisPred parses an axis predicate, and reports whether there was one.
+func (p *queryParser) axisPred() (pred axisPred, isAxis bool, err error) {
+	for _, axis := range predAxes {
+		if p.consume(axis + "::") {
+			pred.axis = axis
+			if pred.kind, err = p.kind(); err != nil {
+				return pred, true, err
+			}
+			pred.preds, err = p.preds()
+			return pred, true, err
+		}
+	}
+	return pred, false, nil
+}
+
+// countPred parses a count predicate, after "count".
+func (p *queryParser) countPred() (queryPred, error) {
+	if !p.consume("(") {
+		return nil, p.errorf("expected '('")
+	}
+	p.skipSpace()
+	axis, isAxis, err := p.axisPred()
+	if err != nil {
+		return nil, err
+	} else if !isAxis {
+		return nil, p.errorf("expected an axis")
+	}
+	if !p.consume(")") {
+		return nil, p.errorf("expected ')'")
+	}
+	pred := countPred{axis: axis}
+	for _, op := range []string{"<=", ">=", "!=", "=", "<", ">"} {
+		if p.consume(op) {
+			pred.op = op
+			break
+		}
+	}
+	if pred.op == "" {
+		return nil, p.errorf("expected a comparison")
+	}
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && unicode.IsDigit(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	if pred.n, err = strconv.Atoi(p.src[start:p.pos]); err != nil {
+		p.pos = start
+		return nil, p.errorf("expected a number")
+	}
+	return pred, nil
+}
+
+// kind parses a node kind, or "*" for any kind, which is returned as nil.
+func (p *queryParser) kind() (reflect.Type, error) {
+	if p.consume("*") {
+		return nil, nil
+	}
+	start := p.pos
+	name, err := p.ident()
+	if err != nil {
+		return nil, p.errorf("expected a node kind or '*'")
+	}
+	kind := nodeKinds[name]
+	if kind == nil {
+		p.pos = start
+		return nil, p.semanticf("unknown node kind %q", name)
+	}
+	return kind, nil
+}
+
+// attr parses the name of an attribute.
+func (p *queryParser) attr() (string, error) {
+	start := p.pos
+	attr, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	if queryAttrs[attr] == nil {
+		p.pos = start
+		return "", p.semanticf("unknown attribute %q", attr)
+	}
+	return attr, nil
+}
+
+// param parses a placeholder for the value of pred, and reports whether there was one.
+func (p *queryParser) param(pred *attrPred) bool {
+	if !p.consume("?") {
+		return false
+	}
+	p.params++
+	pred.param = p.params
+	return true
+}
+
+// attrPred parses an attribute predicate, after its opening bracket.
+func (p *queryParser) attrPred() (queryPred, error) {
+	if !p.consume("@") {
+		return nil, p.errorf("expected '@'")
+	}
+	attr, err := p.attr()
+	if err != nil {
+		return nil, err
+	}
+	pred := attrPred{attr: attr}
+	for _, op := range []string{"=~", "!=", "="} {
+		if p.consume(op) {
+			pred.op = op
+			break
+		}
+	}
+	if pred.op == "" {
+		return pred, nil
+	}
+	if p.param(&pred) {
+		return pred, nil
+	}
+	valuePos := p.pos
+	if pred.value, err = p.str(); err != nil {
+		return nil, err
+	}
+	if pred.op == "=~" {
+		if pred.re, err = regexp.Compile(pred.value); err != nil {
+			p.pos = valuePos
+			return nil, p.semanticf("%v", err)
+		}
+	}
+	return pred, nil
+}
@@ -0,0 +1,144 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const querySrc = `package p
+
+import "log"
+
+func HandleIndex() {
+	if err := load(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func handleAbout() {
+	log.Fatal("about")
+}
+
+func load() error {
+	log.Println("loading")
+	return nil
+}
+
+type Server struct{}
+
+func (s *Server) HandleAdmin() { log.Fatal(s) }
+`
+
+func TestQuery(t *testing.T) {
+	file := parseTestFile(t, querySrc)
+	testcases := []struct {
+		query string
+		exp   []string
+	}{
+		{`//FuncDecl[@name=~'^Handle']//CallExpr[@callee='log.Fatal']`, []string{"log.Fatal(err)", "log.Fatal(s)"}},
+		{`//FuncDecl[@exported='false']//CallExpr[@callee=~'^log\.']`, []string{`log.Fatal("about")`, `log.Println("loading")`}},
+		{`/File/FuncDecl[@receiver='Server']`, []string{"func (s *Server) HandleAdmin() { log.Fatal(s) }"}},
+		{`/FuncDecl`, nil},
+		{`//TypeSpec[@exported]`, []string{"Server struct{}"}},
+		{`//FuncDecl[@name!='load'][@exported='false']`, []string{`func handleAbout() { log.Fatal("about") }`}},
+		{`//IfStmt/BlockStmt/ExprStmt/CallExpr`, []string{"log.Fatal(err)"}},
+		{`//FuncDecl/CallExpr`, nil},
+		{`//ReturnStmt/*[@kind="Ident"]`, []string{"nil"}},
+		{` // ImportSpec `, []string{`"log"`}},
+		{`//SelectorExpr[ancestor::FuncDecl[@exported='true']]`, []string{"log.Fatal", "log.Fatal"}},
+		{`//CallExpr[ancestor::*[@kind='IfStmt']]`, []string{"load()", "log.Fatal(err)"}},
+		{`//Ident[@name='log'][ancestor::FuncDecl[ancestor::File][@name!='load']]`, []string{"log", "log", "log"}},
+		{`//ReturnStmt[ancestor::FuncLit]`, nil},
+		{`//FuncDecl[not(descendant::IfStmt)]/Ident`, []string{"handleAbout", "load", "HandleAdmin"}},
+		{`//FuncDecl[not(descendant::IfStmt) and (@exported='true' or @name='load')]/Ident`, []string{"load", "HandleAdmin"}},
+		{`//FuncDecl[@name='load' or @receiver and not(@name='x')]/Ident`, []string{"load", "HandleAdmin"}},
+		{`//FuncDecl[(@name='load' or @receiver) and not(child::FieldList)]/Ident`, []string{"load"}},
+		{`//BlockStmt[child::ExprStmt[descendant::BasicLit] or not(child::*)]`, []string{`{ log.Fatal("about") }`, `{ log.Println("loading") return nil }`}},
+	}
+	for _, test := range testcases {
+		q, err := CompileQuery(test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, node := range Find([]ast.Node{file}, q) {
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.query, test.exp, got)
+		}
+	}
+}
+
+func TestCompileQueryErrors(t *testing.T) {
+	testcases := []struct {
+		query string
+		err   string
+	}{
+		{``, "empty query"},
+		{`FuncDecl`, "offset 0: expected '/' or '//'"},
+		{`//FuncDel`, `offset 2: unknown node kind "FuncDel"`},
+		{`//FuncDecl[@nam='x']`, `offset 12: unknown attribute "nam"`},
+		{`//FuncDecl[@name=~'(']`, "offset 18: error parsing regexp"},
+		{`//FuncDecl[@name='x'`, "offset 20: expected ']'"},
+		{`//FuncDecl[@name='x]`, "offset 17: unterminated string"},
+		{`//FuncDecl[name='x']`, "offset 11: expected '@'"},
+		{`//`, "offset 2: expected a node kind or '*'"},
+		{`//CallExpr[ancestor::Func]`, `offset 21: unknown node kind "Func"`},
+		{`//FuncDecl[not @exported]`, "offset 15: expected '('"},
+		{`//FuncDecl[not(@exported]`, "offset 24: expected ')'"},
+		{`//FuncDecl[@exported and]`, "offset 24: expected '@'"},
+		{`//FuncDecl[@exported or or]`, "offset 24: expected '@'"},
+		{`//CallExpr[ancestor::FuncDecl[@name='x']`, "offset 40: expected ']'"},
+	}
+	for _, test := range testcases {
+		_, err := CompileQuery(test.query)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.query, test.err, err)
+		}
+	}
+}
+
+func TestQueryBind(t *testing.T) {
+	file := parseTestFile(t, querySrc)
+	testcases := []struct {
+		query string
+		args  []string
+		exp   []string
+		err   string
+	}{
+		{`//FuncDecl[@name=?]`, []string{"load"}, []string{"func load() error { log.Println(\"loading\") return nil }"}, ""},
+		{`//FuncDecl[@name=~?]//CallExpr[@callee=?]`, []string{"^Handle", "log.Fatal"}, []string{"log.Fatal(err)", "log.Fatal(s)"}, ""},
+		{`//FuncDecl[@name=?]`, []string{"load", "x"}, nil, "expected 1 arguments, but got 2"},
+		{`//FuncDecl[@name=~?]`, []string{"("}, nil, "error parsing regexp"},
+		{`//ImportSpec`, nil, []string{`"log"`}, ""},
+		{`//CallExpr[ancestor::FuncDecl[@name=?]]`, []string{"load"}, []string{`log.Println("loading")`}, ""},
+		{`//FuncDecl[@name=? or not(@receiver=?)]/Ident`, []string{"load", "Server"}, []string{"HandleIndex", "handleAbout", "load"}, ""},
+	}
+	for _, test := range testcases {
+		q := MustCompileQuery(test.query)
+		bound, err := q.Bind(test.args...)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error containing %q, but got %v", test.query, test.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, node := range Find([]ast.Node{file}, bound) {
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s %q: expected %v, but got %v", test.query, test.args, test.exp, got)
+		}
+		if len(test.args) > 0 && len(Find([]ast.Node{file}, q)) > 0 {
+			t.Errorf("%s: expected the unbound query to match no nodes", test.query)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// Unused returns the identifiers declaring variables, constants, types and functions in
+// p that are never referred to within p, in source order. Declarations that may be used
+// without being referred to are not reported: blank identifiers, exported package-level
+// declarations, methods (which may satisfy interfaces), struct fields, parameters and
+// results, and the init and main functions.
+func (p *TypedPackage) Unused() []*ast.Ident {
+	used := make(map[types.Object]bool)
+	for _, obj := range p.Info.Uses {
+		used[obj] = true
+	}
+	params := p.paramVars()
+
+	var unused []*ast.Ident
+	for ident, obj := range p.Info.Defs {
+		if obj == nil || used[obj] || params[obj] || !reportable(obj) {
+			continue
+		}
+		unused = append(unused, ident)
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i].Pos() < unused[j].Pos() })
+	return unused
+}
+
+// paramVars returns the receivers, parameters and results of all functions in p.
+func (p *TypedPackage) paramVars() map[types.Object]bool {
+	params := make(map[types.Object]bool)
+	addFields := func(fields *ast.FieldList) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				params[p.Info.Defs[name]] = true
+			}
+		}
+	}
+	for _, file := range p.Files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.FuncDecl:
+				addFields(node.Recv)
+			case *ast.FuncType:
+				addFields(node.Params)
+				addFields(node.Results)
+			}
+			return true
+		})
+	}
+	return params
+}
+
+// reportable reports whether Unused reports obj if it has no uses, excluding parameters.
+func reportable(obj types.Object) bool {
+	if obj.Name() == "_" {
+		return false
+	}
+	isPkgLevel := obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope()
+	if isPkgLevel && obj.Exported() {
+		return false
+	}
+	switch obj := obj.(type) {
+	case *types.Var:
+		return !obj.IsField()
+	case *types.Const, *types.TypeName:
+		return true
+	case *types.Func:
+		if obj.Type().(*types.Signature).Recv() != nil {
+			return false
+		}
+		return obj.Name() != "init" && obj.Name() != "main"
+	default:
+		return false
+	}
+}
+
+// ShadowFilter matches identifiers (*ast.Ident) declaring a variable, constant, type or
+// function that shadows a declaration with the same name in an enclosing scope, such as
+// an err declared with := in an inner block. Use Shadowed to get the shadowed object.
+// Shadowed predeclared identifiers, such as len, are not reported.
+type ShadowFilter struct {
+	// Names is a set of names to match (e.g., "err"). If empty, any name matches.
+	Names []string
+}
+
+func (f ShadowFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	ident, isIdent := node.(*ast.Ident)
+	if !isIdent || pkg.Shadowed(ident) == nil {
+		return false
+	}
+	if len(f.Names) == 0 {
+		return true
+	}
+	for _, name := range f.Names {
+		if name == ident.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Shadowed returns the object declared in an enclosing scope that the declaration ident
+// shadows, or nil if ident is not a declaration or shadows nothing. The shadowed object's
+// position is given by its Pos method.
+func (p *TypedPackage) Shadowed(ident *ast.Ident) types.Object {
+	obj := p.Info.Defs[ident]
+	if obj == nil || obj.Name() == "_" {
+		return nil
+	}
+	switch obj.(type) {
+	case *types.Var, *types.Const, *types.TypeName, *types.Func:
+	default:
+		return nil
+	}
+	scope := obj.Parent()
+	if scope == nil || scope.Parent() == nil {
+		return nil // field, method or package-level declaration
+	}
+	_, outer := scope.Parent().LookupParent(ident.Name, ident.Pos())
+	if outer == nil || outer.Parent() == types.Universe {
+		return nil
+	}
+	return outer
+}
+
+// References returns the identifiers in p and the other loaded packages that refer to
+// the objects declared by decl, in p, in source order, followed by those in each of the
+// others in turn. decl may be a function declaration, a type or value spec, a field, an
+// import spec or a declaring identifier; for specs and fields declaring several names,
+// references to any of them are returned. Uses of generic functions, types and their
+// members through instantiations are included.
+//
+// The others may have been type-checked separately from p, importing its package from
+// export data: their objects are matched with those of p by package path, and then by
+// name or by position.
+func (p *TypedPackage) References(decl ast.Node, others ...*TypedPackage) []*ast.Ident {
+	objs := make(map[types.Object]bool)
+	for _, obj := range p.declObjects(decl) {
+		objs[originOf(obj)] = true
+	}
+	refs := p.uses(func(obj types.Object) bool { return objs[obj] })
+	for _, other := range others {
+		if other == p {
+			continue
+		}
+		refs = append(refs, other.uses(func(o types.Object) bool {
+			for obj := range objs {
+				if sameObject(p, obj, other, o) {
+					return true
+				}
+			}
+			return false
+		})...)
+	}
+	return refs
+}
+
+// uses returns the identifiers in p that refer to an object, or the generic origin of an
+// object, for which match returns true, in source order.
+func (p *TypedPackage) uses(match func(types.Object) bool) []*ast.Ident {
+	var refs []*ast.Ident
+	for ident, obj := range p.Info.Uses {
+		if match(originOf(obj)) {
+			refs = append(refs, ident)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Pos() < refs[j].Pos() })
+	return refs
+}
+
+// sameObject reports whether the object obj of p and the object o of other are the same
+// object, possibly from separately type-checked copies of its package.
+func sameObject(p *TypedPackage, obj types.Object, other *TypedPackage, o types.Object) bool {
+	if obj == o {
+		return true
+	}
+	if obj.Pkg() == nil || o.Pkg() == nil || obj.Pkg().Path() != o.Pkg().Path() || obj.Name() != o.Name() {
+		return false
+	}
+	if key, hasKey := objectKey(obj); hasKey {
+		otherKey, otherHasKey := objectKey(o)
+		return otherHasKey && key == otherKey
+	}
+	// Fields and local objects, told apart by where they are declared.
+	pos, otherPos := p.Fset.Position(obj.Pos()), other.Fset.Position(o.Pos())
+	return pos.IsValid() && pos.Filename == otherPos.Filename && pos.Line == otherPos.Line && pos.Column == otherPos.Column
+}
+
+// Definition returns the identifier declaring the object ident refers to, and its
+// position. The declaration is looked up in p and, for objects of other packages, in the
+// others with the matching import path; there, only package-level objects and methods can
+// be resolved. It returns nil and the zero position if the declaration is not found, as
+// for predeclared identifiers.
+func (p *TypedPackage) Definition(ident *ast.Ident, others ...*TypedPackage) (*ast.Ident, token.Position) {
+	obj := p.Info.Uses[ident]
+	if obj == nil {
+		obj = p.Info.Defs[ident]
+	}
+	if obj == nil || obj.Pkg() == nil {
+		return nil, token.Position{}
+	}
+	obj = originOf(obj)
+	if obj.Pkg() == p.Pkg {
+		if def := p.defIdent(func(o types.Object) bool { return o == obj }); def != nil {
+			return def, p.Fset.Position(def.Pos())
+		}
+		return nil, token.Position{}
+	}
+	key, hasKey := objectKey(obj)
+	if !hasKey {
+		return nil, token.Position{}
+	}
+	for _, other := range others {
+		if other.Pkg == nil || other.Pkg.Path() != obj.Pkg().Path() {
+			continue
+		}
+		def := other.defIdent(func(o types.Object) bool {
+			k, ok := objectKey(o)
+			return ok && k == key
+		})
+		if def != nil {
+			return def, other.Fset.Position(def.Pos())
+		}
+	}
+	return nil, token.Position{}
+}
+
+// defIdent returns the identifier in p declaring an object for which match returns true.
+func (p *TypedPackage) defIdent(match func(types.Object) bool) *ast.Ident {
+	for ident, obj := range p.Info.Defs {
+		if obj != nil && match(obj) {
+			return ident
+		}
+	}
+	return nil
+}
+
+// objectKey identifies a package-level object or method across separately type-checked
+// copies of its package, as "Name" or "Recv.Name". It reports false for other objects.
+func objectKey(obj types.Object) (string, bool) {
+	if obj.Pkg() == nil {
+		return "", false
+	}
+	if obj.Parent() == obj.Pkg().Scope() {
+		return obj.Name(), true
+	}
+	if fn, isFunc := obj.(*types.Func); isFunc {
+		if recv := recvTypeName(fn); recv != "" {
+			return recv + "." + fn.Name(), true
+		}
+	}
+	return "", false
+}
+
+// declObjects returns the objects declared by a declaration node.
+func (p *TypedPackage) declObjects(decl ast.Node) []types.Object {
+	var idents []*ast.Ident
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		idents = []*ast.Ident{decl.Name}
+	case *ast.TypeSpec:
+		idents = []*ast.Ident{decl.Name}
+	case *ast.ValueSpec:
+		idents = decl.Names
+	case *ast.Field:
+		idents = decl.Names
+		if len(idents) == 0 {
+			// The embedded type's name declares the field.
+			if ident := embeddedIdent(decl.Type); ident != nil {
+				idents = []*ast.Ident{ident}
+			}
+		}
+	case *ast.ImportSpec:
+		if decl.Name != nil {
+			idents = []*ast.Ident{decl.Name}
+		} else if obj := p.Info.Implicits[decl]; obj != nil {
+			return []types.Object{obj}
+		}
+	case *ast.Ident:
+		if obj := p.Info.Defs[decl]; obj != nil {
+			return []types.Object{obj}
+		}
+		if obj := p.Info.Uses[decl]; obj != nil {
+			return []types.Object{obj}
+		}
+	}
+	var objs []types.Object
+	for _, ident := range idents {
+		if obj := p.Info.Defs[ident]; obj != nil {
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+// embeddedIdent returns the identifier naming the type of an embedded field, or nil if
+// typ is not a named type.
+func embeddedIdent(typ ast.Expr) *ast.Ident {
+	switch typ := typ.(type) {
+	case *ast.StarExpr:
+		return embeddedIdent(typ.X)
+	case *ast.IndexExpr:
+		return embeddedIdent(typ.X)
+	case *ast.IndexListExpr:
+		return embeddedIdent(typ.X)
+	case *ast.Ident:
+		return typ
+	case *ast.SelectorExpr:
+		return typ.Sel
+	default:
+		return nil
+	}
+}
+
+// originOf returns the generic object that obj is an instantiation of, or obj itself.
+func originOf(obj types.Object) types.Object {
+	switch obj := obj.(type) {
+	case *types.Func:
+		return obj.Origin()
+	case *types.Var:
+		return obj.Origin()
+	default:
+		return obj
+	}
+}
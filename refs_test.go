@@ -0,0 +1,309 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"testing"
+)
+
+func TestUnused(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import "fmt"
+
+const (
+	used   = 1
+	unused = 2
+	Public = 3
+)
+
+type helper struct{ field int }
+
+type orphan int
+
+var cache = map[string]int{}
+
+func init() { fmt.Println(used) }
+
+func Run(arg int) (result int) {
+	var tmp int
+	tmp = arg
+	_ = tmp
+	h := helper{}
+	return h.field
+}
+
+func deadCode() {
+	x := 1
+	_ = func(y int) {}
+	_ = x
+}
+
+func (h helper) method() {}
+`)
+
+	var names []string
+	for _, ident := range pkg.Unused() {
+		names = append(names, ident.Name)
+	}
+	if exp := []string{"unused", "orphan", "cache", "deadCode"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected unused identifiers %v, but got %v", exp, names)
+	}
+}
+
+func TestShadowFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import (
+	"errors"
+	"strconv"
+)
+
+var count int
+
+func parse(s string) (n int, err error) {
+	if s == "" {
+		err := errors.New("empty")
+		return 0, err
+	}
+	n, err = strconv.Atoi(s)
+	for count := 0; count < 3; count++ {
+		len := count
+		_ = len
+	}
+	f := func(s string) {}
+	f(s)
+	return n, err
+}
+`)
+
+	testcases := []struct {
+		filter ShadowFilter
+		exp    []string
+	}{
+		{ShadowFilter{}, []string{"err@12 shadows err@10", "count@16 shadows count@8", "s@20 shadows s@10"}},
+		{ShadowFilter{Names: []string{"err"}}, []string{"err@12 shadows err@10"}},
+	}
+	for _, test := range testcases {
+		var shadows []string
+		for _, node := range pkg.FindTyped(test.filter) {
+			ident := node.(*ast.Ident)
+			shadowed := pkg.Shadowed(ident)
+			shadows = append(shadows, fmt.Sprintf("%s@%d shadows %s@%d", ident.Name, pkg.Fset.Position(ident.Pos()).Line,
+				shadowed.Name(), pkg.Fset.Position(shadowed.Pos()).Line))
+		}
+		if !reflect.DeepEqual(shadows, test.exp) {
+			t.Errorf("%+v: expected shadowing declarations %v, but got %v", test.filter, test.exp, shadows)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import "sync"
+
+type Stack[T any] struct {
+	sync.Mutex
+	items []T
+}
+
+func (s *Stack[T]) Push(v T) {
+	s.Lock()
+	s.items = append(s.items, v)
+	s.Unlock()
+}
+
+var ints Stack[int]
+
+func fill() {
+	ints.Push(1)
+	ints.Push(2)
+	var strs Stack[string]
+	strs.Push("a")
+	strs.items = nil
+}
+`)
+
+	decls := make(map[string]ast.Node)
+	for _, node := range pkg.Find(FilterFunc(func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.TypeSpec, *ast.FuncDecl, *ast.Field, *ast.ValueSpec:
+			return true
+		}
+		return false
+	})) {
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			decls[node.Name.Name] = node
+		case *ast.ValueSpec:
+			decls[node.Names[0].Name] = node
+		case *ast.TypeSpec:
+			decls[node.Name.Name] = node
+			for _, field := range node.Type.(*ast.StructType).Fields.List {
+				if len(field.Names) > 0 {
+					decls[field.Names[0].Name] = field
+				} else {
+					decls["Mutex field"] = field
+				}
+			}
+		}
+	}
+
+	testcases := []struct {
+		decl string
+		exp  []string
+	}{
+		{"Stack", []string{"Stack@10", "Stack@16", "Stack@21"}},
+		{"Push", []string{"Push@19", "Push@20", "Push@22"}},
+		{"items", []string{"items@12", "items@12", "items@23"}},
+		{"ints", []string{"ints@19", "ints@20"}},
+		{"Mutex field", nil},
+	}
+	for _, test := range testcases {
+		var refs []string
+		for _, ident := range pkg.References(decls[test.decl]) {
+			refs = append(refs, fmt.Sprintf("%s@%d", ident.Name, pkg.Fset.Position(ident.Pos()).Line))
+		}
+		if !reflect.DeepEqual(refs, test.exp) {
+			t.Errorf("%s: expected references %v, but got %v", test.decl, test.exp, refs)
+		}
+	}
+}
+
+func TestReferencesAcrossPackages(t *testing.T) {
+	fset := token.NewFileSet()
+	parse := func(filename, src string) []*ast.File {
+		file, err := parser.ParseFile(fset, filename, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []*ast.File{file}
+	}
+	libFiles := parse("lib.go", `package lib
+
+type Client struct{ Name string }
+
+func (c *Client) Do() {}
+
+func New() *Client { return &Client{} }
+`)
+	lib, err := NewTypedPackage("example.com/lib", fset, libFiles, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The app imports a separately type-checked copy of lib, as if from export data.
+	libCopy, err := NewTypedPackage("example.com/lib", fset, libFiles, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := NewTypedPackage("example.com/app", fset, parse("app.go", `package app
+
+import "example.com/lib"
+
+func run() {
+	c := lib.New()
+	c.Do()
+	c.Name = "x"
+	var _ *lib.Client = c
+}
+`), &types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) { return libCopy.Pkg, nil }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name string
+		exp  []string
+	}{
+		{"Client", []string{"lib.go:5", "lib.go:7", "lib.go:7", "app.go:9"}},
+		{"Do", []string{"app.go:7"}},
+		{"Name", []string{"app.go:8"}},
+		{"New", []string{"app.go:6"}},
+		{"c", nil},
+	}
+	for _, test := range testcases {
+		var refs []string
+		for _, ident := range lib.References(declIdent(test.name)(lib), app) {
+			pos := fset.Position(ident.Pos())
+			refs = append(refs, fmt.Sprintf("%s:%d", pos.Filename, pos.Line))
+		}
+		if !reflect.DeepEqual(refs, test.exp) {
+			t.Errorf("%s: expected references %v, but got %v", test.name, test.exp, refs)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	libFset := token.NewFileSet()
+	libFile, err := parser.ParseFile(libFset, "lib.go", `package lib
+
+type Client struct{}
+
+func (c *Client) Do() {}
+
+func New() *Client { return &Client{} }
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib, err := NewTypedPackage("example.com/lib", libFset, []*ast.File{libFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Type-check the main package from source, importing lib from its AST.
+	appFset := token.NewFileSet()
+	appFile, err := parser.ParseFile(appFset, "app.go", `package app
+
+import "example.com/lib"
+
+func run() {
+	c := lib.New()
+	c.Do()
+	println(c)
+}
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := NewTypedPackage("example.com/app", appFset, []*ast.File{appFile}, &types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) { return lib.Pkg, nil }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name string
+		exp  string
+	}{
+		{"New", "lib.go:7 New"},
+		{"Do", "lib.go:5 Do"},
+		{"c", "app.go:6 c"},
+		{"println", "-"},
+	}
+	for _, test := range testcases {
+		uses := app.Find(FilterFunc(func(node ast.Node) bool {
+			ident, isIdent := node.(*ast.Ident)
+			return isIdent && ident.Name == test.name && app.Info.Uses[ident] != nil
+		}))
+		if len(uses) == 0 {
+			t.Fatalf("no use of %s found", test.name)
+		}
+		def, pos := app.Definition(uses[0].(*ast.Ident), lib)
+		got := "-"
+		if def != nil {
+			got = fmt.Sprintf("%s:%d %s", pos.Filename, pos.Line, def.Name)
+		}
+		if got != test.exp {
+			t.Errorf("%s: expected definition %s, but got %s", test.name, test.exp, got)
+		}
+	}
+}
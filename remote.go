@@ -0,0 +1,489 @@
+package astquery
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// LoadModuleVersion downloads a version of the module modPath from the module proxies
+// listed by GOPROXY and loads its packages, as LoadZip does, without writing the module
+// to disk. version is a version such as "v1.2.3", or "latest". The go command's
+// environment, as amended by opts.Env, configures the download as it does the go
+// command's:
+//
+//   - Proxies are tried in order as the go command tries them, except that "direct"
+//     entries, which would fetch the module from its version control repository, are
+//     skipped. Modules matching GONOPROXY (by default, GOPRIVATE) are fetched directly by
+//     the go command, so they can't be loaded.
+//   - The hash of the downloaded module is checked against the checksum database named by
+//     GOSUMDB, unless GOSUMDB is "off" or the module matches GONOSUMDB (by default,
+//     GOPRIVATE), and LoadModuleVersion fails if the database doesn't list the module or
+//     lists another hash. The module's record must be included in the tree the database
+//     signed, as proven by the hashes of the tree's tiles. Unlike the go command,
+//     LoadModuleVersion doesn't remember the trees it has seen, so it doesn't check that
+//     the database's trees are consistent with each other.
+func LoadModuleVersion(modPath, version string, opts *LoadOptions) ([]*Package, error) {
+	envOpts := &LoadOptions{}
+	if opts != nil {
+		envOpts.Env = opts.Env
+	}
+	env := make(map[string]string)
+	for _, name := range []string{"GOPROXY", "GONOPROXY", "GOSUMDB", "GONOSUMDB"} {
+		value, err := goEnv(envOpts, name)
+		if err != nil {
+			return nil, err
+		}
+		env[name] = value
+	}
+	if matchPrefixPatterns(env["GONOPROXY"], modPath) {
+		return nil, fmt.Errorf("%s: module matches GONOPROXY, and direct module downloads are not supported", modPath)
+	}
+	escapedPath, err := escapeModulePath(modPath)
+	if err != nil {
+		return nil, err
+	}
+	if version == "latest" {
+		data, err := proxyGet(env["GOPROXY"], "/"+escapedPath+"/@latest")
+		if err != nil {
+			return nil, err
+		}
+		var info struct{ Version string }
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, fmt.Errorf("%s@latest: %v", modPath, err)
+		}
+		version = info.Version
+	}
+	escapedVersion, err := escapeModulePath(version)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := proxyGet(env["GOPROXY"], "/"+escapedPath+"/@v/"+escapedVersion+".zip")
+	if err != nil {
+		return nil, err
+	}
+	if env["GOSUMDB"] != "off" && !matchPrefixPatterns(env["GONOSUMDB"], modPath) {
+		if err := checkModuleSum(env["GOSUMDB"], modPath, version, archive); err != nil {
+			return nil, fmt.Errorf("%s@%s: %v", modPath, version, err)
+		}
+	}
+	return LoadZipReader(bytes.NewReader(archive), int64(len(archive)), opts)
+}
+
+// matchPrefixPatterns reports whether modPath or one of its leading path prefixes matches
+// one of the comma-separated glob patterns in patterns, as GOPRIVATE's patterns match.
+func matchPrefixPatterns(patterns, modPath string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		// Match the prefix of modPath with as many path elements as pattern has.
+		prefix := modPath
+		for i, n := 0, strings.Count(pattern, "/")+1; i < len(modPath); i++ {
+			if modPath[i] == '/' {
+				if n--; n == 0 {
+					prefix = modPath[:i]
+					break
+				}
+			}
+		}
+		if strings.Count(prefix, "/") == strings.Count(pattern, "/") {
+			if matched, _ := path.Match(pattern, prefix); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sumGolangOrgKey is the verifier key of the checksum database sum.golang.org.
+const sumGolangOrgKey = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8"
+
+// checkModuleSum checks the hash of archive, the zip file of the module modPath at
+// version, against the one listed by the checksum database gosumdb, a GOSUMDB value.
+func checkModuleSum(gosumdb, modPath, version string, archive []byte) error {
+	fields := strings.Fields(gosumdb)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("invalid GOSUMDB %q", gosumdb)
+	}
+	key, dbURL := fields[0], ""
+	if len(fields) == 2 {
+		dbURL = fields[1]
+	}
+	switch key {
+	case "sum.golang.org":
+		key = sumGolangOrgKey
+	case "sum.golang.google.cn":
+		key, dbURL = sumGolangOrgKey, "https://sum.golang.google.cn"
+	}
+	name, verifier, err := parseVerifierKey(key)
+	if err != nil {
+		return fmt.Errorf("invalid GOSUMDB %q: %v", gosumdb, err)
+	}
+	if dbURL == "" {
+		dbURL = "https://" + name
+	}
+
+	escapedPath, _ := escapeModulePath(modPath)
+	escapedVersion, _ := escapeModulePath(version)
+	data, err := httpGet(strings.TrimSuffix(dbURL, "/") + "/lookup/" + escapedPath + "@" + escapedVersion)
+	if err != nil {
+		return fmt.Errorf("checksum database: %v", err)
+	}
+	// The response holds the ID of the module's record, the record, ended by a blank line,
+	// and the signed tree of the database.
+	i := bytes.IndexByte(data, '\n')
+	j := bytes.Index(data, []byte("\n\n"))
+	if i < 0 || j < i {
+		return fmt.Errorf("checksum database: malformed lookup response")
+	}
+	id, err := strconv.ParseInt(string(data[:i]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("checksum database: malformed record ID: %v", err)
+	}
+	record := data[i+1 : j+1]
+	treeText, err := verifyNote(data[j+2:], name, verifier)
+	if err != nil {
+		return fmt.Errorf("checksum database: %v", err)
+	}
+	tree, err := parseSumTree(treeText)
+	if err != nil {
+		return fmt.Errorf("checksum database: %v", err)
+	}
+	tree.url = strings.TrimSuffix(dbURL, "/")
+	if err := tree.checkIncluded(id, record); err != nil {
+		return fmt.Errorf("checksum database: %v", err)
+	}
+	sum, err := hashZip(archive)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(record), "\n") {
+		if f := strings.Fields(line); len(f) == 3 && f[0] == modPath && f[1] == version {
+			if f[2] != sum {
+				return fmt.Errorf("checksum mismatch: downloaded %s, but %s lists %s", sum, name, f[2])
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("checksum database %s has no hash for the module", name)
+}
+
+// parseVerifierKey parses a note verifier key, "name+hash+key", returning the name and
+// the Ed25519 public key with the hash identifying it.
+func parseVerifierKey(vkey string) (string, verifierKey, error) {
+	parts := strings.SplitN(vkey, "+", 3)
+	if len(parts) != 3 || parts[0] == "" || len(parts[1]) != 8 {
+		return "", verifierKey{}, errors.New("malformed verifier key")
+	}
+	hash, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return "", verifierKey{}, errors.New("malformed verifier key")
+	}
+	data, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(data) != 1+ed25519.PublicKeySize || data[0] != 1 {
+		return "", verifierKey{}, errors.New("malformed or unsupported verifier key")
+	}
+	key := verifierKey{hash: binary.BigEndian.Uint32(hash), key: ed25519.PublicKey(data[1:])}
+	if key.hash != noteKeyHash(parts[0], data) {
+		return "", verifierKey{}, errors.New("verifier key hash mismatch")
+	}
+	return parts[0], key, nil
+}
+
+// verifierKey is the public key of a note signer.
+type verifierKey struct {
+	hash uint32
+	key  ed25519.PublicKey
+}
+
+// noteKeyHash returns the hash identifying the key of a note signer, of the given name,
+// in its signatures.
+func noteKeyHash(name string, key []byte) uint32 {
+	h := sha256.Sum256(append([]byte(name+"\n"), key...))
+	return binary.BigEndian.Uint32(h[:4])
+}
+
+// verifyNote verifies that msg, a signed note, has a valid signature by the signer name
+// with key, and returns the text of the note.
+func verifyNote(msg []byte, name string, key verifierKey) ([]byte, error) {
+	split := bytes.LastIndex(msg, []byte("\n\n"))
+	if split < 0 {
+		return nil, errors.New("malformed signed tree")
+	}
+	text, sigs := msg[:split+1], msg[split+2:]
+	for _, line := range strings.SplitAfter(string(sigs), "\n") {
+		f := strings.Fields(strings.TrimPrefix(line, "\u2014 "))
+		if !strings.HasPrefix(line, "\u2014 ") || len(f) != 2 || f[0] != name {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(f[1])
+		if err != nil || len(sig) != 4+ed25519.SignatureSize || binary.BigEndian.Uint32(sig) != key.hash {
+			continue
+		}
+		if ed25519.Verify(key.key, text, sig[4:]) {
+			return text, nil
+		}
+	}
+	return nil, fmt.Errorf("signed tree has no valid signature by %s", name)
+}
+
+// sumTree is the tree of the records of a checksum database, a Merkle tree whose stored
+// hashes are served in tiles.
+type sumTree struct {
+	url   string // of the database
+	size  int64  // the number of records
+	hash  sumHash
+	tiles map[string][]byte // by URL
+}
+
+// sumHash is the hash of a record or of a subtree of a sumTree.
+type sumHash [sha256.Size]byte
+
+// sumTileHeight is the number of tree levels a tile of a checksum database covers.
+const sumTileHeight = 8
+
+// parseSumTree parses the text of a checksum database's signed tree note.
+func parseSumTree(text []byte) (*sumTree, error) {
+	lines := strings.Split(string(text), "\n")
+	if len(lines) != 4 || lines[0] != "go.sum database tree" || lines[3] != "" {
+		return nil, errors.New("malformed tree note")
+	}
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	hash, hashErr := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || size < 0 || hashErr != nil || len(hash) != sha256.Size {
+		return nil, errors.New("malformed tree note")
+	}
+	tree := &sumTree{size: size, tiles: make(map[string][]byte)}
+	copy(tree.hash[:], hash)
+	return tree, nil
+}
+
+// checkIncluded checks that the record with the given ID and text is included in t: that
+// the hash of t, computed from the record's hash and the hashes stored for the rest of t,
+// is the one the database signed.
+func (t *sumTree) checkIncluded(id int64, record []byte) error {
+	if id < 0 || id >= t.size {
+		return fmt.Errorf("record %d is not in the tree of %d records", id, t.size)
+	}
+	leaf := sumHash(sha256.Sum256(append([]byte{0}, record...)))
+	root, err := t.subtreeHash(0, t.size, id, leaf)
+	if err != nil {
+		return err
+	}
+	if root != t.hash {
+		return fmt.Errorf("record %d is not included in the signed tree", id)
+	}
+	return nil
+}
+
+// subtreeHash returns the hash of the subtree of t holding the records [lo, hi), in
+// which record id has the hash leaf.
+func (t *sumTree) subtreeHash(lo, hi, id int64, leaf sumHash) (sumHash, error) {
+	n := hi - lo
+	if n == 1 && lo == id {
+		return leaf, nil
+	}
+	if n&(n-1) == 0 && (id < lo || id >= hi) {
+		// A complete subtree without the record, whose hash is stored.
+		return t.storedHash(bits.TrailingZeros64(uint64(n)), lo/n)
+	}
+	k := int64(1) << (bits.Len64(uint64(n-1)) - 1) // the largest power of 2 less than n
+	left, err := t.subtreeHash(lo, lo+k, id, leaf)
+	if err != nil {
+		return sumHash{}, err
+	}
+	right, err := t.subtreeHash(lo+k, hi, id, leaf)
+	if err != nil {
+		return sumHash{}, err
+	}
+	return nodeHash(left, right), nil
+}
+
+// storedHash returns the hash of the index'th complete subtree of t at the given level,
+// computed from the bottom row of the tile holding it.
+func (t *sumTree) storedHash(level int, index int64) (sumHash, error) {
+	tileLevel, height := level/sumTileHeight, level%sumTileHeight
+	start, count := index<<height, int64(1)<<height // at the bottom of the tile
+	tileIndex := start >> sumTileHeight
+	width := min(1<<sumTileHeight, t.size>>(tileLevel*sumTileHeight)-tileIndex<<sumTileHeight)
+	url := fmt.Sprintf("%s/tile/%d/%d/%s", t.url, sumTileHeight, tileLevel, tilePath(tileIndex))
+	if width < 1<<sumTileHeight {
+		url += fmt.Sprintf(".p/%d", width)
+	}
+	data, cached := t.tiles[url]
+	if !cached {
+		var err error
+		if data, err = httpGet(url); err != nil {
+			return sumHash{}, err
+		}
+		if int64(len(data)) != width*sha256.Size {
+			return sumHash{}, fmt.Errorf("%s: expected %d hashes", url, width)
+		}
+		t.tiles[url] = data
+	}
+	offset := start - tileIndex<<sumTileHeight
+	hashes := make([]sumHash, count)
+	for i := range hashes {
+		copy(hashes[i][:], data[(offset+int64(i))*sha256.Size:])
+	}
+	for len(hashes) > 1 {
+		for i := 0; i < len(hashes)/2; i++ {
+			hashes[i] = nodeHash(hashes[2*i], hashes[2*i+1])
+		}
+		hashes = hashes[:len(hashes)/2]
+	}
+	return hashes[0], nil
+}
+
+// nodeHash returns the hash of a subtree from those of its two halves.
+func nodeHash(left, right sumHash) sumHash {
+	return sha256.Sum256(append(append([]byte{1}, left[:]...), right[:]...))
+}
+
+// tilePath returns the path element of a tile index in a tile's URL: groups of three
+// digits, all but the last prefixed with 'x' (e.g., "x001/x234/067" for 1234067).
+func tilePath(index int64) string {
+	path := fmt.Sprintf("%03d", index%1000)
+	for index /= 1000; index > 0; index /= 1000 {
+		path = fmt.Sprintf("x%03d/", index%1000) + path
+	}
+	return path
+}
+
+// hashZip returns the "h1:" hash of a module zip file, as go.sum files and checksum
+// databases list it: the SHA-256 of the sorted list of the SHA-256 of each file with its
+// name.
+func hashZip(archive []byte) (string, error) {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, f := range r.File {
+		if strings.Contains(f.Name, "\n") {
+			return "", fmt.Errorf("invalid file name %q in module zip", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("%x  %s\n", h.Sum(nil), f.Name))
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "")))
+	return "h1:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// proxyStatusError is a module proxy's response to a request that failed.
+type proxyStatusError struct {
+	url  string
+	code int
+}
+
+func (e *proxyStatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.url, e.code, http.StatusText(e.code))
+}
+
+// proxyGet requests urlPath from the proxies in the GOPROXY list proxies, falling back to
+// the next proxy after a proxy followed by a comma responds that it doesn't have the
+// module, or after any error of a proxy followed by a pipe.
+func proxyGet(proxies, urlPath string) ([]byte, error) {
+	err := errors.New("GOPROXY lists no proxies")
+	for proxies != "" {
+		proxy, sep := proxies, byte(0)
+		if i := strings.IndexAny(proxies, ",|"); i >= 0 {
+			proxy, sep, proxies = proxies[:i], proxies[i], proxies[i+1:]
+		} else {
+			proxies = ""
+		}
+		switch strings.TrimSpace(proxy) {
+		case "":
+			continue
+		case "off":
+			return nil, errors.New("module downloads disabled by GOPROXY=off")
+		case "direct":
+			err = errors.New("direct module downloads are not supported")
+			continue
+		}
+		var data []byte
+		data, err = httpGet(strings.TrimSuffix(strings.TrimSpace(proxy), "/") + urlPath)
+		if err == nil {
+			return data, nil
+		}
+		var statusErr *proxyStatusError
+		notFound := errors.As(err, &statusErr) && (statusErr.code == http.StatusNotFound || statusErr.code == http.StatusGone)
+		if sep != '|' && !notFound {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// httpClient is the client for requests to module proxies and checksum databases.
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// maxResponseSize is the size of the largest response accepted from a module proxy or
+// checksum database: that of the largest module zip file the go command accepts.
+const maxResponseSize = 500 << 20
+
+func httpGet(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &proxyStatusError{url: url, code: resp.StatusCode}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("%s: response larger than %d bytes", url, maxResponseSize)
+	}
+	return data, nil
+}
+
+// escapeModulePath escapes a module path or version for use in a module proxy URL,
+// replacing each upper-case letter with an exclamation mark followed by the lower-case
+// letter.
+func escapeModulePath(s string) (string, error) {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '!' || r >= unicode.MaxASCII:
+			return "", fmt.Errorf("invalid module path or version %q", s)
+		case 'A' <= r && r <= 'Z':
+			b.WriteByte('!')
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), nil
+}
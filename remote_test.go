@@ -0,0 +1,230 @@
+package astquery
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLoadModuleVersion(t *testing.T) {
+	archives := map[string][]byte{
+		"/example.com/!dep/@v/v1.0.0.zip": writeTestZip(t, map[string]string{
+			"example.com/Dep@v1.0.0/dep.go": "package dep\n\nfunc Old() {}\n",
+		}),
+		"/example.com/!dep/@v/v1.1.0.zip": writeTestZip(t, map[string]string{
+			"example.com/Dep@v1.1.0/dep.go": "package dep\n\nfunc New() {}\n",
+		}),
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/example.com/!dep/@latest" {
+			w.Write([]byte(`{"Version":"v1.1.0"}`))
+			return
+		}
+		if archive, exists := archives[r.URL.Path]; exists {
+			w.Write(archive)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer proxy.Close()
+	empty := httptest.NewServer(http.NotFoundHandler())
+	defer empty.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	sums := make(map[string]string)
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		sum, err := hashZip(archives["/example.com/!dep/@v/"+version+".zip"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sums["/lookup/example.com/!dep@"+version] = "example.com/Dep " + version + " " + sum
+	}
+	archives["/example.com/!dep/@v/v1.2.0.zip"] = writeTestZip(t, map[string]string{
+		"example.com/Dep@v1.2.0/dep.go": "package dep\n\nfunc Unlisted() {}\n",
+	})
+	archives["/example.com/!dep/@v/v1.3.0.zip"] = writeTestZip(t, map[string]string{
+		"example.com/Dep@v1.3.0/dep.go": "package dep\n\nfunc Tampered() {}\n",
+	})
+	archives["/example.com/!dep/@v/v1.4.0.zip"] = writeTestZip(t, map[string]string{
+		"example.com/Dep@v1.4.0/dep.go": "package dep\n\nfunc Forged() {}\n",
+	})
+	// The hash of v1.3.0 in the checksum database is not that of its archive, and the
+	// database forges the record of v1.4.0, which its tree doesn't include.
+	sums["/lookup/example.com/!dep@v1.3.0"] = strings.Replace(sums["/lookup/example.com/!dep@v1.1.0"], "v1.1.0", "v1.3.0", 1)
+	sums["/lookup/example.com/!dep@v1.4.0"] = strings.Replace(sums["/lookup/example.com/!dep@v1.1.0"], "v1.1.0", "v1.4.0", 1)
+	forgedSum, err := hashZip(archives["/example.com/!dep/@v/v1.4.0.zip"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sumdb, gosumdb := testSumDB(t, sums, map[string]string{
+		"/lookup/example.com/!dep@v1.4.0": "example.com/Dep v1.4.0 " + forgedSum,
+	})
+	defer sumdb.Close()
+
+	testcases := []struct {
+		goproxy string
+		env     []string
+		version string
+		exp     []string // or nil for an error
+	}{
+		{proxy.URL, nil, "v1.0.0", []string{"Old"}},
+		{proxy.URL, nil, "latest", []string{"New"}},
+		{empty.URL + "," + proxy.URL, nil, "v1.0.0", []string{"Old"}},
+		{broken.URL + "|" + proxy.URL, nil, "v1.0.0", []string{"Old"}},
+		{broken.URL + "," + proxy.URL, nil, "v1.0.0", nil},
+		{"direct," + proxy.URL, nil, "v1.0.0", []string{"Old"}},
+		{proxy.URL, nil, "v2.0.0", nil},
+		{"off", nil, "v1.0.0", nil},
+		{proxy.URL, []string{"GOPRIVATE=example.com"}, "v1.0.0", nil},
+		{proxy.URL, []string{"GONOPROXY=*.com/Dep"}, "v1.0.0", nil},
+		{proxy.URL, []string{"GONOPROXY=example.com/Other"}, "v1.0.0", []string{"Old"}},
+		{proxy.URL, nil, "v1.2.0", nil},
+		{proxy.URL, []string{"GONOSUMDB=example.com"}, "v1.2.0", []string{"Unlisted"}},
+		{proxy.URL, []string{"GOSUMDB=off"}, "v1.2.0", []string{"Unlisted"}},
+		{proxy.URL, nil, "v1.3.0", nil},
+		{proxy.URL, nil, "v1.4.0", nil},
+		{proxy.URL, []string{"GOSUMDB=" + testVerifierKey(t, "sum.example") + " " + sumdb.URL}, "v1.0.0", nil},
+	}
+	for _, test := range testcases {
+		env := append(os.Environ(), "GOPRIVATE=", "GONOPROXY=", "GONOSUMDB=", "GOSUMDB="+gosumdb, "GOPROXY="+test.goproxy)
+		env = append(env, test.env...)
+		pkgs, err := LoadModuleVersion("example.com/Dep", test.version, &LoadOptions{Env: env})
+		if test.exp == nil {
+			if err == nil {
+				t.Errorf("%+v: expected an error, but got none", test)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", test, err)
+			continue
+		}
+		if len(pkgs) != 1 || pkgs[0].ImportPath != "example.com/Dep" {
+			t.Errorf("%+v: expected package example.com/Dep, but got %v", test, pkgs)
+			continue
+		}
+		var funcs []string
+		for _, m := range pkgs[0].Find(FilterFunc(func(node ast.Node) bool {
+			_, isFunc := node.(*ast.FuncDecl)
+			return isFunc
+		})) {
+			funcs = append(funcs, m.Node.(*ast.FuncDecl).Name.Name)
+		}
+		if !reflect.DeepEqual(funcs, test.exp) {
+			t.Errorf("%+v: expected funcs %v, but got %v", test, test.exp, funcs)
+		}
+	}
+}
+
+func TestSumGolangOrgKey(t *testing.T) {
+	if name, _, err := parseVerifierKey(sumGolangOrgKey); name != "sum.golang.org" || err != nil {
+		t.Errorf("expected the key of sum.golang.org, but got %q, %v", name, err)
+	}
+}
+
+// testSumDB starts a checksum database, sum.example, whose tree holds the given records,
+// by lookup path, among others, and returns it with its GOSUMDB value. The records in
+// forged are served for their lookup paths, in place of those of the tree.
+func testSumDB(t *testing.T, records, forged map[string]string) (*httptest.Server, string) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Spread the records over a tree of several tiles.
+	var lookups []string
+	for lookup := range records {
+		lookups = append(lookups, lookup)
+	}
+	sort.Strings(lookups)
+	leaves := make([][sha256.Size]byte, 150*len(lookups)+7)
+	ids := make(map[string]int)
+	for i := range leaves {
+		text := fmt.Sprintf("example.com/filler%d v1.0.0 h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n", i)
+		if i%150 == 0 && i/150 < len(lookups) {
+			ids[lookups[i/150]] = i
+			text = records[lookups[i/150]] + "\n"
+		}
+		leaves[i] = sha256.Sum256(append([]byte{0}, text...))
+	}
+
+	keyData := append([]byte{1}, pub...)
+	hash := noteKeyHash("sum.example", keyData)
+	root := testTreeHash(leaves)
+	tree := fmt.Sprintf("go.sum database tree\n%d\n%s\n", len(leaves), base64.StdEncoding.EncodeToString(root[:]))
+	sig := binary.BigEndian.AppendUint32(nil, hash)
+	sig = append(sig, ed25519.Sign(priv, []byte(tree))...)
+	note := tree + "\n\u2014 sum.example " + base64.StdEncoding.EncodeToString(sig) + "\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tile, isTile := strings.CutPrefix(r.URL.Path, "/tile/8/"); isTile {
+			// The hashes of the complete subtrees at the bottom level of the tile.
+			parts := strings.Split(tile, "/")
+			level, _ := strconv.Atoi(parts[0])
+			parts, width := parts[1:], 256
+			if n := len(parts); n >= 2 && strings.HasSuffix(parts[n-2], ".p") {
+				width, _ = strconv.Atoi(parts[n-1])
+				parts = append(parts[:n-2], strings.TrimSuffix(parts[n-2], ".p"))
+			}
+			index, _ := strconv.Atoi(strings.ReplaceAll(strings.Join(parts, ""), "x", ""))
+			size := 1 << (8 * level)
+			for i := index * 256; i < index*256+width; i++ {
+				if (i+1)*size > len(leaves) {
+					http.NotFound(w, r)
+					return
+				}
+				subtree := testTreeHash(leaves[i*size : (i+1)*size])
+				w.Write(subtree[:])
+			}
+			return
+		}
+		id, exists := ids[r.URL.Path]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		record := records[r.URL.Path]
+		if forgery, isForged := forged[r.URL.Path]; isForged {
+			record = forgery
+		}
+		fmt.Fprintf(w, "%d\n%s\n\n%s", id, record, note)
+	}))
+	vkey := fmt.Sprintf("sum.example+%08x+%s", hash, base64.StdEncoding.EncodeToString(keyData))
+	return server, vkey + " " + server.URL
+}
+
+// testTreeHash returns the hash of the Merkle tree of the given leaf hashes, as RFC 6962
+// defines it.
+func testTreeHash(leaves [][sha256.Size]byte) [sha256.Size]byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := 1
+	for k*2 < len(leaves) {
+		k *= 2
+	}
+	left, right := testTreeHash(leaves[:k]), testTreeHash(leaves[k:])
+	return sha256.Sum256(append(append([]byte{1}, left[:]...), right[:]...))
+}
+
+// testVerifierKey returns the verifier key of a new signer named name.
+func testVerifierKey(t *testing.T, name string) string {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyData := append([]byte{1}, pub...)
+	return fmt.Sprintf("%s+%08x+%s", name, noteKeyHash(name, keyData), base64.StdEncoding.EncodeToString(keyData))
+}
@@ -0,0 +1,303 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// Rename renames the object declared by decl to newName, rewriting the identifier
+// declaring it and all its references in the package's files and in those of the other
+// loaded packages given, and returns the rewritten identifiers: p's in source order, then
+// each other package's in turn. decl is a declaration as passed to References, and must
+// declare a single object of p. Renaming a type renames the fields embedding it too, and
+// renaming an import that has no name gives it one.
+//
+// Before rewriting anything, Rename checks that the new name collides with no other
+// declaration in the scopes affected: that it is not declared in the same scope, or as a
+// field or method of the same type, that no declaration in an inner scope would shadow
+// the renamed object at one of its references, and that the renamed object would shadow
+// no object at the references to it. An object referred to by the other packages can't be
+// renamed to an unexported name, and the fields embedding it there, and its references
+// through dot imports, must not collide either. Packages importing p that are not given,
+// and the interfaces a renamed method satisfies, are not considered. The type information
+// of the packages is not updated and still holds the old name.
+func (p *TypedPackage) Rename(decl ast.Node, newName string, others ...*TypedPackage) ([]*ast.Ident, error) {
+	objs := p.declObjects(decl)
+	if len(objs) != 1 {
+		return nil, fmt.Errorf("expected a declaration of one object, but got %d", len(objs))
+	}
+	obj := originOf(objs[0])
+	switch {
+	case !token.IsIdentifier(newName) || newName == "_":
+		return nil, fmt.Errorf("invalid name %q", newName)
+	case obj.Pkg() != p.Pkg:
+		return nil, fmt.Errorf("cannot rename %s: it is declared in package %s", obj.Name(), obj.Pkg().Path())
+	case obj.Name() == newName:
+		return nil, nil
+	}
+	if v, isVar := obj.(*types.Var); isVar && v.Embedded() {
+		return nil, fmt.Errorf("cannot rename %s: it is an embedded field", obj.Name())
+	}
+
+	// Renaming a type renames the fields embedding it, and renaming a field or method
+	// renames those promoted through the fields embedding its type, so none of those
+	// fields' structs may have a field or method with the new name.
+	host := obj
+	if obj.Parent() == nil {
+		host = nil
+		typ := p.ownerOf(obj)
+		if ptr, isPtr := typ.(*types.Pointer); isPtr {
+			typ = ptr.Elem()
+		}
+		if named, isNamed := typ.(*types.Named); isNamed {
+			host = named.Obj()
+		}
+	}
+
+	idents, implicit := p.renamedIdents(func(o types.Object) bool { return o == obj })
+	if err := p.renameConflict(obj, newName, idents); err != nil {
+		return nil, fmt.Errorf("renaming %s to %s: %v", obj.Name(), newName, err)
+	}
+	if err := p.embeddingConflict(newName, p.embeddingFields(func(o types.Object) bool { return o == host })); err != nil {
+		return nil, fmt.Errorf("renaming %s to %s: %v", obj.Name(), newName, err)
+	}
+	otherIdents := make([][]*ast.Ident, len(others))
+	for i, other := range others {
+		if other == p {
+			continue
+		}
+		otherIdents[i], _ = other.renamedIdents(func(o types.Object) bool { return sameObject(p, obj, other, o) })
+		embedding := other.embeddingFields(func(o types.Object) bool { return host != nil && sameObject(p, host, other, o) })
+		if err := other.renameConflictOutside(newName, otherIdents[i], embedding); err != nil {
+			return nil, fmt.Errorf("renaming %s to %s: %v", obj.Name(), newName, err)
+		}
+	}
+
+	for _, ident := range idents {
+		ident.Name = newName
+	}
+	if implicit != nil {
+		implicit.Name = &ast.Ident{NamePos: implicit.Path.Pos(), Name: newName}
+		idents = append([]*ast.Ident{implicit.Name}, idents...)
+	}
+	for _, renamed := range otherIdents {
+		for _, ident := range renamed {
+			ident.Name = newName
+		}
+		idents = append(idents, renamed...)
+	}
+	return idents, nil
+}
+
+// renamedIdents returns, in source order, the identifiers declaring the object that
+// isObj reports and referring to it, along with those of the fields embedding it if it's
+// a type. If the object is an import without a name, it returns its import spec too.
+func (p *TypedPackage) renamedIdents(isObj func(types.Object) bool) ([]*ast.Ident, *ast.ImportSpec) {
+	renamed := make(map[types.Object]bool)
+	for _, v := range p.embeddingFields(isObj) {
+		renamed[v] = true
+	}
+	var idents []*ast.Ident
+	seen := make(map[*ast.Ident]bool)
+	for _, objects := range []map[*ast.Ident]types.Object{p.Info.Defs, p.Info.Uses} {
+		for ident, o := range objects {
+			if o == nil || seen[ident] {
+				continue
+			}
+			if o = originOf(o); renamed[o] || isObj(o) {
+				seen[ident] = true
+				idents = append(idents, ident)
+			}
+		}
+	}
+	sort.Slice(idents, func(i, j int) bool { return idents[i].Pos() < idents[j].Pos() })
+	var implicit *ast.ImportSpec
+	for node, o := range p.Info.Implicits {
+		if spec, isImport := node.(*ast.ImportSpec); isImport && isObj(o) {
+			implicit = spec
+		}
+	}
+	return idents, implicit
+}
+
+// embeddingFields returns the fields of p embedding the type that isType reports, in
+// source order.
+func (p *TypedPackage) embeddingFields(isType func(types.Object) bool) []*types.Var {
+	var fields []*types.Var
+	for ident, def := range p.Info.Defs {
+		if v, isVar := def.(*types.Var); isVar && v.Embedded() {
+			if tn, isTypeName := p.Info.Uses[ident].(*types.TypeName); isTypeName && isType(tn) {
+				fields = append(fields, v)
+			}
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Pos() < fields[j].Pos() })
+	return fields
+}
+
+// embeddingConflict returns an error if the struct of one of the given embedded fields
+// has a field or method named newName.
+func (p *TypedPackage) embeddingConflict(newName string, embedding []*types.Var) error {
+	for _, v := range embedding {
+		if other := p.fieldOrMethod(v, newName); other != nil && other != v {
+			return fmt.Errorf("conflicts with %s", p.describe(other))
+		}
+	}
+	return nil
+}
+
+// renameConflictOutside returns an error if renaming an object of another package to
+// newName would break the given identifiers of p referring to it, or collide with a
+// field or method of the structs holding the given embedded fields.
+func (p *TypedPackage) renameConflictOutside(newName string, idents []*ast.Ident, embedding []*types.Var) error {
+	if err := p.embeddingConflict(newName, embedding); err != nil {
+		return err
+	}
+	if len(idents) == 0 {
+		return nil
+	}
+	if !token.IsExported(newName) {
+		return fmt.Errorf("it is referred to by package %s", p.Pkg.Path())
+	}
+	// Identifiers not selected from a package or a value refer to the object through a
+	// dot import, and may be shadowed.
+	selected := make(map[*ast.Ident]bool)
+	for _, file := range p.Files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			if sel, isSel := node.(*ast.SelectorExpr); isSel {
+				selected[sel.Sel] = true
+			}
+			return true
+		})
+	}
+	for _, ident := range idents {
+		if selected[ident] || p.Info.Defs[ident] != nil {
+			continue
+		}
+		inner := p.Pkg.Scope().Innermost(ident.Pos())
+		if inner == nil {
+			continue
+		}
+		if _, other := inner.LookupParent(newName, ident.Pos()); other != nil {
+			return fmt.Errorf("%s would shadow it at %s", p.describe(other), p.Fset.Position(ident.Pos()))
+		}
+	}
+	return nil
+}
+
+// renameConflict returns an error if renaming obj, with the given identifiers, to
+// newName would change what an identifier refers to.
+func (p *TypedPackage) renameConflict(obj types.Object, newName string, idents []*ast.Ident) error {
+	scope := obj.Parent()
+	if scope == nil {
+		// A field or method.
+		if other := p.fieldOrMethod(obj, newName); other != nil {
+			return fmt.Errorf("conflicts with %s", p.describe(other))
+		}
+		return nil
+	}
+	if other := scope.Lookup(newName); other != nil {
+		return fmt.Errorf("conflicts with %s", p.describe(other))
+	}
+	if scope == p.Pkg.Scope() || scope.Parent() == p.Pkg.Scope() {
+		// Names of the package scope and the file scopes, holding imports, can't collide.
+		for _, file := range p.Files {
+			if other := p.Info.Scopes[file].Lookup(newName); other != nil {
+				return fmt.Errorf("conflicts with %s", p.describe(other))
+			}
+		}
+		if other := p.Pkg.Scope().Lookup(newName); other != nil {
+			return fmt.Errorf("conflicts with %s", p.describe(other))
+		}
+	}
+	for _, ident := range idents {
+		inner := p.Pkg.Scope().Innermost(ident.Pos())
+		if inner == nil {
+			continue
+		}
+		if s, other := inner.LookupParent(newName, ident.Pos()); other != nil && within(s, scope) {
+			return fmt.Errorf("%s would shadow it at %s", p.describe(other), p.Fset.Position(ident.Pos()))
+		}
+	}
+	var uses []*ast.Ident
+	for ident, other := range p.Info.Uses {
+		if ident.Name == newName && other.Parent() != nil && !within(other.Parent(), scope) {
+			uses = append(uses, ident)
+		}
+	}
+	sort.Slice(uses, func(i, j int) bool { return uses[i].Pos() < uses[j].Pos() })
+	for _, ident := range uses {
+		// The renamed object would capture the use if it's visible there: anywhere in
+		// its scope for package-level objects, and after its declaration for local ones.
+		inner := p.Pkg.Scope().Innermost(ident.Pos())
+		if !within(inner, scope) {
+			continue
+		}
+		s, visible := inner.LookupParent(obj.Name(), ident.Pos())
+		if isPkgOrFileScope(scope, p.Pkg) || visible == obj || visible != nil && s != scope && within(s, scope) {
+			return fmt.Errorf("it would shadow %s at %s", p.describe(p.Info.Uses[ident]), p.Fset.Position(ident.Pos()))
+		}
+	}
+	return nil
+}
+
+// fieldOrMethod returns the field or method named name of the type that the field or
+// method obj belongs to, or nil if there is none.
+func (p *TypedPackage) fieldOrMethod(obj types.Object, name string) types.Object {
+	typ := p.ownerOf(obj)
+	if typ == nil {
+		return nil
+	}
+	other, _, _ := types.LookupFieldOrMethod(typ, true, p.Pkg, name)
+	return other
+}
+
+// ownerOf returns the type that the field or method obj belongs to, or nil if it isn't
+// declared in p.
+func (p *TypedPackage) ownerOf(obj types.Object) types.Type {
+	var typ types.Type
+	if sig, isFunc := obj.Type().(*types.Signature); isFunc && sig.Recv() != nil {
+		typ = sig.Recv().Type()
+	} else {
+		// Find the struct declaring the field, and the named type it's the type of.
+		for _, tv := range p.Info.Types {
+			st, isStruct := tv.Type.(*types.Struct)
+			if !isStruct {
+				continue
+			}
+			for i := 0; i < st.NumFields(); i++ {
+				if st.Field(i) == obj {
+					typ = st
+				}
+			}
+		}
+		for _, def := range p.Info.Defs {
+			if tn, isType := def.(*types.TypeName); isType && typ != nil && tn.Type().Underlying() == typ {
+				typ = types.NewPointer(tn.Type())
+				break
+			}
+		}
+	}
+	return typ
+}
+
+// describe describes an object and where it's declared, for errors.
+func (p *TypedPackage) describe(obj types.Object) string {
+	if obj.Parent() == types.Universe {
+		return fmt.Sprintf("the predeclared %s", obj.Name())
+	}
+	return fmt.Sprintf("%s declared at %s", obj.Name(), p.Fset.Position(obj.Pos()))
+}
+
+// within reports whether scope is outer or one of its inner scopes.
+func within(scope, outer *types.Scope) bool {
+	for ; scope != nil; scope = scope.Parent() {
+		if scope == outer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+const renameSrc = `package p
+
+import "strings"
+
+type Buffer struct {
+	data []string
+}
+
+func (b *Buffer) Add(s string) {
+	b.data = append(b.data, strings.TrimSpace(s))
+}
+
+func (b *Buffer) Len() int { return len(b.data) }
+
+type Log struct {
+	*Buffer
+	name string
+}
+
+func newLog(name string) *Log {
+	l := &Log{Buffer: &Buffer{}, name: name}
+	count := 0
+	for _, s := range []string{"a", "b"} {
+		size := len(s)
+		l.Add(s)
+		count += size
+	}
+	l.Buffer.Add(name)
+	return l
+}
+`
+
+func TestRename(t *testing.T) {
+	testcases := []struct {
+		decl    func(pkg *TypedPackage) ast.Node
+		newName string
+		exp     []string
+	}{
+		{declIdent("count"), "total", []string{"total := 0", "total += size"}},
+		{declIdent("newLog"), "NewLog", []string{"func NewLog(name string) *Log {"}},
+		{declIdent("Buffer"), "Lines", []string{"type Lines struct", "func (b *Lines) Add", "*Lines\n", "l := &Log{Lines: &Lines{}", "l.Lines.Add(name)"}},
+		{declIdent("Add"), "Append", []string{"func (b *Buffer) Append(s string) {", "l.Append(s)", "l.Buffer.Append(name)"}},
+		{declIdent("data"), "lines", []string{"lines []string", "b.lines = append(b.lines,", "return len(b.lines)"}},
+		{importSpec, "strs", []string{`import strs "strings"`, "strs.TrimSpace(s)"}},
+	}
+	for _, test := range testcases {
+		pkg := typeCheckTestPkg(t, renameSrc)
+		if _, err := pkg.Rename(test.decl(pkg), test.newName); err != nil {
+			t.Errorf("%s: %v", test.newName, err)
+			continue
+		}
+		got := fileSource(t, pkg.Files[0])
+		for _, exp := range test.exp {
+			if !strings.Contains(got, exp) {
+				t.Errorf("%s: expected source containing %q, but got %q", test.newName, exp, got)
+			}
+		}
+	}
+}
+
+func TestRenameConflicts(t *testing.T) {
+	testcases := []struct {
+		decl    func(pkg *TypedPackage) ast.Node
+		newName string
+		err     string
+	}{
+		{declIdent("count"), "l", "renaming count to l: conflicts with l declared at 21:2"},
+		{declIdent("count"), "size", "size declared at 24:3 would shadow it at 26:3"},
+		{declIdent("count"), "len", "it would shadow the predeclared len at 24:11"},
+		{declIdent("newLog"), "Log", "conflicts with Log declared at 15:6"},
+		{declIdent("newLog"), "strings", `conflicts with strings declared at 3:8`},
+		{declIdent("Add"), "Len", "conflicts with Len declared at 13:18"},
+		{declIdent("data"), "Add", "conflicts with Add declared at 9:18"},
+		{declIdent("size"), "s", "it would shadow s declared at 23:9 at 25:9"},
+		{declIdent("b"), "strings", "it would shadow strings declared at 3:8 at 10:26"},
+		{declIdent("count"), "1x", `invalid name "1x"`},
+		{func(pkg *TypedPackage) ast.Node { return pkg.Files[0] }, "x", "expected a declaration of one object, but got 0"},
+	}
+	for _, test := range testcases {
+		pkg := typeCheckTestPkg(t, renameSrc)
+		_, err := pkg.Rename(test.decl(pkg), test.newName)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.newName, test.err, err)
+		}
+	}
+}
+
+func TestRenameAcrossPackages(t *testing.T) {
+	testcases := []struct {
+		name, newName string
+		exp           []string // or nil for an error
+		err           string
+	}{
+		{"Client", "Conn", []string{"func (c *Conn) Do()", "struct {\n\tlib.Conn\n", "w.Conn.Do()", "var _ *lib.Conn"}, ""},
+		{"Do", "Run", []string{"c.Run()", "w.Client.Run()"}, ""},
+		{"New", "Dial", []string{"Dial()"}, ""},
+		{"New", "dial", nil, "it is referred to by package example.com/app"},
+		{"Client", "Retries", nil, "conflicts with Retries declared at app.go:7:2"},
+		{"Do", "Close", nil, "conflicts with Close declared at app.go:10:19"},
+		{"Client", "limit", nil, "it is referred to by package example.com/app"},
+		{"Client", "Wrapped", nil, "Wrapped declared at dot.go:5:6 would shadow it at dot.go:7:10"},
+	}
+	for _, test := range testcases {
+		fset := token.NewFileSet()
+		parse := func(filename, src string) *ast.File {
+			file, err := parser.ParseFile(fset, filename, src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return file
+		}
+		lib, err := NewTypedPackage("example.com/lib", fset, []*ast.File{parse("lib.go", `package lib
+
+type Client struct{ Name string }
+
+func (c *Client) Do() {}
+
+func New() *Client { return &Client{} }
+`)}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := &types.Config{Importer: importerFunc(func(path string) (*types.Package, error) { return lib.Pkg, nil })}
+		app, err := NewTypedPackage("example.com/app", fset, []*ast.File{parse("app.go", `package app
+
+import "example.com/lib"
+
+type wrapper struct {
+	lib.Client
+	Retries int
+}
+
+func (w *wrapper) Close() { w.Client.Do() }
+
+func run() {
+	c := lib.New()
+	c.Do()
+	var _ *lib.Client = c
+}
+`)}, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dot, err := NewTypedPackage("example.com/dot", fset, []*ast.File{parse("dot.go", `package dot
+
+import . "example.com/lib"
+
+type Wrapped int
+
+var c = &Client{}
+`)}, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = lib.Rename(declIdent(test.name)(lib), test.newName, app, dot)
+		if test.exp == nil {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error containing %q, but got %v", test.newName, test.err, err)
+			}
+			if got := fileSource(t, app.Files[0]); strings.Contains(got, test.newName+"\n") || strings.Contains(got, "."+test.newName) {
+				t.Errorf("%s: expected app to be unchanged, but got %q", test.newName, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.newName, err)
+			continue
+		}
+		got := fileSource(t, lib.Files[0]) + fileSource(t, app.Files[0])
+		for _, exp := range test.exp {
+			if !strings.Contains(got, exp) {
+				t.Errorf("%s: expected source containing %q, but got %q", test.newName, exp, got)
+			}
+		}
+	}
+}
+
+// declIdent returns a function returning the first identifier declaring name in a
+// package.
+func declIdent(name string) func(pkg *TypedPackage) ast.Node {
+	return func(pkg *TypedPackage) ast.Node {
+		var decl *ast.Ident
+		for ident, obj := range pkg.Info.Defs {
+			if _, isPkg := obj.(*types.PkgName); ident.Name == name && !isPkg && (decl == nil || ident.Pos() < decl.Pos()) {
+				decl = ident
+			}
+		}
+		return decl
+	}
+}
+
+func importSpec(pkg *TypedPackage) ast.Node {
+	return pkg.Files[0].Imports[0]
+}
@@ -0,0 +1,230 @@
+package astquery
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule is a pattern rule, as read from a rule file or defined by a RuleFunc.
+type Rule struct {
+	ID       string
+	Pattern  *Pattern
+	Message  string
+	Severity string
+
+	// Fix is the replacement for matched nodes, if the rule has one.
+	Fix string
+
+	// Where, if set, is a condition that matches must meet to be reported, as set by
+	// the Where clause of a RuleFunc.
+	Where Cond
+}
+
+// Finding is a match of a rule, with the rule's message and fix filled in.
+type Finding struct {
+	Rule  *Rule
+	Match Match
+
+	// Message and Fix are the rule's message and fix, with each metavariable replaced
+	// by the source of the node bound to it.
+	Message string
+	Fix     string
+}
+
+// LoadRules reads the rules of a rule file. See ParseRules.
+func LoadRules(filename string) (rules []*Rule, skipped []error, err error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, skipped, err = ParseRules(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	for i, ruleErr := range skipped {
+		skipped[i] = fmt.Errorf("%s: %v", filename, ruleErr)
+	}
+	return rules, skipped, nil
+}
+
+// ParseRules parses the rules of a YAML rule file, in either of two forms: as in
+// Semgrep, a document holding a list of rules under "rules", or, as in ast-grep, one
+// rule per document, with its pattern under "rule". A rule has these keys:
+//
+//	id         the rule's ID
+//	pattern    the Pattern the rule matches
+//	message    the message reported for each match
+//	severity   the severity of the findings, as written (e.g., 'WARNING' or 'error')
+//	fix        the replacement for matched nodes
+//	languages  the rules for other languages than Go ('go' or 'golang') are skipped;
+//	           ast-grep's 'language' is a single language
+//
+// The message and fix can refer to the pattern's metavariables. Other keys, such as
+// "metadata", are ignored, but rules combining several patterns, such as with
+// "pattern-either" or "patterns", are not supported. Only the subset of YAML that rule
+// files commonly use is supported.
+//
+// Rules that can't be compiled, such as those that aren't supported, are skipped, so
+// that the others in a rule file can still be used: ParseRules returns an error for each
+// in skipped. It returns an error only if the file itself can't be parsed.
+func ParseRules(src []byte) (rules []*Rule, skipped []error, err error) {
+	docs, err := parseYAML(string(src))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, doc := range docs {
+		m, isMap := doc.(map[string]interface{})
+		if !isMap {
+			return nil, nil, fmt.Errorf("expected a mapping of rules")
+		}
+		specs := []interface{}{m}
+		if list, hasRules := m["rules"]; hasRules {
+			if specs, isMap = list.([]interface{}); !isMap {
+				return nil, nil, fmt.Errorf("rules: expected a list of rules")
+			}
+		}
+		for _, spec := range specs {
+			rule, err := parseRule(spec)
+			if err != nil {
+				skipped = append(skipped, err)
+			} else if rule != nil {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules, skipped, nil
+}
+
+// parseRule parses a rule. It returns nil if the rule is for other languages than Go.
+func parseRule(spec interface{}) (*Rule, error) {
+	m, isMap := spec.(map[string]interface{})
+	if !isMap {
+		return nil, fmt.Errorf("expected a rule")
+	}
+	rule := &Rule{}
+	rule.ID, _ = m["id"].(string)
+	errorf := func(format string, args ...interface{}) error {
+		return fmt.Errorf("rule %q: %s", rule.ID, fmt.Sprintf(format, args...))
+	}
+	for _, field := range []struct {
+		key string
+		s   *string
+	}{{"id", &rule.ID}, {"message", &rule.Message}, {"severity", &rule.Severity}, {"fix", &rule.Fix}} {
+		if value, ok := m[field.key]; ok {
+			if *field.s, ok = value.(string); !ok {
+				return nil, errorf("%s: expected a string", field.key)
+			}
+		}
+	}
+
+	var languages []interface{}
+	switch value := m["languages"].(type) {
+	case []interface{}:
+		languages = value
+	case string:
+		languages = []interface{}{value}
+	}
+	if language, ok := m["language"]; ok {
+		languages = append(languages, language)
+	}
+	isGo := len(languages) == 0
+	for _, language := range languages {
+		if language, _ := language.(string); strings.EqualFold(language, "go") || strings.EqualFold(language, "golang") {
+			isGo = true
+		}
+	}
+	if !isGo {
+		return nil, nil
+	}
+
+	pattern, hasPattern := m["pattern"]
+	if inner, ok := m["rule"].(map[string]interface{}); ok {
+		for key := range inner {
+			if key != "pattern" {
+				return nil, errorf("rule: %s is not supported", key)
+			}
+		}
+		pattern, hasPattern = inner["pattern"]
+	}
+	for key := range m {
+		if key == "patterns" || strings.HasPrefix(key, "pattern-") {
+			return nil, errorf("%s is not supported", key)
+		}
+	}
+	src, isString := pattern.(string)
+	if !hasPattern || !isString {
+		return nil, errorf("expected a pattern")
+	}
+	var err error
+	if rule.Pattern, err = CompilePattern(strings.TrimSpace(src)); err != nil {
+		return nil, errorf("%v", err)
+	}
+	return rule, nil
+}
+
+// Check returns the findings of the rules in the workspace, ordered by package and
+// position.
+func (w *Workspace) Check(rules ...*Rule) []Finding {
+	var findings []Finding
+	for _, pkg := range w.Packages {
+		var pkgFindings []Finding
+		for _, rule := range rules {
+			for _, match := range pkg.Find(rule.Pattern) {
+				if rule.Where != nil && !rule.Where(match) {
+					continue
+				}
+				pkgFindings = append(pkgFindings, Finding{
+					Rule:    rule,
+					Match:   match,
+					Message: expandMetavars(rule.Message, match),
+					Fix:     expandMetavars(rule.Fix, match),
+				})
+			}
+		}
+		sort.SliceStable(pkgFindings, func(i, j int) bool {
+			return pkgFindings[i].Match.Node.Pos() < pkgFindings[j].Match.Node.Pos()
+		})
+		findings = append(findings, pkgFindings...)
+	}
+	return findings
+}
+
+var metavarRef = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// expandMetavars replaces each metavariable in s that is bound in match with the source
+// of its node, as bindingSource returns it.
+func expandMetavars(s string, match Match) string {
+	return metavarRef.ReplaceAllStringFunc(s, func(ref string) string {
+		node, isBound := match.Bindings[ref[1:]]
+		if !isBound {
+			return ref
+		}
+		return bindingSource(node, match)
+	})
+}
+
+// bindingSource returns the source of a node bound in match. The elements of a list are
+// separated by ", ", or by newlines for statements.
+func bindingSource(node ast.Node, match Match) string {
+	list, isList := node.(NodeList)
+	if !isList {
+		list = NodeList{node}
+	}
+	sep := ", "
+	elems := make([]string, len(list))
+	for i, elem := range list {
+		var buf bytes.Buffer
+		format.Node(&buf, match.Pkg.Fset, elem)
+		elems[i] = buf.String()
+		if _, isStmt := elem.(ast.Stmt); isStmt {
+			sep = "\n"
+		}
+	}
+	return strings.Join(elems, sep)
+}
@@ -0,0 +1,164 @@
+package astquery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const semgrepRules = `rules:
+  - id: no-errors-wrap
+    pattern: errors.Wrap($ERR, $MSG)
+    message: |
+      Use fmt.Errorf to wrap $ERR
+    severity: WARNING
+    languages: [go]
+    fix: fmt.Errorf($MSG + ": %w", $ERR)
+    metadata:
+      category: style
+  - id: python-only
+    pattern: print($X)
+    message: no prints
+    languages: [python]
+  - id: log-args
+    pattern: log($ARGS...)
+    message: 'log called with $ARGS'
+    severity: INFO
+`
+
+const astGrepRules = `id: empty-return
+language: go
+rule:
+  pattern: if $C { return nil }
+message: returns nil when $C
+severity: hint
+---
+id: second
+language: Go
+rule:
+  pattern: count($_)
+`
+
+func TestParseRules(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp []string
+	}{
+		{semgrepRules, []string{
+			"no-errors-wrap: errors.Wrap($ERR, $MSG) WARNING \"Use fmt.Errorf to wrap $ERR\\n\" fix \"fmt.Errorf($MSG + \\\": %w\\\", $ERR)\"",
+			`log-args: log($ARGS...) INFO "log called with $ARGS" fix ""`,
+		}},
+		{astGrepRules, []string{
+			`empty-return: if $C { return nil } hint "returns nil when $C" fix ""`,
+			`second: count($_)  "" fix ""`,
+		}},
+	}
+	for _, test := range testcases {
+		rules, skipped, err := ParseRules([]byte(test.src))
+		if err != nil || skipped != nil {
+			t.Errorf("%q: %v %v", test.src, err, skipped)
+			continue
+		}
+		var got []string
+		for _, rule := range rules {
+			got = append(got, fmt.Sprintf("%s: %s %s %q fix %q", rule.ID, rule.Pattern, rule.Severity, rule.Message, rule.Fix))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%q: expected %q, but got %q", test.src, test.exp, got)
+		}
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	testcases := []struct {
+		src string
+		err string
+	}{
+		{"- a\n", "expected a mapping of rules"},
+		{"rules: x\n", "rules: expected a list of rules"},
+	}
+	for _, test := range testcases {
+		_, _, err := ParseRules([]byte(test.src))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error containing %q, but got %v", test.src, test.err, err)
+		}
+	}
+}
+
+func TestParseRulesSkipped(t *testing.T) {
+	testcases := []struct {
+		src string
+		err string
+	}{
+		{"id: a\nmessage: m\n", `rule "a": expected a pattern`},
+		{"id: a\npattern: f($)\n", `rule "a": pattern "f($)": offset 2`},
+		{"id: a\npattern-either:\n  - pattern: f()\n", `rule "a": pattern-either is not supported`},
+		{"id: a\nrule:\n  kind: call_expression\n", `rule "a": rule: kind is not supported`},
+		{"id: a\npattern: f()\nmessage:\n  - m\n", `rule "a": message: expected a string`},
+	}
+	for _, test := range testcases {
+		rules, skipped, err := ParseRules([]byte(test.src))
+		if err != nil || rules != nil || len(skipped) != 1 || !strings.Contains(skipped[0].Error(), test.err) {
+			t.Errorf("%q: expected a skipped rule with error containing %q, but got %v %v", test.src, test.err, skipped, err)
+		}
+	}
+
+	src := `rules:
+  - id: either
+    pattern-either:
+      - pattern: f()
+  - id: call
+    pattern: foo(...)
+  - id: printf
+    pattern: log.Printf($F, ...)
+`
+	rules, skipped, err := ParseRules([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, rule := range rules {
+		ids = append(ids, rule.ID)
+	}
+	if exp := []string{"call", "printf"}; !reflect.DeepEqual(ids, exp) {
+		t.Errorf("expected rules %q, but got %q", exp, ids)
+	}
+	if len(skipped) != 1 || !strings.Contains(skipped[0].Error(), `rule "either": pattern-either is not supported`) {
+		t.Errorf("expected the either rule to be skipped, but got %v", skipped)
+	}
+}
+
+func TestWorkspaceCheck(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "rules.yml")
+	if err := os.WriteFile(filename, []byte(semgrepRules), 0666); err != nil {
+		t.Fatal(err)
+	}
+	rules, skipped, err := LoadRules(filename)
+	if err != nil || skipped != nil {
+		t.Fatal(err, skipped)
+	}
+	pkg, err := ParseSource("load.go", []byte(patternSrc+"\nfunc log(args ...interface{}) {}\n\nfunc logAll() { log(1, \"two\") }\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, finding := range (&Workspace{Packages: []*Package{pkg}}).Check(rules...) {
+		got = append(got, fmt.Sprintf("%s: %s: %q %q", finding.Match.Position(), finding.Rule.ID, finding.Message, finding.Fix))
+	}
+	exp := []string{
+		`load.go:7:10: no-errors-wrap: "Use fmt.Errorf to wrap err\n" "fmt.Errorf(\"opening\" + \": %w\", err)"`,
+		`load.go:10:10: no-errors-wrap: "Use fmt.Errorf to wrap err\n" "fmt.Errorf(name + \": %w\", err)"`,
+		`load.go:20:17: log-args: "log called with 1, \"two\"" ""`,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %q, but got %q", exp, got)
+	}
+
+	if _, _, err := LoadRules(filepath.Join(dir, "missing.yml")); err == nil {
+		t.Error("expected an error for a missing rule file")
+	}
+}
@@ -0,0 +1,80 @@
+package astquery
+
+import (
+	"go/token"
+	"go/types"
+)
+
+// ScanPackages loads the packages matching the patterns as Load does, but one at a time:
+// fn is called with each package before the next one is loaded, and the package is not
+// kept afterwards, so memory use is bounded by the largest package rather than growing
+// with the number of packages. Each package has its own file set. If opts.Types is set,
+// each package is type-checked on its own, with its imports resolved from compiled export
+// data, so the types of different packages are not identical to each other. If fn returns
+// an error, ScanPackages stops and returns it.
+func ScanPackages(opts *LoadOptions, fn func(pkg *Package) error, patterns ...string) error {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	overlay, err := absOverlay(opts)
+	if err != nil {
+		return err
+	}
+	listed, err := goList(opts, overlay, patterns)
+	if err != nil {
+		return err
+	}
+	exports := make(map[string]string)
+	for _, lp := range listed {
+		exports[lp.ImportPath] = lp.Export
+	}
+	loaded, err := loadedPackages(opts, nil, listed)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range loaded {
+		pkg := *l.pkg
+		pkg.Fset = token.NewFileSet()
+		if l.listErr != nil {
+			pkg.Errors = append(pkg.Errors, l.listErr)
+		}
+		jobs := l.parseJobs(&pkg, overlay)
+		parseFiles(pkg.Fset, jobs, opts, nil)
+		addParsed(opts, pkg.Fset, jobs)
+		if opts.Types && len(pkg.Files) > 0 {
+			imp := exportDataImporter(pkg.Fset, exports)
+			importMap := l.importMap
+			pkg.Typed, _ = NewTypedPackage(pkg.ImportPath, pkg.Fset, pkg.Files, &types.Config{
+				FakeImportC:      l.cgo,
+				GoVersion:        opts.GoVersion,
+				IgnoreFuncBodies: opts.DeclsOnly,
+				Importer: importerFunc(func(path string) (*types.Package, error) {
+					if mapped, exists := importMap[path]; exists {
+						path = mapped
+					}
+					return imp.Import(path)
+				}),
+			})
+		}
+		if err := fn(&pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scan is like ScanPackages, calling fn with each match of filter, package by package.
+func Scan(opts *LoadOptions, filter Filter, fn func(m Match) error, patterns ...string) error {
+	return ScanPackages(opts, func(pkg *Package) error {
+		for _, m := range pkg.Find(filter) {
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, patterns...)
+}
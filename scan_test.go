@@ -0,0 +1,77 @@
+package astquery
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":       "module example.com/m\n\ngo 1.21\n",
+		"app/app.go":   "package app\n\nimport \"example.com/m/lib\"\n\nfunc Run() { lib.Greet() }\n",
+		"lib/lib.go":   "package lib\n\nfunc Greet() {}\n",
+		"util/util.go": "package util\n\nfunc Max(a, b int) int { return a }\n",
+	})
+	opts := &LoadOptions{
+		Dir: dir,
+		Env: append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod"),
+	}
+	isFunc := FilterFunc(func(node ast.Node) bool {
+		_, isFunc := node.(*ast.FuncDecl)
+		return isFunc
+	})
+
+	var got []string
+	err := Scan(opts, isFunc, func(m Match) error {
+		got = append(got, fmt.Sprintf("%s.%s %s", m.PkgPath, m.Node.(*ast.FuncDecl).Name.Name, m.Position()))
+		return nil
+	}, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each package has its own file set, so positions are relative to it.
+	exp := []string{
+		fmt.Sprintf("example.com/m/app.Run %s:5:1", filepath.Join(dir, "app", "app.go")),
+		fmt.Sprintf("example.com/m/lib.Greet %s:3:1", filepath.Join(dir, "lib", "lib.go")),
+		fmt.Sprintf("example.com/m/util.Max %s:3:1", filepath.Join(dir, "util", "util.go")),
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected matches %v, but got %v", exp, got)
+	}
+
+	// Stopping early.
+	stop := errors.New("stop")
+	got = nil
+	err = Scan(opts, isFunc, func(m Match) error {
+		got = append(got, m.PkgPath)
+		return stop
+	}, "./...")
+	if err != stop || len(got) != 1 {
+		t.Errorf("expected to stop after the first match with %v, but got %v after %v", stop, err, got)
+	}
+
+	// Packages are type-checked against the export data of their imports.
+	opts.Types = true
+	var calls []string
+	err = ScanPackages(opts, func(pkg *Package) error {
+		if pkg.Typed == nil || len(pkg.Typed.Errors) != 0 {
+			return fmt.Errorf("%s: expected to type-check, but got %+v", pkg.ImportPath, pkg.Typed)
+		}
+		for _, m := range pkg.FindTyped(CallFilter{PkgPath: "example.com/m/lib", Name: "Greet"}) {
+			calls = append(calls, m.PkgPath+": "+nodeSource(t, m.Node))
+		}
+		return nil
+	}, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"example.com/m/app: lib.Greet()"}; !reflect.DeepEqual(calls, exp) {
+		t.Errorf("expected calls %v, but got %v", exp, calls)
+	}
+}
@@ -0,0 +1,81 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+)
+
+// VisibleAt returns the objects whose names are in scope at the start of node, sorted by
+// name; they are the objects whose names InScope reports are in scope. Predeclared
+// objects are omitted, as are objects shadowed by an inner declaration and local
+// declarations whose scope starts after node, such as a variable in its own initializer.
+// It returns nil if node is not in p.
+func (p *TypedPackage) VisibleAt(node ast.Node) []types.Object {
+	pos := node.Pos()
+	innermost := p.Pkg.Scope().Innermost(pos)
+	var visible []types.Object
+	seen := make(map[string]bool)
+	for scope := innermost; scope != nil && scope != types.Universe; scope = scope.Parent() {
+		for _, name := range scope.Names() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			// A local object is only visible after its declaration, which for a
+			// variable ends with its specification.
+			if s, obj := innermost.LookupParent(name, pos); obj != nil && s != types.Universe {
+				visible = append(visible, obj)
+			}
+		}
+	}
+	sort.Slice(visible, func(i, j int) bool { return visible[i].Name() < visible[j].Name() })
+	return visible
+}
+
+// InScope reports whether an object with the given name, other than a predeclared one,
+// is in scope at the start of node.
+func (p *TypedPackage) InScope(node ast.Node, name string) bool {
+	scope := p.Pkg.Scope().Innermost(node.Pos())
+	if scope == nil {
+		return false
+	}
+	s, obj := scope.LookupParent(name, node.Pos())
+	return obj != nil && s != types.Universe
+}
+
+// isPkgOrFileScope reports whether scope is the package scope of pkg or one of its file
+// scopes, in which declaration order doesn't matter.
+func isPkgOrFileScope(scope *types.Scope, pkg *types.Package) bool {
+	return scope == pkg.Scope() || scope.Parent() == pkg.Scope()
+}
+
+// ScopeFilter matches nodes that match another filter and where certain names are, or
+// are not, in scope, as determined by InScope.
+type ScopeFilter struct {
+	// Filter is the filter nodes must match.
+	Filter Filter
+
+	// InScope are names that must all be in scope at the node (e.g., "ctx").
+	InScope []string
+
+	// NotInScope are names that must all be out of scope at the node.
+	NotInScope []string
+}
+
+func (f ScopeFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	if !filterNode(f.Filter, node, ancestors) {
+		return false
+	}
+	for _, name := range f.InScope {
+		if !pkg.InScope(node, name) {
+			return false
+		}
+	}
+	for _, name := range f.NotInScope {
+		if pkg.InScope(node, name) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"testing"
+)
+
+const scopeTestSrc = `package p
+
+import "context"
+
+var limit = 10
+
+func handle(ctx context.Context, id string) {
+	n := 1
+	if id != "" {
+		msg := id
+		fetch(ctx, msg)
+	}
+	later := n
+	_ = later
+}
+
+func background(id string) {
+	fetch(context.Background(), id)
+}
+
+func fetch(ctx context.Context, key string) {}
+`
+
+func TestVisibleAt(t *testing.T) {
+	pkg := typeCheckTestPkg(t, scopeTestSrc)
+
+	calls := pkg.FindTyped(CallFilter{PkgPath: "p", Name: "fetch"})
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls to fetch, but got %d", len(calls))
+	}
+	var names []string
+	for _, obj := range pkg.VisibleAt(calls[0]) {
+		names = append(names, obj.Name())
+	}
+	exp := []string{"background", "context", "ctx", "fetch", "handle", "id", "limit", "msg", "n"}
+	if !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected visible names %v, but got %v", exp, names)
+	}
+
+	// A variable isn't in scope in its own initializer, and the names VisibleAt returns
+	// are those InScope reports.
+	pkg = typeCheckTestPkg(t, `package p
+
+func f(y int) int {
+	x := y
+	return x
+}
+`)
+	var y ast.Node
+	ast.Inspect(pkg.Files[0], func(node ast.Node) bool {
+		if ident, isIdent := node.(*ast.Ident); isIdent && ident.Name == "y" && pkg.Info.Uses[ident] != nil {
+			y = ident
+		}
+		return true
+	})
+	names = nil
+	visible := make(map[string]bool)
+	for _, obj := range pkg.VisibleAt(y) {
+		names = append(names, obj.Name())
+		visible[obj.Name()] = true
+	}
+	if exp := []string{"f", "y"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected visible names %v at y, but got %v", exp, names)
+	}
+	for _, name := range []string{"f", "x", "y"} {
+		if inScope := pkg.InScope(y, name); inScope != visible[name] {
+			t.Errorf("%s: expected InScope %v to agree with VisibleAt %v", name, inScope, visible[name])
+		}
+	}
+}
+
+func TestScopeFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, scopeTestSrc)
+
+	// Find calls made without a context in scope.
+	calls := pkg.FindTyped(ScopeFilter{
+		Filter: FilterFunc(func(node ast.Node) bool {
+			sel, isSel := node.(*ast.SelectorExpr)
+			return isSel && sel.Sel.Name == "Background"
+		}),
+		NotInScope: []string{"ctx"},
+	})
+	if len(calls) != 1 || pkg.Fset.Position(calls[0].Pos()).Line != 18 {
+		t.Errorf("expected the call to context.Background on line 18, but got %v", calls)
+	}
+
+	calls = pkg.FindTyped(ScopeFilter{
+		Filter: FilterFunc(func(node ast.Node) bool {
+			call, isCall := node.(*ast.CallExpr)
+			return isCall && types.ExprString(call.Fun) == "fetch"
+		}),
+		InScope: []string{"ctx", "msg"},
+	})
+	if len(calls) != 1 || pkg.Fset.Position(calls[0].Pos()).Line != 11 {
+		t.Errorf("expected the call to fetch on line 11, but got %v", calls)
+	}
+}
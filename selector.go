@@ -0,0 +1,125 @@
+package astquery
+
+// CompileSelector compiles a query written as a CSS-style selector, an alternative to the
+// XPath-like language of Query:
+//
+//	TypeSpec.exported > StructType Field[tag~=json]
+//
+// A selector is a sequence of compound selectors separated by combinators: whitespace
+// selects the nodes at any depth below the nodes selected by the previous compound, and
+// ">" selects their children. A compound selector is a node kind, or "*" for any kind,
+// followed by any number of classes and attribute selectors; as in CSS, a compound
+// starting with a class or attribute selector, such as ".exported", is of any kind. A
+// class ".attr" is
+// satisfied by nodes whose attribute is set and not 'false', such as ".exported". The
+// attributes are those of Query, compared with:
+//
+//	[attr]          the attribute is set, and not 'false'
+//	[attr=value]    the attribute is value
+//	[attr!=value]   the attribute is not value
+//	[attr^=value]   the attribute starts with value
+//	[attr$=value]   the attribute ends with value
+//	[attr*=value]   the attribute contains value
+//	[attr~=value]   one of the attribute's words is value, where words are runs of
+//	                letters, digits and underscores
+//
+// Values are identifiers, quoted strings, or placeholders ("?") bound by Query.Bind.
+func CompileSelector(src string) (*Query, error) {
+	p := &queryParser{src: src}
+	q := &Query{src: src}
+	axis := descendantAxis
+	for {
+		step, err := p.compoundSelector(axis)
+		if err != nil {
+			return nil, queryError(SelectorLanguage, src, err)
+		}
+		q.steps = append(q.steps, step)
+		p.skipSpace()
+		if p.pos == len(src) {
+			break
+		}
+		axis = descendantAxis
+		if p.consume(">") {
+			axis = childAxis
+		}
+	}
+	q.params = p.params
+	return q, nil
+}
+
+// MustCompileSelector is like CompileSelector but panics if the selector cannot be
+// compiled.
+func MustCompileSelector(src string) *Query {
+	q, err := CompileSelector(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// compoundSelector parses a compound selector, selecting nodes on the given axis.
+func (p *queryParser) compoundSelector(axis queryAxis) (queryStep, error) {
+	step := queryStep{axis: axis}
+	p.skipSpace()
+	if p.pos == len(p.src) || (p.src[p.pos] != '.' && p.src[p.pos] != '[') {
+		var err error
+		if step.kind, err = p.kind(); err != nil {
+			return step, err
+		}
+	}
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '.':
+			p.pos++
+			attr, err := p.attr()
+			if err != nil {
+				return step, err
+			}
+			step.preds = append(step.preds, attrPred{attr: attr})
+		case '[':
+			p.pos++
+			pred, err := p.selectorAttrPred()
+			if err != nil {
+				return step, err
+			}
+			if !p.consume("]") {
+				return step, p.errorf("expected ']'")
+			}
+			step.preds = append(step.preds, pred)
+		default:
+			return step, nil
+		}
+	}
+	return step, nil
+}
+
+// selectorAttrPred parses an attribute selector, after its opening bracket.
+func (p *queryParser) selectorAttrPred() (queryPred, error) {
+	p.skipSpace()
+	attr, err := p.attr()
+	if err != nil {
+		return nil, err
+	}
+	pred := attrPred{attr: attr}
+	for _, op := range []string{"!=", "^=", "$=", "*=", "~=", "="} {
+		if p.consume(op) {
+			pred.op = op
+			break
+		}
+	}
+	if pred.op == "" {
+		return pred, nil
+	}
+	if p.param(&pred) {
+		return pred, nil
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) && (p.src[p.pos] == '\'' || p.src[p.pos] == '"') {
+		if pred.value, err = p.str(); err != nil {
+			return nil, err
+		}
+	} else if pred.value, err = p.ident(); err != nil {
+		return nil, p.errorf("expected a value")
+	}
+	return pred, nil
+}
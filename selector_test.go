@@ -0,0 +1,82 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const selectorSrc = `package p
+
+type Config struct {
+	Name    string ` + "`json:\"name\"`" + `
+	Timeout int    ` + "`yaml:\"timeout\" json:\"timeout,omitempty\"`" + `
+	secret  string
+}
+
+type options struct {
+	Verbose bool ` + "`json:\"verbose\"`" + `
+}
+`
+
+func TestSelector(t *testing.T) {
+	file := parseTestFile(t, selectorSrc)
+	testcases := []struct {
+		selector string
+		exp      []string
+	}{
+		{`TypeSpec.exported > StructType Field[tag~=json]`, []string{"Name", "Timeout"}},
+		{`Field[tag~=json]`, []string{"Name", "Timeout", "Verbose"}},
+		{`Field[tag^=yaml]`, []string{"Timeout"}},
+		{`Field[tag$='"verbose"']`, []string{"Verbose"}},
+		{`Field[tag*=omitempty]`, []string{"Timeout"}},
+		{`Field[tag~=omit]`, nil},
+		{`TypeSpec[name!=Config] Field`, []string{"Verbose"}},
+		{`StructType > Field`, nil},
+		{`TypeSpec > Ident[name = options]`, []string{"options"}},
+		{`Field > *[kind=Ident][name^=s]`, []string{"string", "secret", "string"}},
+		{`Field > [kind=Ident][name^=s]`, []string{"string", "secret", "string"}},
+		{`.exported > StructType [tag~=json]`, []string{"Name", "Timeout"}},
+	}
+	for _, test := range testcases {
+		q, err := CompileSelector(test.selector)
+		if err != nil {
+			t.Errorf("%s: %v", test.selector, err)
+			continue
+		}
+		var got []string
+		for _, node := range Find([]ast.Node{file}, q) {
+			if field, isField := node.(*ast.Field); isField {
+				got = append(got, field.Names[0].Name) // fields can't be printed on their own
+				continue
+			}
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.selector, test.exp, got)
+		}
+	}
+}
+
+func TestCompileSelectorErrors(t *testing.T) {
+	testcases := []struct {
+		selector string
+		err      string
+	}{
+		{``, "offset 0: expected a node kind or '*'"},
+		{`TypeSpc`, `offset 0: unknown node kind "TypeSpc"`},
+		{`TypeSpec.exportd`, `offset 9: unknown attribute "exportd"`},
+		{`Field[tag~=json`, "offset 15: expected ']'"},
+		{`Field[tag=]`, "offset 10: expected a value"},
+		{`Field[tag='json]`, "offset 10: unterminated string"},
+		{`TypeSpec >`, "offset 10: expected a node kind or '*'"},
+		{`Field:first-child`, "offset 5: expected a node kind or '*'"},
+	}
+	for _, test := range testcases {
+		_, err := CompileSelector(test.selector)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.selector, test.err, err)
+		}
+	}
+}
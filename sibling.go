@@ -0,0 +1,105 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+)
+
+// Siblings returns the list of nodes that node is an element of, such as the statements
+// of a block or the fields of a struct, along with the index of node in it. The list is
+// found in the innermost of the node's ancestors, as a PathFilter is passed them. It
+// returns nil and -1 if node is not an element of a list.
+func Siblings(node ast.Node, ancestors []ast.Node) ([]ast.Node, int) {
+	p := parent(ancestors)
+	if p == nil {
+		return nil, -1
+	}
+	v := reflect.ValueOf(p)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, -1
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() != reflect.Slice {
+			continue
+		}
+		for j := 0; j < field.Len(); j++ {
+			if elem, isNode := field.Index(j).Interface().(ast.Node); isNode && elem == node {
+				siblings := make([]ast.Node, field.Len())
+				for k := range siblings {
+					siblings[k], _ = field.Index(k).Interface().(ast.Node)
+				}
+				return siblings, j
+			}
+		}
+	}
+	return nil, -1
+}
+
+// SiblingFilter matches nodes that match Node and have siblings matching Preceding and
+// Following, such as a return statement immediately following an assignment to err:
+//
+//	astquery.SiblingFilter{
+//		Node:      astquery.MustCompileQuery("//ReturnStmt"),
+//		Preceding: astquery.MustCompilePattern("err = $x"),
+//		Adjacent:  true,
+//	}
+//
+// Siblings are the other elements of the list the node is in, as Siblings returns them,
+// and are filtered with the node's ancestors. Nodes that are not in a list don't match.
+// Captures of the filters are passed along, as CaptureFilter describes.
+type SiblingFilter struct {
+	// Node is the filter nodes must match. If nil, any node matches.
+	Node Filter
+
+	// Preceding, if set, is a filter that a sibling before the node must match, and
+	// Following one that a sibling after the node must match.
+	Preceding, Following Filter
+
+	// Adjacent is if the siblings must immediately precede or follow the node.
+	Adjacent bool
+}
+
+func (f SiblingFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f SiblingFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	return f.FilterCaptures(node, ancestors, make(map[string]ast.Node))
+}
+
+func (f SiblingFilter) FilterCaptures(node ast.Node, ancestors []ast.Node, captures map[string]ast.Node) bool {
+	siblings, i := Siblings(node, ancestors)
+	if siblings == nil {
+		return false
+	}
+	inner := make(map[string]ast.Node)
+	if f.Node != nil && !FilterCaptures(f.Node, node, ancestors, inner) {
+		return false
+	}
+	if f.Preceding != nil && !f.matchSibling(f.Preceding, siblings, i-1, -1, ancestors, inner) {
+		return false
+	}
+	if f.Following != nil && !f.matchSibling(f.Following, siblings, i+1, 1, ancestors, inner) {
+		return false
+	}
+	for name, captured := range inner {
+		captures[name] = captured
+	}
+	return true
+}
+
+// matchSibling reports whether one of the siblings from index start, in the direction
+// step, matches filter, or just the sibling at start if the filter is Adjacent.
+func (f SiblingFilter) matchSibling(filter Filter, siblings []ast.Node, start, step int, ancestors []ast.Node, captures map[string]ast.Node) bool {
+	for i := start; i >= 0 && i < len(siblings); i += step {
+		if siblings[i] != nil && FilterCaptures(filter, siblings[i], ancestors, captures) {
+			return true
+		}
+		if f.Adjacent {
+			break
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+const siblingSrc = `package p
+
+type Config struct {
+	Name    string
+	Addr    string
+	Timeout int
+}
+
+func load() error {
+	x, err := open()
+	if err != nil {
+		return err
+	}
+	err = x.Close()
+	return err
+}
+`
+
+func TestSiblingFilter(t *testing.T) {
+	file := parseTestFile(t, siblingSrc)
+	isReturn := MustCompileSelector("ReturnStmt")
+	testcases := []struct {
+		name   string
+		filter Filter
+		exp    []string
+	}{
+		{"after assignment", SiblingFilter{Node: isReturn, Preceding: MustCompilePattern("err = $x"), Adjacent: true}, []string{"return err"}},
+		{"after any assignment", SiblingFilter{Node: isReturn, Preceding: MustCompileSelector("AssignStmt")}, []string{"return err"}},
+		{"before if", SiblingFilter{Node: MustCompileSelector("AssignStmt"), Following: MustCompileSelector("IfStmt"), Adjacent: true}, []string{"x, err := open()"}},
+		{"any siblings", SiblingFilter{Node: isReturn}, []string{"return err", "return err"}},
+		{"not in a list", SiblingFilter{Node: MustCompileSelector("BlockStmt")}, nil},
+		{"after field", SiblingFilter{
+			Node:      MustCompileSelector("Field"),
+			Preceding: MustCompileSelector("Field[name=Name]"),
+		}, []string{"Addr", "Timeout"}},
+	}
+	for _, test := range testcases {
+		var got []string
+		for _, node := range Find([]ast.Node{file}, test.filter) {
+			if field, isField := node.(*ast.Field); isField {
+				got = append(got, field.Names[0].Name)
+				continue
+			}
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.name, test.exp, got)
+		}
+	}
+}
+
+func TestQuerySiblingAxes(t *testing.T) {
+	file := parseTestFile(t, siblingSrc)
+	testcases := []struct {
+		query string
+		exp   []string
+	}{
+		{`//ReturnStmt[previous-sibling::AssignStmt[@lhs='err']]`, []string{"return err"}},
+		{`//ReturnStmt[preceding-sibling::AssignStmt[@lhs=~'\berr$']]`, []string{"return err"}},
+		{`//AssignStmt[next-sibling::IfStmt]`, []string{"x, err := open()"}},
+		{`//AssignStmt[following-sibling::ReturnStmt]`, []string{"x, err := open()", "err = x.Close()"}},
+		{`//Field[preceding-sibling::Field[@name='Addr']]/Ident`, []string{"Timeout", "int"}},
+		{`//Ident[@name='Name'][next-sibling::*]`, nil},
+	}
+	for _, test := range testcases {
+		var got []string
+		for _, node := range Find([]ast.Node{file}, MustCompileQuery(test.query)) {
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %v, but got %v", test.query, test.exp, got)
+		}
+	}
+}
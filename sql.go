@@ -0,0 +1,543 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// SQLQuery is a compiled query in a SQL-like language, for exploring code and reporting
+// on it in tables:
+//
+//	SELECT name, pos FROM FuncDecl WHERE receiver = 'Service' AND exported
+//
+// FROM names a go/ast node type, or "*" for any kind. WHERE compares the attributes of
+// Query, with AND, OR, NOT and parentheses:
+//
+//	attr = 'value'      the attribute is value ("!=" and "<>" for is not)
+//	attr LIKE 'pat%'    the attribute matches the pattern, where '%' is any text and
+//	                    '_' any character
+//	attr =~ 'regexp'    the attribute matches the regular expression
+//	attr                the attribute is set, and not 'false'
+//
+// Values can be placeholders, written "?", whose values are given to Bind.
+//
+// SELECT lists the columns of the table, which are the attributes, the position ("pos"),
+// "file", "line" and "package" of the matches, or "*" for name, kind and pos. The rows
+// can be ordered with ORDER BY a column, optionally DESC, and limited with LIMIT. Keywords
+// are case-insensitive. An SQLQuery is a Filter, matching the nodes of the kind that
+// satisfy the WHERE clause.
+type SQLQuery struct {
+	src     string
+	columns []string
+	kind    reflect.Type
+	where   sqlExpr
+	orderBy string
+	desc    bool
+	limit   int // or -1
+	params  int // the number of placeholders
+}
+
+// Table is the result of an SQLQuery: one row of values per match, in the order of the
+// columns.
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// String returns the table as aligned text, with a header row.
+func (t *Table) String() string {
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(t.Columns, "\t"))
+	for _, row := range t.Rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// sqlColumns are the columns of the matches that are not attributes, by name.
+var sqlColumns = map[string]func(m Match) string{
+	"pos":     func(m Match) string { return m.Position().String() },
+	"file":    func(m Match) string { return m.Position().Filename },
+	"line":    func(m Match) string { return strconv.Itoa(m.Position().Line) },
+	"package": func(m Match) string { return m.PkgPath },
+}
+
+// CompileSQL compiles an SQL-like query.
+func CompileSQL(src string) (*SQLQuery, error) {
+	q, err := parseSQL(src)
+	if err != nil {
+		return nil, queryError(SQLLanguage, src, err)
+	}
+	return q, nil
+}
+
+// MustCompileSQL is like CompileSQL but panics if the query cannot be compiled.
+func MustCompileSQL(src string) *SQLQuery {
+	q, err := CompileSQL(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the source of the query.
+func (q *SQLQuery) String() string { return q.src }
+
+// Bind returns the query with its placeholders replaced by args, in order, without
+// compiling it again. A query with placeholders matches no nodes until it is bound.
+func (q *SQLQuery) Bind(args ...string) (*SQLQuery, error) {
+	if len(args) != q.params {
+		return nil, fmt.Errorf("select %q: expected %d arguments, but got %d", q.src, q.params, len(args))
+	}
+	if q.params == 0 {
+		return q, nil
+	}
+	bound := *q
+	where, err := q.where.bind(args)
+	if err != nil {
+		return nil, fmt.Errorf("select %q: %v", q.src, err)
+	}
+	bound.where, bound.params = where, 0
+	return &bound, nil
+}
+
+func (q *SQLQuery) Filter(node ast.Node) bool {
+	if q.params > 0 || q.kind != nil && reflect.TypeOf(node) != q.kind {
+		return false
+	}
+	return q.where == nil || q.where.eval(node)
+}
+
+// Run runs the query on the packages of the workspace.
+func (q *SQLQuery) Run(w *Workspace) *Table {
+	matches := w.Find(q)
+	table := &Table{Columns: q.columns, Rows: make([][]string, len(matches))}
+	for i, m := range matches {
+		row := make([]string, len(q.columns))
+		for j, column := range q.columns {
+			row[j] = sqlValue(column, m)
+		}
+		table.Rows[i] = row
+	}
+	if q.orderBy != "" {
+		values := make([]string, len(matches))
+		for i, m := range matches {
+			values[i] = sqlValue(q.orderBy, m)
+		}
+		sort.Stable(sqlRows{table.Rows, values, q.desc})
+	}
+	if q.limit >= 0 && len(table.Rows) > q.limit {
+		table.Rows = table.Rows[:q.limit]
+	}
+	return table
+}
+
+// sqlValue returns the value of a column for a match, which is empty if the node doesn't
+// have the attribute.
+func sqlValue(column string, m Match) string {
+	if value, isColumn := sqlColumns[column]; isColumn {
+		return value(m)
+	}
+	value, _ := queryAttrs[column](m.Node)
+	return value
+}
+
+// sqlRows sorts rows by their values, with numbers in numeric order.
+type sqlRows struct {
+	rows   [][]string
+	values []string
+	desc   bool
+}
+
+func (r sqlRows) Len() int { return len(r.rows) }
+
+func (r sqlRows) Less(i, j int) bool {
+	if r.desc {
+		i, j = j, i
+	}
+	x, errX := strconv.Atoi(r.values[i])
+	y, errY := strconv.Atoi(r.values[j])
+	if errX == nil && errY == nil {
+		return x < y
+	}
+	return r.values[i] < r.values[j]
+}
+
+func (r sqlRows) Swap(i, j int) {
+	r.rows[i], r.rows[j] = r.rows[j], r.rows[i]
+	r.values[i], r.values[j] = r.values[j], r.values[i]
+}
+
+// sqlExpr is a condition of a WHERE clause.
+type sqlExpr interface {
+	eval(node ast.Node) bool
+
+	// bind returns the condition with its placeholders replaced by the arguments.
+	bind(args []string) (sqlExpr, error)
+}
+
+type sqlAnd struct{ x, y sqlExpr }
+
+func (e sqlAnd) eval(node ast.Node) bool { return e.x.eval(node) && e.y.eval(node) }
+
+func (e sqlAnd) bind(args []string) (sqlExpr, error) {
+	x, y, err := bindSQL(e.x, e.y, args)
+	return sqlAnd{x, y}, err
+}
+
+type sqlOr struct{ x, y sqlExpr }
+
+func (e sqlOr) eval(node ast.Node) bool { return e.x.eval(node) || e.y.eval(node) }
+
+func (e sqlOr) bind(args []string) (sqlExpr, error) {
+	x, y, err := bindSQL(e.x, e.y, args)
+	return sqlOr{x, y}, err
+}
+
+// bindSQL binds the placeholders of the operands of a binary condition.
+func bindSQL(x, y sqlExpr, args []string) (sqlExpr, sqlExpr, error) {
+	x, err := x.bind(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	y, err = y.bind(args)
+	return x, y, err
+}
+
+type sqlNot struct{ x sqlExpr }
+
+func (e sqlNot) eval(node ast.Node) bool { return !e.x.eval(node) }
+
+func (e sqlNot) bind(args []string) (sqlExpr, error) {
+	x, err := e.x.bind(args)
+	return sqlNot{x}, err
+}
+
+// sqlCond is a comparison of an attribute.
+type sqlCond struct{ pred attrPred }
+
+func (e sqlCond) eval(node ast.Node) bool { return e.pred.eval(node, nil) }
+
+func (e sqlCond) bind(args []string) (sqlExpr, error) {
+	pred, err := e.pred.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	return sqlCond{pred.(attrPred)}, nil
+}
+
+// sqlToken is a token of an SQL-like query.
+type sqlToken struct {
+	offset int
+	text   string // the text of a keyword or identifier, or of an operator
+	str    bool   // if text is the value of a string literal
+}
+
+// sqlParser parses an SQL-like query.
+type sqlParser struct {
+	toks   []sqlToken
+	i      int
+	end    int // the length of the source
+	params int // the number of placeholders parsed
+}
+
+func (p *sqlParser) errorf(format string, args ...interface{}) error {
+	return syntaxError(p.offset(), format, args...)
+}
+
+func (p *sqlParser) semanticf(format string, args ...interface{}) error {
+	return semanticError(p.offset(), format, args...)
+}
+
+// offset returns the offset of the current token.
+func (p *sqlParser) offset() int {
+	if p.i < len(p.toks) {
+		return p.toks[p.i].offset
+	}
+	return p.end
+}
+
+// peek returns the current token, or an empty token at the end.
+func (p *sqlParser) peek() sqlToken {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return sqlToken{offset: p.end}
+}
+
+// keyword consumes the current token if it is the keyword kw.
+func (p *sqlParser) keyword(kw string) bool {
+	if tok := p.peek(); !tok.str && strings.EqualFold(tok.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// ident consumes an identifier, which must not be a keyword.
+func (p *sqlParser) ident() (string, error) {
+	tok := p.peek()
+	if tok.str || tok.text == "" || !unicode.IsLetter(rune(tok.text[0])) && tok.text[0] != '_' || sqlKeywords[strings.ToUpper(tok.text)] {
+		return "", p.errorf("expected a name")
+	}
+	p.i++
+	return tok.text, nil
+}
+
+var sqlKeywords = map[string]bool{"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true, "LIKE": true, "ORDER": true, "BY": true, "ASC": true, "DESC": true, "LIMIT": true}
+
+func parseSQL(src string) (*SQLQuery, error) {
+	toks, err := lexSQL(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{toks: toks, end: len(src)}
+	q := &SQLQuery{src: src, limit: -1}
+	if !p.keyword("SELECT") {
+		return nil, p.errorf("expected SELECT")
+	}
+	for {
+		if p.keyword("*") {
+			q.columns = append(q.columns, "name", "kind", "pos")
+		} else {
+			column, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			q.columns = append(q.columns, column)
+		}
+		if !p.keyword(",") {
+			break
+		}
+	}
+	if !p.keyword("FROM") {
+		return nil, p.errorf("expected FROM")
+	}
+	if !p.keyword("*") {
+		name, err := p.ident()
+		if err != nil {
+			return nil, p.errorf("expected a node kind or '*'")
+		}
+		if q.kind = nodeKinds[name]; q.kind == nil {
+			p.i--
+			return nil, p.semanticf("unknown node kind %q", name)
+		}
+	}
+	if p.keyword("WHERE") {
+		if q.where, err = p.or(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("ORDER") {
+		if !p.keyword("BY") {
+			return nil, p.errorf("expected BY")
+		}
+		if q.orderBy, err = p.column(); err != nil {
+			return nil, err
+		}
+		if !p.keyword("ASC") {
+			q.desc = p.keyword("DESC")
+		}
+	}
+	if p.keyword("LIMIT") {
+		limit, err := strconv.Atoi(p.peek().text)
+		if err != nil || limit < 0 || p.peek().str {
+			return nil, p.errorf("expected a number")
+		}
+		q.limit = limit
+		p.i++
+	}
+	if p.i < len(p.toks) {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	q.params = p.params
+	return q, nil
+}
+
+// column parses the name of a column.
+func (p *sqlParser) column() (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", p.errorf("expected a column")
+	}
+	if queryAttrs[name] == nil && sqlColumns[name] == nil {
+		p.i--
+		return "", p.semanticf("unknown column %q", name)
+	}
+	return name, nil
+}
+
+func (p *sqlParser) or() (sqlExpr, error) {
+	x, err := p.and()
+	for err == nil && p.keyword("OR") {
+		var y sqlExpr
+		if y, err = p.and(); err == nil {
+			x = sqlOr{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *sqlParser) and() (sqlExpr, error) {
+	x, err := p.not()
+	for err == nil && p.keyword("AND") {
+		var y sqlExpr
+		if y, err = p.not(); err == nil {
+			x = sqlAnd{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *sqlParser) not() (sqlExpr, error) {
+	if p.keyword("NOT") {
+		x, err := p.not()
+		return sqlNot{x}, err
+	}
+	if p.keyword("(") {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		return x, nil
+	}
+	return p.cond()
+}
+
+// cond parses a comparison of an attribute.
+func (p *sqlParser) cond() (sqlExpr, error) {
+	start := p.i
+	attr, err := p.ident()
+	if err != nil {
+		return nil, p.errorf("expected a condition")
+	}
+	if queryAttrs[attr] == nil {
+		p.i = start
+		return nil, p.semanticf("unknown attribute %q", attr)
+	}
+	pred := attrPred{attr: attr}
+	negate, like := p.keyword("NOT"), false
+	switch {
+	case p.keyword("LIKE"):
+		pred.op, like = "=~", true
+	case negate:
+		return nil, p.errorf("expected LIKE")
+	case p.keyword("="):
+		pred.op = "="
+	case p.keyword("!="), p.keyword("<>"):
+		pred.op = "!="
+	case p.keyword("=~"):
+		pred.op = "=~"
+	default:
+		return sqlCond{pred}, nil
+	}
+	if p.keyword("?") {
+		p.params++
+		pred.param, pred.like = p.params, like
+		if negate {
+			return sqlNot{sqlCond{pred}}, nil
+		}
+		return sqlCond{pred}, nil
+	}
+	tok := p.peek()
+	if !tok.str {
+		return nil, p.errorf("expected a string or '?'")
+	}
+	p.i++
+	pred.value = tok.text
+	if pred.op == "=~" {
+		expr := tok.text
+		if like {
+			expr = likeRegexp(tok.text)
+		}
+		if pred.re, err = regexp.Compile(expr); err != nil {
+			p.i--
+			return nil, p.semanticf("%v", err)
+		}
+	}
+	if negate {
+		return sqlNot{sqlCond{pred}}, nil
+	}
+	return sqlCond{pred}, nil
+}
+
+// likeRegexp returns the regular expression equivalent to a LIKE pattern.
+func likeRegexp(pattern string) string {
+	var buf strings.Builder
+	buf.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			buf.WriteString(".*")
+		case '_':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
+
+// lexSQL splits an SQL-like query into tokens.
+func lexSQL(src string) ([]sqlToken, error) {
+	var toks []sqlToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '\'':
+			var value strings.Builder
+			j := i + 1
+			for ; j < len(src); j++ {
+				if src[j] == '\'' {
+					if j+1 < len(src) && src[j+1] == '\'' {
+						j++
+					} else {
+						break
+					}
+				}
+				value.WriteByte(src[j])
+			}
+			if j == len(src) {
+				return nil, syntaxError(i, "unterminated string")
+			}
+			toks = append(toks, sqlToken{offset: i, text: value.String(), str: true})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, sqlToken{offset: i, text: src[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"!=", "<>", "=~", "=", ",", "(", ")", "*", "?"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, syntaxError(i, "unexpected %q", c)
+			}
+			toks = append(toks, sqlToken{offset: i, text: op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
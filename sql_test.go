@@ -0,0 +1,120 @@
+package astquery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sqlSrc = `package p
+
+type Service struct{}
+
+func (s *Service) Start() {}
+
+func (s *Service) stop() {}
+
+func (s *Service) Status() string { return "ok" }
+
+type Client struct{}
+
+func (c *Client) Send() {}
+
+func NewService() *Service { return &Service{} }
+`
+
+func TestSQLQuery(t *testing.T) {
+	pkg, err := ParseSource("service.go", []byte(sqlSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.ImportPath = "example.com/p"
+	ws := &Workspace{Packages: []*Package{pkg}}
+	testcases := []struct {
+		query string
+		exp   [][]string
+	}{
+		{`SELECT name, pos FROM FuncDecl WHERE receiver = 'Service' AND exported`, [][]string{
+			{"name", "pos"},
+			{"Start", "service.go:5:1"},
+			{"Status", "service.go:9:1"},
+		}},
+		{`select name, line from FuncDecl where receiver != 'Service' or not exported order by name desc`, [][]string{
+			{"name", "line"},
+			{"stop", "7"},
+			{"Send", "13"},
+		}},
+		{`SELECT name FROM FuncDecl WHERE name LIKE 'St%' AND NOT (receiver = 'Client') ORDER BY line DESC LIMIT 1`, [][]string{
+			{"name"},
+			{"Status"},
+		}},
+		{`SELECT name, receiver FROM FuncDecl WHERE name NOT LIKE 'S_a%' AND name =~ '^[A-Z]'`, [][]string{
+			{"name", "receiver"},
+			{"Send", "Client"},
+			{"NewService", ""},
+		}},
+		{`SELECT * FROM TypeSpec`, [][]string{
+			{"name", "kind", "pos"},
+			{"Service", "TypeSpec", "service.go:3:6"},
+			{"Client", "TypeSpec", "service.go:11:6"},
+		}},
+		{`SELECT kind, package, file FROM * WHERE name = 'NewService'`, [][]string{
+			{"kind", "package", "file"},
+			{"FuncDecl", "example.com/p", "service.go"},
+		}},
+	}
+	for _, test := range testcases {
+		q, err := CompileSQL(test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		table := q.Run(ws)
+		got := append([][]string{table.Columns}, table.Rows...)
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %q, but got %q", test.query, test.exp, got)
+		}
+	}
+
+	q, err := MustCompileSQL(`SELECT name FROM FuncDecl WHERE receiver = ? AND name NOT LIKE ?`).Bind("Service", "St%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := q.Run(ws).Rows, [][]string{{"stop"}}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected bound query rows %q, but got %q", exp, got)
+	}
+	if _, err := MustCompileSQL(`SELECT name FROM FuncDecl WHERE name = ?`).Bind(); err == nil || !strings.Contains(err.Error(), "expected 1 arguments, but got 0") {
+		t.Errorf("expected an error binding too few arguments, but got %v", err)
+	}
+
+	table := MustCompileSQL(`SELECT name, line FROM TypeSpec`).Run(ws)
+	if exp := "name     line\nService  3\nClient   11\n"; table.String() != exp {
+		t.Errorf("expected table\n%s\nbut got\n%s", exp, table)
+	}
+}
+
+func TestCompileSQLErrors(t *testing.T) {
+	testcases := []struct {
+		query string
+		err   string
+	}{
+		{`FROM FuncDecl`, "offset 0: expected SELECT"},
+		{`SELECT nam FROM FuncDecl`, `offset 7: unknown column "nam"`},
+		{`SELECT name FuncDecl`, "offset 12: expected FROM"},
+		{`SELECT name FROM FuncDel`, `offset 17: unknown node kind "FuncDel"`},
+		{`SELECT name FROM FuncDecl WHERE recv = 'x'`, `offset 32: unknown attribute "recv"`},
+		{`SELECT name FROM FuncDecl WHERE name = x`, "offset 39: expected a string"},
+		{`SELECT name FROM FuncDecl WHERE name =~ '('`, "offset 40: error parsing regexp"},
+		{`SELECT name FROM FuncDecl WHERE (exported`, "offset 41: expected ')'"},
+		{`SELECT name FROM FuncDecl WHERE name = 'x`, "offset 39: unterminated string"},
+		{`SELECT name FROM FuncDecl LIMIT many`, "offset 32: expected a number"},
+		{`SELECT name FROM FuncDecl WHERE exported exported`, `offset 41: unexpected "exported"`},
+		{`SELECT name FROM FuncDecl WHERE name NOT = 'x'`, "offset 41: expected LIKE"},
+	}
+	for _, test := range testcases {
+		_, err := CompileSQL(test.query)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.query, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,635 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+)
+
+// DeferFilter matches defer statements (*ast.DeferStmt).
+type DeferFilter struct {
+	// Callee, if non-nil, is a regular expression matching the deferred function as
+	// written in the source (e.g., "f.Close" or "mu.Unlock").
+	Callee *regexp.Regexp
+
+	// FuncLit is if the filter should select only deferred function literals.
+	FuncLit bool
+}
+
+func (f DeferFilter) Filter(node ast.Node) bool {
+	stmt, isDefer := node.(*ast.DeferStmt)
+	if !isDefer {
+		return false
+	}
+	return callMatches(stmt.Call, f.Callee, f.FuncLit)
+}
+
+// GoStmtFilter matches go statements (*ast.GoStmt), i.e., goroutine launch sites.
+type GoStmtFilter struct {
+	// Callee, if non-nil, is a regular expression matching the launched function as
+	// written in the source.
+	Callee *regexp.Regexp
+
+	// FuncLit is if the filter should select only goroutines running a function literal.
+	FuncLit bool
+
+	// CapturesLoopVar is if the filter should select only goroutines running a function
+	// literal that refers to a variable declared by an enclosing for or range statement.
+	// It requires ancestors, so Filter never matches when it is set.
+	CapturesLoopVar bool
+}
+
+func (f GoStmtFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f GoStmtFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	stmt, isGo := node.(*ast.GoStmt)
+	if !isGo {
+		return false
+	}
+	if !callMatches(stmt.Call, f.Callee, f.FuncLit) {
+		return false
+	}
+	if f.CapturesLoopVar {
+		lit, isLit := stmt.Call.Fun.(*ast.FuncLit)
+		if !isLit || !refersToAny(lit, loopVars(ancestors)) {
+			return false
+		}
+	}
+	return true
+}
+
+// loopVars returns the names of the variables declared by the for and range statements
+// among ancestors.
+func loopVars(ancestors []ast.Node) map[string]bool {
+	vars := make(map[string]bool)
+	addIdents := func(exprs ...ast.Expr) {
+		for _, expr := range exprs {
+			if ident, isIdent := expr.(*ast.Ident); isIdent && ident.Name != "_" {
+				vars[ident.Name] = true
+			}
+		}
+	}
+	for _, node := range ancestors {
+		switch node := node.(type) {
+		case *ast.ForStmt:
+			if init, isAssign := node.Init.(*ast.AssignStmt); isAssign && init.Tok == token.DEFINE {
+				addIdents(init.Lhs...)
+			}
+		case *ast.RangeStmt:
+			if node.Tok == token.DEFINE {
+				addIdents(node.Key, node.Value)
+			}
+		}
+	}
+	return vars
+}
+
+// refersToAny reports whether lit refers to any of the named variables declared outside
+// it. References are found syntactically: identifiers with one of the names refer to the
+// variable unless a declaration in lit, such as a parameter, shadows it, and the names of
+// selected fields and methods, the field keys of composite literals and labels are not
+// references.
+func refersToAny(lit *ast.FuncLit, names map[string]bool) bool {
+	c := &captureFinder{names: names}
+	c.walk(lit, nil)
+	return c.found
+}
+
+// captureFinder looks for references to the named variables, following the scopes of the
+// declarations that shadow them.
+type captureFinder struct {
+	names map[string]bool
+
+	// goroutines is if only references in function literals run as goroutines count.
+	goroutines bool
+
+	found bool
+}
+
+// walk looks for references in node, where the names in shadowed are declared.
+func (c *captureFinder) walk(node ast.Node, shadowed map[string]bool) {
+	if node == nil {
+		return
+	}
+	ast.Inspect(node, func(node ast.Node) bool {
+		if c.found {
+			return false
+		}
+		switch node := node.(type) {
+		case *ast.Ident:
+			c.found = c.names[node.Name] && !shadowed[node.Name] && !c.goroutines
+		case *ast.SelectorExpr:
+			c.walk(node.X, shadowed)
+			return false
+		case *ast.KeyValueExpr:
+			if _, isField := node.Key.(*ast.Ident); !isField {
+				c.walk(node.Key, shadowed)
+			}
+			c.walk(node.Value, shadowed)
+			return false
+		case *ast.BranchStmt, *ast.LabeledStmt:
+			c.walkStmt(node.(ast.Stmt), shadowed)
+			return false
+		case *ast.GoStmt:
+			if lit, isLit := node.Call.Fun.(*ast.FuncLit); isLit && c.goroutines {
+				c.goroutines = false
+				c.walk(lit, shadowed)
+				c.goroutines = true
+				return false
+			}
+		case *ast.FuncLit:
+			inner := declare(shadowed, paramNames(node.Type.Params)...)
+			if node.Type.Results != nil {
+				inner = declare(inner, paramNames(node.Type.Results)...)
+			}
+			c.walk(node.Body, inner)
+			return false
+		case *ast.BlockStmt:
+			c.walkStmts(node.List, shadowed)
+			return false
+		case *ast.IfStmt:
+			inner := c.walkStmt(node.Init, shadowed)
+			c.walk(node.Cond, inner)
+			c.walk(node.Body, inner)
+			if node.Else != nil {
+				c.walk(node.Else, inner)
+			}
+			return false
+		case *ast.ForStmt:
+			inner := c.walkStmt(node.Init, shadowed)
+			c.walk(node.Cond, inner)
+			c.walkStmt(node.Post, inner)
+			c.walk(node.Body, inner)
+			return false
+		case *ast.RangeStmt:
+			c.walk(node.X, shadowed)
+			inner := shadowed
+			if node.Tok == token.DEFINE {
+				inner = declare(shadowed, identNames(node.Key, node.Value)...)
+			} else {
+				c.walk(node.Key, shadowed)
+				c.walk(node.Value, shadowed)
+			}
+			c.walk(node.Body, inner)
+			return false
+		case *ast.SwitchStmt:
+			inner := c.walkStmt(node.Init, shadowed)
+			c.walk(node.Tag, inner)
+			c.walk(node.Body, inner)
+			return false
+		case *ast.TypeSwitchStmt:
+			inner := c.walkStmt(node.Init, shadowed)
+			var symbol []string
+			if assign, isAssign := node.Assign.(*ast.AssignStmt); isAssign {
+				symbol = identNames(assign.Lhs...)
+				c.walk(assign.Rhs[0], inner)
+			} else {
+				c.walk(node.Assign, inner)
+			}
+			for _, clause := range node.Body.List {
+				clause := clause.(*ast.CaseClause)
+				for _, typ := range clause.List {
+					c.walk(typ, inner)
+				}
+				c.walkStmts(clause.Body, declare(inner, symbol...))
+			}
+			return false
+		case *ast.CaseClause:
+			for _, expr := range node.List {
+				c.walk(expr, shadowed)
+			}
+			c.walkStmts(node.Body, shadowed)
+			return false
+		case *ast.CommClause:
+			c.walkStmts(node.Body, c.walkStmt(node.Comm, shadowed))
+			return false
+		}
+		return !c.found
+	})
+}
+
+// walkStmts looks for references in a list of statements, forming a scope inside the one
+// where the names in shadowed are declared.
+func (c *captureFinder) walkStmts(stmts []ast.Stmt, shadowed map[string]bool) {
+	for _, stmt := range stmts {
+		shadowed = c.walkStmt(stmt, shadowed)
+	}
+}
+
+// walkStmt looks for references in stmt, where the names in shadowed are declared, and
+// returns the names declared after it.
+func (c *captureFinder) walkStmt(stmt ast.Stmt, shadowed map[string]bool) map[string]bool {
+	switch stmt := stmt.(type) {
+	case nil:
+	case *ast.AssignStmt:
+		for _, rhs := range stmt.Rhs {
+			c.walk(rhs, shadowed)
+		}
+		if stmt.Tok == token.DEFINE {
+			return declare(shadowed, identNames(stmt.Lhs...)...)
+		}
+		for _, lhs := range stmt.Lhs {
+			c.walk(lhs, shadowed)
+		}
+	case *ast.DeclStmt:
+		gen, isGen := stmt.Decl.(*ast.GenDecl)
+		if !isGen {
+			break
+		}
+		for _, spec := range gen.Specs {
+			switch spec := spec.(type) {
+			case *ast.ValueSpec:
+				c.walk(spec.Type, shadowed)
+				for _, value := range spec.Values {
+					c.walk(value, shadowed)
+				}
+				for _, name := range spec.Names {
+					shadowed = declare(shadowed, name.Name)
+				}
+			case *ast.TypeSpec:
+				shadowed = declare(shadowed, spec.Name.Name)
+				c.walk(spec.Type, shadowed)
+			}
+		}
+	case *ast.LabeledStmt:
+		return c.walkStmt(stmt.Stmt, shadowed)
+	case *ast.BranchStmt:
+	default:
+		c.walk(stmt, shadowed)
+	}
+	return shadowed
+}
+
+// declare returns shadowed with names added.
+func declare(shadowed map[string]bool, names ...string) map[string]bool {
+	if len(names) == 0 {
+		return shadowed
+	}
+	inner := make(map[string]bool, len(shadowed)+len(names))
+	for name := range shadowed {
+		inner[name] = true
+	}
+	for _, name := range names {
+		inner[name] = true
+	}
+	return inner
+}
+
+// paramNames returns the names of the parameters or results of a field list.
+func paramNames(fields *ast.FieldList) []string {
+	var names []string
+	for _, field := range fields.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+// identNames returns the names of the identifiers among exprs.
+func identNames(exprs ...ast.Expr) []string {
+	var names []string
+	for _, expr := range exprs {
+		if ident, isIdent := expr.(*ast.Ident); isIdent {
+			names = append(names, ident.Name)
+		}
+	}
+	return names
+}
+
+// SelectStmtFilter matches select statements (*ast.SelectStmt).
+type SelectStmtFilter struct {
+	// Default selects statements by whether they have a default case, i.e., whether they
+	// are non-blocking.
+	Default DefaultCase
+}
+
+// DefaultCase selects switch and select statements by whether they have a default case.
+type DefaultCase int
+
+const (
+	AnyDefault     DefaultCase = iota // with or without a default case
+	WithDefault                       // with a default case
+	WithoutDefault                    // without a default case
+)
+
+// matches reports whether a statement's default case presence is selected by d.
+func (d DefaultCase) matches(hasDefault bool) bool {
+	switch d {
+	case WithDefault:
+		return hasDefault
+	case WithoutDefault:
+		return !hasDefault
+	default:
+		return true
+	}
+}
+
+func (f SelectStmtFilter) Filter(node ast.Node) bool {
+	stmt, isSelect := node.(*ast.SelectStmt)
+	if !isSelect {
+		return false
+	}
+	hasDefault := false
+	for _, clause := range stmt.Body.List {
+		if clause.(*ast.CommClause).Comm == nil {
+			hasDefault = true
+		}
+	}
+	return f.Default.matches(hasDefault)
+}
+
+// TypeSwitchFilter matches type switch statements (*ast.TypeSwitchStmt).
+type TypeSwitchFilter struct {
+	// Default selects statements by whether they have a default case.
+	Default DefaultCase
+
+	// CaseTypes are types, written as they appear in the source, that must all be listed
+	// in the statement's cases.
+	CaseTypes []string
+
+	// MissingTypes are types, written as they appear in the source, of which at least
+	// one must not be listed in the statement's cases. Together with CaseTypes, it finds
+	// switches that handle some variants of a sum type but not others.
+	MissingTypes []string
+}
+
+func (f TypeSwitchFilter) Filter(node ast.Node) bool {
+	stmt, isSwitch := node.(*ast.TypeSwitchStmt)
+	if !isSwitch {
+		return false
+	}
+	hasDefault := false
+	listed := make(map[string]bool)
+	for _, clause := range stmt.Body.List {
+		cases := clause.(*ast.CaseClause).List
+		if cases == nil {
+			hasDefault = true
+		}
+		for _, typ := range cases {
+			listed[types.ExprString(typ)] = true
+		}
+	}
+	if !f.Default.matches(hasDefault) {
+		return false
+	}
+	for _, typ := range f.CaseTypes {
+		if !listed[typ] {
+			return false
+		}
+	}
+	if len(f.MissingTypes) > 0 {
+		missing := false
+		for _, typ := range f.MissingTypes {
+			if !listed[typ] {
+				missing = true
+			}
+		}
+		if !missing {
+			return false
+		}
+	}
+	return true
+}
+
+// RangeStmtFilter matches range statements (*ast.RangeStmt).
+type RangeStmtFilter struct {
+	// Over selects statements by the kind of value ranged over. The kind is determined from
+	// the ranged expression if it spells out its type, or else from the declaration of
+	// the ranged variable in an enclosing scope, so it requires ancestors for the latter.
+	Over RangeKind
+
+	// X, if non-nil, is a regular expression matching the ranged expression as written in
+	// the source (e.g., "s.items").
+	X *regexp.Regexp
+
+	// GoroutineCapture is if the filter should select only statements whose loop variables
+	// are referred to by function literals launched as goroutines in the loop body.
+	GoroutineCapture bool
+}
+
+// RangeKind is the kind of value a range statement ranges over.
+type RangeKind int
+
+const (
+	AnyRange   RangeKind = iota // any value, including ones of unknown kind
+	SliceRange                  // slices, arrays and pointers to arrays
+	MapRange                    // maps
+	ChanRange                   // channels
+)
+
+func (f RangeStmtFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f RangeStmtFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	stmt, isRange := node.(*ast.RangeStmt)
+	if !isRange {
+		return false
+	}
+	if f.X != nil && !f.X.MatchString(types.ExprString(stmt.X)) {
+		return false
+	}
+	if f.Over != AnyRange && rangeKind(stmt.X, ancestors) != f.Over {
+		return false
+	}
+	if f.GoroutineCapture && !capturedByGoroutine(stmt) {
+		return false
+	}
+	return true
+}
+
+// rangeKind returns the kind of the ranged expression x, or AnyRange if it is unknown.
+func rangeKind(x ast.Expr, ancestors []ast.Node) RangeKind {
+	typ := inferredType(x)
+	if ident, isIdent := x.(*ast.Ident); isIdent && typ == nil {
+		typ = declaredType(ident.Name, ident.Pos(), ancestors)
+	}
+	if star, isStar := typ.(*ast.StarExpr); isStar {
+		typ = star.X
+	}
+	switch typ.(type) {
+	case *ast.ArrayType:
+		return SliceRange
+	case *ast.MapType:
+		return MapRange
+	case *ast.ChanType:
+		return ChanRange
+	default:
+		return AnyRange
+	}
+}
+
+// capturedByGoroutine reports whether the loop variables of stmt are referred to by a
+// function literal launched as a goroutine in the loop body.
+func capturedByGoroutine(stmt *ast.RangeStmt) bool {
+	vars := loopVars([]ast.Node{stmt})
+	if len(vars) == 0 {
+		return false
+	}
+	c := &captureFinder{names: vars, goroutines: true}
+	c.walk(stmt.Body, nil)
+	return c.found
+}
+
+// LabeledStmtFilter matches labeled statements (*ast.LabeledStmt).
+type LabeledStmtFilter struct {
+	// Pattern, if non-nil, is a regular expression matching the label's name.
+	Pattern *regexp.Regexp
+}
+
+func (f LabeledStmtFilter) Filter(node ast.Node) bool {
+	stmt, isLabeled := node.(*ast.LabeledStmt)
+	if !isLabeled {
+		return false
+	}
+	return f.Pattern == nil || f.Pattern.MatchString(stmt.Label.Name)
+}
+
+// BranchStmtFilter matches branch statements (*ast.BranchStmt): goto, break, continue and
+// fallthrough.
+type BranchStmtFilter struct {
+	// Tok is the kind of branch statement to filter for (token.GOTO, token.BREAK,
+	// token.CONTINUE or token.FALLTHROUGH). The zero value, token.ILLEGAL, matches any kind.
+	Tok token.Token
+
+	// Pattern, if non-nil, is a regular expression matching the name of the statement's
+	// label. Statements without a label never match it.
+	Pattern *regexp.Regexp
+
+	// LabeledOnly is if the filter should select only statements with a label.
+	LabeledOnly bool
+}
+
+func (f BranchStmtFilter) Filter(node ast.Node) bool {
+	stmt, isBranch := node.(*ast.BranchStmt)
+	if !isBranch {
+		return false
+	}
+	if f.Tok != token.ILLEGAL && stmt.Tok != f.Tok {
+		return false
+	}
+	if stmt.Label == nil {
+		return !f.LabeledOnly && f.Pattern == nil
+	}
+	return f.Pattern == nil || f.Pattern.MatchString(stmt.Label.Name)
+}
+
+// ReturnStmtFilter matches return statements (*ast.ReturnStmt).
+type ReturnStmtFilter struct {
+	// Naked is if the filter should select only naked returns: returns without results in
+	// functions with named results. It requires ancestors, so Filter never matches when it
+	// is set.
+	Naked bool
+
+	// Nil is if the filter should select only returns with a literal nil result.
+	Nil bool
+
+	// Result, if non-nil, is a regular expression that one of the results, as written in
+	// the source, must match (e.g., "^errors\.New\(").
+	Result *regexp.Regexp
+}
+
+func (f ReturnStmtFilter) Filter(node ast.Node) bool {
+	return f.FilterPath(node, nil)
+}
+
+func (f ReturnStmtFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	stmt, isReturn := node.(*ast.ReturnStmt)
+	if !isReturn {
+		return false
+	}
+	if f.Naked {
+		funcType := enclosingFuncType(ancestors)
+		if len(stmt.Results) != 0 || funcType == nil || !hasNamedResults(funcType) {
+			return false
+		}
+	}
+	if f.Nil && !anyResult(stmt.Results, func(result string) bool { return result == "nil" }) {
+		return false
+	}
+	if f.Result != nil && !anyResult(stmt.Results, f.Result.MatchString) {
+		return false
+	}
+	return true
+}
+
+// anyResult reports whether match returns true for any of the results as written in the
+// source.
+func anyResult(results []ast.Expr, match func(string) bool) bool {
+	for _, result := range results {
+		if match(types.ExprString(result)) {
+			return true
+		}
+	}
+	return false
+}
+
+// enclosingFuncType returns the type of the innermost function declaration or literal
+// among ancestors, or nil if there is none.
+func enclosingFuncType(ancestors []ast.Node) *ast.FuncType {
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if funcType := funcTypeOf(ancestors[i]); funcType != nil {
+			return funcType
+		}
+	}
+	return nil
+}
+
+// hasNamedResults reports whether a function type declares named results.
+func hasNamedResults(funcType *ast.FuncType) bool {
+	return funcType.Results != nil && len(funcType.Results.List) > 0 && len(funcType.Results.List[0].Names) > 0
+}
+
+// AssignmentFilter matches assignment statements (*ast.AssignStmt), including short
+// variable declarations and assignment operations such as +=.
+type AssignmentFilter struct {
+	// Tok is the assignment operator to filter for (e.g., token.ASSIGN, token.DEFINE or
+	// token.ADD_ASSIGN). The zero value, token.ILLEGAL, matches any operator.
+	Tok token.Token
+
+	// LHS, if non-nil, is a regular expression that one of the assigned expressions, as
+	// written in the source, must match (e.g., "^config$" or "^s\\.cache\\[").
+	LHS *regexp.Regexp
+
+	// RHS selects statements by the shape of the assigned values; one of them must have
+	// the shape.
+	RHS ExprShape
+}
+
+func (f AssignmentFilter) Filter(node ast.Node) bool {
+	stmt, isAssign := node.(*ast.AssignStmt)
+	if !isAssign {
+		return false
+	}
+	if f.Tok != token.ILLEGAL && stmt.Tok != f.Tok {
+		return false
+	}
+	if f.LHS != nil && !anyResult(stmt.Lhs, f.LHS.MatchString) {
+		return false
+	}
+	if f.RHS != AnyShape {
+		for _, rhs := range stmt.Rhs {
+			if f.RHS.matches(rhs) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// callMatches reports whether the callee of call matches the pattern (if non-nil) and is
+// a function literal (if funcLit is set).
+func callMatches(call *ast.CallExpr, callee *regexp.Regexp, funcLit bool) bool {
+	if callee != nil && !callee.MatchString(types.ExprString(call.Fun)) {
+		return false
+	}
+	if _, isLit := call.Fun.(*ast.FuncLit); funcLit && !isLit {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,430 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const stmtTestSrc = `package p
+
+func process(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Print(r)
+		}
+	}()
+	return nil
+}
+
+func fanOut(jobs []Job) {
+	for i, job := range jobs {
+		go func() { job.Run(i) }()
+		go func(job Job) { job.Run(0) }(job)
+	}
+	for n := 0; n < 3; n++ {
+		go worker(n)
+	}
+	go func() { wg.Wait() }()
+}
+
+func poll(results chan int, quit chan struct{}) {
+	select {
+	case r := <-results:
+		handle(r)
+	default:
+	}
+	select {
+	case r := <-results:
+		handle(r)
+	case <-quit:
+		return
+	}
+}
+
+func area(s Shape) float64 {
+	switch s := s.(type) {
+	case *Circle:
+		return s.r * s.r
+	case *Square, *Rect:
+		return 1
+	}
+	switch s.(type) {
+	case *Circle:
+		return 0
+	default:
+		panic("unknown shape")
+	}
+}
+
+`
+
+func TestDeferFilter(t *testing.T) {
+	file := parseTestFile(t, stmtTestSrc)
+
+	testcases := []struct {
+		filter DeferFilter
+		exp    []string
+	}{
+		{DeferFilter{}, []string{"f.Close", "mu.Unlock", "(func() literal)"}},
+		{DeferFilter{Callee: regexp.MustCompile(`\.Close$`)}, []string{"f.Close"}},
+		{DeferFilter{FuncLit: true}, []string{"(func() literal)"}},
+	}
+	for _, test := range testcases {
+		var callees []string
+		for _, stmt := range Find([]ast.Node{file}, test.filter) {
+			callees = append(callees, types.ExprString(stmt.(*ast.DeferStmt).Call.Fun))
+		}
+		if !reflect.DeepEqual(callees, test.exp) {
+			t.Errorf("%+v: expected deferred calls %v, but got %v", test.filter, test.exp, callees)
+		}
+	}
+}
+
+func TestGoStmtFilter(t *testing.T) {
+	file := parseTestFile(t, stmtTestSrc)
+
+	testcases := []struct {
+		filter GoStmtFilter
+		exp    []string
+	}{
+		{GoStmtFilter{}, []string{"func() { job.Run(i) }", "func(job Job) { job.Run(0) }", "worker", "func() { wg.Wait() }"}},
+		{GoStmtFilter{FuncLit: true}, []string{"func() { job.Run(i) }", "func(job Job) { job.Run(0) }", "func() { wg.Wait() }"}},
+		{GoStmtFilter{Callee: regexp.MustCompile(`^worker$`)}, []string{"worker"}},
+		{GoStmtFilter{CapturesLoopVar: true}, []string{"func() { job.Run(i) }"}},
+	}
+	for _, test := range testcases {
+		var callees []string
+		for _, stmt := range Find([]ast.Node{file}, test.filter) {
+			callees = append(callees, nodeSource(t, stmt.(*ast.GoStmt).Call.Fun))
+		}
+		if !reflect.DeepEqual(callees, test.exp) {
+			t.Errorf("%+v: expected goroutines %v, but got %v", test.filter, test.exp, callees)
+		}
+	}
+}
+
+func TestSelectStmtFilter(t *testing.T) {
+	file := parseTestFile(t, stmtTestSrc)
+
+	testcases := []struct {
+		filter SelectStmtFilter
+		exp    []string
+	}{
+		{SelectStmtFilter{}, []string{"<-results, default", "<-results, <-quit"}},
+		{SelectStmtFilter{Default: WithDefault}, []string{"<-results, default"}},
+		{SelectStmtFilter{Default: WithoutDefault}, []string{"<-results, <-quit"}},
+	}
+	for _, test := range testcases {
+		var stmts []string
+		for _, stmt := range Find([]ast.Node{file}, test.filter) {
+			var comms []string
+			for _, clause := range stmt.(*ast.SelectStmt).Body.List {
+				switch comm := clause.(*ast.CommClause).Comm.(type) {
+				case nil:
+					comms = append(comms, "default")
+				case *ast.AssignStmt:
+					comms = append(comms, types.ExprString(comm.Rhs[0]))
+				case *ast.ExprStmt:
+					comms = append(comms, types.ExprString(comm.X))
+				}
+			}
+			stmts = append(stmts, strings.Join(comms, ", "))
+		}
+		if !reflect.DeepEqual(stmts, test.exp) {
+			t.Errorf("%+v: expected select statements %v, but got %v", test.filter, test.exp, stmts)
+		}
+	}
+}
+
+func TestTypeSwitchFilter(t *testing.T) {
+	file := parseTestFile(t, stmtTestSrc)
+
+	testcases := []struct {
+		filter TypeSwitchFilter
+		exp    []string
+	}{
+		{TypeSwitchFilter{}, []string{"*Circle, *Square, *Rect", "*Circle, default"}},
+		{TypeSwitchFilter{Default: WithoutDefault}, []string{"*Circle, *Square, *Rect"}},
+		{TypeSwitchFilter{CaseTypes: []string{"*Circle", "*Rect"}}, []string{"*Circle, *Square, *Rect"}},
+		{TypeSwitchFilter{CaseTypes: []string{"*Circle"}, MissingTypes: []string{"*Square", "*Rect"}}, []string{"*Circle, default"}},
+		{TypeSwitchFilter{Default: WithDefault, CaseTypes: []string{"*Square"}}, nil},
+	}
+	for _, test := range testcases {
+		var stmts []string
+		for _, stmt := range Find([]ast.Node{file}, test.filter) {
+			var cases []string
+			for _, clause := range stmt.(*ast.TypeSwitchStmt).Body.List {
+				list := clause.(*ast.CaseClause).List
+				if list == nil {
+					cases = append(cases, "default")
+				}
+				for _, typ := range list {
+					cases = append(cases, types.ExprString(typ))
+				}
+			}
+			stmts = append(stmts, strings.Join(cases, ", "))
+		}
+		if !reflect.DeepEqual(stmts, test.exp) {
+			t.Errorf("%+v: expected type switches %v, but got %v", test.filter, test.exp, stmts)
+		}
+	}
+}
+
+func TestLoopVarCapture(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+func f(field, redeclared, key, inner, param, indexed, later []int) {
+	for i := range field {
+		go func() { log.Print(cfg.i) }()
+	}
+	for i := range redeclared {
+		go func() { i := 0; log.Print(i) }()
+	}
+	for i := range key {
+		go func() { log.Print(T{i: 1}) }()
+	}
+	for i := range inner {
+		go func() {
+			for i := range inner {
+				log.Print(i)
+			}
+		}()
+	}
+	for i := range param {
+		go func(i int) { log.Print(i) }(i)
+	}
+	for i := range indexed {
+		go func() { log.Print(m[i]) }()
+	}
+	for i := range later {
+		go func() { log.Print(i); i := 2; _ = i }()
+	}
+}
+`)
+	var goroutines, ranges []string
+	for _, stmt := range Find([]ast.Node{file}, GoStmtFilter{CapturesLoopVar: true}) {
+		goroutines = append(goroutines, nodeSource(t, stmt.(*ast.GoStmt).Call.Fun))
+	}
+	for _, stmt := range Find([]ast.Node{file}, RangeStmtFilter{GoroutineCapture: true}) {
+		ranges = append(ranges, types.ExprString(stmt.(*ast.RangeStmt).X))
+	}
+	if exp := []string{"func() { log.Print(m[i]) }", "func() { log.Print(i) i := 2 _ = i }"}; !reflect.DeepEqual(goroutines, exp) {
+		t.Errorf("expected goroutines %v, but got %v", exp, goroutines)
+	}
+	if exp := []string{"indexed", "later"}; !reflect.DeepEqual(ranges, exp) {
+		t.Errorf("expected range statements over %v, but got %v", exp, ranges)
+	}
+}
+
+func TestRangeStmtFilter(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+var registry = map[string]Handler{}
+
+func serveAll(conns []net.Conn, events <-chan Event) {
+	for _, c := range conns {
+		go func() { c.Close() }()
+	}
+	for name := range registry {
+		log.Print(name)
+	}
+	for e := range events {
+		handle(e)
+	}
+	for i := range [3]int{} {
+		go worker(i)
+	}
+	counts := map[string]int{}
+	for k, v := range counts {
+		go func(k string, v int) { log.Print(k, v) }(k, v)
+	}
+}
+
+func dedupe(ids []int) {
+	if len(ids) > 1 {
+		for _, id := range ids {
+			log.Print(id)
+		}
+		ids := map[int]bool{}
+		log.Print(ids)
+	}
+}
+`)
+
+	testcases := []struct {
+		filter RangeStmtFilter
+		exp    []string
+	}{
+		{RangeStmtFilter{Over: SliceRange}, []string{"conns", "[3]int{}", "ids"}},
+		{RangeStmtFilter{Over: MapRange}, []string{"registry", "counts"}},
+		{RangeStmtFilter{Over: ChanRange}, []string{"events"}},
+		{RangeStmtFilter{X: regexp.MustCompile(`^c`)}, []string{"conns", "counts"}},
+		{RangeStmtFilter{GoroutineCapture: true}, []string{"conns"}},
+	}
+	for _, test := range testcases {
+		var xs []string
+		for _, stmt := range Find([]ast.Node{file}, test.filter) {
+			xs = append(xs, types.ExprString(stmt.(*ast.RangeStmt).X))
+		}
+		if !reflect.DeepEqual(xs, test.exp) {
+			t.Errorf("%+v: expected range statements over %v, but got %v", test.filter, test.exp, xs)
+		}
+	}
+}
+
+func TestLabelFilters(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+func search(grid [][]int, target int) bool {
+outer:
+	for _, row := range grid {
+		for _, v := range row {
+			if v < 0 {
+				continue outer
+			}
+			if v == target {
+				break outer
+			}
+			if v == 0 {
+				break
+			}
+		}
+	}
+	goto done
+done:
+	return false
+}
+`)
+
+	var labels []string
+	for _, stmt := range Find([]ast.Node{file}, LabeledStmtFilter{}) {
+		labels = append(labels, stmt.(*ast.LabeledStmt).Label.Name)
+	}
+	if exp := []string{"outer", "done"}; !reflect.DeepEqual(labels, exp) {
+		t.Errorf("expected labels %v, but got %v", exp, labels)
+	}
+
+	testcases := []struct {
+		filter BranchStmtFilter
+		exp    []string
+	}{
+		{BranchStmtFilter{}, []string{"continue outer", "break outer", "break", "goto done"}},
+		{BranchStmtFilter{Tok: token.BREAK}, []string{"break outer", "break"}},
+		{BranchStmtFilter{LabeledOnly: true}, []string{"continue outer", "break outer", "goto done"}},
+		{BranchStmtFilter{Pattern: regexp.MustCompile(`^outer$`)}, []string{"continue outer", "break outer"}},
+		{BranchStmtFilter{Tok: token.GOTO, Pattern: regexp.MustCompile(`^outer$`)}, nil},
+	}
+	for _, test := range testcases {
+		var stmts []string
+		for _, stmt := range Find([]ast.Node{file}, test.filter) {
+			stmts = append(stmts, nodeSource(t, stmt))
+		}
+		if !reflect.DeepEqual(stmts, test.exp) {
+			t.Errorf("%+v: expected branch statements %v, but got %v", test.filter, test.exp, stmts)
+		}
+	}
+}
+
+func TestReturnStmtFilter(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+func parse(s string) (n int, err error) {
+	if s == "" {
+		return 0, errors.New("empty")
+	}
+	n, err = strconv.Atoi(s)
+	check := func() (ok bool) {
+		return
+	}
+	check()
+	return
+}
+
+func find(key string) (*Item, error) {
+	if key == "" {
+		return nil, nil
+	}
+	return lookup(key), nil
+}
+
+func reset() {
+	return
+}
+`)
+
+	testcases := []struct {
+		filter ReturnStmtFilter
+		exp    []string
+	}{
+		{ReturnStmtFilter{Naked: true}, []string{"return", "return"}},
+		{ReturnStmtFilter{Nil: true}, []string{"return nil, nil", "return lookup(key), nil"}},
+		{ReturnStmtFilter{Result: regexp.MustCompile(`^errors\.New\(`)}, []string{"return 0, errors.New(\"empty\")"}},
+		{ReturnStmtFilter{Result: regexp.MustCompile(`^lookup\(`), Nil: true}, []string{"return lookup(key), nil"}},
+	}
+	for _, test := range testcases {
+		var stmts []string
+		for _, stmt := range Find([]ast.Node{file}, test.filter) {
+			stmts = append(stmts, nodeSource(t, stmt))
+		}
+		if !reflect.DeepEqual(stmts, test.exp) {
+			t.Errorf("%+v: expected return statements %v, but got %v", test.filter, test.exp, stmts)
+		}
+	}
+
+	// The naked return in reset doesn't count because reset has no named results.
+	naked := Find([]ast.Node{file.Decls[2]}, ReturnStmtFilter{Naked: true})
+	if len(naked) != 0 {
+		t.Errorf("expected no naked returns in a function without results, but got %d", len(naked))
+	}
+}
+
+func TestAssignmentFilter(t *testing.T) {
+	file := parseTestFile(t, `package p
+
+var config *Config
+
+func setup() {
+	config = loadConfig()
+	total := 0
+	total += 5
+	srv := &Server{Addr: ":80"}
+	srv.handler, config = nil, &Config{}
+	name := "default"
+	_ = name
+}
+`)
+
+	testcases := []struct {
+		filter AssignmentFilter
+		exp    []string
+	}{
+		{AssignmentFilter{LHS: regexp.MustCompile(`^config$`)}, []string{"config = loadConfig()", "srv.handler, config = nil, &Config{}"}},
+		{AssignmentFilter{Tok: token.DEFINE}, []string{"total := 0", "srv := &Server{Addr: \":80\"}", "name := \"default\""}},
+		{AssignmentFilter{Tok: token.ADD_ASSIGN}, []string{"total += 5"}},
+		{AssignmentFilter{RHS: CompositeShape}, []string{"srv := &Server{Addr: \":80\"}", "srv.handler, config = nil, &Config{}"}},
+		{AssignmentFilter{RHS: CallShape}, []string{"config = loadConfig()"}},
+		{AssignmentFilter{Tok: token.ASSIGN, RHS: LiteralShape}, nil},
+		{AssignmentFilter{RHS: NilShape}, []string{"srv.handler, config = nil, &Config{}"}},
+	}
+	for _, test := range testcases {
+		var stmts []string
+		for _, stmt := range Find([]ast.Node{file}, test.filter) {
+			stmts = append(stmts, nodeSource(t, stmt))
+		}
+		if !reflect.DeepEqual(stmts, test.exp) {
+			t.Errorf("%+v: expected assignments %v, but got %v", test.filter, test.exp, stmts)
+		}
+	}
+}
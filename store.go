@@ -0,0 +1,459 @@
+package astquery
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store loads packages as Load does, caching the parsed files and type information so
+// that loading packages again only parses the files whose contents have changed and only
+// type-checks the packages affected by the changes. It suits long-running tools that
+// query the same code repeatedly. A Store is safe for concurrent use.
+//
+// All the packages loaded by a Store share its file set, which grows with every file
+// parsed. Dependencies imported from export data are imported once and assumed not to
+// change.
+type Store struct {
+	opts LoadOptions
+
+	mu             sync.Mutex // held during loads
+	fset           *token.FileSet
+	files          fileCache
+	typed          map[string]cachedTypes // by import path
+	exports        map[string]string      // export data files by import path
+	exportImporter types.Importer
+
+	// loaded and pkgs are the packages of the last load, as listed and as built.
+	loaded []loadedPackage
+	pkgs   []*Package
+}
+
+// loadedPackage is a package of the last load, as listed by the go command.
+type loadedPackage struct {
+	pkg       *Package // without files, errors or type information
+	listErr   error
+	filenames []string // sorted
+	importMap map[string]string
+	cgo       bool
+}
+
+// cachedTypes is the cached type information of a package.
+type cachedTypes struct {
+	typed *TypedPackage
+
+	// files and imports are the files and imported packages it was checked with.
+	files   []*ast.File
+	imports map[string]*types.Package
+}
+
+// NewStore returns an empty store that loads packages with the given options. If opts is
+// nil, packages are loaded as by Load with nil options.
+func NewStore(opts *LoadOptions) *Store {
+	s := &Store{
+		fset:    token.NewFileSet(),
+		files:   fileCache{files: make(map[string]cachedFile)},
+		typed:   make(map[string]cachedTypes),
+		exports: make(map[string]string),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	s.exportImporter = exportDataImporter(s.fset, s.exports)
+	return s
+}
+
+// exportDataImporter returns an importer of packages from the export data files listed,
+// by import path, in exports.
+func exportDataImporter(fset *token.FileSet, exports map[string]string) types.Importer {
+	return importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		export, exists := exports[path]
+		if !exists || export == "" {
+			return nil, fmt.Errorf("no export data for %q", path)
+		}
+		return os.Open(export)
+	})
+}
+
+// Load loads the packages matching the patterns, as Load does. Files and type
+// information that are still up to date are reused from previous loads.
+func (s *Store) Load(patterns ...string) ([]*Package, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.opts.validate(); err != nil {
+		return nil, err
+	}
+	overlay, err := absOverlay(&s.opts)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := goList(&s.opts, overlay, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lp := range listed {
+		if _, exists := s.exports[lp.ImportPath]; !exists {
+			s.exports[lp.ImportPath] = lp.Export
+		}
+	}
+	loaded, err := loadedPackages(&s.opts, s.fset, listed)
+	if err != nil {
+		return nil, err
+	}
+	return s.build(loaded, overlay), nil
+}
+
+// loadedPackages returns the packages to load, with opts, of the packages listed by the go
+// command. Their packages are given the file set fset.
+func loadedPackages(opts *LoadOptions, fset *token.FileSet, listed []listedPackage) ([]loadedPackage, error) {
+	base, err := filepath.Abs(opts.Dir) // for scoping with Include and Exclude
+	if err != nil {
+		return nil, err
+	}
+	var loaded []loadedPackage
+	depths := importDepths(listed)
+	for _, lp := range listed {
+		if lp.ForTest != "" || strings.HasSuffix(lp.ImportPath, ".test") {
+			continue // test variant
+		}
+		if depth, reached := depths[lp.ImportPath]; lp.DepOnly && !(reached && opts.loadsDepth(depth)) {
+			continue // dependency that is not to be loaded
+		}
+		if lp.excluded(opts) {
+			continue
+		}
+		l := loadedPackage{
+			pkg:       &Package{ImportPath: lp.ImportPath, Name: lp.Name, Dir: lp.Dir, Standard: lp.Standard, Fset: fset},
+			importMap: lp.ImportMap,
+			cgo:       len(lp.CgoFiles) > 0,
+		}
+		if lp.Error != nil {
+			l.listErr = errors.New(lp.Error.Err)
+		}
+		names := append(lp.GoFiles[:len(lp.GoFiles):len(lp.GoFiles)], lp.CgoFiles...)
+		if opts.AllFiles {
+			names = append(names[:len(names):len(names)], lp.IgnoredGoFiles...)
+		}
+		if opts.Tests {
+			names = append(names[:len(names):len(names)], lp.TestGoFiles...)
+		}
+		if scoped := opts.scope(base, lp.Dir, names); len(scoped) > 0 || len(names) == 0 {
+			l.filenames = joinSorted(lp.Dir, scoped)
+			loaded = append(loaded, l)
+		}
+
+		if xtestNames := opts.scope(base, lp.Dir, lp.XTestGoFiles); opts.Tests && len(xtestNames) > 0 {
+			loaded = append(loaded, loadedPackage{
+				pkg:       &Package{ImportPath: lp.ImportPath + "_test", Name: lp.Name + "_test", Dir: lp.Dir, Fset: fset},
+				filenames: joinSorted(lp.Dir, xtestNames),
+				importMap: lp.ImportMap,
+			})
+		}
+	}
+	return loaded, nil
+}
+
+// joinSorted returns the paths of the named files in dir, sorted.
+func joinSorted(dir string, names []string) []string {
+	filenames := make([]string, len(names))
+	for i, name := range names {
+		filenames[i] = filepath.Join(dir, name)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+// parseJobs returns the jobs to parse the files of l into pkg.
+func (l loadedPackage) parseJobs(pkg *Package, overlay map[string][]byte) []*parseJob {
+	jobs := make([]*parseJob, len(l.filenames))
+	for i, filename := range l.filenames {
+		jobs[i] = &parseJob{pkg: pkg, filename: filename}
+		if contents, exists := overlay[filename]; exists {
+			jobs[i].src = contents
+		}
+	}
+	return jobs
+}
+
+// build parses and type-checks the listed packages, reusing the files and type
+// information that are still up to date, and records them as the last load.
+func (s *Store) build(loaded []loadedPackage, overlay map[string][]byte) []*Package {
+	pkgs := make([]*Package, len(loaded))
+	var jobs []*parseJob
+	for i, l := range loaded {
+		pkg := *l.pkg
+		pkgs[i] = &pkg
+		if l.listErr != nil {
+			pkg.Errors = append(pkg.Errors, l.listErr)
+		}
+		jobs = append(jobs, l.parseJobs(&pkg, overlay)...)
+	}
+
+	parseFiles(s.fset, jobs, &s.opts, &s.files)
+	addParsed(&s.opts, s.fset, jobs)
+
+	if s.opts.Types {
+		// go list -deps lists dependencies first, so the loaded packages a package imports
+		// are checked before it. External test packages can import any package, so they
+		// are checked last.
+		checked := make(map[string]*types.Package)
+		for _, xtests := range []bool{false, true} {
+			for i, pkg := range pkgs {
+				if len(pkg.Files) > 0 && isXTest(pkg) == xtests {
+					pkg.Typed = s.typeCheck(pkg, loaded[i].importMap, loaded[i].cgo, checked)
+					checked[pkg.ImportPath] = pkg.Typed.Pkg
+				}
+			}
+		}
+	}
+	s.loaded, s.pkgs = loaded, pkgs
+	return pkgs
+}
+
+// addParsed adds the files parsed by jobs, and their errors, to the jobs' packages.
+func addParsed(opts *LoadOptions, fset *token.FileSet, jobs []*parseJob) {
+	for _, job := range jobs {
+		keep, errs := opts.keep(job)
+		job.pkg.Errors = append(job.pkg.Errors, errs...)
+		if keep {
+			job.pkg.Files = append(job.pkg.Files, job.file)
+			if opts.GoVersion != "" {
+				job.pkg.Errors = append(job.pkg.Errors, checkSyntaxVersion(fset, job.file, opts.GoVersion)...)
+			}
+		}
+	}
+}
+
+// UpdateFile replaces the contents of a file of the packages of the last load, as if the
+// file had been changed to contents, and returns the packages of the last load updated
+// accordingly. Only that file is parsed again, and only its package and the loaded
+// packages that depend on it are type-checked again; the other packages are shared with
+// the last load. The contents are kept, as an entry of LoadOptions.Overlay would be, for
+// later loads. The go command is not run, so changes to the file's imports that need
+// packages that were not loaded call for a new Load.
+func (s *Store) UpdateFile(filename string, contents []byte) ([]*Package, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(s.opts.Dir, filename)
+	}
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, l := range s.loaded {
+		i := sort.SearchStrings(l.filenames, filename)
+		found = found || (i < len(l.filenames) && l.filenames[i] == filename)
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not a file of a loaded package", filename)
+	}
+
+	overlay, err := absOverlay(&s.opts) // a copy, as the options' map is the caller's
+	if err != nil {
+		return nil, err
+	}
+	if overlay == nil {
+		overlay = make(map[string][]byte)
+	}
+	overlay[filename] = contents
+	s.opts.Overlay = overlay
+	return s.build(s.loaded, overlay), nil
+}
+
+// StoreQuery is a query of the packages of a store's last load. Its matches are cached by
+// file, so running it again after a Load or UpdateFile only searches the files that were
+// parsed again, and for typed queries, the files of the packages that were type-checked
+// again. A StoreQuery is safe for concurrent use.
+type StoreQuery struct {
+	store *Store
+	find  func(pkg *Package, file *ast.File) []Match
+	typed bool
+
+	mu    sync.Mutex
+	cache map[queryKey][]Match
+}
+
+// queryKey identifies a file as searched by a query.
+type queryKey struct {
+	file  *ast.File
+	typed *TypedPackage // nil for untyped queries
+}
+
+// NewQuery returns a query for the nodes matching filter.
+func (s *Store) NewQuery(filter Filter) *StoreQuery {
+	return &StoreQuery{
+		store: s,
+		find: func(pkg *Package, file *ast.File) []Match {
+			return pkg.matches(Find([]ast.Node{file}, filter))
+		},
+		cache: make(map[queryKey][]Match),
+	}
+}
+
+// NewTypedQuery is like NewQuery for a typed filter. Packages loaded without type
+// information are skipped.
+func (s *Store) NewTypedQuery(filter TypedFilter) *StoreQuery {
+	return &StoreQuery{
+		store: s,
+		find: func(pkg *Package, file *ast.File) []Match {
+			return pkg.matches(Find([]ast.Node{file}, pkg.Typed.Bind(filter)))
+		},
+		typed: true,
+		cache: make(map[queryKey][]Match),
+	}
+}
+
+// Find returns the matches of the query in the packages of the store's last load, in the
+// order of the packages.
+func (q *StoreQuery) Find() []Match {
+	q.store.mu.Lock()
+	pkgs := q.store.pkgs
+	q.store.mu.Unlock()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cache := make(map[queryKey][]Match)
+	var matches []Match
+	for _, pkg := range pkgs {
+		if q.typed && pkg.Typed == nil {
+			continue
+		}
+		for _, file := range pkg.Files {
+			key := queryKey{file: file}
+			if q.typed {
+				key.typed = pkg.Typed
+			}
+			found, cached := q.cache[key]
+			if !cached {
+				found = q.find(pkg, file)
+			}
+			cache[key] = found
+			for _, m := range found {
+				m.Pkg = pkg // the file may have been cached with an earlier load's package
+				matches = append(matches, m)
+			}
+		}
+	}
+	q.cache = cache
+	return matches
+}
+
+// isXTest reports whether pkg is an external test package, whose files are in another
+// package's directory.
+func isXTest(pkg *Package) bool {
+	return strings.HasSuffix(pkg.Name, "_test")
+}
+
+// typeCheck returns the type information of pkg, reusing the cached information if pkg's
+// files and imports haven't changed since it was checked. checked holds the packages of
+// the current load that have been checked. For packages using cgo, references to
+// package C are not checked.
+func (s *Store) typeCheck(pkg *Package, importMap map[string]string, cgo bool, checked map[string]*types.Package) *TypedPackage {
+	resolve := func(path string) (*types.Package, error) {
+		if mapped, exists := importMap[path]; exists {
+			path = mapped
+		}
+		if typesPkg, exists := checked[path]; exists {
+			return typesPkg, nil
+		}
+		return s.exportImporter.Import(path)
+	}
+
+	if cached, exists := s.typed[pkg.ImportPath]; exists && sameFiles(cached.files, pkg.Files) {
+		upToDate := true
+		for path, imported := range cached.imports {
+			if current, err := resolve(path); err != nil || current != imported {
+				upToDate = false
+				break
+			}
+		}
+		if upToDate {
+			return cached.typed
+		}
+	}
+
+	imports := make(map[string]*types.Package)
+	typed, _ := NewTypedPackage(pkg.ImportPath, s.fset, pkg.Files, &types.Config{
+		FakeImportC:      cgo,
+		GoVersion:        s.opts.GoVersion,
+		IgnoreFuncBodies: s.opts.DeclsOnly,
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			typesPkg, err := resolve(path)
+			if err == nil {
+				imports[path] = typesPkg
+			}
+			return typesPkg, err
+		}),
+	})
+	s.typed[pkg.ImportPath] = cachedTypes{typed: typed, files: pkg.Files, imports: imports}
+	return typed
+}
+
+// sameFiles reports whether a and b hold the same files in the same order.
+func sameFiles(a, b []*ast.File) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fileCache caches parsed files by name and content hash.
+type fileCache struct {
+	mu    sync.Mutex
+	files map[string]cachedFile
+}
+
+// cachedFile is a parsed file and the hash of the contents it was parsed from.
+type cachedFile struct {
+	hash [sha256.Size]byte
+	file *ast.File
+	err  error
+}
+
+// parse parses the file of job, or sets job's results from the cache if the file hasn't
+// changed.
+func (c *fileCache) parse(fset *token.FileSet, job *parseJob, opts *LoadOptions) {
+	var src []byte
+	if contents, isBytes := job.src.([]byte); isBytes {
+		src = contents
+	} else if job.src != nil {
+		job.err = fmt.Errorf("%s: unsupported source type %T", job.filename, job.src)
+		return
+	} else if src, job.err = os.ReadFile(job.filename); job.err != nil {
+		return
+	}
+	hash := sha256.Sum256(src)
+
+	c.mu.Lock()
+	cached, exists := c.files[job.filename]
+	c.mu.Unlock()
+	if exists && cached.hash == hash {
+		job.file, job.err = cached.file, cached.err
+		return
+	}
+
+	job.file, job.err = opts.parseFile(fset, job.filename, src)
+	c.mu.Lock()
+	c.files[job.filename] = cachedFile{hash: hash, file: job.file, err: job.err}
+	c.mu.Unlock()
+}
@@ -0,0 +1,152 @@
+package astquery
+
+import (
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":       "module example.com/m\n\ngo 1.21\n",
+		"app/app.go":   "package app\n\nimport \"example.com/m/lib\"\n\nvar Greeting = lib.Greet()\n",
+		"lib/lib.go":   "package lib\n\nfunc Greet() string { return \"hi\" }\n",
+		"util/util.go": "package util\n\nfunc Max(a, b int) int { return a }\n",
+	})
+	store := NewStore(&LoadOptions{
+		Dir:   dir,
+		Env:   append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod"),
+		Types: true,
+	})
+	load := func() map[string]*Package {
+		pkgs, err := store.Load("./...")
+		if err != nil {
+			t.Fatal(err)
+		}
+		byPath := make(map[string]*Package)
+		for _, pkg := range pkgs {
+			if pkg.Typed == nil || len(pkg.Typed.Errors) != 0 {
+				t.Fatalf("expected %s to type-check, but got %+v", pkg.ImportPath, pkg.Typed)
+			}
+			byPath[pkg.ImportPath] = pkg
+		}
+		return byPath
+	}
+
+	first := load()
+	second := load()
+	for path, pkg := range first {
+		if second[path].Files[0] != pkg.Files[0] || second[path].Typed != pkg.Typed {
+			t.Errorf("%s: expected unchanged package to be reused", path)
+		}
+	}
+
+	// Changing lib re-checks lib and app, which imports it, but not util.
+	if err := os.WriteFile(filepath.Join(dir, "lib", "lib.go"), []byte("package lib\n\nfunc Greet() string { return \"hello\" }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	third := load()
+	if third["example.com/m/lib"].Files[0] == second["example.com/m/lib"].Files[0] {
+		t.Errorf("expected changed file to be parsed again")
+	}
+	if third["example.com/m/app"].Files[0] != second["example.com/m/app"].Files[0] {
+		t.Errorf("expected unchanged file to be reused")
+	}
+	for path, rechecked := range map[string]bool{"example.com/m/lib": true, "example.com/m/app": true, "example.com/m/util": false} {
+		if got := third[path].Typed != second[path].Typed; got != rechecked {
+			t.Errorf("%s: expected re-checked to be %v, but got %v", path, rechecked, got)
+		}
+	}
+	app := third["example.com/m/app"].Typed
+	if calls := app.FindTyped(CallFilter{PkgPath: "example.com/m/lib", Name: "Greet"}); len(calls) != 1 ||
+		calleeFunc(calls[0].(*ast.CallExpr), app.Info) != third["example.com/m/lib"].Typed.Pkg.Scope().Lookup("Greet") {
+		t.Errorf("expected app to refer to the re-checked lib")
+	}
+}
+
+func TestStoreUpdateFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":       "module example.com/m\n\ngo 1.21\n",
+		"app/app.go":   "package app\n\nimport \"example.com/m/lib\"\n\nvar Greeting = lib.Greet()\n",
+		"lib/lib.go":   "package lib\n\nfunc Greet() string { return \"hi\" }\n",
+		"util/util.go": "package util\n\nfunc Max(a, b int) int { return a }\n",
+	})
+	store := NewStore(&LoadOptions{
+		Dir:   dir,
+		Env:   append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod"),
+		Types: true,
+	})
+	before, err := store.Load("./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The queries record the files they search.
+	var searched []string
+	funcs := store.NewQuery(FilterFunc(func(node ast.Node) bool {
+		if file, isFile := node.(*ast.File); isFile {
+			searched = append(searched, filepath.Base(store.fset.Position(file.Pos()).Filename))
+		}
+		_, isFunc := node.(*ast.FuncDecl)
+		return isFunc
+	}))
+	calls := store.NewTypedQuery(TypedFilterFunc(func(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+		if file, isFile := node.(*ast.File); isFile {
+			searched = append(searched, "typed "+filepath.Base(pkg.Fset.Position(file.Pos()).Filename))
+		}
+		return CallFilter{PkgPath: "example.com/m/lib", Name: "Greet"}.FilterTyped(node, ancestors, pkg)
+	}))
+	run := func() (funcNames, callNames []string) {
+		searched = nil
+		for _, m := range funcs.Find() {
+			funcNames = append(funcNames, m.Node.(*ast.FuncDecl).Name.Name)
+		}
+		for _, m := range calls.Find() {
+			callNames = append(callNames, nodeSource(t, m.Node))
+		}
+		return funcNames, callNames
+	}
+	run()
+	if exp := []string{"lib.go", "app.go", "util.go", "typed lib.go", "typed app.go", "typed util.go"}; !reflect.DeepEqual(searched, exp) {
+		t.Errorf("expected the first run to search %v, but got %v", exp, searched)
+	}
+
+	after, err := store.UpdateFile(filepath.Join("lib", "lib.go"), []byte("package lib\n\nfunc Greet() string { return \"hello\" }\n\nfunc Wave() {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pkg := range after {
+		changed := pkg.ImportPath == "example.com/m/lib"
+		if got := pkg.Files[0] != before[i].Files[0]; got != changed {
+			t.Errorf("%s: expected file reparsed to be %v, but got %v", pkg.ImportPath, changed, got)
+		}
+	}
+	funcNames, callNames := run()
+	if exp := []string{"Greet", "Wave", "Max"}; !reflect.DeepEqual(funcNames, exp) {
+		t.Errorf("expected funcs %v, but got %v", exp, funcNames)
+	}
+	if exp := []string{"lib.Greet()"}; !reflect.DeepEqual(callNames, exp) {
+		t.Errorf("expected calls %v, but got %v", exp, callNames)
+	}
+	// Only lib.go was parsed again, and app was type-checked again as it imports lib.
+	if exp := []string{"lib.go", "typed lib.go", "typed app.go"}; !reflect.DeepEqual(searched, exp) {
+		t.Errorf("expected the second run to search %v, but got %v", exp, searched)
+	}
+
+	// The update is kept for later loads.
+	pkgs, err := store.Load("./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkgs[0].ImportPath != "example.com/m/lib" || pkgs[0].Files[0] != after[0].Files[0] {
+		t.Errorf("expected the updated file to be reused by Load")
+	}
+
+	if _, err := store.UpdateFile(filepath.Join(dir, "go.mod"), nil); err == nil {
+		t.Errorf("expected an error for a file that is not part of a loaded package")
+	}
+}
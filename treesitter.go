@@ -0,0 +1,774 @@
+package astquery
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TreeSitterQuery is a compiled query in the S-expression syntax of tree-sitter, with the
+// node kinds and field names of the tree-sitter Go grammar mapped onto go/ast:
+//
+//	(function_declaration name: (identifier) @fn)
+//
+// A query holds one or more patterns, and matches the nodes that any of them matches. A
+// pattern "(kind ...)" matches the nodes of the kind, such as call_expression for a
+// CallExpr, whose fields, written "field: pattern", match their patterns, and whose
+// children match the other patterns in the parentheses, in order. "(_)" and "_" match
+// any node, "!field" matches nodes without the field, and "[pattern ...]" matches the
+// nodes that one of the patterns matches. A pattern followed by "@name" captures the
+// node it matches, and the captures are reported as bindings, by name without the '@'.
+// The predicates #eq?, #not-eq?, #match? and #not-match? compare the text of a capture,
+// which is the name of an identifier, the value of a literal or otherwise the node's
+// formatted source, to a string or another capture's text, and apply to the top-level
+// pattern holding them:
+//
+//	((call_expression function: (identifier) @f) (#match? @f "^must"))
+//
+// All the identifier kinds, such as type_identifier and field_identifier, match any
+// identifier, and the kinds of fields, such as field_declaration and
+// parameter_declaration, match any Field. Fields holding lists, such as a call's
+// arguments, hold a NodeList. Anonymous nodes and quantifiers are not supported. A
+// TreeSitterQuery is a Filter.
+type TreeSitterQuery struct {
+	src      string
+	patterns []*tsPattern
+}
+
+// tsPattern is a pattern of a tree-sitter query.
+type tsPattern struct {
+	kind     string // "" for '_'
+	fields   []tsField
+	children []*tsPattern
+	alts     []*tsPattern // of an alternation
+	captures []string
+
+	// predicates are those held by the pattern, for a top-level pattern of a query.
+	predicates []tsPredicate
+}
+
+// tsField is a field of a pattern, which matches if the field has a node matching the
+// pattern or, if negated, if the field is empty.
+type tsField struct {
+	name    string
+	pattern *tsPattern
+	negated bool
+}
+
+// tsPredicate is a predicate comparing a capture's text to a string or capture.
+type tsPredicate struct {
+	name    string
+	capture string
+	other   string // the other capture, for #eq?
+	value   string
+	re      *regexp.Regexp
+}
+
+// tsKind describes a tree-sitter node kind: the nodes it matches and its fields.
+type tsKind struct {
+	match  func(node ast.Node) bool
+	fields map[string]func(node ast.Node) []ast.Node
+}
+
+// CompileTreeSitter compiles a tree-sitter query.
+func CompileTreeSitter(src string) (*TreeSitterQuery, error) {
+	p := &tsParser{src: src}
+	q := &TreeSitterQuery{src: src}
+	for p.skipSpace(); p.pos < len(src); p.skipSpace() {
+		var predicates []tsPredicate
+		pattern, err := p.pattern(&predicates)
+		if err != nil {
+			return nil, queryError(TreeSitterLanguage, src, err)
+		}
+		pattern.predicates = predicates
+		q.patterns = append(q.patterns, pattern)
+	}
+	if len(q.patterns) == 0 {
+		return nil, queryError(TreeSitterLanguage, src, p.errorf("empty query"))
+	}
+	return q, nil
+}
+
+// MustCompileTreeSitter is like CompileTreeSitter but panics if the query cannot be
+// compiled.
+func MustCompileTreeSitter(src string) *TreeSitterQuery {
+	q, err := CompileTreeSitter(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the source of the query.
+func (q *TreeSitterQuery) String() string { return q.src }
+
+func (q *TreeSitterQuery) Filter(node ast.Node) bool {
+	_, ok := q.Match(node)
+	return ok
+}
+
+// Match reports whether node matches the query and, if it does, the captured nodes.
+func (q *TreeSitterQuery) Match(node ast.Node) (bindings map[string]ast.Node, ok bool) {
+	for _, pattern := range q.patterns {
+		m := &tsMatcher{bindings: make(map[string]ast.Node)}
+		if m.match(pattern, node) && m.satisfies(pattern.predicates) {
+			return m.bindings, true
+		}
+	}
+	return nil, false
+}
+
+// Find searches nodes like Find, returning the matches with their captures.
+func (q *TreeSitterQuery) Find(nodes []ast.Node) []PatternMatch {
+	var matches []PatternMatch
+	for _, node := range Find(nodes, q) {
+		bindings, _ := q.Match(node)
+		matches = append(matches, PatternMatch{Node: node, Bindings: bindings})
+	}
+	return matches
+}
+
+// tsMatcher matches patterns against nodes, recording the captures. Like
+// patternMatcher's, the bindings are replaced rather than modified.
+type tsMatcher struct {
+	bindings map[string]ast.Node
+}
+
+// match reports whether node matches p, and captures it if it does.
+func (m *tsMatcher) match(p *tsPattern, node ast.Node) bool {
+	saved := m.bindings
+	if !m.matchNode(p, node) {
+		m.bindings = saved
+		return false
+	}
+	if len(p.captures) > 0 {
+		bindings := make(map[string]ast.Node, len(m.bindings)+len(p.captures))
+		for name, bound := range m.bindings {
+			bindings[name] = bound
+		}
+		for _, name := range p.captures {
+			bindings[name] = node
+		}
+		m.bindings = bindings
+	}
+	return true
+}
+
+func (m *tsMatcher) matchNode(p *tsPattern, node ast.Node) bool {
+	if p.alts != nil {
+		for _, alt := range p.alts {
+			if m.match(alt, node) {
+				return true
+			}
+		}
+		return false
+	}
+	if p.kind == "" || p.kind == "_" {
+		return len(p.children) == 0 || m.matchChildren(p.children, tsChildren(node))
+	}
+	kind := tsKinds[p.kind]
+	if !kind.match(node) {
+		return false
+	}
+	for _, field := range p.fields {
+		nodes := kind.fields[field.name](node)
+		if field.negated {
+			if len(nodes) > 0 {
+				return false
+			}
+			continue
+		}
+		matched := false
+		for _, n := range nodes {
+			if m.match(field.pattern, n) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return m.matchChildren(p.children, tsChildren(node))
+}
+
+// matchChildren reports whether the patterns match distinct nodes of children, in order.
+func (m *tsMatcher) matchChildren(patterns []*tsPattern, children []ast.Node) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for i, child := range children {
+		saved := m.bindings
+		if m.match(patterns[0], child) && m.matchChildren(patterns[1:], children[i+1:]) {
+			return true
+		}
+		m.bindings = saved
+	}
+	return false
+}
+
+// satisfies reports whether the captures satisfy the predicates. Predicates on captures
+// that are not bound are ignored.
+func (m *tsMatcher) satisfies(predicates []tsPredicate) bool {
+	for _, pred := range predicates {
+		node, isBound := m.bindings[pred.capture]
+		if !isBound {
+			continue
+		}
+		text, value := tsNodeText(node), pred.value
+		if pred.other != "" {
+			other, isBound := m.bindings[pred.other]
+			if !isBound {
+				continue
+			}
+			value = tsNodeText(other)
+		}
+		var ok bool
+		switch pred.name {
+		case "eq?":
+			ok = text == value
+		case "not-eq?":
+			ok = text != value
+		case "match?":
+			ok = pred.re.MatchString(text)
+		case "not-match?":
+			ok = !pred.re.MatchString(text)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// tsNodeText returns the text of a node for predicates.
+func tsNodeText(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.Ident:
+		return node.Name
+	case *ast.BasicLit:
+		return node.Value
+	case NodeList:
+		elems := make([]string, len(node))
+		for i, elem := range node {
+			elems[i] = tsNodeText(elem)
+		}
+		return strings.Join(elems, ", ")
+	}
+	var buf bytes.Buffer
+	format.Node(&buf, token.NewFileSet(), node)
+	return buf.String()
+}
+
+// tsChildren returns the children of a node: the elements of a NodeList, or the nodes
+// directly below it.
+func tsChildren(node ast.Node) []ast.Node {
+	if list, isList := node.(NodeList); isList {
+		return list
+	}
+	var children []ast.Node
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == node {
+			return true
+		}
+		if n != nil {
+			children = append(children, n)
+		}
+		return false
+	})
+	return children
+}
+
+// tsParser parses a tree-sitter query.
+type tsParser struct {
+	src string
+	pos int
+}
+
+func (p *tsParser) errorf(format string, args ...interface{}) error {
+	return syntaxError(p.pos, format, args...)
+}
+
+func (p *tsParser) semanticf(format string, args ...interface{}) error {
+	return semanticError(p.pos, format, args...)
+}
+
+// skipSpace skips whitespace and comments, which run from ';' to the end of the line.
+func (p *tsParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ';':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case unicode.IsSpace(rune(c)):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *tsParser) consume(s string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// name parses a node kind, field, capture or predicate name.
+func (p *tsParser) name() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := rune(p.src[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("_-.?", c) {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// pattern parses a pattern, with its captures, adding the predicates it holds.
+func (p *tsParser) pattern(predicates *[]tsPredicate) (*tsPattern, error) {
+	p.skipSpace()
+	var pattern *tsPattern
+	var err error
+	switch {
+	case p.consume("["):
+		pattern = &tsPattern{}
+		for !p.consume("]") {
+			if p.pos == len(p.src) {
+				return nil, p.errorf("expected ']'")
+			}
+			alt, err := p.pattern(predicates)
+			if err != nil {
+				return nil, err
+			}
+			pattern.alts = append(pattern.alts, alt)
+		}
+	case p.consume("("):
+		if pattern, err = p.nodePattern(predicates); err != nil {
+			return nil, err
+		}
+	case p.consume("_"):
+		pattern = &tsPattern{}
+	case p.pos < len(p.src) && p.src[p.pos] == '"':
+		return nil, p.errorf("anonymous nodes are not supported")
+	default:
+		return nil, p.errorf("expected a pattern")
+	}
+	for p.consume("@") {
+		name := p.name()
+		if name == "" {
+			return nil, p.errorf("expected a capture name")
+		}
+		pattern.captures = append(pattern.captures, name)
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) && strings.ContainsRune("*+?", rune(p.src[p.pos])) {
+		return nil, p.errorf("quantifiers are not supported")
+	}
+	return pattern, nil
+}
+
+// nodePattern parses a node pattern, after its opening parenthesis.
+func (p *tsParser) nodePattern(predicates *[]tsPredicate) (*tsPattern, error) {
+	p.skipSpace()
+	start := p.pos
+	pattern := &tsPattern{kind: p.name()}
+	kind, known := tsKinds[pattern.kind]
+	switch {
+	case pattern.kind == "" && p.pos < len(p.src) && (p.src[p.pos] == '(' || p.src[p.pos] == '['):
+		return p.group(predicates)
+	case pattern.kind == "":
+		return nil, p.errorf("expected a node kind")
+	case pattern.kind != "_" && !known:
+		p.pos = start
+		return nil, p.semanticf("unknown node kind %q", pattern.kind)
+	}
+	for !p.consume(")") {
+		p.skipSpace()
+		start := p.pos
+		switch {
+		case p.pos == len(p.src):
+			return nil, p.errorf("expected ')'")
+		case p.consume("(#"):
+			pred, err := p.predicate()
+			if err != nil {
+				return nil, err
+			}
+			*predicates = append(*predicates, pred)
+			continue
+		case p.consume("!"):
+			field := tsField{name: p.name(), negated: true}
+			if kind.fields[field.name] == nil {
+				p.pos = start + 1
+				return nil, p.semanticf("unknown field %q of %s", field.name, pattern.kind)
+			}
+			pattern.fields = append(pattern.fields, field)
+			continue
+		}
+		if name := p.name(); name != "" && p.consume(":") {
+			if kind.fields[name] == nil {
+				p.pos = start
+				return nil, p.semanticf("unknown field %q of %s", name, pattern.kind)
+			}
+			child, err := p.pattern(predicates)
+			if err != nil {
+				return nil, err
+			}
+			pattern.fields = append(pattern.fields, tsField{name: name, pattern: child})
+			continue
+		}
+		p.pos = start
+		child, err := p.pattern(predicates)
+		if err != nil {
+			return nil, err
+		}
+		pattern.children = append(pattern.children, child)
+	}
+	return pattern, nil
+}
+
+// group parses a parenthesized pattern, which may be followed by predicates, after its
+// opening parenthesis.
+func (p *tsParser) group(predicates *[]tsPredicate) (*tsPattern, error) {
+	pattern, err := p.pattern(predicates)
+	if err != nil {
+		return nil, err
+	}
+	for !p.consume(")") {
+		switch {
+		case p.pos == len(p.src):
+			return nil, p.errorf("expected ')'")
+		case p.consume("(#"):
+			pred, err := p.predicate()
+			if err != nil {
+				return nil, err
+			}
+			*predicates = append(*predicates, pred)
+		default:
+			return nil, p.errorf("groups of several patterns are not supported")
+		}
+	}
+	return pattern, nil
+}
+
+// predicate parses a predicate, after its "(#".
+func (p *tsParser) predicate() (tsPredicate, error) {
+	start := p.pos
+	pred := tsPredicate{name: p.name()}
+	switch pred.name {
+	case "eq?", "not-eq?", "match?", "not-match?":
+	default:
+		p.pos = start
+		return pred, p.errorf("unsupported predicate #%s", pred.name)
+	}
+	if !p.consume("@") {
+		return pred, p.errorf("expected a capture")
+	}
+	pred.capture = p.name()
+	switch {
+	case p.consume("@"):
+		if strings.HasSuffix(pred.name, "match?") {
+			return pred, p.errorf("expected a string")
+		}
+		pred.other = p.name()
+	case p.consume(`"`):
+		p.pos--
+		end := p.pos + 1
+		for ; end < len(p.src) && p.src[end] != '"'; end++ {
+			if p.src[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(p.src) {
+			return pred, p.errorf("unterminated string")
+		}
+		value, err := strconv.Unquote(p.src[p.pos : end+1])
+		if err != nil {
+			return pred, p.errorf("invalid string %s", p.src[p.pos:end+1])
+		}
+		pred.value = value
+		if strings.HasSuffix(pred.name, "match?") {
+			if pred.re, err = regexp.Compile(value); err != nil {
+				return pred, p.semanticf("%v", err)
+			}
+		}
+		p.pos = end + 1
+	default:
+		return pred, p.errorf("expected a string or capture")
+	}
+	if !p.consume(")") {
+		return pred, p.errorf("expected ')'")
+	}
+	return pred, nil
+}
+
+// tsNodes returns the nodes that are not nil.
+func tsNodes(nodes ...ast.Node) []ast.Node {
+	var nonNil []ast.Node
+	for _, node := range nodes {
+		if node != nil && !reflect.ValueOf(node).IsNil() {
+			nonNil = append(nonNil, node)
+		}
+	}
+	return nonNil
+}
+
+// tsList returns a slice of nodes as a NodeList field.
+func tsList(nodes interface{}) []ast.Node {
+	return []ast.Node{NodeList(tsEach(nodes))}
+}
+
+// tsEach returns the elements of a slice of nodes as the values of a repeated field.
+func tsEach(nodes interface{}) []ast.Node {
+	v := reflect.ValueOf(nodes)
+	each := make([]ast.Node, v.Len())
+	for i := range each {
+		each[i] = v.Index(i).Interface().(ast.Node)
+	}
+	return each
+}
+
+// tsIs returns a match function for the nodes of the same type as example that satisfy
+// ok, if not nil.
+func tsIs(example ast.Node, ok func(node ast.Node) bool) func(ast.Node) bool {
+	typ := reflect.TypeOf(example)
+	return func(node ast.Node) bool {
+		return reflect.TypeOf(node) == typ && (ok == nil || ok(node))
+	}
+}
+
+// tsFuncType returns the fields of a function's type.
+func tsFuncType(typ func(node ast.Node) *ast.FuncType) map[string]func(ast.Node) []ast.Node {
+	return map[string]func(ast.Node) []ast.Node{
+		"type_parameters": func(n ast.Node) []ast.Node { return tsNodes(typ(n).TypeParams) },
+		"parameters":      func(n ast.Node) []ast.Node { return tsNodes(typ(n).Params) },
+		"result":          func(n ast.Node) []ast.Node { return tsNodes(typ(n).Results) },
+	}
+}
+
+// tsKinds maps the node kinds of the tree-sitter Go grammar to go/ast.
+var tsKinds = map[string]tsKind{}
+
+func init() {
+	ident := tsKind{match: tsIs((*ast.Ident)(nil), nil)}
+	for _, kind := range []string{"identifier", "type_identifier", "field_identifier", "package_identifier", "label_name", "blank_identifier"} {
+		tsKinds[kind] = ident
+	}
+	for _, name := range []string{"nil", "true", "false", "iota"} {
+		name := name
+		tsKinds[name] = tsKind{match: tsIs((*ast.Ident)(nil), func(n ast.Node) bool { return n.(*ast.Ident).Name == name })}
+	}
+	lit := func(kind token.Token, prefix string) tsKind {
+		return tsKind{match: tsIs((*ast.BasicLit)(nil), func(n ast.Node) bool {
+			return n.(*ast.BasicLit).Kind == kind && strings.HasPrefix(n.(*ast.BasicLit).Value, prefix)
+		})}
+	}
+	tsKinds["interpreted_string_literal"] = lit(token.STRING, `"`)
+	tsKinds["raw_string_literal"] = lit(token.STRING, "`")
+	tsKinds["int_literal"] = lit(token.INT, "")
+	tsKinds["float_literal"] = lit(token.FLOAT, "")
+	tsKinds["imaginary_literal"] = lit(token.IMAG, "")
+	tsKinds["rune_literal"] = lit(token.CHAR, "")
+	tsKinds["comment"] = tsKind{match: tsIs((*ast.Comment)(nil), nil)}
+
+	funcDecl := func(n ast.Node) *ast.FuncType { return n.(*ast.FuncDecl).Type }
+	function := tsKind{match: tsIs((*ast.FuncDecl)(nil), func(n ast.Node) bool { return n.(*ast.FuncDecl).Recv == nil }), fields: tsFuncType(funcDecl)}
+	function.fields["name"] = func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.FuncDecl).Name) }
+	function.fields["body"] = func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.FuncDecl).Body) }
+	tsKinds["function_declaration"] = function
+	method := tsKind{match: tsIs((*ast.FuncDecl)(nil), func(n ast.Node) bool { return n.(*ast.FuncDecl).Recv != nil }), fields: tsFuncType(funcDecl)}
+	method.fields["name"] = function.fields["name"]
+	method.fields["body"] = function.fields["body"]
+	method.fields["receiver"] = func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.FuncDecl).Recv) }
+	tsKinds["method_declaration"] = method
+	funcLit := tsKind{match: tsIs((*ast.FuncLit)(nil), nil), fields: tsFuncType(func(n ast.Node) *ast.FuncType { return n.(*ast.FuncLit).Type })}
+	funcLit.fields["body"] = func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.FuncLit).Body) }
+	tsKinds["func_literal"] = funcLit
+	tsKinds["function_type"] = tsKind{match: tsIs((*ast.FuncType)(nil), nil), fields: tsFuncType(func(n ast.Node) *ast.FuncType { return n.(*ast.FuncType) })}
+
+	genDecl := func(tok token.Token) tsKind {
+		return tsKind{match: tsIs((*ast.GenDecl)(nil), func(n ast.Node) bool { return n.(*ast.GenDecl).Tok == tok })}
+	}
+	tsKinds["import_declaration"] = genDecl(token.IMPORT)
+	tsKinds["const_declaration"] = genDecl(token.CONST)
+	tsKinds["var_declaration"] = genDecl(token.VAR)
+	tsKinds["type_declaration"] = genDecl(token.TYPE)
+	tsKinds["import_spec"] = tsKind{match: tsIs((*ast.ImportSpec)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"name": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.ImportSpec).Name) },
+		"path": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.ImportSpec).Path) },
+	}}
+	valueSpec := tsKind{match: tsIs((*ast.ValueSpec)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"name":  func(n ast.Node) []ast.Node { return tsEach(n.(*ast.ValueSpec).Names) },
+		"type":  func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.ValueSpec).Type) },
+		"value": func(n ast.Node) []ast.Node { return tsList(n.(*ast.ValueSpec).Values) },
+	}}
+	tsKinds["const_spec"] = valueSpec
+	tsKinds["var_spec"] = valueSpec
+	typeSpecFields := map[string]func(ast.Node) []ast.Node{
+		"name":            func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.TypeSpec).Name) },
+		"type_parameters": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.TypeSpec).TypeParams) },
+		"type":            func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.TypeSpec).Type) },
+	}
+	tsKinds["type_spec"] = tsKind{match: tsIs((*ast.TypeSpec)(nil), func(n ast.Node) bool { return !n.(*ast.TypeSpec).Assign.IsValid() }), fields: typeSpecFields}
+	tsKinds["type_alias"] = tsKind{match: tsIs((*ast.TypeSpec)(nil), func(n ast.Node) bool { return n.(*ast.TypeSpec).Assign.IsValid() }), fields: typeSpecFields}
+
+	field := tsKind{match: tsIs((*ast.Field)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"name": func(n ast.Node) []ast.Node { return tsEach(n.(*ast.Field).Names) },
+		"type": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.Field).Type) },
+		"tag":  func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.Field).Tag) },
+	}}
+	for _, kind := range []string{"field_declaration", "parameter_declaration", "variadic_parameter_declaration", "method_elem", "type_parameter_declaration"} {
+		tsKinds[kind] = field
+	}
+	fieldList := tsKind{match: tsIs((*ast.FieldList)(nil), nil)}
+	for _, kind := range []string{"field_declaration_list", "parameter_list", "type_parameter_list"} {
+		tsKinds[kind] = fieldList
+	}
+	tsKinds["struct_type"] = tsKind{match: tsIs((*ast.StructType)(nil), nil)}
+	tsKinds["interface_type"] = tsKind{match: tsIs((*ast.InterfaceType)(nil), nil)}
+	tsKinds["pointer_type"] = tsKind{match: tsIs((*ast.StarExpr)(nil), nil)}
+	elem := func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.ArrayType).Elt) }
+	tsKinds["slice_type"] = tsKind{match: tsIs((*ast.ArrayType)(nil), func(n ast.Node) bool { return n.(*ast.ArrayType).Len == nil }), fields: map[string]func(ast.Node) []ast.Node{"element": elem}}
+	tsKinds["array_type"] = tsKind{match: tsIs((*ast.ArrayType)(nil), func(n ast.Node) bool { return n.(*ast.ArrayType).Len != nil }), fields: map[string]func(ast.Node) []ast.Node{
+		"element": elem,
+		"length":  func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.ArrayType).Len) },
+	}}
+	tsKinds["map_type"] = tsKind{match: tsIs((*ast.MapType)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"key":   func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.MapType).Key) },
+		"value": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.MapType).Value) },
+	}}
+	tsKinds["channel_type"] = tsKind{match: tsIs((*ast.ChanType)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"value": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.ChanType).Value) },
+	}}
+	tsKinds["qualified_type"] = tsKind{match: tsIs((*ast.SelectorExpr)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"package": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SelectorExpr).X) },
+		"name":    func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SelectorExpr).Sel) },
+	}}
+
+	tsKinds["call_expression"] = tsKind{match: tsIs((*ast.CallExpr)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"function":  func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.CallExpr).Fun) },
+		"arguments": func(n ast.Node) []ast.Node { return tsList(n.(*ast.CallExpr).Args) },
+	}}
+	tsKinds["argument_list"] = tsKind{match: tsIs(NodeList(nil), nil)}
+	tsKinds["expression_list"] = tsKinds["argument_list"]
+	tsKinds["selector_expression"] = tsKind{match: tsIs((*ast.SelectorExpr)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"operand": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SelectorExpr).X) },
+		"field":   func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SelectorExpr).Sel) },
+	}}
+	tsKinds["binary_expression"] = tsKind{match: tsIs((*ast.BinaryExpr)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"left":  func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.BinaryExpr).X) },
+		"right": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.BinaryExpr).Y) },
+	}}
+	tsKinds["unary_expression"] = tsKind{
+		match: func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.UnaryExpr, *ast.StarExpr:
+				return true
+			}
+			return false
+		},
+		fields: map[string]func(ast.Node) []ast.Node{"operand": func(n ast.Node) []ast.Node {
+			if star, isStar := n.(*ast.StarExpr); isStar {
+				return tsNodes(star.X)
+			}
+			return tsNodes(n.(*ast.UnaryExpr).X)
+		}},
+	}
+	tsKinds["parenthesized_expression"] = tsKind{match: tsIs((*ast.ParenExpr)(nil), nil)}
+	tsKinds["index_expression"] = tsKind{match: tsIs((*ast.IndexExpr)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"operand": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.IndexExpr).X) },
+		"index":   func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.IndexExpr).Index) },
+	}}
+	tsKinds["slice_expression"] = tsKind{match: tsIs((*ast.SliceExpr)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"operand":  func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SliceExpr).X) },
+		"start":    func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SliceExpr).Low) },
+		"end":      func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SliceExpr).High) },
+		"capacity": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SliceExpr).Max) },
+	}}
+	tsKinds["type_assertion_expression"] = tsKind{match: tsIs((*ast.TypeAssertExpr)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"operand": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.TypeAssertExpr).X) },
+		"type":    func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.TypeAssertExpr).Type) },
+	}}
+	tsKinds["composite_literal"] = tsKind{match: tsIs((*ast.CompositeLit)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"type": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.CompositeLit).Type) },
+		"body": func(n ast.Node) []ast.Node { return tsList(n.(*ast.CompositeLit).Elts) },
+	}}
+	tsKinds["literal_value"] = tsKinds["argument_list"]
+	tsKinds["keyed_element"] = tsKind{match: tsIs((*ast.KeyValueExpr)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"key":   func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.KeyValueExpr).Key) },
+		"value": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.KeyValueExpr).Value) },
+	}}
+
+	tsKinds["block"] = tsKind{match: tsIs((*ast.BlockStmt)(nil), nil)}
+	tsKinds["expression_statement"] = tsKind{match: tsIs((*ast.ExprStmt)(nil), nil)}
+	tsKinds["return_statement"] = tsKind{match: tsIs((*ast.ReturnStmt)(nil), nil)}
+	tsKinds["go_statement"] = tsKind{match: tsIs((*ast.GoStmt)(nil), nil)}
+	tsKinds["defer_statement"] = tsKind{match: tsIs((*ast.DeferStmt)(nil), nil)}
+	tsKinds["send_statement"] = tsKind{match: tsIs((*ast.SendStmt)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"channel": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SendStmt).Chan) },
+		"value":   func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SendStmt).Value) },
+	}}
+	tsKinds["labeled_statement"] = tsKind{match: tsIs((*ast.LabeledStmt)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"label": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.LabeledStmt).Label) },
+	}}
+	branch := func(tok token.Token) tsKind {
+		return tsKind{match: tsIs((*ast.BranchStmt)(nil), func(n ast.Node) bool { return n.(*ast.BranchStmt).Tok == tok })}
+	}
+	tsKinds["break_statement"] = branch(token.BREAK)
+	tsKinds["continue_statement"] = branch(token.CONTINUE)
+	tsKinds["goto_statement"] = branch(token.GOTO)
+	tsKinds["fallthrough_statement"] = branch(token.FALLTHROUGH)
+	tsKinds["inc_statement"] = tsKind{match: tsIs((*ast.IncDecStmt)(nil), func(n ast.Node) bool { return n.(*ast.IncDecStmt).Tok == token.INC })}
+	tsKinds["dec_statement"] = tsKind{match: tsIs((*ast.IncDecStmt)(nil), func(n ast.Node) bool { return n.(*ast.IncDecStmt).Tok == token.DEC })}
+	assignFields := map[string]func(ast.Node) []ast.Node{
+		"left":  func(n ast.Node) []ast.Node { return tsList(n.(*ast.AssignStmt).Lhs) },
+		"right": func(n ast.Node) []ast.Node { return tsList(n.(*ast.AssignStmt).Rhs) },
+	}
+	tsKinds["short_var_declaration"] = tsKind{match: tsIs((*ast.AssignStmt)(nil), func(n ast.Node) bool { return n.(*ast.AssignStmt).Tok == token.DEFINE }), fields: assignFields}
+	tsKinds["assignment_statement"] = tsKind{match: tsIs((*ast.AssignStmt)(nil), func(n ast.Node) bool { return n.(*ast.AssignStmt).Tok != token.DEFINE }), fields: assignFields}
+	tsKinds["if_statement"] = tsKind{match: tsIs((*ast.IfStmt)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"initializer": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.IfStmt).Init) },
+		"condition":   func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.IfStmt).Cond) },
+		"consequence": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.IfStmt).Body) },
+		"alternative": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.IfStmt).Else) },
+	}}
+	tsKinds["for_statement"] = tsKind{
+		match: func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.ForStmt, *ast.RangeStmt:
+				return true
+			}
+			return false
+		},
+		fields: map[string]func(ast.Node) []ast.Node{"body": func(n ast.Node) []ast.Node {
+			if loop, isFor := n.(*ast.ForStmt); isFor {
+				return tsNodes(loop.Body)
+			}
+			return tsNodes(n.(*ast.RangeStmt).Body)
+		}},
+	}
+	tsKinds["expression_switch_statement"] = tsKind{match: tsIs((*ast.SwitchStmt)(nil), nil), fields: map[string]func(ast.Node) []ast.Node{
+		"initializer": func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SwitchStmt).Init) },
+		"value":       func(n ast.Node) []ast.Node { return tsNodes(n.(*ast.SwitchStmt).Tag) },
+	}}
+	tsKinds["type_switch_statement"] = tsKind{match: tsIs((*ast.TypeSwitchStmt)(nil), nil)}
+	tsKinds["expression_case"] = tsKind{match: tsIs((*ast.CaseClause)(nil), func(n ast.Node) bool { return n.(*ast.CaseClause).List != nil }), fields: map[string]func(ast.Node) []ast.Node{
+		"value": func(n ast.Node) []ast.Node { return tsList(n.(*ast.CaseClause).List) },
+	}}
+	tsKinds["default_case"] = tsKind{match: tsIs((*ast.CaseClause)(nil), func(n ast.Node) bool { return n.(*ast.CaseClause).List == nil })}
+	tsKinds["select_statement"] = tsKind{match: tsIs((*ast.SelectStmt)(nil), nil)}
+	tsKinds["communication_case"] = tsKind{match: tsIs((*ast.CommClause)(nil), nil)}
+	tsKinds["source_file"] = tsKind{match: tsIs((*ast.File)(nil), nil)}
+}
@@ -0,0 +1,108 @@
+package astquery
+
+import (
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const treeSitterSrc = `package p
+
+import "fmt"
+
+type Server struct {
+	Name string ` + "`json:\"name\"`" + `
+	port int
+}
+
+func (s *Server) Start() error {
+	return mustListen(s.port)
+}
+
+func main() {
+	s := &Server{Name: "x"}
+	fmt.Println(s.Name, 1)
+	mustStart(s)
+}
+`
+
+func TestTreeSitter(t *testing.T) {
+	file := parseTestFile(t, treeSitterSrc)
+	testcases := []struct {
+		query string
+		exp   []string
+	}{
+		{`(function_declaration name: (identifier) @fn)`, []string{
+			`func main() { s := &Server{Name: "x"} fmt.Println(s.Name, 1) mustStart(s) }`, "fn=main",
+		}},
+		{`(method_declaration receiver: (parameter_list (parameter_declaration type: (pointer_type (type_identifier) @recv))) name: (field_identifier) @name)`, []string{
+			"func (s *Server) Start() error { return mustListen(s.port) }", "name=Start", "recv=Server",
+		}},
+		{`((call_expression function: (identifier) @f) (#match? @f "^must"))`, []string{
+			"mustListen(s.port)", "f=mustListen", "mustStart(s)", "f=mustStart",
+		}},
+		{`(call_expression function: (selector_expression operand: (identifier) @pkg field: (field_identifier) @fn (#eq? @pkg "fmt")) arguments: (argument_list (_) @first (int_literal)))`, []string{
+			"fmt.Println(s.Name, 1)", "first=s.Name", "fn=Println", "pkg=fmt",
+		}},
+		{`(field_declaration name: (field_identifier) @f tag: (raw_string_literal))`, []string{"f=Name"}},
+		{`(field_declaration name: (field_identifier) @f !tag)`, []string{"f=port", "f=s"}},
+		{`; short variable declarations of composite literals
+		(short_var_declaration right: (expression_list (unary_expression (composite_literal type: (type_identifier) @t))))`, []string{
+			`s := &Server{Name: "x"}`, "t=Server",
+		}},
+		{`[(return_statement) (import_spec path: (interpreted_string_literal) @path)]`, []string{
+			`"fmt"`, `path="fmt"`, "return mustListen(s.port)",
+		}},
+		{`((keyed_element key: (_) @k value: (_) @v) (#not-eq? @k @v))`, []string{`Name: "x"`, "k=Name", `v="x"`}},
+		{`((function_declaration name: (identifier) @f) (#match? @f "^ma"))
+		((method_declaration name: (field_identifier) @f) (#eq? @f "Start"))`, []string{
+			"func (s *Server) Start() error { return mustListen(s.port) }", "f=Start",
+			`func main() { s := &Server{Name: "x"} fmt.Println(s.Name, 1) mustStart(s) }`, "f=main",
+		}},
+		{`(call_expression (identifier) (identifier) (identifier))`, nil},
+	}
+	for _, test := range testcases {
+		q, err := CompileTreeSitter(test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		var matches []PatternMatch
+		for _, m := range q.Find([]ast.Node{file}) {
+			if _, isField := m.Node.(*ast.Field); isField {
+				m.Node = nil // fields can't be printed on their own
+			}
+			matches = append(matches, m)
+		}
+		got := patternMatches(t, matches)
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%s: expected %q, but got %q", test.query, test.exp, got)
+		}
+	}
+}
+
+func TestCompileTreeSitterErrors(t *testing.T) {
+	testcases := []struct {
+		query string
+		err   string
+	}{
+		{``, "empty query"},
+		{`(function_decl)`, `offset 1: unknown node kind "function_decl"`},
+		{`(function_declaration nam: (identifier))`, `offset 22: unknown field "nam" of function_declaration`},
+		{`(function_declaration`, "offset 21: expected ')'"},
+		{`(return_statement "return")`, "offset 18: anonymous nodes are not supported"},
+		{`(identifier)+`, "offset 12: quantifiers are not supported"},
+		{`((identifier) @x (#any-of? @x "a"))`, "offset 19: unsupported predicate #any-of?"},
+		{`((identifier) @x (#match? @x "("))`, "error parsing regexp"},
+		{`(identifier) @`, "offset 14: expected a capture name"},
+		{`[(identifier)`, "offset 13: expected ']'"},
+		{`((identifier) (identifier))`, "offset 14: groups of several patterns are not supported"},
+	}
+	for _, test := range testcases {
+		_, err := CompileTreeSitter(test.query)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", test.query, test.err, err)
+		}
+	}
+}
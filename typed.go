@@ -0,0 +1,932 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"strings"
+	"sync"
+)
+
+// TypedPackage is a parsed package together with the type information go/types computes
+// for it. It lets TypedFilters answer questions the syntax alone can't, such as what an
+// identifier refers to or what type an expression has.
+type TypedPackage struct {
+	// Fset is the file set the files were parsed with.
+	Fset *token.FileSet
+
+	// Files are the package's files.
+	Files []*ast.File
+
+	// Pkg is the type-checked package.
+	Pkg *types.Package
+
+	// Info is the type information recorded for the files. Its Types, Defs, Uses,
+	// Implicits, Selections, Scopes and Instances maps are populated.
+	Info *types.Info
+
+	// Errors are the type errors found while checking the package, if any.
+	Errors []error
+
+	typeCache typeCache
+}
+
+// typeCache holds the types that filters resolved in a package, by their string form, so
+// that they are resolved once rather than at every node.
+type typeCache struct {
+	mu    sync.Mutex
+	types map[string]types.Type
+}
+
+// NewTypedPackage type-checks the files of a package, which must have been parsed with
+// fset. If conf is nil, a configuration that imports dependencies from compiled export
+// data is used. Type errors don't stop checking: NewTypedPackage returns the package
+// along with the first error, and records all of them in Errors. The type information of
+// such a package is incomplete but still usable.
+func NewTypedPackage(path string, fset *token.FileSet, files []*ast.File, conf *types.Config) (*TypedPackage, error) {
+	if conf == nil {
+		conf = &types.Config{Importer: importer.Default()}
+	}
+	p := &TypedPackage{
+		Fset:  fset,
+		Files: files,
+		Info: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			Scopes:     make(map[ast.Node]*types.Scope),
+			Instances:  make(map[*ast.Ident]types.Instance),
+		},
+	}
+	checkConf := *conf
+	checkConf.Error = func(err error) {
+		p.Errors = append(p.Errors, err)
+		if conf.Error != nil {
+			conf.Error(err)
+		}
+	}
+	p.Pkg, _ = checkConf.Check(path, fset, files, p.Info)
+	if len(p.Errors) > 0 {
+		return p, p.Errors[0]
+	}
+	return p, nil
+}
+
+// TypedFilter is a filter that consults the type information of the package being
+// searched. Bind it to a package to use it with Find.
+type TypedFilter interface {
+	// FilterTyped reports whether node, whose ancestors are given as for
+	// PathFilter.FilterPath, matches. pkg is the package containing node.
+	FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool
+}
+
+// TypedFilterFunc lets you specify a function for custom filtering logic that uses type
+// information.
+type TypedFilterFunc func(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool
+
+func (f TypedFilterFunc) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	return f(node, ancestors, pkg)
+}
+
+// Bind returns a Filter that applies f using the type information of p. Only nodes of p
+// should be searched with it.
+func (p *TypedPackage) Bind(f TypedFilter) Filter {
+	return boundFilter{filter: f, pkg: p}
+}
+
+// Find searches the files of p and returns all AST nodes that match the filter, as Find
+// does.
+func (p *TypedPackage) Find(filter Filter) []ast.Node {
+	return FindFiles(p.Files, filter)
+}
+
+// FindTyped searches the files of p and returns all AST nodes that match the typed filter.
+func (p *TypedPackage) FindTyped(filter TypedFilter) []ast.Node {
+	return p.Find(p.Bind(filter))
+}
+
+// Position returns the position of the start of node, which must be part of one of the
+// files of p.
+func (p *TypedPackage) Position(node ast.Node) token.Position {
+	return p.Fset.Position(node.Pos())
+}
+
+// boundFilter is a TypedFilter bound to a package.
+type boundFilter struct {
+	filter TypedFilter
+	pkg    *TypedPackage
+}
+
+func (f boundFilter) Filter(node ast.Node) bool {
+	return f.filter.FilterTyped(node, nil, f.pkg)
+}
+
+func (f boundFilter) FilterPath(node ast.Node, ancestors []ast.Node) bool {
+	return f.filter.FilterTyped(node, ancestors, f.pkg)
+}
+
+// ObjectFilter matches identifiers (*ast.Ident) by the object they declare or refer to.
+type ObjectFilter struct {
+	// Kind is the kind of object to match. The zero value matches any kind.
+	Kind ObjectKind
+
+	// PkgPath, if non-empty, is the import path of the package the object belongs to
+	// (e.g., "net/http"). Objects of the universe scope, such as the builtins, belong to
+	// no package.
+	PkgPath string
+
+	// Name, if non-empty, is the name of the object.
+	Name string
+
+	// DefsOnly is if the filter should select only identifiers declaring the object
+	// rather than referring to it.
+	DefsOnly bool
+
+	// UsesOnly is if the filter should select only identifiers referring to the object
+	// rather than declaring it.
+	UsesOnly bool
+}
+
+// ObjectKind is the kind of object an identifier denotes.
+type ObjectKind int
+
+const (
+	AnyObject   ObjectKind = iota // any kind of object
+	VarObject                     // variable, parameter, result or struct field
+	ConstObject                   // constant
+	TypeObject                    // type name
+	FuncObject                    // function or method
+	PkgObject                     // imported package name
+	LabelObject                   // label
+)
+
+func (f ObjectFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	ident, isIdent := node.(*ast.Ident)
+	if !isIdent {
+		return false
+	}
+	obj, isDef := pkg.Info.Defs[ident]
+	if !isDef || obj == nil {
+		obj, isDef = pkg.Info.Uses[ident], false
+	}
+	if obj == nil {
+		return false
+	}
+	if (f.DefsOnly && !isDef) || (f.UsesOnly && isDef) {
+		return false
+	}
+	if f.Kind != AnyObject && objectKind(obj) != f.Kind {
+		return false
+	}
+	if f.Name != "" && obj.Name() != f.Name {
+		return false
+	}
+	if f.PkgPath != "" && (obj.Pkg() == nil || obj.Pkg().Path() != f.PkgPath) {
+		return false
+	}
+	return true
+}
+
+// objectKind returns the kind of obj.
+func objectKind(obj types.Object) ObjectKind {
+	switch obj.(type) {
+	case *types.Var:
+		return VarObject
+	case *types.Const:
+		return ConstObject
+	case *types.TypeName:
+		return TypeObject
+	case *types.Func:
+		return FuncObject
+	case *types.PkgName:
+		return PkgObject
+	case *types.Label:
+		return LabelObject
+	default:
+		return AnyObject
+	}
+}
+
+// ImplementsFilter matches type specs (*ast.TypeSpec) of concrete types that implement an
+// interface, either directly or through a pointer to the type. Generic types never match.
+type ImplementsFilter struct {
+	// PkgPath is the import path of the package declaring the interface (e.g., "io"), or
+	// empty for the predeclared error interface. The package must be the one being
+	// searched or among its (transitive) imports.
+	PkgPath string
+
+	// Name is the name of the interface (e.g., "Reader").
+	Name string
+
+	// ValueOnly is if the filter should select only types whose values, not just pointers
+	// to them, implement the interface.
+	ValueOnly bool
+}
+
+func (f ImplementsFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	spec, isSpec := node.(*ast.TypeSpec)
+	if !isSpec || spec.TypeParams != nil {
+		return false
+	}
+	obj := pkg.Info.Defs[spec.Name]
+	if obj == nil {
+		return false
+	}
+	qualified := f.Name
+	if f.PkgPath != "" {
+		qualified = f.PkgPath + "." + f.Name
+	}
+	named := pkg.resolveType(qualified)
+	if named == nil {
+		return false
+	}
+	iface, isInterface := named.Underlying().(*types.Interface)
+	if !isInterface {
+		return false
+	}
+	typ := obj.Type()
+	if types.IsInterface(typ) {
+		return false
+	}
+	if types.Implements(typ, iface) {
+		return true
+	}
+	return !f.ValueOnly && types.Implements(types.NewPointer(typ), iface)
+}
+
+// CallFilter matches calls (*ast.CallExpr) to a function or method identified by the
+// import path of its package, regardless of the name under which the package is imported
+// (including dot imports). Calls through function values never match.
+type CallFilter struct {
+	// PkgPath is the import path of the package declaring the function (e.g., "errors").
+	PkgPath string
+
+	// Name is the name of the function or method (e.g., "New").
+	Name string
+
+	// Recv, if non-empty, is the name of the receiver type of the method, without the '*'
+	// if a pointer (e.g., "Client" for (*http.Client).Do). If empty, only functions that
+	// are not methods match.
+	Recv string
+}
+
+func (f CallFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	call, isCall := node.(*ast.CallExpr)
+	if !isCall {
+		return false
+	}
+	fn := calleeFunc(call, pkg.Info)
+	if fn == nil || fn.Name() != f.Name || fn.Pkg() == nil || fn.Pkg().Path() != f.PkgPath {
+		return false
+	}
+	return recvTypeName(fn) == f.Recv
+}
+
+// calleeFunc returns the function or method called by call, or nil if the callee is not a
+// statically known function (e.g., a function value, builtin or conversion).
+func calleeFunc(call *ast.CallExpr, info *types.Info) *types.Func {
+	ident, _ := calleeIdent(call)
+	if ident == nil {
+		return nil
+	}
+	fn, _ := info.Uses[ident].(*types.Func)
+	return fn
+}
+
+// calleeIdent returns the identifier naming the function called by call, and the selector
+// expression it is the Sel of, if any. It returns nil if the callee is not named.
+func calleeIdent(call *ast.CallExpr) (*ast.Ident, *ast.SelectorExpr) {
+	fun := ast.Unparen(call.Fun)
+	switch index := fun.(type) {
+	case *ast.IndexExpr:
+		fun = ast.Unparen(index.X) // instantiated generic function
+	case *ast.IndexListExpr:
+		fun = ast.Unparen(index.X)
+	}
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		return fun, nil
+	case *ast.SelectorExpr:
+		return fun.Sel, fun
+	default:
+		return nil, nil
+	}
+}
+
+// recvTypeName returns the name of the receiver's type of a method, without the '*' if a
+// pointer, or the empty string if fn is not a method.
+func recvTypeName(fn *types.Func) string {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return ""
+	}
+	typ := recv.Type()
+	if ptr, isPtr := typ.(*types.Pointer); isPtr {
+		typ = ptr.Elem()
+	}
+	switch typ := typ.(type) {
+	case *types.Named:
+		return typ.Obj().Name()
+	case *types.Alias:
+		return typ.Obj().Name()
+	default:
+		return "" // method of an interface literal
+	}
+}
+
+// lookupType returns the named type declared by the package with the given import path,
+// which must be pkg or one of its transitive imports. An empty path denotes the universe
+// scope. It returns nil if the type is not found.
+func lookupType(pkg *types.Package, path, name string) types.Type {
+	scope := types.Universe
+	if path != "" {
+		imported := findImport(pkg, path, make(map[*types.Package]bool))
+		if imported == nil {
+			return nil
+		}
+		scope = imported.Scope()
+	}
+	typeName, isTypeName := scope.Lookup(name).(*types.TypeName)
+	if !isTypeName {
+		return nil
+	}
+	return typeName.Type()
+}
+
+// parseType returns the type denoted by s, written as types.TypeString formats types
+// with full package paths (e.g., "*database/sql.DB", "[]byte" or "map[string]io.Reader").
+// Named types must be declared by pkg or one of its transitive imports. It returns nil if
+// s cannot be resolved.
+func parseType(pkg *types.Package, s string) types.Type {
+	switch {
+	case strings.HasPrefix(s, "*"):
+		if elem := parseType(pkg, s[1:]); elem != nil {
+			return types.NewPointer(elem)
+		}
+	case strings.HasPrefix(s, "[]"):
+		if elem := parseType(pkg, s[2:]); elem != nil {
+			return types.NewSlice(elem)
+		}
+	case strings.HasPrefix(s, "map["):
+		if end := matchingBracket(s, len("map")); end > 0 {
+			key, elem := parseType(pkg, s[len("map["):end]), parseType(pkg, s[end+1:])
+			if key != nil && elem != nil {
+				return types.NewMap(key, elem)
+			}
+		}
+	case strings.HasPrefix(s, "chan "):
+		if elem := parseType(pkg, s[len("chan "):]); elem != nil {
+			return types.NewChan(types.SendRecv, elem)
+		}
+	case s == "interface{}" || s == "any":
+		return types.Universe.Lookup("any").Type()
+	default:
+		path, name := "", s
+		if dot := strings.LastIndex(s, "."); dot >= 0 {
+			path, name = s[:dot], s[dot+1:]
+		}
+		if typ := lookupType(pkg, path, name); typ != nil {
+			return typ
+		}
+	}
+	return nil
+}
+
+// resolveType returns the type denoted by s in p, as parseType does, resolving each type
+// only once.
+func (p *TypedPackage) resolveType(s string) types.Type {
+	p.typeCache.mu.Lock()
+	defer p.typeCache.mu.Unlock()
+	typ, resolved := p.typeCache.types[s]
+	if !resolved {
+		if p.typeCache.types == nil {
+			p.typeCache.types = make(map[string]types.Type)
+		}
+		typ = parseType(p.Pkg, s)
+		p.typeCache.types[s] = typ
+	}
+	return typ
+}
+
+// typeIs reports whether typ is the type denoted by s in pkg, written as types.TypeString
+// formats types with full package paths. Types that parseType cannot resolve, such as
+// function types, are compared by their string form.
+func typeIs(pkg *TypedPackage, typ types.Type, s string) bool {
+	if types.TypeString(typ, nil) == s {
+		return true
+	}
+	parsed := pkg.resolveType(s)
+	return parsed != nil && types.Identical(parsed, typ)
+}
+
+// matchingBracket returns the index of the ']' matching the '[' at s[open], or -1.
+func matchingBracket(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// ExprTypeFilter matches expressions (ast.Expr) whose value has a given type, such as
+// every expression of type *sql.DB. Type expressions never match. Because Find does not
+// descend into matches, an expression containing other matching expressions is the only
+// one matched.
+type ExprTypeFilter struct {
+	// Type is the type, written with full package paths as formatted by types.TypeString
+	// (e.g., "*database/sql.DB" or "[]byte"). Named types must be declared by the package
+	// being searched or one of its transitive imports.
+	Type string
+
+	// Assignable is if the filter should select expressions whose type is assignable to
+	// Type rather than identical to it.
+	Assignable bool
+}
+
+func (f ExprTypeFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	expr, isExpr := node.(ast.Expr)
+	if !isExpr {
+		return false
+	}
+	tv, isTyped := pkg.Info.Types[expr]
+	if !isTyped || !tv.IsValue() || tv.Type == nil {
+		return false
+	}
+	target := pkg.resolveType(f.Type)
+	if target == nil {
+		return false
+	}
+	if f.Assignable {
+		return types.AssignableTo(tv.Type, target)
+	}
+	return types.Identical(tv.Type, target)
+}
+
+// findImport returns the package with the given import path among pkg and its transitive
+// imports, or nil if there is none.
+func findImport(pkg *types.Package, path string, seen map[*types.Package]bool) *types.Package {
+	if pkg == nil || seen[pkg] {
+		return nil
+	}
+	seen[pkg] = true
+	if pkg.Path() == path {
+		return pkg
+	}
+	for _, imported := range pkg.Imports() {
+		if found := findImport(imported, path, seen); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// AssignableFilter matches expressions (ast.Expr) whose value is assignable, or
+// convertible, to a target type, such as everything that could be used as an io.Writer.
+type AssignableFilter struct {
+	// Type is the target type, written as for ExprTypeFilter (e.g., "io.Writer").
+	Type string
+
+	// Convertible is if the filter should select expressions convertible to Type rather
+	// than assignable to it.
+	Convertible bool
+
+	// Passed is if the filter should select only arguments of calls whose corresponding
+	// parameter has type Type, i.e., values passed where a Type is expected. It requires
+	// ancestors, so Filter never matches when it is set.
+	Passed bool
+}
+
+func (f AssignableFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	expr, isExpr := node.(ast.Expr)
+	if !isExpr {
+		return false
+	}
+	tv, isTyped := pkg.Info.Types[expr]
+	if !isTyped || !tv.IsValue() || tv.Type == nil {
+		return false
+	}
+	target := pkg.resolveType(f.Type)
+	if target == nil {
+		return false
+	}
+	if f.Convertible {
+		if !types.ConvertibleTo(tv.Type, target) {
+			return false
+		}
+	} else if !types.AssignableTo(tv.Type, target) {
+		return false
+	}
+	if f.Passed {
+		param := paramType(expr, parent(ancestors), pkg.Info)
+		return param != nil && types.Identical(param, target)
+	}
+	return true
+}
+
+// paramType returns the type of the parameter that arg is passed for, if parent is a call
+// of a function with arg among its arguments. It returns nil otherwise.
+func paramType(arg ast.Expr, parent ast.Node, info *types.Info) types.Type {
+	call, isCall := parent.(*ast.CallExpr)
+	if !isCall {
+		return nil
+	}
+	sig, isFunc := info.Types[call.Fun].Type.(*types.Signature)
+	if !isFunc {
+		return nil // conversion or builtin
+	}
+	for i, a := range call.Args {
+		if a != arg {
+			continue
+		}
+		params := sig.Params()
+		if sig.Variadic() && i >= params.Len()-1 {
+			last := params.At(params.Len() - 1).Type()
+			if call.Ellipsis.IsValid() {
+				return last
+			}
+			return last.(*types.Slice).Elem()
+		}
+		if i < params.Len() {
+			return params.At(i).Type()
+		}
+	}
+	return nil
+}
+
+// NilComparisonFilter matches comparisons (*ast.BinaryExpr using == or !=) of
+// interface-typed or pointer-typed expressions against nil.
+type NilComparisonFilter struct {
+	// Operand selects comparisons by the type of the expression compared against nil.
+	Operand NilOperand
+
+	// TypedNil is if the filter should select only comparisons of interfaces that may
+	// hold a typed nil pointer, the classic pitfall where a nil *T stored in an interface
+	// makes it compare unequal to nil. An interface operand may hold one if it is a
+	// conversion of a pointer, or a variable assigned a pointer in the enclosing function.
+	// It requires ancestors, so Filter never matches when it is set.
+	TypedNil bool
+}
+
+// NilOperand is the type of an expression compared against nil.
+type NilOperand int
+
+const (
+	AnyNilOperand       NilOperand = iota // interface or pointer
+	InterfaceNilOperand                   // interface
+	PointerNilOperand                     // pointer
+)
+
+func (f NilComparisonFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	expr, isBinary := node.(*ast.BinaryExpr)
+	if !isBinary || (expr.Op != token.EQL && expr.Op != token.NEQ) {
+		return false
+	}
+	operand := expr.X
+	if pkg.Info.Types[operand].IsNil() {
+		operand = expr.Y
+	} else if !pkg.Info.Types[expr.Y].IsNil() {
+		return false
+	}
+	typ := pkg.Info.TypeOf(operand)
+	if typ == nil {
+		return false
+	}
+	_, isPointer := typ.Underlying().(*types.Pointer)
+	isInterface := types.IsInterface(typ)
+	switch f.Operand {
+	case InterfaceNilOperand:
+		if !isInterface {
+			return false
+		}
+	case PointerNilOperand:
+		if !isPointer {
+			return false
+		}
+	default:
+		if !isInterface && !isPointer {
+			return false
+		}
+	}
+	if f.TypedNil {
+		return isInterface && mayHoldPointer(operand, ancestors, pkg.Info)
+	}
+	return true
+}
+
+// mayHoldPointer reports whether the interface-typed expr is a conversion of a pointer or
+// a variable assigned a pointer within the innermost function among ancestors.
+func mayHoldPointer(expr ast.Expr, ancestors []ast.Node, info *types.Info) bool {
+	isPointer := func(e ast.Expr) bool {
+		tv := info.Types[e]
+		if tv.Type == nil || tv.IsNil() {
+			return false
+		}
+		_, isPtr := tv.Type.Underlying().(*types.Pointer)
+		return isPtr
+	}
+	expr = ast.Unparen(expr)
+	if call, isCall := expr.(*ast.CallExpr); isCall && info.Types[call.Fun].IsType() && len(call.Args) == 1 {
+		return isPointer(call.Args[0])
+	}
+	ident, isIdent := expr.(*ast.Ident)
+	if !isIdent {
+		return false
+	}
+	obj := info.Uses[ident]
+	if obj == nil {
+		return false
+	}
+	var body ast.Node
+	for i := len(ancestors) - 1; i >= 0 && body == nil; i-- {
+		switch fn := ancestors[i].(type) {
+		case *ast.FuncDecl:
+			body = fn.Body
+		case *ast.FuncLit:
+			body = fn.Body
+		}
+	}
+	if body == nil {
+		return false
+	}
+	found := false
+	assigns := func(lhs ast.Expr) bool {
+		id, isIdent := lhs.(*ast.Ident)
+		return isIdent && (info.Uses[id] == obj || info.Defs[id] == obj)
+	}
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.AssignStmt:
+			if len(node.Lhs) == len(node.Rhs) {
+				for i, lhs := range node.Lhs {
+					if assigns(lhs) && isPointer(node.Rhs[i]) {
+						found = true
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			if len(node.Names) == len(node.Values) {
+				for i, name := range node.Names {
+					if assigns(name) && isPointer(node.Values[i]) {
+						found = true
+					}
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// ConstValueFilter matches constant expressions (ast.Expr) by their evaluated value,
+// including named constants and constant expressions such as 24 * 60 * 60.
+type ConstValueFilter struct {
+	// Value, if non-nil, is the exact value to match. Numeric values of different kinds
+	// compare by value, so constant.MakeInt64(86400) matches 86400.0.
+	Value constant.Value
+
+	// Min and Max, if non-nil, are inclusive bounds on the value. Only numeric constants
+	// match when either is set.
+	Min, Max constant.Value
+
+	// MinLen, if positive, is the minimum length in bytes of a string constant. Only
+	// string constants match when it is set.
+	MinLen int
+}
+
+func (f ConstValueFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	expr, isExpr := node.(ast.Expr)
+	if !isExpr {
+		return false
+	}
+	val := pkg.Info.Types[expr].Value
+	if val == nil {
+		return false
+	}
+	if f.Value != nil && !constantsEqual(val, f.Value) {
+		return false
+	}
+	if f.Min != nil || f.Max != nil {
+		if !isNumeric(val) {
+			return false
+		}
+		if f.Min != nil && (!isNumeric(f.Min) || constant.Compare(val, token.LSS, f.Min)) {
+			return false
+		}
+		if f.Max != nil && (!isNumeric(f.Max) || constant.Compare(val, token.GTR, f.Max)) {
+			return false
+		}
+	}
+	if f.MinLen > 0 && (val.Kind() != constant.String || len(constant.StringVal(val)) < f.MinLen) {
+		return false
+	}
+	return true
+}
+
+// constantsEqual reports whether two constant values are equal, comparing numeric values
+// of different kinds by value.
+func constantsEqual(x, y constant.Value) bool {
+	if isNumeric(x) && isNumeric(y) {
+		return constant.Compare(x, token.EQL, y)
+	}
+	return x.Kind() == y.Kind() && constant.Compare(x, token.EQL, y)
+}
+
+// isNumeric reports whether val is an integer, floating-point or complex constant.
+func isNumeric(val constant.Value) bool {
+	switch val.Kind() {
+	case constant.Int, constant.Float, constant.Complex:
+		return true
+	default:
+		return false
+	}
+}
+
+// InstantiationFilter matches identifiers (*ast.Ident) that instantiate a generic function
+// or type, whether the type arguments are explicit, as in Map[string, int], or inferred
+// from a call's arguments.
+type InstantiationFilter struct {
+	// PkgPath, if non-empty, is the import path of the package declaring the generic
+	// function or type.
+	PkgPath string
+
+	// Name, if non-empty, is the name of the generic function or type.
+	Name string
+
+	// TypeArgs, if non-nil, are the type arguments of the instantiation, written with full
+	// package paths as formatted by types.TypeString (e.g., "string" or "*net/http.Request").
+	// "_" matches any type argument.
+	TypeArgs []string
+}
+
+func (f InstantiationFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	ident, isIdent := node.(*ast.Ident)
+	if !isIdent {
+		return false
+	}
+	inst, isInstance := pkg.Info.Instances[ident]
+	if !isInstance {
+		return false
+	}
+	obj := pkg.Info.Uses[ident]
+	if obj == nil {
+		return false
+	}
+	if f.Name != "" && obj.Name() != f.Name {
+		return false
+	}
+	if f.PkgPath != "" && (obj.Pkg() == nil || obj.Pkg().Path() != f.PkgPath) {
+		return false
+	}
+	if f.TypeArgs != nil {
+		if inst.TypeArgs.Len() != len(f.TypeArgs) {
+			return false
+		}
+		for i, want := range f.TypeArgs {
+			if want != "_" && !typeIs(pkg, inst.TypeArgs.At(i), want) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ErrorResultFilter matches functions (*ast.FuncDecl and *ast.FuncLit) whose last result
+// implements the error interface. Unlike FuncSignatureFilter's ReturnsError, it recognizes
+// named error types and interfaces that embed error, however they are written.
+type ErrorResultFilter struct {
+	// Concrete is if the filter should select only functions whose last result is a
+	// concrete type, such as *MyError. Returning a nil pointer of such a type as an error
+	// yields a non-nil error.
+	Concrete bool
+}
+
+func (f ErrorResultFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	var typ types.Type
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		if obj := pkg.Info.Defs[node.Name]; obj != nil {
+			typ = obj.Type()
+		}
+	case *ast.FuncLit:
+		typ = pkg.Info.TypeOf(node)
+	}
+	sig, isSig := typ.(*types.Signature)
+	if !isSig || sig.Results().Len() == 0 {
+		return false
+	}
+	last := sig.Results().At(sig.Results().Len() - 1).Type()
+	errorType := types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+	if !types.Implements(last, errorType) {
+		return false
+	}
+	return !f.Concrete || !types.IsInterface(last)
+}
+
+// MissingContextFilter matches declarations of exported functions and methods
+// (*ast.FuncDecl) that make I/O calls but take no context.Context parameter, so the calls
+// cannot be cancelled by their callers. Calls made in function literals in the body count.
+type MissingContextFilter struct {
+	// Calls are the calls considered to perform I/O (e.g., {PkgPath: "net/http", Recv:
+	// "Client", Name: "Do"}). If empty, a call to any function or method whose first
+	// parameter is a context.Context is considered to perform I/O.
+	Calls []CallFilter
+}
+
+func (f MissingContextFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	decl, isDecl := node.(*ast.FuncDecl)
+	if !isDecl || decl.Body == nil || !decl.Name.IsExported() {
+		return false
+	}
+	fn, isFunc := pkg.Info.Defs[decl.Name].(*types.Func)
+	if !isFunc {
+		return false
+	}
+	params := fn.Type().(*types.Signature).Params()
+	for i := 0; i < params.Len(); i++ {
+		if isContextType(params.At(i).Type()) {
+			return false
+		}
+	}
+	performsIO := false
+	ast.Inspect(decl.Body, func(node ast.Node) bool {
+		if call, isCall := node.(*ast.CallExpr); isCall && !performsIO {
+			performsIO = f.isIOCall(call, pkg)
+		}
+		return !performsIO
+	})
+	return performsIO
+}
+
+// isIOCall reports whether call is one of f.Calls or, if there are none, a call taking a
+// context.
+func (f MissingContextFilter) isIOCall(call *ast.CallExpr, pkg *TypedPackage) bool {
+	if len(f.Calls) == 0 {
+		fn := calleeFunc(call, pkg.Info)
+		if fn == nil {
+			return false
+		}
+		params := fn.Type().(*types.Signature).Params()
+		return params.Len() > 0 && isContextType(params.At(0).Type())
+	}
+	for _, callFilter := range f.Calls {
+		if callFilter.FilterTyped(call, nil, pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+// isContextType reports whether typ is context.Context.
+func isContextType(typ types.Type) bool {
+	named, isNamed := typ.(*types.Named)
+	if !isNamed {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == "context" && obj.Name() == "Context"
+}
+
+// ConversionFilter matches type conversions (*ast.CallExpr), such as string(b), which are
+// told apart from function calls by the type information.
+type ConversionFilter struct {
+	// From, if non-empty, is the type of the converted operand, written with full package
+	// paths as formatted by types.TypeString (e.g., "[]byte"). An untyped constant
+	// operand has the type it is converted to.
+	From string
+
+	// To, if non-empty, is the type converted to, in the same form as From.
+	To string
+}
+
+func (f ConversionFilter) FilterTyped(node ast.Node, ancestors []ast.Node, pkg *TypedPackage) bool {
+	call, isCall := node.(*ast.CallExpr)
+	if !isCall || len(call.Args) != 1 {
+		return false
+	}
+	fun, isTyped := pkg.Info.Types[call.Fun]
+	if !isTyped || !fun.IsType() {
+		return false
+	}
+	if f.To != "" && !typeIs(pkg, fun.Type, f.To) {
+		return false
+	}
+	if f.From != "" {
+		arg := pkg.Info.TypeOf(call.Args[0])
+		if arg == nil || !typeIs(pkg, arg, f.From) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,554 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const typedTestSrc = `package p
+
+import (
+	"fmt"
+	str "strings"
+)
+
+const greeting = "hello"
+
+type Greeter struct{ name string }
+
+func (g *Greeter) Greet() string {
+	msg := fmt.Sprintf("%s, %s", greeting, g.name)
+	return str.ToUpper(msg)
+}
+
+func Println(s string) { fmt.Println(s) }
+`
+
+func TestObjectFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, typedTestSrc)
+
+	testcases := []struct {
+		filter ObjectFilter
+		exp    []string
+	}{
+		{ObjectFilter{Kind: FuncObject, PkgPath: "fmt"}, []string{"Sprintf", "Println"}},
+		{ObjectFilter{Name: "Println"}, []string{"Println", "Println"}},
+		{ObjectFilter{Name: "Println", PkgPath: "p"}, []string{"Println"}},
+		{ObjectFilter{Kind: PkgObject}, []string{"str", "fmt", "str", "fmt"}},
+		{ObjectFilter{Kind: ConstObject, UsesOnly: true}, []string{"greeting"}},
+		{ObjectFilter{Kind: VarObject, DefsOnly: true}, []string{"name", "g", "msg", "s"}},
+		{ObjectFilter{PkgPath: "strings"}, []string{"ToUpper"}},
+	}
+	for _, test := range testcases {
+		var names []string
+		for _, ident := range pkg.FindTyped(test.filter) {
+			names = append(names, ident.(*ast.Ident).Name)
+		}
+		if !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v: expected identifiers %v, but got %v", test.filter, test.exp, names)
+		}
+	}
+}
+
+func TestImplementsFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import (
+	"bytes"
+	"io"
+)
+
+type Service interface {
+	Serve() error
+}
+
+type FileReader struct{}
+
+func (r *FileReader) Read(p []byte) (int, error) { return 0, nil }
+
+type StringReader string
+
+func (r StringReader) Read(p []byte) (int, error) { return 0, nil }
+func (r StringReader) Serve() error              { return nil }
+
+type Buffered struct{ bytes.Buffer }
+
+type ReadCloser interface {
+	io.Reader
+	io.Closer
+}
+
+type NotAReader struct{}
+
+type MyErr struct{}
+
+func (MyErr) Error() string { return "" }
+`)
+
+	testcases := []struct {
+		filter ImplementsFilter
+		exp    []string
+	}{
+		{ImplementsFilter{PkgPath: "io", Name: "Reader"}, []string{"FileReader", "StringReader", "Buffered"}},
+		{ImplementsFilter{PkgPath: "io", Name: "Reader", ValueOnly: true}, []string{"StringReader"}},
+		{ImplementsFilter{PkgPath: "io", Name: "Writer"}, []string{"Buffered"}},
+		{ImplementsFilter{PkgPath: "p", Name: "Service"}, []string{"StringReader"}},
+		{ImplementsFilter{Name: "error"}, []string{"MyErr"}},
+		{ImplementsFilter{PkgPath: "net/http", Name: "Handler"}, nil},
+	}
+	for _, test := range testcases {
+		var names []string
+		for _, spec := range pkg.FindTyped(test.filter) {
+			names = append(names, spec.(*ast.TypeSpec).Name.Name)
+		}
+		if !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%+v: expected types %v, but got %v", test.filter, test.exp, names)
+		}
+	}
+}
+
+func TestCallFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import (
+	"bytes"
+	goerrors "errors"
+	. "fmt"
+	"strings"
+)
+
+func New(s string) error { return nil }
+
+func run() error {
+	var buf bytes.Buffer
+	buf.WriteString("x")
+	Println(strings.TrimSpace(" x "))
+	newErr := goerrors.New
+	_ = newErr("via value")
+	_ = New("local")
+	return goerrors.New("failed")
+}
+`)
+
+	testcases := []struct {
+		filter CallFilter
+		exp    []string
+	}{
+		{CallFilter{PkgPath: "errors", Name: "New"}, []string{"goerrors.New(\"failed\")"}},
+		{CallFilter{PkgPath: "p", Name: "New"}, []string{"New(\"local\")"}},
+		{CallFilter{PkgPath: "fmt", Name: "Println"}, []string{"Println(strings.TrimSpace(\" x \"))"}},
+		{CallFilter{PkgPath: "bytes", Name: "WriteString", Recv: "Buffer"}, []string{"buf.WriteString(\"x\")"}},
+		{CallFilter{PkgPath: "bytes", Name: "WriteString"}, nil},
+	}
+	for _, test := range testcases {
+		var calls []string
+		for _, call := range pkg.FindTyped(test.filter) {
+			calls = append(calls, nodeSource(t, call))
+		}
+		if !reflect.DeepEqual(calls, test.exp) {
+			t.Errorf("%+v: expected calls %v, but got %v", test.filter, test.exp, calls)
+		}
+	}
+}
+
+func TestExprTypeFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+func copyTo(w io.Writer, data []byte) {
+	var buf bytes.Buffer
+	buf.Write(data)
+	w.Write(buf.Bytes())
+	io.Copy(os.Stdout, &buf)
+	counts := map[string]int{}
+	counts["x"]++
+}
+`)
+
+	testcases := []struct {
+		filter ExprTypeFilter
+		exp    []string
+	}{
+		{ExprTypeFilter{Type: "*bytes.Buffer"}, []string{"&buf"}},
+		{ExprTypeFilter{Type: "[]byte"}, []string{"data", "buf.Bytes()"}},
+		{ExprTypeFilter{Type: "io.Writer"}, []string{"w"}},
+		{ExprTypeFilter{Type: "io.Writer", Assignable: true}, []string{"w", "os.Stdout", "&buf"}},
+		{ExprTypeFilter{Type: "map[string]int"}, []string{"map[string]int{}", "counts"}},
+		{ExprTypeFilter{Type: "net/http.Handler"}, nil},
+	}
+	for _, test := range testcases {
+		var exprs []string
+		for _, expr := range pkg.FindTyped(test.filter) {
+			exprs = append(exprs, nodeSource(t, expr))
+		}
+		if !reflect.DeepEqual(exprs, test.exp) {
+			t.Errorf("%+v: expected expressions %v, but got %v", test.filter, test.exp, exprs)
+		}
+	}
+
+	// The types are resolved once per package, not at each expression.
+	if len(pkg.typeCache.types) != 5 {
+		t.Errorf("expected 5 resolved types, but got %v", pkg.typeCache.types)
+	}
+	if pkg.resolveType("*bytes.Buffer") != pkg.typeCache.types["*bytes.Buffer"] {
+		t.Errorf("expected *bytes.Buffer to be resolved from the cache")
+	}
+}
+
+func TestAssignableFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+type Celsius float64
+
+func report(w io.Writer, temp Celsius, buf *bytes.Buffer) {
+	fmt.Fprintln(w, temp)
+	fmt.Fprintln(buf, float64(temp))
+	io.Copy(os.Stdout, buf)
+	var f float64 = 1.5
+	_ = Celsius(f)
+	writers := []io.Writer{os.Stderr}
+	io.MultiWriter(writers...)
+	io.MultiWriter(buf, w)
+}
+`)
+
+	testcases := []struct {
+		filter AssignableFilter
+		exp    []string
+	}{
+		{AssignableFilter{Type: "io.Writer", Passed: true}, []string{"w", "buf", "os.Stdout", "buf", "w"}},
+		{AssignableFilter{Type: "float64", Convertible: true, Passed: true}, nil},
+		{AssignableFilter{Type: "p.Celsius", Convertible: true}, []string{"temp", "float64(temp)", "1.5", "Celsius(f)"}},
+		{AssignableFilter{Type: "[]io.Writer", Passed: true}, []string{"writers"}},
+	}
+	for _, test := range testcases {
+		var exprs []string
+		for _, expr := range pkg.FindTyped(test.filter) {
+			exprs = append(exprs, nodeSource(t, expr))
+		}
+		if !reflect.DeepEqual(exprs, test.exp) {
+			t.Errorf("%+v: expected expressions %v, but got %v", test.filter, test.exp, exprs)
+		}
+	}
+}
+
+func TestNilComparisonFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+type MyErr struct{}
+
+func (*MyErr) Error() string { return "" }
+
+func find() *MyErr { return nil }
+
+func check(items []int, m map[string]int) bool {
+	var p *MyErr = find()
+	if p == nil {
+		return false
+	}
+	var err error = p
+	if err != nil {
+		return true
+	}
+	var plain error
+	if nil == plain {
+		return false
+	}
+	if error(find()) != nil || items == nil || m == nil {
+		return true
+	}
+	return false
+}
+`)
+
+	testcases := []struct {
+		filter NilComparisonFilter
+		exp    []string
+	}{
+		{NilComparisonFilter{}, []string{"p == nil", "err != nil", "nil == plain", "error(find()) != nil"}},
+		{NilComparisonFilter{Operand: PointerNilOperand}, []string{"p == nil"}},
+		{NilComparisonFilter{Operand: InterfaceNilOperand}, []string{"err != nil", "nil == plain", "error(find()) != nil"}},
+		{NilComparisonFilter{TypedNil: true}, []string{"err != nil", "error(find()) != nil"}},
+	}
+	for _, test := range testcases {
+		var exprs []string
+		for _, expr := range pkg.FindTyped(test.filter) {
+			exprs = append(exprs, nodeSource(t, expr))
+		}
+		if !reflect.DeepEqual(exprs, test.exp) {
+			t.Errorf("%+v: expected comparisons %v, but got %v", test.filter, test.exp, exprs)
+		}
+	}
+}
+
+func TestConstValueFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+const day = 24 * 60 * 60
+
+const banner = "a very long banner message"
+
+var (
+	timeout = 86400
+	ratio   = 0.5
+	name    = "short"
+	seconds = day
+)
+`)
+
+	testcases := []struct {
+		filter ConstValueFilter
+		exp    []string
+	}{
+		{ConstValueFilter{Value: constant.MakeInt64(86400)}, []string{"24 * 60 * 60", "86400", "day"}},
+		{ConstValueFilter{Value: constant.MakeString("short")}, []string{"\"short\""}},
+		{ConstValueFilter{Min: constant.MakeFloat64(0.1), Max: constant.MakeInt64(1)}, []string{"0.5"}},
+		{ConstValueFilter{MinLen: 10}, []string{"\"a very long banner message\""}},
+		{ConstValueFilter{Min: constant.MakeInt64(100000)}, nil},
+	}
+	for _, test := range testcases {
+		var exprs []string
+		for _, expr := range pkg.FindTyped(test.filter) {
+			exprs = append(exprs, nodeSource(t, expr))
+		}
+		if !reflect.DeepEqual(exprs, test.exp) {
+			t.Errorf("%+v: expected constant expressions %v, but got %v", test.filter, test.exp, exprs)
+		}
+	}
+}
+
+func TestInstantiationFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import "bytes"
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+func Map[T, U any](s []T, f func(T) U) []U { return nil }
+
+var (
+	counts Pair[string, int]
+	bufs   Pair[string, *bytes.Buffer]
+	lens   = Map([]string{"a"}, func(s string) int { return len(s) })
+	strs   = Map[int, string](nil, nil)
+)
+`)
+
+	testcases := []struct {
+		filter InstantiationFilter
+		exp    []string
+	}{
+		{InstantiationFilter{}, []string{"Pair[string, int]", "Pair[string, *bytes.Buffer]", "Map[string, int]", "Map[int, string]"}},
+		{InstantiationFilter{Name: "Map"}, []string{"Map[string, int]", "Map[int, string]"}},
+		{InstantiationFilter{TypeArgs: []string{"string", "int"}}, []string{"Pair[string, int]", "Map[string, int]"}},
+		{InstantiationFilter{Name: "Pair", TypeArgs: []string{"_", "*bytes.Buffer"}}, []string{"Pair[string, *bytes.Buffer]"}},
+		{InstantiationFilter{PkgPath: "p", Name: "Pair", TypeArgs: []string{"string"}}, nil},
+		{InstantiationFilter{PkgPath: "bytes"}, nil},
+	}
+	for _, test := range testcases {
+		var got []string
+		for _, node := range pkg.FindTyped(test.filter) {
+			ident := node.(*ast.Ident)
+			inst := pkg.Info.Instances[ident]
+			var args []string
+			for i := 0; i < inst.TypeArgs.Len(); i++ {
+				args = append(args, types.TypeString(inst.TypeArgs.At(i), (*types.Package).Name))
+			}
+			got = append(got, ident.Name+"["+strings.Join(args, ", ")+"]")
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected instantiations %v, but got %v", test.filter, test.exp, got)
+		}
+	}
+}
+
+func TestErrorResultFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+type NotFound struct{ Key string }
+
+func (e *NotFound) Error() string { return e.Key }
+
+type Temporary interface {
+	error
+	Temporary() bool
+}
+
+type failure = error
+
+func open() error { return nil }
+
+func lookup() (string, *NotFound) { return "", nil }
+
+func retry() Temporary { return nil }
+
+func close() failure { return nil }
+
+func count() (int, bool) { return 0, false }
+
+func value() NotFound { return NotFound{} }
+
+var check = func() (ok bool, err error) { return }
+`)
+
+	testcases := []struct {
+		filter ErrorResultFilter
+		exp    []string
+	}{
+		{ErrorResultFilter{}, []string{"open", "lookup", "retry", "close", "func literal"}},
+		{ErrorResultFilter{Concrete: true}, []string{"lookup"}},
+	}
+	for _, test := range testcases {
+		if got := funcNames(pkg.FindTyped(test.filter)); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected functions %v, but got %v", test.filter, test.exp, got)
+		}
+	}
+}
+
+func TestMissingContextFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import (
+	"context"
+	"net/http"
+	"os"
+)
+
+type Client struct{ hc *http.Client }
+
+func (c *Client) Fetch(url string) (*http.Response, error) {
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+	return c.hc.Do(req)
+}
+
+func (c *Client) FetchContext(ctx context.Context, url string) (*http.Response, error) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	return c.hc.Do(req)
+}
+
+func Load(name string) ([]byte, error) {
+	var data []byte
+	read := func() { data, _ = os.ReadFile(name) }
+	read()
+	return data, nil
+}
+
+func load(name string) ([]byte, error) { return os.ReadFile(name) }
+
+func Name() string { return "p" }
+`)
+
+	testcases := []struct {
+		filter MissingContextFilter
+		exp    []string
+	}{
+		{MissingContextFilter{}, []string{"Fetch"}},
+		{MissingContextFilter{Calls: []CallFilter{{PkgPath: "os", Name: "ReadFile"}}}, []string{"Load"}},
+		{MissingContextFilter{Calls: []CallFilter{
+			{PkgPath: "os", Name: "ReadFile"},
+			{PkgPath: "net/http", Recv: "Client", Name: "Do"},
+		}}, []string{"Fetch", "Load"}},
+	}
+	for _, test := range testcases {
+		if got := funcNames(pkg.FindTyped(test.filter)); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected functions %v, but got %v", test.filter, test.exp, got)
+		}
+	}
+}
+
+func TestConversionFilter(t *testing.T) {
+	pkg := typeCheckTestPkg(t, `package p
+
+import "time"
+
+type ID string
+
+func convert(b []byte, n int64, id ID) {
+	_ = string(b)
+	_ = []byte("raw")
+	_ = time.Duration(n)
+	_ = string(id)
+	_ = ID(string(b))
+	_ = len(b)
+	_ = float64(3)
+	_ = (*int)(nil)
+}
+`)
+
+	testcases := []struct {
+		filter ConversionFilter
+		exp    []string
+	}{
+		{ConversionFilter{}, []string{"string(b)", "[]byte(\"raw\")", "time.Duration(n)", "string(id)", "ID(string(b))", "float64(3)", "(*int)(nil)"}},
+		{ConversionFilter{From: "[]byte", To: "string"}, []string{"string(b)", "string(b)"}},
+		{ConversionFilter{To: "string"}, []string{"string(b)", "string(id)", "string(b)"}},
+		{ConversionFilter{From: "p.ID"}, []string{"string(id)"}},
+		{ConversionFilter{To: "time.Duration"}, []string{"time.Duration(n)"}},
+		{ConversionFilter{To: "*int"}, []string{"(*int)(nil)"}},
+	}
+	for _, test := range testcases {
+		var got []string
+		for _, node := range pkg.FindTyped(test.filter) {
+			got = append(got, nodeSource(t, node))
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected conversions %v, but got %v", test.filter, test.exp, got)
+		}
+	}
+}
+
+func TestNewTypedPackageErrors(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "test.go", "package p\n\nvar x int = \"s\"\nvar y = undefined\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := NewTypedPackage("p", fset, []*ast.File{file}, nil)
+	if err == nil {
+		t.Fatal("expected a type error")
+	}
+	if len(pkg.Errors) != 2 {
+		t.Errorf("expected 2 type errors, but got %d: %v", len(pkg.Errors), pkg.Errors)
+	}
+	if pkg.Pkg.Scope().Lookup("y") == nil {
+		t.Error("expected the package to be checked despite the errors")
+	}
+}
+
+func typeCheckTestPkg(t *testing.T, srcs ...string) *TypedPackage {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, src := range srcs {
+		file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	pkg, err := NewTypedPackage(files[0].Name.Name, fset, files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
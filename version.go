@@ -0,0 +1,53 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/version"
+	"strings"
+)
+
+// checkSyntaxVersion returns an error for each use in file of syntax that requires a
+// later version of Go than goVersion (e.g., "go1.17"). Language changes that are not
+// syntactic, such as ranging over integers, are reported by the type checker instead.
+func checkSyntaxVersion(fset *token.FileSet, file *ast.File, goVersion string) []error {
+	var errs []error
+	require := func(node ast.Node, feature, minVersion string) {
+		if version.Compare(goVersion, minVersion) < 0 {
+			errs = append(errs, fmt.Errorf("%s: %s requires %s or later (version set to %s)", fset.Position(node.Pos()), feature, minVersion, goVersion))
+		}
+	}
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.TypeSpec:
+			if node.TypeParams != nil {
+				require(node.TypeParams, "type parameters", "go1.18")
+			}
+			if node.Assign.IsValid() {
+				require(node, "type aliases", "go1.9")
+			}
+		case *ast.FuncType:
+			if node.TypeParams != nil {
+				require(node.TypeParams, "type parameters", "go1.18")
+			}
+		case *ast.BasicLit:
+			if node.Kind == token.INT || node.Kind == token.FLOAT || node.Kind == token.IMAG {
+				lit := strings.ToLower(node.Value)
+				switch {
+				case strings.HasPrefix(lit, "0b"):
+					require(node, "binary literals", "go1.13")
+				case strings.HasPrefix(lit, "0o"):
+					require(node, "0o-prefixed octal literals", "go1.13")
+				case strings.HasPrefix(lit, "0x") && node.Kind != token.INT:
+					require(node, "hexadecimal floating-point literals", "go1.13")
+				}
+				if strings.Contains(lit, "_") {
+					require(node, "digit separators", "go1.13")
+				}
+			}
+		}
+		return true
+	})
+	return errs
+}
@@ -0,0 +1,221 @@
+package astquery
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watcher watches the directories of loaded packages and, when their Go files change,
+// reloads the packages through a Store and re-runs registered queries, reporting the
+// matches that appeared or disappeared. Directories are polled, so changes are noticed
+// within one polling interval.
+type Watcher struct {
+	store    *Store
+	patterns []string
+	interval time.Duration
+
+	mu      sync.Mutex
+	pkgs    []*Package
+	stamps  map[string]fileStamp // of the watched directories' Go files
+	queries []*watchQuery
+	closed  bool
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// WatchEvent reports how the matches of a watched query changed. Matches are told apart by
+// their package, file, node type and source text, so editing other parts of a file does
+// not make a match appear to change.
+type WatchEvent struct {
+	Added   []Match
+	Removed []Match
+
+	// Err is the error that prevented the packages from being reloaded, if any. The
+	// packages are reloaded again when their files next change.
+	Err error
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchQuery is a query registered with a watcher.
+type watchQuery struct {
+	find    func(w *Workspace) []Match
+	events  chan WatchEvent
+	matches map[string]Match
+}
+
+// Watch loads the packages matching the patterns and starts watching their directories for
+// changes every interval. Call Close to stop watching.
+func (s *Store) Watch(interval time.Duration, patterns ...string) (*Watcher, error) {
+	pkgs, err := s.Load(patterns...)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		store:    s,
+		patterns: patterns,
+		interval: interval,
+		pkgs:     pkgs,
+		stamps:   goFileStamps(pkgs),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go w.poll()
+	return w, nil
+}
+
+// Query registers a query with the watcher. Its first event adds the current matches and
+// each following event reports a change. The events must be received for the watcher to
+// make progress. The channel is closed by Close.
+func (w *Watcher) Query(filter Filter) <-chan WatchEvent {
+	return w.register(func(ws *Workspace) []Match { return ws.Find(filter) })
+}
+
+// QueryTyped is like Query for a typed filter. It requires the store to load packages with
+// type information.
+func (w *Watcher) QueryTyped(filter TypedFilter) <-chan WatchEvent {
+	return w.register(func(ws *Workspace) []Match { return ws.FindTyped(filter) })
+}
+
+func (w *Watcher) register(find func(w *Workspace) []Match) <-chan WatchEvent {
+	q := &watchQuery{find: find, events: make(chan WatchEvent, 1), matches: make(map[string]Match)}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		close(q.events)
+		return q.events
+	}
+	w.queries = append(w.queries, q)
+	q.events <- q.update(w.pkgs) // buffered, so this doesn't block
+	return q.events
+}
+
+// Close stops watching and closes the channels of the registered queries.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.done)
+	<-w.stopped
+	for _, q := range w.queries {
+		close(q.events)
+	}
+	return nil
+}
+
+// poll checks for changes every interval until the watcher is closed.
+func (w *Watcher) poll() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		w.mu.Lock()
+		stamps := goFileStamps(w.pkgs)
+		if reflect.DeepEqual(stamps, w.stamps) {
+			w.mu.Unlock()
+			continue
+		}
+		var events []WatchEvent
+		pkgs, err := w.store.Load(w.patterns...)
+		if err != nil {
+			// Report the failure once, retrying only after the files change again.
+			w.stamps = stamps
+			for range w.queries {
+				events = append(events, WatchEvent{Err: err})
+			}
+		} else {
+			w.pkgs, w.stamps = pkgs, goFileStamps(pkgs)
+			for _, q := range w.queries {
+				events = append(events, q.update(pkgs))
+			}
+		}
+		queries := w.queries
+		w.mu.Unlock()
+
+		for i, q := range queries {
+			if len(events[i].Added) == 0 && len(events[i].Removed) == 0 && events[i].Err == nil {
+				continue
+			}
+			select {
+			case q.events <- events[i]:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// update re-runs the query on pkgs and returns the changes to its matches.
+func (q *watchQuery) update(pkgs []*Package) WatchEvent {
+	var event WatchEvent
+	matches := make(map[string]Match)
+	for _, m := range q.find(&Workspace{Packages: pkgs}) {
+		key := matchKey(m)
+		for i := 1; ; i++ {
+			if _, exists := matches[key]; !exists {
+				break
+			}
+			key = fmt.Sprintf("%s\x00%d", matchKey(m), i) // identical matches
+		}
+		matches[key] = m
+		if _, existed := q.matches[key]; !existed {
+			event.Added = append(event.Added, m)
+		}
+	}
+	for key, m := range q.matches {
+		if _, exists := matches[key]; !exists {
+			event.Removed = append(event.Removed, m)
+		}
+	}
+	q.matches = matches
+	return event
+}
+
+// matchKey identifies a match independently of its position.
+func matchKey(m Match) string {
+	var buf bytes.Buffer
+	format.Node(&buf, m.Pkg.Fset, m.Node)
+	filename := m.Pkg.Fset.Position(m.Node.Pos()).Filename
+	return strings.Join([]string{m.PkgPath, filename, reflect.TypeOf(m.Node).String(), buf.String()}, "\x00")
+}
+
+// goFileStamps returns the stamps of the Go files in the directories of pkgs.
+func goFileStamps(pkgs []*Package) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, pkg := range pkgs {
+		entries, err := os.ReadDir(pkg.Dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				stamps[filepath.Join(pkg.Dir, entry.Name())] = fileStamp{info.ModTime(), info.Size()}
+			}
+		}
+	}
+	return stamps
+}
@@ -0,0 +1,97 @@
+package astquery
+
+import (
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":    "module example.com/m\n\ngo 1.21\n",
+		"server.go": "package m\n\nfunc Serve() {}\n\nfunc Stop() {}\n",
+	})
+	store := NewStore(&LoadOptions{Dir: dir, Env: append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod")})
+	w, err := store.Watch(10*time.Millisecond, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	events := w.Query(FilterFunc(func(node ast.Node) bool {
+		_, isFunc := node.(*ast.FuncDecl)
+		return isFunc
+	}))
+	next := func() (added, removed []string) {
+		select {
+		case event := <-events:
+			if event.Err != nil {
+				t.Fatal(event.Err)
+			}
+			for _, m := range event.Added {
+				added = append(added, m.Node.(*ast.FuncDecl).Name.Name)
+			}
+			for _, m := range event.Removed {
+				removed = append(removed, m.Node.(*ast.FuncDecl).Name.Name)
+			}
+			sort.Strings(added)
+			sort.Strings(removed)
+			return added, removed
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for event")
+			return nil, nil
+		}
+	}
+	write := func(name, src string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if added, removed := next(); !reflect.DeepEqual(added, []string{"Serve", "Stop"}) || removed != nil {
+		t.Errorf("expected initial matches Serve and Stop, but got %v and %v", added, removed)
+	}
+
+	// Moving Stop down and removing Serve only reports Serve's removal.
+	write("server.go", "package m\n\n// Stop stops the server.\n\nfunc Stop() {}\n")
+	if added, removed := next(); added != nil || !reflect.DeepEqual(removed, []string{"Serve"}) {
+		t.Errorf("expected Serve to be removed, but got %v and %v", added, removed)
+	}
+
+	write("health.go", "package m\n\nfunc Health() bool { return true }\n")
+	if added, removed := next(); !reflect.DeepEqual(added, []string{"Health"}) || removed != nil {
+		t.Errorf("expected Health to be added, but got %v and %v", added, removed)
+	}
+
+	// A failed reload is reported once, and retried when the files change again.
+	write("go.mod", "module example.com/m\n\ngo 1.21\n\nbroken\n")
+	write("health.go", "package m\n\nfunc Health() bool { return true }\n\n")
+	select {
+	case event := <-events:
+		if event.Err == nil {
+			t.Errorf("expected an error, but got %+v", event)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("expected no event before the files change, but got %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+	write("go.mod", "module example.com/m\n\ngo 1.21\n")
+	write("health.go", "package m\n\nfunc Health() bool { return true }\n\nfunc Ready() bool { return true }\n")
+	if added, removed := next(); !reflect.DeepEqual(added, []string{"Ready"}) || removed != nil {
+		t.Errorf("expected Ready to be added, but got %v and %v", added, removed)
+	}
+
+	w.Close()
+	if _, open := <-events; open {
+		t.Errorf("expected events to be closed")
+	}
+}
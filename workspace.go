@@ -0,0 +1,65 @@
+package astquery
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// Workspace is a set of loaded packages that can be queried together, such as all the
+// packages of a module.
+type Workspace struct {
+	Packages []*Package
+}
+
+// LoadWorkspace loads the packages matching the patterns, as Load does, into a workspace.
+func LoadWorkspace(opts *LoadOptions, patterns ...string) (*Workspace, error) {
+	pkgs, err := Load(opts, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{Packages: pkgs}, nil
+}
+
+// Match is a node found in a loaded package.
+type Match struct {
+	Node ast.Node
+
+	// PkgPath is the import path of the package containing Node.
+	PkgPath string
+
+	// Pkg is the package containing Node.
+	Pkg *Package
+
+	// Constraint is the build constraint of the file containing Node, as reported by
+	// Package.Constraint.
+	Constraint string
+
+	// Bindings are the nodes bound to the metavariables of the Pattern, or captured by the
+	// TreeSitterQuery or Capture, that matched Node.
+	Bindings map[string]ast.Node
+}
+
+// Position returns the position of the start of the matched node.
+func (m Match) Position() token.Position {
+	return m.Pkg.Position(m.Node)
+}
+
+// Find returns the nodes of all the workspace's packages that match filter, in the order
+// of the packages.
+func (w *Workspace) Find(filter Filter) []Match {
+	var matches []Match
+	for _, pkg := range w.Packages {
+		matches = append(matches, pkg.Find(filter)...)
+	}
+	return matches
+}
+
+// FindTyped is like Find for a typed filter. Packages loaded without type information are
+// skipped.
+func (w *Workspace) FindTyped(filter TypedFilter) []Match {
+	var matches []Match
+	for _, pkg := range w.Packages {
+		matches = append(matches, pkg.FindTyped(filter)...)
+	}
+	return matches
+}
@@ -0,0 +1,62 @@
+package astquery
+
+import (
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":         "module example.com/m\n\ngo 1.21\n",
+		"api/handler.go": "package api\n\nimport \"errors\"\n\nfunc Handle() error { return errors.New(\"api\") }\n",
+		"db/db.go":       "package db\n\nimport \"errors\"\n\nvar ErrClosed = errors.New(\"closed\")\n\nfunc Close() {}\n",
+	})
+	ws, err := LoadWorkspace(&LoadOptions{
+		Dir:   dir,
+		Env:   append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod"),
+		Types: true,
+	}, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matchStrings := func(matches []Match) []string {
+		var strs []string
+		for _, m := range matches {
+			strs = append(strs, fmt.Sprintf("%s: %s", m.PkgPath, nodeSource(t, m.Node)))
+		}
+		return strs
+	}
+
+	funcs := ws.Find(FilterFunc(func(node ast.Node) bool {
+		_, isFunc := node.(*ast.FuncDecl)
+		return isFunc
+	}))
+	exp := []string{
+		`example.com/m/api: func Handle() error { return errors.New("api") }`,
+		`example.com/m/db: func Close() { }`,
+	}
+	if got := matchStrings(funcs); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected funcs %v, but got %v", exp, got)
+	}
+
+	calls := ws.FindTyped(CallFilter{PkgPath: "errors", Name: "New"})
+	exp = []string{
+		`example.com/m/api: errors.New("api")`,
+		`example.com/m/db: errors.New("closed")`,
+	}
+	if got := matchStrings(calls); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected calls %v, but got %v", exp, got)
+	}
+	if calls[0].Pkg != ws.Packages[0] {
+		t.Errorf("expected match to refer to its package")
+	}
+	if pos := calls[0].Position(); filepath.Base(pos.Filename) != "handler.go" || pos.Line != 5 {
+		t.Errorf("expected call at handler.go:5, but got %v", pos)
+	}
+}
@@ -0,0 +1,338 @@
+package astquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the documents of a YAML file, as far as rule files need: block
+// mappings and sequences, plain and quoted scalars, flow sequences, literal and folded
+// block scalars, and comments. Mappings are returned as map[string]interface{},
+// sequences as []interface{} and scalars as strings. Empty documents are left out.
+func parseYAML(src string) ([]interface{}, error) {
+	var docs []interface{}
+	var lines []yamlLine
+	flush := func() error {
+		p := &yamlParser{lines: lines}
+		if p.skipBlank(); p.i == len(lines) {
+			return nil
+		}
+		doc, err := p.block(p.lines[p.i].indent)
+		if err != nil {
+			return err
+		}
+		if p.skipBlank(); p.i < len(p.lines) {
+			return p.errorf("unexpected indentation")
+		}
+		docs = append(docs, doc)
+		return nil
+	}
+	for i, text := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(text, "---") || strings.HasPrefix(text, "...") {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			lines = nil
+			continue
+		}
+		if strings.HasPrefix(text, "%") { // a directive
+			continue
+		}
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// yamlLine is a line of a YAML document, without its indentation.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// blank reports whether the line is empty or holds just a comment.
+func (l yamlLine) blank() bool {
+	return l.text == "" || strings.HasPrefix(l.text, "#")
+}
+
+// yamlParser parses the lines of a YAML document.
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	num := 0
+	if p.i < len(p.lines) {
+		num = p.lines[p.i].num
+	} else if len(p.lines) > 0 {
+		num = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips blank lines.
+func (p *yamlParser) skipBlank() {
+	for p.i < len(p.lines) && p.lines[p.i].blank() {
+		p.i++
+	}
+}
+
+// block parses the block node starting at the current line, which is indented by indent.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	line := p.lines[p.i]
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.sequence(indent)
+	}
+	if _, _, isPair := splitYAMLPair(line.text); isPair {
+		return p.mapping(indent)
+	}
+	return p.scalar(line.text)
+}
+
+// scalar parses the scalar text ending the current line, and moves to the next line.
+func (p *yamlParser) scalar(text string) (interface{}, error) {
+	value, err := yamlScalar(text)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	p.i++
+	return value, nil
+}
+
+// sequence parses a block sequence whose items are indented by indent.
+func (p *yamlParser) sequence(indent int) ([]interface{}, error) {
+	seq := []interface{}{}
+	for p.skipBlank(); p.i < len(p.lines) && p.lines[p.i].indent == indent; p.skipBlank() {
+		line := p.lines[p.i]
+		if line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			return nil, p.errorf("expected a sequence item")
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		var item interface{}
+		var err error
+		if rest == "" || strings.HasPrefix(rest, "#") {
+			item, err = p.nested(indent, false)
+		} else {
+			// The item's node starts on the item's line, indented past the "-".
+			p.lines[p.i] = yamlLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+			item, err = p.block(p.lines[p.i].indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, item)
+	}
+	return seq, nil
+}
+
+// mapping parses a block mapping whose keys are indented by indent.
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for p.skipBlank(); p.i < len(p.lines) && p.lines[p.i].indent == indent; p.skipBlank() {
+		key, value, isPair := splitYAMLPair(p.lines[p.i].text)
+		if !isPair {
+			return nil, p.errorf("expected a mapping key")
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		var err error
+		switch {
+		case value == "" || strings.HasPrefix(value, "#"):
+			m[key], err = p.nested(indent, true)
+		case value[0] == '|' || value[0] == '>':
+			m[key], err = p.blockScalar(indent, value)
+		default:
+			m[key], err = p.scalar(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// nested parses the node after a line holding just a key or a "-", which is more
+// indented than indent or, after a key, a sequence at indent. A missing node is an empty
+// string.
+func (p *yamlParser) nested(indent int, afterKey bool) (interface{}, error) {
+	p.i++
+	p.skipBlank()
+	if p.i == len(p.lines) {
+		return "", nil
+	}
+	line := p.lines[p.i]
+	if line.indent > indent || afterKey && line.indent == indent && strings.HasPrefix(line.text, "- ") {
+		return p.block(line.indent)
+	}
+	return "", nil
+}
+
+// blockScalar parses a literal ('|') or folded ('>') block scalar, introduced by header
+// on a line indented by indent.
+func (p *yamlParser) blockScalar(indent int, header string) (string, error) {
+	style, chomp := header[0], ""
+	if rest := strings.TrimSpace(header[1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		if rest != "-" && rest != "+" {
+			return "", p.errorf("unsupported block scalar header %q", header)
+		}
+		chomp = rest
+	}
+	p.i++
+	var lines []string
+	contentIndent := -1
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		if line.text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if line.indent <= indent || contentIndent >= 0 && line.indent < contentIndent {
+			break
+		}
+		if contentIndent < 0 {
+			contentIndent = line.indent
+		}
+		lines = append(lines, strings.Repeat(" ", line.indent-contentIndent)+line.text)
+	}
+	var trailing int
+	for trailing < len(lines) && lines[len(lines)-1-trailing] == "" {
+		trailing++
+	}
+	lines = lines[:len(lines)-trailing]
+	var text string
+	if style == '|' {
+		text = strings.Join(lines, "\n")
+	} else {
+		// Lines are joined by spaces, and each blank line is a newline.
+		for i, line := range lines {
+			if line == "" {
+				text += "\n"
+				continue
+			}
+			if i > 0 && lines[i-1] != "" {
+				text += " "
+			}
+			text += line
+		}
+	}
+	switch {
+	case len(lines) == 0 || chomp == "-":
+	case chomp == "+":
+		text += strings.Repeat("\n", trailing+1)
+	default:
+		text += "\n"
+	}
+	return text, nil
+}
+
+// splitYAMLPair splits the line of a mapping entry into its key and the rest of the line.
+func splitYAMLPair(text string) (key, value string, isPair bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' || text[0] == '#' {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		end := quotedYAMLEnd(text)
+		if end < 0 || !strings.HasPrefix(text[end:], ":") {
+			return "", "", false
+		}
+		key, err := yamlScalar(text[:end])
+		if err != nil {
+			return "", "", false
+		}
+		value, isPair = splitYAMLValue(text[end+1:])
+		return key.(string), value, isPair
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' {
+			if value, isPair := splitYAMLValue(text[i+1:]); isPair {
+				return text[:i], value, true
+			}
+		} else if text[i] == '#' && i > 0 && text[i-1] == ' ' {
+			break
+		}
+	}
+	return "", "", false
+}
+
+// splitYAMLValue returns the value after a key's ':', which must be followed by a space
+// or end the line.
+func splitYAMLValue(rest string) (string, bool) {
+	if rest != "" && rest[0] != ' ' {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// quotedYAMLEnd returns the offset just after the quoted scalar at the start of text, or
+// -1 if it is unterminated.
+func quotedYAMLEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// yamlScalar parses a scalar, or a flow sequence of scalars, written on one line.
+func yamlScalar(text string) (interface{}, error) {
+	switch {
+	case text == "":
+		return "", nil
+	case text[0] == '"' || text[0] == '\'':
+		end := quotedYAMLEnd(text)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		if rest := strings.TrimSpace(text[end:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("unexpected %q after string", rest)
+		}
+		if text[0] == '\'' {
+			return strings.ReplaceAll(text[1:end-1], "''", "'"), nil
+		}
+		s, err := strconv.Unquote(text[:end])
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", text[:end])
+		}
+		return s, nil
+	case text[0] == '[':
+		end := strings.LastIndex(text, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated flow sequence %s", text)
+		}
+		seq := []interface{}{}
+		for _, item := range strings.Split(text[1:end], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			value, err := yamlScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, value)
+		}
+		return seq, nil
+	case text[0] == '{':
+		return nil, fmt.Errorf("flow mappings are not supported")
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text), nil
+}
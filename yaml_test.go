@@ -0,0 +1,61 @@
+package astquery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp []interface{}
+	}{
+		{"a: 1\nb: two words # comment\n", []interface{}{map[string]interface{}{"a": "1", "b": "two words"}}},
+		{"- a\n- 'b''s'\n- \"c\\td\"\n", []interface{}{[]interface{}{"a", "b's", "c\td"}}},
+		{
+			"rules:\n  - id: x\n    languages: [go, 'c']\n  -\n    id: y\nother:\n- 1\n",
+			[]interface{}{map[string]interface{}{
+				"rules": []interface{}{
+					map[string]interface{}{"id": "x", "languages": []interface{}{"go", "c"}},
+					map[string]interface{}{"id": "y"},
+				},
+				"other": []interface{}{"1"},
+			}},
+		},
+		{"a: |\n  line 1\n    indented\n\n  line 3\nb: x\n", []interface{}{map[string]interface{}{"a": "line 1\n  indented\n\nline 3\n", "b": "x"}}},
+		{"a: >-\n  folded\n  text\n\n  # not a comment\n", []interface{}{map[string]interface{}{"a": "folded text\n# not a comment"}}},
+		{"a: x\n---\n# empty\n---\nb: y\n", []interface{}{map[string]interface{}{"a": "x"}, map[string]interface{}{"b": "y"}}},
+		{"url: http://example.com\n\"k: v\": z\nempty:\n", []interface{}{map[string]interface{}{"url": "http://example.com", "k: v": "z", "empty": ""}}},
+	}
+	for _, test := range testcases {
+		docs, err := parseYAML(test.src)
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(docs, test.exp) {
+			t.Errorf("%q: expected %#v, but got %#v", test.src, test.exp, docs)
+		}
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	testcases := []struct {
+		src string
+		err string
+	}{
+		{"a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"a: 1\na: 2\n", `line 2: duplicate key "a"`},
+		{"a: 'x\n", "line 1: unterminated string 'x"},
+		{"a: {b: c}\n", "line 1: flow mappings are not supported"},
+		{"a:\n\t- b\n", "line 2: tabs are not allowed in indentation"},
+		{"- a\nb: c\n", "line 2: expected a sequence item"},
+	}
+	for _, test := range testcases {
+		_, err := parseYAML(test.src)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error containing %q, but got %v", test.src, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package astquery
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// LoadZip loads the packages in the zip archive name, as LoadFS loads them, without
+// extracting it. Module zip files, such as those the module cache keeps under
+// $GOMODCACHE/cache/download, hold the files of a module in a "module@version" directory:
+// the packages are loaded from that directory, with import paths under the module path
+// even if the module has no go.mod file. opts.Dir is relative to that directory.
+func LoadZip(name string, opts *LoadOptions) ([]*Package, error) {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return loadZip(&r.Reader, opts)
+}
+
+// LoadZipReader is like LoadZip, reading the archive of the given size from r.
+func LoadZipReader(r io.ReaderAt, size int64, opts *LoadOptions) ([]*Package, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return loadZip(zr, opts)
+}
+
+func loadZip(r *zip.Reader, opts *LoadOptions) ([]*Package, error) {
+	var fsys fs.FS = r
+	var modPath string
+	if dir := moduleZipDir(r); dir != "" {
+		sub, err := fs.Sub(r, dir)
+		if err != nil {
+			return nil, err
+		}
+		fsys, modPath = sub, dir[:strings.LastIndex(dir, "@")]
+	}
+	if declared := fsModulePath(fsys); declared != "" {
+		modPath = declared
+	}
+	return loadFS(fsys, opts, modPath)
+}
+
+// moduleZipDir returns the "module@version" directory holding all the files of a module
+// zip file, or the empty string if r is not a module zip file.
+func moduleZipDir(r *zip.Reader) string {
+	var dir string
+	for _, f := range r.File {
+		i := strings.Index(f.Name, "@")
+		if i < 0 {
+			return ""
+		}
+		slash := strings.Index(f.Name[i:], "/")
+		if slash < 0 {
+			return ""
+		}
+		if prefix := f.Name[:i+slash]; dir == "" {
+			dir = prefix
+		} else if prefix != dir {
+			return ""
+		}
+	}
+	return dir
+}
@@ -0,0 +1,98 @@
+package astquery
+
+import (
+	"archive/zip"
+	"bytes"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestZip returns a zip archive of files.
+func writeTestZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, contents := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadZip(t *testing.T) {
+	testcases := []struct {
+		files map[string]string
+		exp   []string
+	}{
+		{
+			// A module zip file without a go.mod file.
+			files: map[string]string{
+				"example.com/dep@v1.2.0/dep.go":      "package dep\n\nfunc Dep() {}\n",
+				"example.com/dep@v1.2.0/util/u.go":   "package util\n\nfunc Util() {}\n",
+				"example.com/dep@v1.2.0/LICENSE":     "MIT\n",
+				"example.com/dep@v1.2.0/testdata/x":  "x\n",
+				"example.com/dep@v1.2.0/util/README": "util\n",
+			},
+			exp: []string{"example.com/dep dep.go Dep", "example.com/dep/util util/u.go Util"},
+		},
+		{
+			// The module path declared by go.mod wins.
+			files: map[string]string{
+				"example.com/dep/v2@v2.0.0/go.mod": "module example.com/dep/v2\n",
+				"example.com/dep/v2@v2.0.0/d.go":   "package dep\n\nfunc Dep() {}\n",
+			},
+			exp: []string{"example.com/dep/v2 d.go Dep"},
+		},
+		{
+			// An arbitrary zip file.
+			files: map[string]string{
+				"go.mod":   "module example.com/m\n",
+				"src/s.go": "package src\n\nfunc S() {}\n",
+			},
+			exp: []string{"example.com/m/src src/s.go S"},
+		},
+	}
+	for _, test := range testcases {
+		archive := writeTestZip(t, test.files)
+		name := filepath.Join(t.TempDir(), "m.zip")
+		if err := os.WriteFile(name, archive, 0666); err != nil {
+			t.Fatal(err)
+		}
+		fromFile, err := LoadZip(name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromReader, err := LoadZipReader(bytes.NewReader(archive), int64(len(archive)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pkgs := range [][]*Package{fromFile, fromReader} {
+			var got []string
+			for _, pkg := range pkgs {
+				for _, m := range pkg.Find(FilterFunc(func(node ast.Node) bool {
+					_, isFunc := node.(*ast.FuncDecl)
+					return isFunc
+				})) {
+					got = append(got, pkg.ImportPath+" "+m.Position().Filename+" "+m.Node.(*ast.FuncDecl).Name.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("expected functions %v, but got %v", test.exp, got)
+			}
+		}
+	}
+
+	if _, err := LoadZip(filepath.Join(t.TempDir(), "missing.zip"), nil); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}